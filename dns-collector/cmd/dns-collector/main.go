@@ -0,0 +1,218 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"dns-collector/internal/admin"
+	"dns-collector/internal/archive"
+	"dns-collector/internal/cleanup"
+	"dns-collector/internal/clickhouse"
+	"dns-collector/internal/config"
+	"dns-collector/internal/database"
+	"dns-collector/internal/geoip"
+	"dns-collector/internal/metrics"
+	"dns-collector/internal/policy"
+	"dns-collector/internal/resolver"
+	"dns-collector/internal/rollup"
+	"dns-collector/internal/server"
+)
+
+func main() {
+	configPath := flag.String("config", "config/config.yaml", "Path to configuration file")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-config path] [cleanup-dry-run]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() > 1 || (flag.NArg() == 1 && flag.Arg(0) != "cleanup-dry-run") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Load configuration
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	log.Printf("Starting DNS Collector...")
+	log.Printf("Configuration loaded from: %s", *configPath)
+
+	// Initialize database
+	db, err := database.Open(cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			log.Printf("Error closing database: %v", err)
+		}
+	}()
+
+	log.Printf("Database connected successfully (%s)", cfg.Database.Driver)
+
+	// Run database migrations
+	log.Println("Running database migrations...")
+	if err := db.RunMigrations(); err != nil {
+		log.Fatalf("Failed to run migrations: %v", err)
+	}
+	log.Println("Migrations completed successfully")
+
+	// cleanup-dry-run prints what the next cleanup run would delete and exits
+	if flag.Arg(0) == "cleanup-dry-run" {
+		report, err := cleanup.NewService(cfg, db, nil).DryRun()
+		if err != nil {
+			log.Fatalf("Failed to compute cleanup dry run: %v", err)
+		}
+		if err := report.WriteText(os.Stdout); err != nil {
+			log.Fatalf("Failed to write cleanup dry run: %v", err)
+		}
+		return
+	}
+
+	// Statistics are inserted into daily partitions that must exist beforehand
+	if _, err := db.EnsureStatPartitions(time.Now()); err != nil {
+		log.Fatalf("Failed to create statistics partitions: %v", err)
+	}
+
+	// Compile resolution policies and re-apply them to already known domains
+	policies, err := policy.New(cfg.Resolver.Policies)
+	if err != nil {
+		log.Fatalf("Failed to load resolution policies: %v", err)
+	}
+	// (always, so domains of removed rules fall back to the defaults)
+	updated, err := policies.Apply(db, cfg.Resolver.MaxResolv)
+	if err != nil {
+		log.Fatalf("Failed to apply resolution policies: %v", err)
+	}
+	log.Printf("Resolution policies loaded: %d rules, %d domains updated", len(cfg.Resolver.Policies), updated)
+
+	// Initialize metrics registry
+	var metricsRegistry *metrics.Registry
+	if cfg.Metrics.Enabled {
+		metricsRegistry = metrics.NewRegistry()
+
+		// Start metrics HTTP server
+		metricsServer := metrics.NewServer(cfg.Metrics, metricsRegistry)
+		if err := metricsServer.Start(); err != nil {
+			log.Fatalf("Failed to start metrics server: %v", err)
+		}
+		defer func() {
+			if err := metricsServer.Stop(); err != nil {
+				log.Printf("Error stopping metrics server: %v", err)
+			}
+		}()
+
+		// Start InfluxDB client if enabled
+		if cfg.Metrics.InfluxDB.Enabled {
+			influxClient := metrics.NewInfluxDBClient(cfg.Metrics.InfluxDB, metricsRegistry)
+			if err := influxClient.Start(); err != nil {
+				log.Printf("Warning: Failed to start InfluxDB client: %v", err)
+			} else {
+				defer func() {
+					if err := influxClient.Stop(); err != nil {
+						log.Printf("Error stopping InfluxDB client: %v", err)
+					}
+				}()
+			}
+		}
+
+		// Start DB metrics collector (updates domain/IP counts every 30 seconds)
+		dbCollector := metrics.NewDBCollector(db, metricsRegistry, 30)
+		dbCollector.Start()
+		defer dbCollector.Stop()
+
+		log.Printf("Metrics enabled on port %d", cfg.Metrics.Port)
+	}
+
+	// Create and start DNS resolver
+	dnsResolver := resolver.NewResolver(cfg, db, metricsRegistry)
+	dnsResolver.SetPolicies(policies)
+	dnsResolver.Start()
+	defer dnsResolver.Stop()
+
+	// Create and start the ClickHouse sink for query statistics if enabled
+	// (stopped after the UDP server so the last events are flushed)
+	var statsWriter *clickhouse.Writer
+	if cfg.ClickHouse.Enabled {
+		statsWriter = clickhouse.NewWriter(cfg, metricsRegistry)
+		if err := statsWriter.Start(); err != nil {
+			log.Fatalf("Failed to start ClickHouse sink: %v", err)
+		}
+		defer statsWriter.Stop()
+	}
+
+	// Create and start UDP server; new domains go to the resolver's priority lane
+	udpServer := server.NewUDPServer(cfg, db, metricsRegistry)
+	udpServer.SetNewDomainHandler(dnsResolver.ResolveNow)
+	udpServer.SetPolicies(policies)
+	if statsWriter != nil {
+		udpServer.SetStatsSink(statsWriter, cfg.ClickHouse.KeepDatabase)
+	}
+	if err := udpServer.Start(); err != nil {
+		log.Fatalf("Failed to start UDP server: %v", err)
+	}
+	defer udpServer.Stop()
+
+	// Archive expired statistics before the cleanup deletes them if enabled
+	var statsArchive *archive.Archiver
+	if cfg.Retention.Archive.Enabled {
+		statsArchive = archive.New(cfg.Retention.Archive, db)
+	}
+
+	// Create and start cleanup service
+	cleanupService := cleanup.NewService(cfg, db, metricsRegistry)
+	if statsArchive != nil {
+		cleanupService.SetArchiver(statsArchive)
+	}
+	cleanupService.Start()
+	defer cleanupService.Stop()
+
+	// Create and start GeoIP enrichment of resolved IPs
+	if cfg.GeoIP.Enabled {
+		geoService, err := geoip.NewService(cfg, db, metricsRegistry)
+		if err != nil {
+			log.Fatalf("Failed to start GeoIP enrichment: %v", err)
+		}
+		geoService.Start()
+		defer geoService.Stop()
+	}
+
+	// Create and start the hourly and daily rollups of query statistics
+	if cfg.Rollup.Enabled {
+		rollupService := rollup.NewService(cfg, db, metricsRegistry)
+		rollupService.Start()
+		defer rollupService.Stop()
+	}
+
+	// Start the admin API for on-demand resolution and scheduler control
+	if cfg.Admin.Enabled {
+		adminServer := admin.NewServer(cfg.Admin, dnsResolver, cleanupService, db)
+		if statsArchive != nil {
+			adminServer.SetArchive(statsArchive)
+		}
+		if err := adminServer.Start(); err != nil {
+			log.Fatalf("Failed to start admin server: %v", err)
+		}
+		defer func() {
+			if err := adminServer.Stop(); err != nil {
+				log.Printf("Error stopping admin server: %v", err)
+			}
+		}()
+	}
+
+	log.Println("DNS Collector is running. Press Ctrl+C to stop.")
+
+	// Wait for interrupt signal
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	<-sigCh
+
+	log.Println("\nShutting down gracefully...")
+}
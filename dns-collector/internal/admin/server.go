@@ -0,0 +1,303 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"dns-collector/internal/archive"
+	"dns-collector/internal/cleanup"
+	"dns-collector/internal/config"
+	"dns-collector/internal/resolver"
+)
+
+// maxRegexLength limits the domain regex accepted by the requeue endpoint
+const maxRegexLength = 256
+
+// Resolver is the part of the resolver controlled through the admin API
+type Resolver interface {
+	ResolveDomain(name string) (*resolver.Result, error)
+	Pause()
+	Resume()
+	Status() (resolver.Status, error)
+}
+
+// Cleaner triggers cleanup runs outside the regular schedule and previews them
+type Cleaner interface {
+	Trigger() bool
+	LastRun() time.Time
+	DryRun() (*cleanup.Report, error)
+}
+
+// Archive loads archived statistics into scratch tables
+type Archive interface {
+	Import(file, table string) (string, int64, error)
+}
+
+// Store requeues domains for resolution
+type Store interface {
+	RequeueDomains(domainRegex string) (int64, error)
+}
+
+// Server provides the authenticated HTTP control API of the collector.
+type Server struct {
+	cfg      config.AdminConfig
+	resolver Resolver
+	cleaner  Cleaner
+	store    Store
+	archive  Archive // nil = statistics archiving disabled
+	server   *http.Server
+}
+
+// NewServer creates a new admin HTTP server.
+func NewServer(cfg config.AdminConfig, r Resolver, c Cleaner, store Store) *Server {
+	return &Server{
+		cfg:      cfg,
+		resolver: r,
+		cleaner:  c,
+		store:    store,
+	}
+}
+
+// SetArchive enables the import of statistics archives. Must be called before Start.
+func (s *Server) SetArchive(a Archive) {
+	s.archive = a
+}
+
+// Handler returns the API routes wrapped in bearer token authentication.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /admin/resolve", s.handleResolve)
+	mux.HandleFunc("POST /admin/requeue", s.handleRequeue)
+	mux.HandleFunc("POST /admin/pause", s.handlePause)
+	mux.HandleFunc("POST /admin/resume", s.handleResume)
+	mux.HandleFunc("POST /admin/cleanup", s.handleCleanup)
+	mux.HandleFunc("GET /admin/cleanup/dry-run", s.handleCleanupDryRun)
+	mux.HandleFunc("GET /admin/status", s.handleStatus)
+	mux.HandleFunc("POST /admin/archive/import", s.handleArchiveImport)
+	return s.authenticate(mux)
+}
+
+// Start binds the listen address and serves the admin API in the background.
+// A bind failure (address in use, invalid address) is returned.
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.cfg.Listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.cfg.Listen, err)
+	}
+
+	s.server = &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		log.Printf("Admin API listening on %s", listener.Addr())
+		if err := s.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("Admin server error: %v", err)
+		}
+	}()
+
+	return nil
+}
+
+// Stop gracefully stops the admin HTTP server.
+func (s *Server) Stop() error {
+	if s.server == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	log.Println("Stopping admin server...")
+	if err := s.server.Shutdown(ctx); err != nil {
+		return fmt.Errorf("admin server shutdown error: %w", err)
+	}
+
+	log.Println("Admin server stopped")
+	return nil
+}
+
+// authenticate rejects requests without the configured bearer token.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="dns-collector"`)
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// handleResolve resolves a domain right away and returns its addresses.
+func (s *Server) handleResolve(w http.ResponseWriter, req *http.Request) {
+	var body struct {
+		Domain string `json:"domain"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	result, err := s.resolver.ResolveDomain(body.Domain)
+	switch {
+	case errors.Is(err, resolver.ErrInvalidDomain):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, resolver.ErrDisabledByPolicy), errors.Is(err, resolver.ErrInFlight):
+		writeError(w, http.StatusConflict, err.Error())
+	case err != nil:
+		log.Printf("Admin: error resolving %s: %v", body.Domain, err)
+		writeError(w, http.StatusInternalServerError, "failed to resolve domain")
+	default:
+		log.Printf("Admin: resolved %s on demand", result.Domain)
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+// handleRequeue makes all domains matching a regex due for resolution.
+func (s *Server) handleRequeue(w http.ResponseWriter, req *http.Request) {
+	var body struct {
+		DomainRegex string `json:"domain_regex"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if err := validateDomainRegex(body.DomainRegex); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	requeued, err := s.store.RequeueDomains(body.DomainRegex)
+	if err != nil {
+		log.Printf("Admin: error requeueing %q: %v", body.DomainRegex, err)
+		writeError(w, http.StatusInternalServerError, "failed to requeue domains")
+		return
+	}
+
+	log.Printf("Admin: requeued %d domains matching %q", requeued, body.DomainRegex)
+	writeJSON(w, http.StatusOK, map[string]int64{"requeued": requeued})
+}
+
+// handlePause stops the resolver from taking new domains.
+func (s *Server) handlePause(w http.ResponseWriter, _ *http.Request) {
+	s.resolver.Pause()
+	log.Println("Admin: resolver paused")
+	writeJSON(w, http.StatusOK, map[string]bool{"paused": true})
+}
+
+// handleResume lets a paused resolver continue.
+func (s *Server) handleResume(w http.ResponseWriter, _ *http.Request) {
+	s.resolver.Resume()
+	log.Println("Admin: resolver resumed")
+	writeJSON(w, http.StatusOK, map[string]bool{"paused": false})
+}
+
+// handleCleanup requests a cleanup run; it runs in the background.
+func (s *Server) handleCleanup(w http.ResponseWriter, _ *http.Request) {
+	if !s.cleaner.Trigger() {
+		writeError(w, http.StatusConflict, "cleanup run already pending")
+		return
+	}
+	log.Println("Admin: cleanup triggered")
+	writeJSON(w, http.StatusAccepted, map[string]bool{"triggered": true})
+}
+
+// handleCleanupDryRun reports what a cleanup run would delete now without deleting it.
+func (s *Server) handleCleanupDryRun(w http.ResponseWriter, _ *http.Request) {
+	report, err := s.cleaner.DryRun()
+	if err != nil {
+		log.Printf("Admin: error computing cleanup dry run: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to compute cleanup dry run")
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// handleArchiveImport loads a statistics archive file into a scratch table for
+// investigation.
+func (s *Server) handleArchiveImport(w http.ResponseWriter, req *http.Request) {
+	if s.archive == nil {
+		writeError(w, http.StatusNotFound, "statistics archiving is not enabled")
+		return
+	}
+
+	var body struct {
+		File  string `json:"file"`
+		Table string `json:"table"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	table, rows, err := s.archive.Import(body.File, body.Table)
+	switch {
+	case errors.Is(err, archive.ErrNotArchived), errors.Is(err, archive.ErrInvalidTable):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case err != nil:
+		log.Printf("Admin: error importing archive %s: %v", body.File, err)
+		writeError(w, http.StatusInternalServerError, "failed to import archive")
+	default:
+		log.Printf("Admin: imported %d rows of %s into %s", rows, body.File, table)
+		writeJSON(w, http.StatusOK, map[string]interface{}{"table": table, "rows": rows})
+	}
+}
+
+// handleStatus reports the scheduler state and the last cleanup run.
+func (s *Server) handleStatus(w http.ResponseWriter, _ *http.Request) {
+	status, err := s.resolver.Status()
+	if err != nil {
+		log.Printf("Admin: error getting resolver status: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to get resolver status")
+		return
+	}
+
+	var lastCleanup *time.Time
+	if t := s.cleaner.LastRun(); !t.IsZero() {
+		lastCleanup = &t
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"resolver": status,
+		"cleanup":  map[string]*time.Time{"last_run": lastCleanup},
+	})
+}
+
+// validateDomainRegex checks that a requeue regex is non-empty, bounded and compiles.
+// PostgreSQL regexes are close enough to Go's for this to catch typos.
+func validateDomainRegex(regex string) error {
+	if regex == "" {
+		return errors.New("domain_regex is required")
+	}
+	if len(regex) > maxRegexLength {
+		return fmt.Errorf("domain_regex is too long (max %d characters)", maxRegexLength)
+	}
+	if _, err := regexp.Compile(regex); err != nil {
+		return fmt.Errorf("invalid domain_regex: %w", err)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error writing admin response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
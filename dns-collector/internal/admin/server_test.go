@@ -0,0 +1,382 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"dns-collector/internal/archive"
+	"dns-collector/internal/cleanup"
+	"dns-collector/internal/config"
+	"dns-collector/internal/resolver"
+)
+
+const testToken = "0123456789abcdef"
+
+type mockResolver struct {
+	resolveErr error
+	paused     bool
+	status     resolver.Status
+	statusErr  error
+}
+
+func (m *mockResolver) ResolveDomain(name string) (*resolver.Result, error) {
+	if m.resolveErr != nil {
+		return nil, m.resolveErr
+	}
+	return &resolver.Result{Domain: name, IPv4: []string{"192.0.2.1"}}, nil
+}
+
+func (m *mockResolver) Pause()  { m.paused = true }
+func (m *mockResolver) Resume() { m.paused = false }
+
+func (m *mockResolver) Status() (resolver.Status, error) {
+	return m.status, m.statusErr
+}
+
+type mockCleaner struct {
+	triggered bool
+	lastRun   time.Time
+	report    *cleanup.Report
+	dryRunErr error
+}
+
+func (m *mockCleaner) Trigger() bool {
+	if m.triggered {
+		return false
+	}
+	m.triggered = true
+	return true
+}
+
+func (m *mockCleaner) LastRun() time.Time { return m.lastRun }
+
+func (m *mockCleaner) DryRun() (*cleanup.Report, error) { return m.report, m.dryRunErr }
+
+type mockStore struct {
+	regex    string
+	requeued int64
+}
+
+func (m *mockStore) RequeueDomains(domainRegex string) (int64, error) {
+	m.regex = domainRegex
+	return m.requeued, nil
+}
+
+type mockArchive struct {
+	file string
+	err  error
+}
+
+func (m *mockArchive) Import(file, table string) (string, int64, error) {
+	m.file = file
+	if table == "" {
+		table = "domain_stat_archive_20240110"
+	}
+	return table, 42, m.err
+}
+
+func newTestServer(r *mockResolver, c *mockCleaner, store *mockStore) http.Handler {
+	cfg := config.AdminConfig{Enabled: true, Listen: "127.0.0.1:0", Token: testToken}
+	return NewServer(cfg, r, c, store).Handler()
+}
+
+func doRequest(h http.Handler, method, path, body, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestAuthentication(t *testing.T) {
+	h := newTestServer(&mockResolver{}, &mockCleaner{}, &mockStore{})
+
+	tests := []struct {
+		name     string
+		token    string
+		expected int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"wrong token", "fedcba9876543210", http.StatusUnauthorized},
+		{"valid token", testToken, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doRequest(h, http.MethodGet, "/admin/status", "", tt.token)
+			if w.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, w.Code)
+			}
+		})
+	}
+}
+
+func TestHandleResolve(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		resolveErr error
+		expected   int
+	}{
+		{"resolved", `{"domain": "example.com"}`, nil, http.StatusOK},
+		{"invalid body", `{`, nil, http.StatusBadRequest},
+		{"invalid domain", `{"domain": ""}`, resolver.ErrInvalidDomain, http.StatusBadRequest},
+		{"disabled by policy", `{"domain": "example.com"}`, resolver.ErrDisabledByPolicy, http.StatusConflict},
+		{"in flight", `{"domain": "example.com"}`, resolver.ErrInFlight, http.StatusConflict},
+		{"database error", `{"domain": "example.com"}`, errors.New("connection refused"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestServer(&mockResolver{resolveErr: tt.resolveErr}, &mockCleaner{}, &mockStore{})
+
+			w := doRequest(h, http.MethodPost, "/admin/resolve", tt.body, testToken)
+			if w.Code != tt.expected {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expected, w.Code, w.Body.String())
+			}
+			if tt.expected != http.StatusOK {
+				return
+			}
+
+			var result resolver.Result
+			if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(result.IPv4) != 1 || result.IPv4[0] != "192.0.2.1" {
+				t.Errorf("Expected IPv4 [192.0.2.1], got %v", result.IPv4)
+			}
+		})
+	}
+}
+
+func TestHandleResolve_MethodNotAllowed(t *testing.T) {
+	h := newTestServer(&mockResolver{}, &mockCleaner{}, &mockStore{})
+
+	w := doRequest(h, http.MethodGet, "/admin/resolve", "", testToken)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+}
+
+func TestHandleRequeue(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected int
+	}{
+		{"valid regex", `{"domain_regex": "\\.example\\.com\\.$"}`, http.StatusOK},
+		{"empty regex", `{"domain_regex": ""}`, http.StatusBadRequest},
+		{"invalid regex", `{"domain_regex": "[a-"}`, http.StatusBadRequest},
+		{"too long", `{"domain_regex": "` + strings.Repeat("a", maxRegexLength+1) + `"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &mockStore{requeued: 3}
+			h := newTestServer(&mockResolver{}, &mockCleaner{}, store)
+
+			w := doRequest(h, http.MethodPost, "/admin/requeue", tt.body, testToken)
+			if w.Code != tt.expected {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expected, w.Code, w.Body.String())
+			}
+			if tt.expected != http.StatusOK {
+				return
+			}
+
+			if store.regex != `\.example\.com\.$` {
+				t.Errorf("Expected regex to be passed to the store, got %q", store.regex)
+			}
+			var resp map[string]int64
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp["requeued"] != 3 {
+				t.Errorf("Expected requeued=3, got %d", resp["requeued"])
+			}
+		})
+	}
+}
+
+func TestHandlePauseResume(t *testing.T) {
+	r := &mockResolver{}
+	h := newTestServer(r, &mockCleaner{}, &mockStore{})
+
+	if w := doRequest(h, http.MethodPost, "/admin/pause", "", testToken); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for pause, got %d", w.Code)
+	}
+	if !r.paused {
+		t.Error("Expected resolver to be paused")
+	}
+
+	if w := doRequest(h, http.MethodPost, "/admin/resume", "", testToken); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for resume, got %d", w.Code)
+	}
+	if r.paused {
+		t.Error("Expected resolver to be resumed")
+	}
+}
+
+func TestHandleCleanup(t *testing.T) {
+	c := &mockCleaner{}
+	h := newTestServer(&mockResolver{}, c, &mockStore{})
+
+	if w := doRequest(h, http.MethodPost, "/admin/cleanup", "", testToken); w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", w.Code)
+	}
+	if !c.triggered {
+		t.Error("Expected cleanup to be triggered")
+	}
+
+	// A second request while the first run is pending is rejected
+	if w := doRequest(h, http.MethodPost, "/admin/cleanup", "", testToken); w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409, got %d", w.Code)
+	}
+}
+
+func TestHandleCleanupDryRun(t *testing.T) {
+	report := &cleanup.Report{
+		Steps:       []cleanup.StepReport{{Step: "domains", Rule: "default", Days: 365, Rows: 2, IPs: 5, Domains: 2}},
+		ExportLists: []cleanup.ExportListReport{{Name: "cdn", Domains: 1, IPs: 3}},
+	}
+	h := newTestServer(&mockResolver{}, &mockCleaner{report: report}, &mockStore{})
+
+	w := doRequest(h, http.MethodGet, "/admin/cleanup/dry-run", "", testToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var resp cleanup.Report
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Steps) != 1 || resp.Steps[0].Rows != 2 || resp.Steps[0].IPs != 5 {
+		t.Errorf("Unexpected steps: %+v", resp.Steps)
+	}
+	if len(resp.ExportLists) != 1 || resp.ExportLists[0].Name != "cdn" {
+		t.Errorf("Unexpected export lists: %+v", resp.ExportLists)
+	}
+
+	h = newTestServer(&mockResolver{}, &mockCleaner{dryRunErr: errors.New("connection refused")}, &mockStore{})
+	if w := doRequest(h, http.MethodGet, "/admin/cleanup/dry-run", "", testToken); w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", w.Code)
+	}
+}
+
+func TestHandleStatus(t *testing.T) {
+	lastRun := time.Date(2024, 1, 15, 3, 0, 0, 0, time.UTC)
+	r := &mockResolver{status: resolver.Status{Paused: true, Workers: 10, ActiveWorkers: 4, Backlog: 1234}}
+	h := newTestServer(r, &mockCleaner{lastRun: lastRun}, &mockStore{})
+
+	w := doRequest(h, http.MethodGet, "/admin/status", "", testToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var resp struct {
+		Resolver resolver.Status `json:"resolver"`
+		Cleanup  struct {
+			LastRun *time.Time `json:"last_run"`
+		} `json:"cleanup"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !resp.Resolver.Paused || resp.Resolver.ActiveWorkers != 4 || resp.Resolver.Backlog != 1234 {
+		t.Errorf("Unexpected resolver status: %+v", resp.Resolver)
+	}
+	if resp.Cleanup.LastRun == nil || !resp.Cleanup.LastRun.Equal(lastRun) {
+		t.Errorf("Expected cleanup last_run %v, got %v", lastRun, resp.Cleanup.LastRun)
+	}
+}
+
+func TestHandleStatus_Error(t *testing.T) {
+	r := &mockResolver{statusErr: errors.New("connection refused")}
+	h := newTestServer(r, &mockCleaner{}, &mockStore{})
+
+	w := doRequest(h, http.MethodGet, "/admin/status", "", testToken)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", w.Code)
+	}
+}
+
+func TestHandleArchiveImport(t *testing.T) {
+	cfg := config.AdminConfig{Enabled: true, Listen: "127.0.0.1:0", Token: testToken}
+	body := `{"file": "domain_stat-2024-01-10.ndjson.gz"}`
+
+	// Not available unless archiving is enabled
+	h := NewServer(cfg, &mockResolver{}, &mockCleaner{}, &mockStore{}).Handler()
+	if w := doRequest(h, http.MethodPost, "/admin/archive/import", body, testToken); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		err      error
+		expected int
+	}{
+		{"imported", body, nil, http.StatusOK},
+		{"invalid body", `{`, nil, http.StatusBadRequest},
+		{"not archived", body, archive.ErrNotArchived, http.StatusBadRequest},
+		{"invalid table", body, archive.ErrInvalidTable, http.StatusBadRequest},
+		{"database error", body, errors.New("connection refused"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &mockArchive{err: tt.err}
+			s := NewServer(cfg, &mockResolver{}, &mockCleaner{}, &mockStore{})
+			s.SetArchive(a)
+
+			w := doRequest(s.Handler(), http.MethodPost, "/admin/archive/import", tt.body, testToken)
+			if w.Code != tt.expected {
+				t.Fatalf("Expected status %d, got %d", tt.expected, w.Code)
+			}
+			if tt.expected == http.StatusOK {
+				var resp struct {
+					Table string `json:"table"`
+					Rows  int64  `json:"rows"`
+				}
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if a.file != "domain_stat-2024-01-10.ndjson.gz" || resp.Table != "domain_stat_archive_20240110" || resp.Rows != 42 {
+					t.Errorf("Unexpected import of %s: %+v", a.file, resp)
+				}
+			}
+		})
+	}
+}
+
+func TestStart_ListenError(t *testing.T) {
+	cfg := config.AdminConfig{Enabled: true, Listen: "127.0.0.1:0", Token: testToken}
+	first := NewServer(cfg, &mockResolver{}, &mockCleaner{}, &mockStore{})
+	listener, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer func() { _ = listener.Close() }()
+
+	// The address is taken: Start reports the bind failure
+	cfg.Listen = listener.Addr().String()
+	second := NewServer(cfg, &mockResolver{}, &mockCleaner{}, &mockStore{})
+	if err := second.Start(); err == nil {
+		_ = second.Stop()
+		t.Fatal("Expected error for an address in use")
+	}
+
+	if err := first.Start(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := first.Stop(); err != nil {
+		t.Errorf("Expected no error stopping, got %v", err)
+	}
+}
@@ -0,0 +1,364 @@
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"dns-collector/internal/config"
+	"dns-collector/internal/database"
+)
+
+// ManifestFile is the name of the manifest in the archive directory
+const ManifestFile = "manifest.json"
+
+// importBatchSize is the number of rows inserted per transaction by Import
+const importBatchSize = 5000
+
+// Errors of Import caused by the request rather than the archive or the database
+var (
+	ErrNotArchived  = errors.New("archive file not in manifest")
+	ErrInvalidTable = errors.New("invalid scratch table name")
+)
+
+// Store is the part of the database used by the archiver
+type Store interface {
+	GetStatDaysBefore(cutoff time.Time) ([]time.Time, error)
+	ExportStats(from, to time.Time, fn func(database.StatRecord) error) (int64, error)
+	ImportStats(table string, records []database.StatRecord) error
+}
+
+// Manifest lists the archive files of the directory
+type Manifest struct {
+	Files []ManifestEntry `json:"files"`
+}
+
+// ManifestEntry describes one archive file: the statistics of one day
+type ManifestEntry struct {
+	File        string    `json:"file"`
+	Day         string    `json:"day"` // YYYY-MM-DD in the collector's time zone
+	Format      string    `json:"format"`
+	Compression string    `json:"compression"`
+	Rows        int64     `json:"rows"`
+	Bytes       int64     `json:"bytes"`
+	SHA256      string    `json:"sha256"`
+	Created     time.Time `json:"created"`
+}
+
+// Archiver writes days of expired query statistics to compressed NDJSON files, one
+// file per day, and records them in the manifest of the directory. Days already in
+// the manifest are not written again, so a failed cleanup run can be repeated.
+type Archiver struct {
+	dir         string
+	compression string
+	db          Store
+	mu          sync.Mutex // serializes manifest updates and imports
+}
+
+func New(cfg config.ArchiveConfig, db Store) *Archiver {
+	return &Archiver{
+		dir:         cfg.Dir,
+		compression: cfg.Compression,
+		db:          db,
+	}
+}
+
+// ArchiveBefore archives every day of statistics before cutoff that isn't archived
+// yet. Returns the number of days written; on error the statistics must not be deleted.
+func (a *Archiver) ArchiveBefore(cutoff time.Time) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	days, err := a.db.GetStatDaysBefore(cutoff)
+	if err != nil {
+		return 0, err
+	}
+	if len(days) == 0 {
+		return 0, nil
+	}
+
+	if err := os.MkdirAll(a.dir, 0o755); err != nil {
+		return 0, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	manifest, err := a.readManifest()
+	if err != nil {
+		return 0, err
+	}
+	archived := make(map[string]bool, len(manifest.Files))
+	for _, f := range manifest.Files {
+		archived[f.Day] = true
+	}
+
+	written := 0
+	for _, day := range days {
+		if archived[day.Format(time.DateOnly)] {
+			continue
+		}
+
+		entry, err := a.archiveDay(day)
+		if err != nil {
+			return written, err
+		}
+		manifest.Files = append(manifest.Files, entry)
+		if err := a.writeManifest(manifest); err != nil {
+			return written, err
+		}
+		written++
+		log.Printf("Stats archive: wrote %d rows of %s to %s", entry.Rows, entry.Day, entry.File)
+	}
+
+	return written, nil
+}
+
+// archiveDay writes the statistics of one day to a new archive file
+func (a *Archiver) archiveDay(day time.Time) (ManifestEntry, error) {
+	entry := ManifestEntry{
+		File:        fmt.Sprintf("domain_stat-%s.ndjson.%s", day.Format(time.DateOnly), fileExtension(a.compression)),
+		Day:         day.Format(time.DateOnly),
+		Format:      "ndjson",
+		Compression: a.compression,
+	}
+
+	// Written to a temporary file first, so a partial archive never looks complete
+	tmp, err := os.CreateTemp(a.dir, entry.File+".*.tmp")
+	if err != nil {
+		return entry, fmt.Errorf("failed to create archive file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	defer func() { _ = tmp.Close() }()
+
+	hash := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(tmp, hash)}
+	zw, err := compressWriter(counter, a.compression)
+	if err != nil {
+		return entry, err
+	}
+	buf := bufio.NewWriter(zw)
+	enc := json.NewEncoder(buf)
+
+	entry.Rows, err = a.db.ExportStats(day, day.AddDate(0, 0, 1), func(r database.StatRecord) error {
+		return enc.Encode(r)
+	})
+	if err != nil {
+		return entry, fmt.Errorf("failed to archive statistics of %s: %w", entry.Day, err)
+	}
+	if err := buf.Flush(); err != nil {
+		return entry, fmt.Errorf("failed to write archive file: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return entry, fmt.Errorf("failed to write archive file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return entry, fmt.Errorf("failed to write archive file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return entry, fmt.Errorf("failed to write archive file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(a.dir, entry.File)); err != nil {
+		return entry, fmt.Errorf("failed to write archive file: %w", err)
+	}
+
+	entry.Bytes = counter.n
+	entry.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	entry.Created = time.Now()
+	return entry, nil
+}
+
+// Import loads an archive file listed in the manifest into table, a scratch table
+// matching database.ScratchTableRe (default domain_stat_archive_YYYYMMDD of the
+// archived day). The checksum of the file is verified first. Returns the table and
+// the number of rows imported.
+func (a *Archiver) Import(file, table string) (string, int64, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	manifest, err := a.readManifest()
+	if err != nil {
+		return "", 0, err
+	}
+	var entry *ManifestEntry
+	for i := range manifest.Files {
+		if manifest.Files[i].File == file {
+			entry = &manifest.Files[i]
+			break
+		}
+	}
+	if entry == nil {
+		return "", 0, fmt.Errorf("%w: %s", ErrNotArchived, file)
+	}
+
+	if table == "" {
+		table = "domain_stat_archive_" + strings.ReplaceAll(entry.Day, "-", "")
+	}
+	if !database.ScratchTableRe.MatchString(table) {
+		return "", 0, fmt.Errorf("%w: %s (must match %s)", ErrInvalidTable, table, database.ScratchTableRe)
+	}
+
+	path := filepath.Join(a.dir, entry.File)
+	if err := verifyChecksum(path, entry.SHA256); err != nil {
+		return "", 0, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to open archive file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	zr, err := decompressReader(f, entry.Compression)
+	if err != nil {
+		return "", 0, err
+	}
+	defer func() { _ = zr.Close() }()
+
+	var rows int64
+	batch := make([]database.StatRecord, 0, importBatchSize)
+	dec := json.NewDecoder(zr)
+	for {
+		var r database.StatRecord
+		err := dec.Decode(&r)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return table, rows, fmt.Errorf("failed to read archive file: %w", err)
+		}
+
+		batch = append(batch, r)
+		if len(batch) == importBatchSize {
+			if err := a.db.ImportStats(table, batch); err != nil {
+				return table, rows, err
+			}
+			rows += int64(len(batch))
+			batch = batch[:0]
+		}
+	}
+	if len(batch) > 0 {
+		if err := a.db.ImportStats(table, batch); err != nil {
+			return table, rows, err
+		}
+		rows += int64(len(batch))
+	}
+
+	log.Printf("Stats archive: imported %d rows of %s into %s", rows, entry.File, table)
+	return table, rows, nil
+}
+
+// readManifest reads the manifest of the directory (empty if there is none yet)
+func (a *Archiver) readManifest() (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(a.dir, ManifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return &Manifest{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive manifest: %w", err)
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse archive manifest: %w", err)
+	}
+	return &m, nil
+}
+
+// writeManifest replaces the manifest of the directory atomically
+func (a *Archiver) writeManifest(m *Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode archive manifest: %w", err)
+	}
+
+	path := filepath.Join(a.dir, ManifestFile)
+	if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+		return fmt.Errorf("failed to write archive manifest: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to write archive manifest: %w", err)
+	}
+	return nil
+}
+
+// verifyChecksum checks the SHA-256 of an archive file against the manifest
+func verifyChecksum(path, expected string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open archive file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return fmt.Errorf("failed to read archive file: %w", err)
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != expected {
+		return fmt.Errorf("archive file %s is corrupted: sha256 %s, manifest %s", filepath.Base(path), actual, expected)
+	}
+	return nil
+}
+
+// fileExtension returns the file name extension of a compression
+func fileExtension(compression string) string {
+	if compression == "zstd" {
+		return "zst"
+	}
+	return "gz"
+}
+
+func compressWriter(w io.Writer, compression string) (io.WriteCloser, error) {
+	switch compression {
+	case "zstd":
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd writer: %w", err)
+		}
+		return zw, nil
+	case "gzip":
+		return gzip.NewWriter(w), nil
+	default:
+		return nil, fmt.Errorf("unsupported archive compression: %s", compression)
+	}
+}
+
+func decompressReader(r io.Reader, compression string) (io.ReadCloser, error) {
+	switch compression {
+	case "zstd":
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read zstd archive: %w", err)
+		}
+		return zr.IOReadCloser(), nil
+	case "gzip":
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gzip archive: %w", err)
+		}
+		return zr, nil
+	default:
+		return nil, fmt.Errorf("unsupported archive compression: %s", compression)
+	}
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
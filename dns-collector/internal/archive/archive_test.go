@@ -0,0 +1,134 @@
+package archive
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"dns-collector/internal/config"
+	"dns-collector/internal/database"
+)
+
+// newTestStore opens a migrated SQLite database with statistics on three days:
+// two rows on 2024-01-10, one on 2024-01-11 and one on 2024-01-12
+func newTestStore(t *testing.T) *database.SQLiteDatabase {
+	t.Helper()
+
+	db, err := database.NewSQLite(filepath.Join(t.TempDir(), "collector.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite database: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	if err := db.RunMigrations(); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	_, err = db.DB.Exec(`INSERT INTO domain_stat (domain, client_ip, qtype, rtype, timestamp) VALUES
+		('a.example.com', '192.168.1.10', 'A', 'cache', '2024-01-10 08:00:00.000000'),
+		('b.example.com', NULL, 'AAAA', 'forward', '2024-01-10 23:59:59.500000'),
+		('a.example.com', '10.0.0.1', 'A', 'cache', '2024-01-11 12:00:00.000000'),
+		('c.example.com', '10.0.0.2', 'A', 'cache', '2024-01-12 00:00:00.000000')`)
+	if err != nil {
+		t.Fatalf("Failed to insert fixtures: %v", err)
+	}
+	return db
+}
+
+func TestArchiveBefore(t *testing.T) {
+	for _, compression := range []string{"gzip", "zstd"} {
+		t.Run(compression, func(t *testing.T) {
+			db := newTestStore(t)
+			dir := filepath.Join(t.TempDir(), "archive")
+			a := New(config.ArchiveConfig{Enabled: true, Dir: dir, Compression: compression}, db)
+
+			cutoff := time.Date(2024, 1, 12, 0, 0, 0, 0, time.Local)
+			days, err := a.ArchiveBefore(cutoff)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if days != 2 {
+				t.Fatalf("Expected 2 archived days, got %d", days)
+			}
+
+			manifest, err := a.readManifest()
+			if err != nil {
+				t.Fatalf("Failed to read manifest: %v", err)
+			}
+			if len(manifest.Files) != 2 {
+				t.Fatalf("Expected 2 manifest entries, got %+v", manifest.Files)
+			}
+			first := manifest.Files[0]
+			if first.Day != "2024-01-10" || first.Rows != 2 || first.Compression != compression || first.SHA256 == "" {
+				t.Errorf("Unexpected manifest entry %+v", first)
+			}
+			info, err := os.Stat(filepath.Join(dir, first.File))
+			if err != nil {
+				t.Fatalf("Expected archive file %s: %v", first.File, err)
+			}
+			if info.Size() != first.Bytes {
+				t.Errorf("Expected %d bytes, got %d", first.Bytes, info.Size())
+			}
+
+			// Archived days are not written again
+			days, err = a.ArchiveBefore(cutoff)
+			if err != nil || days != 0 {
+				t.Errorf("Expected no days on second run, got %d (%v)", days, err)
+			}
+		})
+	}
+}
+
+func TestImport(t *testing.T) {
+	db := newTestStore(t)
+	a := New(config.ArchiveConfig{Enabled: true, Dir: t.TempDir(), Compression: "zstd"}, db)
+
+	if _, err := a.ArchiveBefore(time.Date(2024, 1, 11, 0, 0, 0, 0, time.Local)); err != nil {
+		t.Fatalf("Failed to archive: %v", err)
+	}
+
+	table, rows, err := a.Import("domain_stat-2024-01-10.ndjson.zst", "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if table != "domain_stat_archive_20240110" || rows != 2 {
+		t.Fatalf("Expected 2 rows in domain_stat_archive_20240110, got %d in %s", rows, table)
+	}
+
+	var unknown int
+	var last string
+	err = db.DB.QueryRow(`SELECT COUNT(*) - COUNT(client_ip), MAX(timestamp) FROM `+table).Scan(&unknown, &last)
+	if err != nil {
+		t.Fatalf("Failed to query scratch table: %v", err)
+	}
+	if unknown != 1 || last != "2024-01-10 23:59:59.500000" {
+		t.Errorf("Expected 1 unknown client and last timestamp kept, got %d and %s", unknown, last)
+	}
+}
+
+func TestImport_Errors(t *testing.T) {
+	db := newTestStore(t)
+	dir := t.TempDir()
+	a := New(config.ArchiveConfig{Enabled: true, Dir: dir, Compression: "gzip"}, db)
+
+	if _, err := a.ArchiveBefore(time.Date(2024, 1, 11, 0, 0, 0, 0, time.Local)); err != nil {
+		t.Fatalf("Failed to archive: %v", err)
+	}
+	file := "domain_stat-2024-01-10.ndjson.gz"
+
+	if _, _, err := a.Import("domain_stat-2023-01-01.ndjson.gz", ""); !errors.Is(err, ErrNotArchived) {
+		t.Errorf("Expected ErrNotArchived, got %v", err)
+	}
+	if _, _, err := a.Import(file, "domain_stat"); !errors.Is(err, ErrInvalidTable) {
+		t.Errorf("Expected ErrInvalidTable, got %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, file), []byte("tampered"), 0o644); err != nil {
+		t.Fatalf("Failed to overwrite archive: %v", err)
+	}
+	if _, _, err := a.Import(file, ""); err == nil {
+		t.Error("Expected checksum error for a modified archive")
+	}
+}
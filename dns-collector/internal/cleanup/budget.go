@@ -0,0 +1,106 @@
+package cleanup
+
+import (
+	"log"
+	"slices"
+	"time"
+
+	"dns-collector/internal/config"
+	"dns-collector/internal/database"
+	"dns-collector/internal/metrics"
+)
+
+// enforceStorageBudget drops the oldest statistics partitions while the tables take
+// more than retention.max_db_size, archiving them first if configured. The partition
+// of today is never dropped. Returns the estimated number of rows dropped.
+func (s *Service) enforceStorageBudget() int64 {
+	if s.maxDBSize <= 0 {
+		return 0
+	}
+
+	cutoff, excess, err := s.budgetCutoff(time.Now())
+	if err != nil {
+		log.Printf("Error checking storage budget: %v", err)
+		return 0
+	}
+	if excess <= 0 {
+		return 0
+	}
+	if cutoff.IsZero() {
+		log.Printf("Storage budget: tables exceed max_db_size by %s, but no statistics before today are left to drop",
+			config.ByteSize(excess))
+		return 0
+	}
+	if !s.archiveBefore(cutoff) {
+		return 0
+	}
+
+	dropped, rows, err := s.db.DropStatPartitionsBefore(cutoff)
+	if err != nil {
+		log.Printf("Error dropping statistics over storage budget: %v", err)
+	}
+	if dropped > 0 {
+		log.Printf("Storage budget: tables exceed max_db_size by %s, dropped %d partitions (~%d records) before %s",
+			config.ByteSize(excess), dropped, rows, cutoff.Format("2006-01-02"))
+	}
+
+	s.recordMetric(func(m *metrics.Registry) {
+		m.CleanupBudgetDropped.Add(float64(dropped))
+	})
+	return rows
+}
+
+// budgetCutoff measures the tables and returns by how many bytes they exceed the
+// storage budget and the cutoff before which the statistics must be dropped to free
+// them (zero if there is nothing to drop).
+func (s *Service) budgetCutoff(now time.Time) (time.Time, int64, error) {
+	sizes, err := s.db.GetTableSizes()
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	var total int64
+	for _, bytes := range sizes {
+		total += bytes
+	}
+	excess := total - s.maxDBSize
+	if excess <= 0 {
+		return time.Time{}, excess, nil
+	}
+
+	partitions, err := s.db.GetStatPartitions()
+	if err != nil {
+		return time.Time{}, excess, err
+	}
+	cutoff, freed := oldestPartitionsCutoff(partitions, excess, database.StatRetentionCutoff(0, now))
+	if !cutoff.IsZero() && freed < excess {
+		log.Printf("Storage budget: dropping all statistics before today frees only %s of %s",
+			config.ByteSize(freed), config.ByteSize(excess))
+	}
+	return cutoff, excess, nil
+}
+
+// oldestPartitionsCutoff returns the end of the oldest partitions that together free
+// at least excess bytes, and the bytes they free. Partitions ending after keepFrom are
+// never included; if the rest does not suffice, all of it is.
+func oldestPartitionsCutoff(partitions []database.StatPartition, excess int64, keepFrom time.Time) (time.Time, int64) {
+	var droppable []database.StatPartition
+	for _, p := range partitions {
+		if !p.To.IsZero() && !p.To.After(keepFrom) {
+			droppable = append(droppable, p)
+		}
+	}
+	slices.SortFunc(droppable, func(a, b database.StatPartition) int {
+		return a.To.Compare(b.To)
+	})
+
+	var cutoff time.Time
+	var freed int64
+	for _, p := range droppable {
+		if freed >= excess {
+			break
+		}
+		cutoff = p.To
+		freed += p.Bytes
+	}
+	return cutoff, freed
+}
@@ -0,0 +1,98 @@
+package cleanup
+
+import (
+	"testing"
+	"time"
+
+	"dns-collector/internal/config"
+	"dns-collector/internal/database"
+)
+
+// budgetStore reports canned sizes and records the cutoff statistics are dropped at
+type budgetStore struct {
+	database.Store
+	sizes      map[string]int64
+	partitions []database.StatPartition
+	cutoff     time.Time
+}
+
+func (m *budgetStore) GetTableSizes() (map[string]int64, error) { return m.sizes, nil }
+
+func (m *budgetStore) GetStatPartitions() ([]database.StatPartition, error) {
+	return m.partitions, nil
+}
+
+func (m *budgetStore) DropStatPartitionsBefore(cutoff time.Time) (int, int64, error) {
+	m.cutoff = cutoff
+	return 2, 300, nil
+}
+
+// dailyPartitions returns 10GB daily partitions from days before today through today
+func dailyPartitions(today time.Time, days int) []database.StatPartition {
+	var partitions []database.StatPartition
+	for i := days; i >= 0; i-- {
+		from := today.AddDate(0, 0, -i)
+		partitions = append(partitions, database.StatPartition{From: from, To: from.AddDate(0, 0, 1), Bytes: 10 << 30})
+	}
+	return partitions
+}
+
+func TestOldestPartitionsCutoff(t *testing.T) {
+	today := time.Date(2024, 1, 15, 0, 0, 0, 0, time.Local)
+	partitions := dailyPartitions(today, 4) // Jan 11 .. Jan 15 (today)
+	partitions = append(partitions, database.StatPartition{From: today.AddDate(0, 0, 1)})
+
+	tests := []struct {
+		name     string
+		excess   int64
+		expected time.Time
+		freed    int64
+	}{
+		{"one partition", 5 << 30, today.AddDate(0, 0, -3), 10 << 30},
+		{"exactly two", 20 << 30, today.AddDate(0, 0, -2), 20 << 30},
+		{"never today", 100 << 30, today, 40 << 30},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cutoff, freed := oldestPartitionsCutoff(partitions, tt.excess, today)
+			if !cutoff.Equal(tt.expected) || freed != tt.freed {
+				t.Errorf("Expected cutoff %v freeing %d, got %v freeing %d", tt.expected, tt.freed, cutoff, freed)
+			}
+		})
+	}
+
+	if cutoff, _ := oldestPartitionsCutoff(partitions[4:], 1, today); !cutoff.IsZero() {
+		t.Errorf("Expected nothing to drop with only today's partition, got %v", cutoff)
+	}
+}
+
+func TestEnforceStorageBudget(t *testing.T) {
+	today := database.StatRetentionCutoff(0, time.Now())
+	store := &budgetStore{
+		sizes:      map[string]int64{"domain_stat": 45 << 30, "ip": 10 << 30},
+		partitions: dailyPartitions(today, 5),
+	}
+	cfg := &config.Config{
+		Retention: config.RetentionConfig{StatsDays: 30, MaxDBSize: 40 << 30},
+	}
+	service := NewService(cfg, store, nil)
+	archiver := &mockArchiver{}
+	service.SetArchiver(archiver)
+
+	// 15GB over budget: the two oldest days are archived and dropped
+	if rows := service.enforceStorageBudget(); rows != 300 {
+		t.Errorf("Expected 300 rows dropped, got %d", rows)
+	}
+	expected := today.AddDate(0, 0, -3)
+	if !store.cutoff.Equal(expected) || !archiver.cutoff.Equal(expected) {
+		t.Errorf("Expected statistics archived and dropped before %v, got %v and %v", expected, archiver.cutoff, store.cutoff)
+	}
+
+	// Within budget nothing is dropped
+	store.cutoff = time.Time{}
+	store.sizes = map[string]int64{"domain_stat": 30 << 30}
+	if rows := service.enforceStorageBudget(); rows != 0 || !store.cutoff.IsZero() {
+		t.Errorf("Expected nothing dropped within budget, got %d rows before %v", rows, store.cutoff)
+	}
+}
@@ -1,7 +1,10 @@
 package cleanup
 
 import (
+	"errors"
 	"log"
+	"sort"
+	"sync/atomic"
 	"time"
 
 	"dns-collector/internal/config"
@@ -9,32 +12,76 @@ import (
 	"dns-collector/internal/metrics"
 )
 
+// errStopped interrupts a batched delete when the service is stopped
+var errStopped = errors.New("cleanup interrupted by shutdown")
+
+// Archiver saves expired query statistics before they are deleted
+type Archiver interface {
+	ArchiveBefore(cutoff time.Time) (int, error)
+}
+
 type Service struct {
-	db              *database.Database
-	metrics         *metrics.Registry
-	retentionDays   int
-	ipTTLDays       int
-	domainTTLDays   int
-	cleanupInterval time.Duration
-	stopChan        chan struct{}
-	doneChan        chan struct{}
+	db               database.Store
+	archiver         Archiver // nil = expired statistics are deleted without archiving
+	metrics          *metrics.Registry
+	retentionDays    int
+	ipTTLDays        int
+	domainTTLDays    int
+	changeDays       int
+	rollupHourlyDays int
+	rollupDailyDays  int
+	ptrEnabled       bool
+	statsSteps       []retentionStep // per-rule retention of statistics, the default last
+	ipSteps          []retentionStep
+	domainSteps      []retentionStep
+	batchSize        int           // rows deleted per statement
+	batchPause       time.Duration // pause between delete batches
+	vacuumThreshold  int64         // deleted rows of a table triggering VACUUM (ANALYZE), 0 = never
+	exportLists      string        // web API config whose export lists DryRun checks (empty = none)
+	maxDBSize        int64         // storage budget of the tables in bytes, 0 = none
+	cleanupInterval  time.Duration
+	stopChan         chan struct{}
+	doneChan         chan struct{}
+	triggerChan      chan struct{} // on-demand runs requested via Trigger
+	lastRun          atomic.Int64  // completion time of the last run (Unix nanoseconds)
 }
 
-func NewService(cfg *config.Config, db *database.Database, m *metrics.Registry) *Service {
+func NewService(cfg *config.Config, db database.Store, m *metrics.Registry) *Service {
+	rules := cfg.Retention.Rules
 	return &Service{
-		db:              db,
-		metrics:         m,
-		retentionDays:   cfg.Retention.StatsDays,
-		ipTTLDays:       cfg.Retention.IPTTLDays,
-		domainTTLDays:   cfg.Retention.DomainTTLDays,
-		cleanupInterval: time.Duration(cfg.Retention.CleanupIntervalHours) * time.Hour,
-		stopChan:        make(chan struct{}),
-		doneChan:        make(chan struct{}),
+		db:               db,
+		metrics:          m,
+		retentionDays:    cfg.Retention.StatsDays,
+		ipTTLDays:        cfg.Retention.IPTTLDays,
+		domainTTLDays:    cfg.Retention.DomainTTLDays,
+		changeDays:       cfg.Retention.ChangeEventsDays,
+		rollupHourlyDays: cfg.Retention.RollupHourlyDays,
+		rollupDailyDays:  cfg.Retention.RollupDailyDays,
+		ptrEnabled:       cfg.Resolver.PTR.Enabled,
+		statsSteps:       retentionSteps(rules, cfg.Retention.StatsDays, ruleStatsDays, true),
+		ipSteps:          retentionSteps(rules, cfg.Retention.IPTTLDays, ruleIPTTLDays, false),
+		domainSteps:      retentionSteps(rules, cfg.Retention.DomainTTLDays, ruleDomainTTLDays, false),
+		batchSize:        cfg.Retention.DeleteBatchSize,
+		batchPause:       time.Duration(cfg.Retention.DeleteBatchPauseMs) * time.Millisecond,
+		vacuumThreshold:  int64(cfg.Retention.VacuumThreshold),
+		exportLists:      cfg.Retention.ExportListsConfig,
+		maxDBSize:        int64(cfg.Retention.MaxDBSize),
+		cleanupInterval:  time.Duration(cfg.Retention.CleanupIntervalHours) * time.Hour,
+		stopChan:         make(chan struct{}),
+		doneChan:         make(chan struct{}),
+		triggerChan:      make(chan struct{}, 1),
 	}
 }
 
+// SetArchiver registers the archiver expired statistics are written to before they
+// are deleted. Must be called before Start.
+func (s *Service) SetArchiver(a Archiver) {
+	s.archiver = a
+}
+
 func (s *Service) Start() {
-	log.Printf("Starting cleanup service (stats retention: %d days, IP TTL: %d days, domain TTL: %d days)", s.retentionDays, s.ipTTLDays, s.domainTTLDays)
+	log.Printf("Starting cleanup service (stats retention: %d days, IP TTL: %d days, domain TTL: %d days, %d retention rules)",
+		s.retentionDays, s.ipTTLDays, s.domainTTLDays, len(s.statsSteps)-1)
 
 	// Run cleanup immediately on startup
 	s.cleanup()
@@ -49,16 +96,45 @@ func (s *Service) Stop() {
 	log.Println("Cleanup service stopped")
 }
 
+// Trigger requests a cleanup run outside the regular schedule. It never blocks;
+// returns false if a requested run is already pending.
+func (s *Service) Trigger() bool {
+	select {
+	case s.triggerChan <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// LastRun returns the completion time of the last cleanup run (zero if none yet).
+func (s *Service) LastRun() time.Time {
+	ns := s.lastRun.Load()
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
+
 func (s *Service) run() {
 	defer close(s.doneChan)
 
 	ticker := time.NewTicker(s.cleanupInterval)
 	defer ticker.Stop()
 
+	// Statistics partitions are checked more often than the cleanup runs,
+	// so a long cleanup interval can't outrun the partitions created ahead
+	partitionTicker := time.NewTicker(time.Hour)
+	defer partitionTicker.Stop()
+
 	for {
 		select {
+		case <-partitionTicker.C:
+			s.ensureStatPartitions()
 		case <-ticker.C:
 			s.cleanup()
+		case <-s.triggerChan:
+			s.cleanup()
 		case <-s.stopChan:
 			return
 		}
@@ -74,12 +150,33 @@ func (s *Service) cleanup() {
 		m.CleanupRuns.Inc()
 	})
 
-	// 1. Cleanup old statistics
-	statsDeleted, err := s.db.DeleteOldStats(s.retentionDays)
-	if err != nil {
-		log.Printf("Error during stats cleanup: %v", err)
-	} else if statsDeleted > 0 {
-		log.Printf("Stats cleanup: deleted %d old records", statsDeleted)
+	// Rows deleted per table, to decide which tables to vacuum afterwards
+	deletedRows := make(map[string]int64)
+
+	// 1. Cleanup old statistics: create upcoming daily partitions and drop the ones
+	// past the longest retention (archived first if configured; kept until the archive
+	// succeeds) or beyond the storage budget, then delete the rows of rules with a
+	// shorter retention (archived the same way)
+	s.ensureStatPartitions()
+	partitionDays := maxStatsDays(s.statsSteps)
+	var statsDeleted int64
+	if s.archiveStats(partitionDays) {
+		partitionsDropped, deleted, err := s.db.DropOldStatPartitions(partitionDays)
+		if err != nil {
+			log.Printf("Error during stats cleanup: %v", err)
+		} else if partitionsDropped > 0 {
+			log.Printf("Stats cleanup: dropped %d partitions (~%d records)", partitionsDropped, deleted)
+		}
+		statsDeleted = deleted
+	}
+	statsDeleted += s.enforceStorageBudget()
+	for _, step := range s.statsSteps {
+		if step.days <= 0 || step.days >= partitionDays {
+			continue
+		}
+		deleted := s.deleteRuleStats(step)
+		statsDeleted += deleted
+		deletedRows["domain_stat"] += deleted
 	}
 
 	// Record stats cleanup metrics
@@ -88,44 +185,257 @@ func (s *Service) cleanup() {
 	})
 
 	// 2. Cleanup expired IP addresses (only for active domains)
-	if s.ipTTLDays > 0 {
-		ipsDeleted, err := s.db.DeleteExpiredIPs(s.ipTTLDays)
+	for _, step := range s.ipSteps {
+		if step.days <= 0 {
+			continue
+		}
+		ipsDeleted, err := s.deleteInBatches("ips", func(limit int) (int64, bool, error) {
+			n, err := s.db.DeleteExpiredIPs(step.days, step.scope, limit)
+			return n, n >= int64(limit), err
+		})
 		if err != nil {
-			log.Printf("Error during IP cleanup: %v", err)
-		} else if ipsDeleted > 0 {
-			log.Printf("IP cleanup: deleted %d expired IP addresses", ipsDeleted)
+			log.Printf("Error during IP cleanup (rule %s): %v", step.rule, err)
+		}
+		if ipsDeleted > 0 {
+			log.Printf("IP cleanup (rule %s): deleted %d expired IP addresses", step.rule, ipsDeleted)
 		}
+		deletedRows["ip"] += ipsDeleted
 
 		// Record IP cleanup metrics
 		s.recordMetric(func(m *metrics.Registry) {
 			m.CleanupIPsDeleted.Add(float64(ipsDeleted))
+			m.CleanupRuleDeleted.WithLabelValues(step.rule, "ips").Add(float64(ipsDeleted))
 		})
 	}
 
 	// 3. Cleanup old domains (and their associated IPs)
-	if s.domainTTLDays > 0 {
-		domainsDeleted, domainIPsDeleted, err := s.db.DeleteOldDomains(s.domainTTLDays)
+	for _, step := range s.domainSteps {
+		if step.days <= 0 {
+			continue
+		}
+		var domainIPsDeleted int64
+		domainsDeleted, err := s.deleteInBatches("domains", func(limit int) (int64, bool, error) {
+			domains, ips, err := s.db.DeleteOldDomains(step.days, step.scope, limit)
+			domainIPsDeleted += ips
+			return domains, domains >= int64(limit), err
+		})
 		if err != nil {
-			log.Printf("Error during domain cleanup: %v", err)
-		} else if domainsDeleted > 0 {
-			log.Printf("Domain cleanup: deleted %d domains and %d associated IPs", domainsDeleted, domainIPsDeleted)
+			log.Printf("Error during domain cleanup (rule %s): %v", step.rule, err)
+		}
+		if domainsDeleted > 0 {
+			log.Printf("Domain cleanup (rule %s): deleted %d domains and %d associated IPs", step.rule, domainsDeleted, domainIPsDeleted)
 		}
+		deletedRows["domain"] += domainsDeleted
+		deletedRows["ip"] += domainIPsDeleted
 
 		// Record domain cleanup metrics
 		s.recordMetric(func(m *metrics.Registry) {
 			m.CleanupDomainsDeleted.Add(float64(domainsDeleted))
 			m.CleanupDomainIPsDeleted.Add(float64(domainIPsDeleted))
+			m.CleanupRuleDeleted.WithLabelValues(step.rule, "domains").Add(float64(domainsDeleted))
+			m.CleanupRuleDeleted.WithLabelValues(step.rule, "domain_ips").Add(float64(domainIPsDeleted))
 		})
 	}
 
+	// 4. Cleanup cached PTR names of addresses that no longer exist
+	if s.ptrEnabled {
+		ptrsDeleted, err := s.deleteInBatches("ptrs", func(limit int) (int64, bool, error) {
+			n, err := s.db.DeleteOrphanedPTRs(limit)
+			return n, n >= int64(limit), err
+		})
+		if err != nil {
+			log.Printf("Error during PTR cleanup: %v", err)
+		}
+		if ptrsDeleted > 0 {
+			log.Printf("PTR cleanup: deleted %d orphaned PTR names", ptrsDeleted)
+		}
+		deletedRows["ip_ptr"] += ptrsDeleted
+	}
+
+	// 5. Cleanup old IP change events
+	if s.changeDays > 0 {
+		eventsDeleted, err := s.deleteInBatches("ip_change_events", func(limit int) (int64, bool, error) {
+			n, err := s.db.DeleteOldIPChangeEvents(s.changeDays, limit)
+			return n, n >= int64(limit), err
+		})
+		if err != nil {
+			log.Printf("Error during IP change events cleanup: %v", err)
+		}
+		if eventsDeleted > 0 {
+			log.Printf("IP change events cleanup: deleted %d old events", eventsDeleted)
+		}
+		deletedRows["ip_change_event"] += eventsDeleted
+	}
+
+	// 6. Cleanup expired statistics rollups
+	if s.rollupHourlyDays > 0 && s.rollupDailyDays > 0 {
+		var hourlyDeleted, dailyDeleted int64
+		_, err := s.deleteInBatches("rollups", func(limit int) (int64, bool, error) {
+			hourly, daily, err := s.db.DeleteOldRollups(s.rollupHourlyDays, s.rollupDailyDays, limit)
+			hourlyDeleted += hourly
+			dailyDeleted += daily
+			return hourly + daily, hourly >= int64(limit) || daily >= int64(limit), err
+		})
+		if err != nil {
+			log.Printf("Error during stats rollup cleanup: %v", err)
+		}
+		if hourlyDeleted > 0 || dailyDeleted > 0 {
+			log.Printf("Stats rollup cleanup: deleted %d hourly and %d daily rows", hourlyDeleted, dailyDeleted)
+		}
+		deletedRows["domain_stat_hourly"] += hourlyDeleted
+		deletedRows["domain_stat_daily"] += dailyDeleted
+	}
+
+	// 7. Reclaim the space of large deletes
+	s.vacuumTables(deletedRows)
+
 	// Record cleanup duration
 	s.recordMetric(func(m *metrics.Registry) {
 		m.CleanupDuration.Observe(time.Since(start).Seconds())
 	})
 
+	s.lastRun.Store(time.Now().UnixNano())
 	log.Println("Cleanup completed")
 }
 
+// deleteInBatches runs one batched cleanup step: del deletes at most limit rows and
+// reports whether a full batch was deleted, so more rows may remain. Batches are
+// separated by the configured pause, which keeps replication lag and lock times
+// bounded. Returns the total rows deleted, also when a batch fails.
+func (s *Service) deleteInBatches(step string, del func(limit int) (int64, bool, error)) (int64, error) {
+	var total int64
+	for {
+		if s.stopping() {
+			return total, errStopped
+		}
+
+		start := time.Now()
+		n, more, err := del(s.batchSize)
+		s.recordMetric(func(m *metrics.Registry) {
+			status := "success"
+			if err != nil {
+				status = "error"
+			}
+			m.CleanupBatches.WithLabelValues(step, status).Inc()
+			m.CleanupBatchRows.WithLabelValues(step).Add(float64(n))
+			m.CleanupBatchDuration.WithLabelValues(step).Observe(time.Since(start).Seconds())
+		})
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if !more {
+			return total, nil
+		}
+
+		select {
+		case <-time.After(s.batchPause):
+		case <-s.stopChan:
+			return total, errStopped
+		}
+	}
+}
+
+// vacuumTables runs VACUUM (ANALYZE) on the tables with at least vacuumThreshold
+// rows deleted by this run.
+func (s *Service) vacuumTables(deletedRows map[string]int64) {
+	if s.vacuumThreshold <= 0 || s.stopping() {
+		return
+	}
+
+	tables := make([]string, 0, len(deletedRows))
+	for table, n := range deletedRows {
+		if n >= s.vacuumThreshold {
+			tables = append(tables, table)
+		}
+	}
+	sort.Strings(tables)
+
+	for _, table := range tables {
+		start := time.Now()
+		err := s.db.VacuumAnalyze(table)
+		status := "success"
+		if err != nil {
+			status = "error"
+			log.Printf("Error vacuuming %s: %v", table, err)
+		} else {
+			log.Printf("Vacuumed %s after deleting %d rows in %v", table, deletedRows[table], time.Since(start).Round(time.Millisecond))
+		}
+		s.recordMetric(func(m *metrics.Registry) {
+			m.CleanupVacuums.WithLabelValues(table, status).Inc()
+		})
+	}
+}
+
+// stopping reports whether Stop has been called
+func (s *Service) stopping() bool {
+	select {
+	case <-s.stopChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// deleteRuleStats deletes the statistics of a rule older than its retention. The
+// days before its cutoff are archived first (whole, with the rows of every rule);
+// if archiving fails nothing is deleted until the next run.
+func (s *Service) deleteRuleStats(step retentionStep) int64 {
+	if !s.archiveStats(step.days) {
+		return 0
+	}
+
+	deleted, err := s.deleteInBatches("stats", func(limit int) (int64, bool, error) {
+		n, err := s.db.DeleteOldStats(step.days, step.scope, limit)
+		return n, n >= int64(limit), err
+	})
+	if err != nil {
+		log.Printf("Error during stats cleanup (rule %s): %v", step.rule, err)
+	}
+	if deleted > 0 {
+		log.Printf("Stats cleanup (rule %s): deleted %d records older than %d days", step.rule, deleted, step.days)
+	}
+
+	s.recordMetric(func(m *metrics.Registry) {
+		m.CleanupRuleDeleted.WithLabelValues(step.rule, "stats").Add(float64(deleted))
+	})
+	return deleted
+}
+
+// archiveStats archives the statistics about to be deleted with retentionDays.
+// Returns false if they must be kept because archiving failed.
+func (s *Service) archiveStats(retentionDays int) bool {
+	return s.archiveBefore(database.StatRetentionCutoff(retentionDays, time.Now()))
+}
+
+// archiveBefore archives the statistics of the days before cutoff.
+// Returns false if they must be kept because archiving failed.
+func (s *Service) archiveBefore(cutoff time.Time) bool {
+	if s.archiver == nil {
+		return true
+	}
+
+	days, err := s.archiver.ArchiveBefore(cutoff)
+	if err != nil {
+		log.Printf("Error archiving expired stats, keeping them until the next run: %v", err)
+		return false
+	}
+	if days > 0 {
+		log.Printf("Stats archive: archived %d days", days)
+	}
+	return true
+}
+
+// ensureStatPartitions creates the domain_stat partitions for the coming days.
+func (s *Service) ensureStatPartitions() {
+	created, err := s.db.EnsureStatPartitions(time.Now())
+	if err != nil {
+		log.Printf("Error creating stats partitions: %v", err)
+	} else if created > 0 {
+		log.Printf("Stats partitions: created %d daily partitions", created)
+	}
+}
+
 // recordMetric safely records a metric if metrics are enabled.
 func (s *Service) recordMetric(f func(m *metrics.Registry)) {
 	if s.metrics != nil {
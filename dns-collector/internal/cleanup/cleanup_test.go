@@ -1,10 +1,13 @@
 package cleanup
 
 import (
+	"errors"
 	"testing"
 	"time"
 
 	"dns-collector/internal/config"
+	"dns-collector/internal/database"
+	"dns-collector/internal/metrics"
 )
 
 func TestNewService(t *testing.T) {
@@ -115,3 +118,151 @@ func TestCleanupInterval(t *testing.T) {
 		})
 	}
 }
+
+func TestServiceTrigger(t *testing.T) {
+	cfg := &config.Config{
+		Retention: config.RetentionConfig{
+			StatsDays:            30,
+			CleanupIntervalHours: 24,
+		},
+	}
+
+	service := NewService(cfg, nil, nil)
+
+	if !service.Trigger() {
+		t.Error("Expected first trigger to be accepted")
+	}
+	if service.Trigger() {
+		t.Error("Expected second trigger to be rejected while a run is pending")
+	}
+	if !service.LastRun().IsZero() {
+		t.Errorf("Expected zero LastRun before any run, got %v", service.LastRun())
+	}
+}
+
+// mockArchiver records the cutoff it was called with
+type mockArchiver struct {
+	cutoff time.Time
+	err    error
+}
+
+func (m *mockArchiver) ArchiveBefore(cutoff time.Time) (int, error) {
+	m.cutoff = cutoff
+	return 1, m.err
+}
+
+func TestArchiveStats(t *testing.T) {
+	cfg := &config.Config{
+		Retention: config.RetentionConfig{
+			StatsDays:            30,
+			CleanupIntervalHours: 24,
+		},
+	}
+
+	service := NewService(cfg, nil, nil)
+	if !service.archiveStats(30) {
+		t.Error("Expected stats to be deleted without an archiver")
+	}
+
+	archiver := &mockArchiver{}
+	service.SetArchiver(archiver)
+	if !service.archiveStats(30) {
+		t.Error("Expected stats to be deleted after archiving")
+	}
+	if archiver.cutoff.Hour() != 0 || time.Since(archiver.cutoff) < 30*24*time.Hour {
+		t.Errorf("Expected cutoff at the start of the first kept day, got %v", archiver.cutoff)
+	}
+
+	archiver.err = errors.New("disk full")
+	if service.archiveStats(30) {
+		t.Error("Expected stats to be kept when archiving fails")
+	}
+}
+
+// ruleStatsStore records the rule deletes of statistics
+type ruleStatsStore struct {
+	database.Store
+	deletes int
+}
+
+func (m *ruleStatsStore) DeleteOldStats(retentionDays int, scope database.RetentionScope, limit int) (int64, error) {
+	m.deletes++
+	return 10, nil
+}
+
+func TestDeleteRuleStats(t *testing.T) {
+	cfg := &config.Config{
+		Retention: config.RetentionConfig{StatsDays: 30, DeleteBatchSize: 100},
+	}
+	store := &ruleStatsStore{}
+	service := NewService(cfg, store, nil)
+	archiver := &mockArchiver{}
+	service.SetArchiver(archiver)
+	step := retentionStep{rule: "cdn", days: 3}
+
+	// The days before the rule's cutoff are archived before its rows are deleted
+	if deleted := service.deleteRuleStats(step); deleted != 10 || store.deletes != 1 {
+		t.Errorf("Expected 10 rows deleted in one batch, got %d in %d", deleted, store.deletes)
+	}
+	if expected := database.StatRetentionCutoff(3, time.Now()); !archiver.cutoff.Equal(expected) {
+		t.Errorf("Expected stats archived before %v, got %v", expected, archiver.cutoff)
+	}
+
+	// Nothing is deleted when archiving fails
+	archiver.err = errors.New("disk full")
+	if deleted := service.deleteRuleStats(step); deleted != 0 || store.deletes != 1 {
+		t.Errorf("Expected rule stats kept when archiving fails, got %d rows deleted", deleted)
+	}
+}
+
+func TestDeleteInBatches(t *testing.T) {
+	cfg := &config.Config{
+		Retention: config.RetentionConfig{
+			StatsDays:            30,
+			CleanupIntervalHours: 24,
+			DeleteBatchSize:      100,
+		},
+	}
+
+	service := NewService(cfg, nil, metrics.NewRegistry())
+
+	// Two full batches and a partial one
+	var limits []int
+	remaining := int64(250)
+	total, err := service.deleteInBatches("ips", func(limit int) (int64, bool, error) {
+		limits = append(limits, limit)
+		n := min(remaining, int64(limit))
+		remaining -= n
+		return n, n >= int64(limit), nil
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if total != 250 || len(limits) != 3 || limits[0] != 100 {
+		t.Errorf("Expected 250 rows in 3 batches of 100, got %d rows in %v", total, limits)
+	}
+
+	// A failing batch stops the step, keeping the rows deleted so far
+	calls := 0
+	total, err = service.deleteInBatches("ips", func(limit int) (int64, bool, error) {
+		calls++
+		if calls == 2 {
+			return 0, false, errors.New("lock timeout")
+		}
+		return int64(limit), true, nil
+	})
+	if err == nil || total != 100 || calls != 2 {
+		t.Errorf("Expected error after 100 rows in 2 batches, got %d rows in %d batches (%v)", total, calls, err)
+	}
+
+	// No more batches once the service is stopped
+	close(service.stopChan)
+	calls = 0
+	_, err = service.deleteInBatches("ips", func(limit int) (int64, bool, error) {
+		calls++
+		return int64(limit), true, nil
+	})
+	if !errors.Is(err, errStopped) || calls != 0 {
+		t.Errorf("Expected errStopped without batches, got %v after %d batches", err, calls)
+	}
+}
@@ -0,0 +1,255 @@
+package cleanup
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"dns-collector/internal/config"
+	"dns-collector/internal/database"
+)
+
+// sampleSize is the number of sample domains listed per step and export list
+const sampleSize = 10
+
+// Report is what a cleanup run would delete now, computed by DryRun without
+// modifying data.
+type Report struct {
+	Time        time.Time          `json:"time"`
+	Steps       []StepReport       `json:"steps"`
+	ExportLists []ExportListReport `json:"export_lists"`
+}
+
+// StepReport is what one cleanup step would delete for one retention rule
+type StepReport struct {
+	Step          string   `json:"step"`                     // stat_partitions, stat_budget, stats, ips, domains, ptrs, ip_change_events, rollups_hourly, rollups_daily
+	Rule          string   `json:"rule,omitempty"`           // retention rule (default = rows no rule matches)
+	Days          int      `json:"days,omitempty"`           // retention period applied by the step
+	Rows          int64    `json:"rows"`                     // rows deleted (for domains: the domains)
+	IPs           int64    `json:"ips,omitempty"`            // IP addresses deleted with the domains
+	Domains       int      `json:"domains,omitempty"`        // distinct domains affected
+	SampleDomains []string `json:"sample_domains,omitempty"` // domains losing the most rows
+}
+
+// ExportListReport is what an export list of the web API would lose. With
+// UnappliedFilters the counts ignore those options of the list and are upper bounds.
+type ExportListReport struct {
+	Name             string   `json:"name"`
+	Domains          int      `json:"domains"` // listed domains deleted (lists with include_domains)
+	IPs              int64    `json:"ips"`     // IP addresses of listed domains deleted
+	SampleDomains    []string `json:"sample_domains,omitempty"`
+	UnappliedFilters []string `json:"unapplied_filters,omitempty"`
+}
+
+// DryRun computes what each step of a cleanup run would delete now, per retention
+// rule, and which export lists of the web API (retention.export_lists_config) would
+// lose entries. Nothing is modified. Orphaned PTR names are counted as of now, before
+// the IP deletes that would orphan more of them.
+func (s *Service) DryRun() (*Report, error) {
+	report := &Report{Time: time.Now(), Steps: []StepReport{}, ExportLists: []ExportListReport{}}
+	lostIPs := make(map[string]int64)
+	lostDomains := make(map[string]bool)
+
+	// 1. Statistics: partitions past the longest retention, the oldest ones beyond the
+	// storage budget, then shorter rules
+	partitionDays := maxStatsDays(s.statsSteps)
+	partitionCutoff := database.StatRetentionCutoff(partitionDays, report.Time)
+	counts, err := s.db.PreviewOldStats(time.Time{}, partitionCutoff, database.RetentionScope{})
+	if err != nil {
+		return nil, err
+	}
+	report.Steps = append(report.Steps, domainStep("stat_partitions", "", partitionDays, counts))
+	statsFrom := partitionCutoff
+	if s.maxDBSize > 0 {
+		budgetCutoff, _, err := s.budgetCutoff(report.Time)
+		if err != nil {
+			return nil, err
+		}
+		if budgetCutoff.After(partitionCutoff) {
+			counts, err := s.db.PreviewOldStats(partitionCutoff, budgetCutoff, database.RetentionScope{})
+			if err != nil {
+				return nil, err
+			}
+			report.Steps = append(report.Steps, domainStep("stat_budget", "", 0, counts))
+			statsFrom = budgetCutoff
+		}
+	}
+	for _, step := range s.statsSteps {
+		if step.days <= 0 || step.days >= partitionDays {
+			continue
+		}
+		before := database.StatRetentionCutoff(step.days, report.Time)
+		if !before.After(statsFrom) {
+			continue
+		}
+		counts, err := s.db.PreviewOldStats(statsFrom, before, step.scope)
+		if err != nil {
+			return nil, err
+		}
+		report.Steps = append(report.Steps, domainStep("stats", step.rule, step.days, counts))
+	}
+
+	// 2. Expired IP addresses
+	for _, step := range s.ipSteps {
+		if step.days <= 0 {
+			continue
+		}
+		counts, err := s.db.PreviewExpiredIPs(step.days, step.scope)
+		if err != nil {
+			return nil, err
+		}
+		report.Steps = append(report.Steps, domainStep("ips", step.rule, step.days, counts))
+		for _, c := range counts {
+			lostIPs[c.Domain] += c.Rows
+		}
+	}
+
+	// 3. Old domains and their IP addresses
+	for _, step := range s.domainSteps {
+		if step.days <= 0 {
+			continue
+		}
+		counts, err := s.db.PreviewOldDomains(step.days, step.scope)
+		if err != nil {
+			return nil, err
+		}
+		r := domainStep("domains", step.rule, step.days, counts)
+		r.IPs, r.Rows = r.Rows, int64(len(counts))
+		report.Steps = append(report.Steps, r)
+		for _, c := range counts {
+			lostDomains[c.Domain] = true
+			lostIPs[c.Domain] += c.Rows
+		}
+	}
+
+	// 4. Orphaned PTR names
+	if s.ptrEnabled {
+		n, err := s.db.CountOrphanedPTRs()
+		if err != nil {
+			return nil, err
+		}
+		report.Steps = append(report.Steps, StepReport{Step: "ptrs", Rows: n})
+	}
+
+	// 5. Old IP change events
+	if s.changeDays > 0 {
+		n, err := s.db.CountOldIPChangeEvents(s.changeDays)
+		if err != nil {
+			return nil, err
+		}
+		report.Steps = append(report.Steps, StepReport{Step: "ip_change_events", Days: s.changeDays, Rows: n})
+	}
+
+	// 6. Expired statistics rollups
+	if s.rollupHourlyDays > 0 && s.rollupDailyDays > 0 {
+		hourly, daily, err := s.db.CountOldRollups(s.rollupHourlyDays, s.rollupDailyDays)
+		if err != nil {
+			return nil, err
+		}
+		report.Steps = append(report.Steps,
+			StepReport{Step: "rollups_hourly", Days: s.rollupHourlyDays, Rows: hourly},
+			StepReport{Step: "rollups_daily", Days: s.rollupDailyDays, Rows: daily},
+		)
+	}
+
+	// Export lists losing entries
+	if s.exportLists != "" {
+		lists, err := config.LoadExportLists(s.exportLists)
+		if err != nil {
+			return nil, err
+		}
+		for _, list := range lists {
+			report.ExportLists = append(report.ExportLists, exportListImpact(list, lostDomains, lostIPs))
+		}
+	}
+
+	return report, nil
+}
+
+// domainStep summarizes the per-domain rows a step would delete
+func domainStep(step, rule string, days int, counts []database.DomainCount) StepReport {
+	r := StepReport{Step: step, Rule: rule, Days: days, Domains: len(counts)}
+	for _, c := range counts {
+		r.Rows += c.Rows
+	}
+	r.SampleDomains = topDomains(counts)
+	return r
+}
+
+// exportListImpact returns what an export list would lose with the deleted domains
+// and IP addresses
+func exportListImpact(list config.ExportList, lostDomains map[string]bool, lostIPs map[string]int64) ExportListReport {
+	r := ExportListReport{Name: list.Name, UnappliedFilters: list.UnappliedFilters}
+	var affected []database.DomainCount
+	for domain, ips := range lostIPs {
+		if !list.DomainRegex.MatchString(domain) {
+			continue
+		}
+		lost := false
+		if list.IncludeDomains && lostDomains[domain] {
+			r.Domains++
+			lost = true
+		}
+		if list.IncludeIPs && ips > 0 {
+			r.IPs += ips
+			lost = true
+		}
+		if lost {
+			affected = append(affected, database.DomainCount{Domain: domain, Rows: ips})
+		}
+	}
+	r.SampleDomains = topDomains(affected)
+	return r
+}
+
+// topDomains returns the sampleSize domains with the most rows
+func topDomains(counts []database.DomainCount) []string {
+	sorted := append([]database.DomainCount(nil), counts...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Rows != sorted[j].Rows {
+			return sorted[i].Rows > sorted[j].Rows
+		}
+		return sorted[i].Domain < sorted[j].Domain
+	})
+
+	var domains []string
+	for i := 0; i < len(sorted) && i < sampleSize; i++ {
+		domains = append(domains, sorted[i].Domain)
+	}
+	return domains
+}
+
+// WriteText writes the report as aligned text tables
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tw, "Cleanup dry run at %s\n\n", r.Time.Format(time.RFC3339))
+	_, _ = fmt.Fprintln(tw, "STEP\tRULE\tDAYS\tROWS\tIPS\tDOMAINS\tSAMPLE")
+	for _, s := range r.Steps {
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%d\t%s\n",
+			s.Step, dash(s.Rule), s.Days, s.Rows, s.IPs, s.Domains, dash(strings.Join(s.SampleDomains, ", ")))
+	}
+
+	if len(r.ExportLists) > 0 {
+		approximate := false
+		_, _ = fmt.Fprintln(tw, "\nEXPORT LIST\tDOMAINS\tIPS\tSAMPLE\tNOT APPLIED")
+		for _, l := range r.ExportLists {
+			_, _ = fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\n", l.Name, l.Domains, l.IPs,
+				dash(strings.Join(l.SampleDomains, ", ")), dash(strings.Join(l.UnappliedFilters, ", ")))
+			approximate = approximate || len(l.UnappliedFilters) > 0
+		}
+		if approximate {
+			_, _ = fmt.Fprintln(tw, "\nLists with NOT APPLIED filters are counted without them: their losses are upper bounds.")
+		}
+	}
+	return tw.Flush()
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,126 @@
+package cleanup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"dns-collector/internal/config"
+	"dns-collector/internal/database"
+)
+
+// dryRunStore returns canned previews; any other Store call panics
+type dryRunStore struct {
+	database.Store
+	stats   []database.DomainCount
+	ips     []database.DomainCount
+	domains []database.DomainCount
+}
+
+func (m *dryRunStore) PreviewOldStats(from, before time.Time, scope database.RetentionScope) ([]database.DomainCount, error) {
+	return m.stats, nil
+}
+
+func (m *dryRunStore) PreviewExpiredIPs(ttlDays int, scope database.RetentionScope) ([]database.DomainCount, error) {
+	return m.ips, nil
+}
+
+func (m *dryRunStore) PreviewOldDomains(ttlDays int, scope database.RetentionScope) ([]database.DomainCount, error) {
+	return m.domains, nil
+}
+
+func (m *dryRunStore) CountOrphanedPTRs() (int64, error) { return 4, nil }
+
+func (m *dryRunStore) CountOldIPChangeEvents(days int) (int64, error) { return 5, nil }
+
+func (m *dryRunStore) CountOldRollups(hourlyDays, dailyDays int) (int64, int64, error) {
+	return 6, 7, nil
+}
+
+func TestDryRun(t *testing.T) {
+	webAPIConfig := filepath.Join(t.TempDir(), "web-api.yaml")
+	if err := os.WriteFile(webAPIConfig, []byte(`
+export_lists:
+  - name: "CDN"
+    endpoint: "/export/cdn"
+    domain_regex: "\\.cdn\\.net$"
+    include_domains: true
+  - name: "Example IPv6"
+    endpoint: "/export/example"
+    domain_regex: "example\\.com$"
+    include_ipv4: false
+    include_ipv6: true
+  - name: "Unaffected"
+    endpoint: "/export/other"
+    domain_regex: "^other\\.org$"
+`), 0644); err != nil {
+		t.Fatalf("Failed to write web API config: %v", err)
+	}
+
+	cfg := &config.Config{
+		Retention: config.RetentionConfig{
+			StatsDays:         30,
+			IPTTLDays:         30,
+			DomainTTLDays:     365,
+			ChangeEventsDays:  90,
+			ExportListsConfig: webAPIConfig,
+		},
+	}
+	store := &dryRunStore{
+		stats:   []database.DomainCount{{Domain: "a.example.com", Rows: 10}, {Domain: "b.cdn.net", Rows: 20}},
+		ips:     []database.DomainCount{{Domain: "www.example.com", Rows: 3}},
+		domains: []database.DomainCount{{Domain: "img.cdn.net", Rows: 2}, {Domain: "old.example.com", Rows: 0}},
+	}
+
+	report, err := NewService(cfg, store, nil).DryRun()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	steps := make(map[string]StepReport)
+	for _, step := range report.Steps {
+		steps[step.Step] = step
+	}
+	if s := steps["stat_partitions"]; s.Rows != 30 || s.Domains != 2 || s.SampleDomains[0] != "b.cdn.net" {
+		t.Errorf("Unexpected statistics step: %+v", s)
+	}
+	if s := steps["ips"]; s.Rule != defaultRule || s.Rows != 3 {
+		t.Errorf("Unexpected IP step: %+v", s)
+	}
+	if s := steps["domains"]; s.Rows != 2 || s.IPs != 2 {
+		t.Errorf("Expected 2 domains with 2 IPs, got %+v", s)
+	}
+	if _, ok := steps["ptrs"]; ok {
+		t.Error("Expected no PTR step with PTR lookups disabled")
+	}
+	if s := steps["ip_change_events"]; s.Rows != 5 {
+		t.Errorf("Expected 5 IP change events, got %+v", s)
+	}
+	if _, ok := steps["rollups_hourly"]; ok {
+		t.Error("Expected no rollup steps with rollups disabled")
+	}
+
+	if len(report.ExportLists) != 3 {
+		t.Fatalf("Expected 3 export lists, got %+v", report.ExportLists)
+	}
+	if l := report.ExportLists[0]; l.Domains != 1 || l.IPs != 2 || l.SampleDomains[0] != "img.cdn.net" {
+		t.Errorf("Unexpected CDN list impact: %+v", l)
+	}
+	if l := report.ExportLists[1]; l.Domains != 0 || l.IPs != 3 || len(l.SampleDomains) != 1 || len(l.UnappliedFilters) != 1 {
+		t.Errorf("Expected the IPs of www.example.com only, ignoring include_ipv4, got %+v", l)
+	}
+	if l := report.ExportLists[2]; l.Domains != 0 || l.IPs != 0 {
+		t.Errorf("Expected no loss for the unaffected list, got %+v", l)
+	}
+
+	var out strings.Builder
+	if err := report.WriteText(&out); err != nil {
+		t.Fatalf("Failed to write report: %v", err)
+	}
+	if !strings.Contains(out.String(), "stat_partitions") || !strings.Contains(out.String(), "Unaffected") ||
+		!strings.Contains(out.String(), "upper bounds") {
+		t.Errorf("Unexpected text report:\n%s", out.String())
+	}
+}
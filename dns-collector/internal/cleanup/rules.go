@@ -0,0 +1,89 @@
+package cleanup
+
+import (
+	"slices"
+	"strings"
+
+	"dns-collector/internal/config"
+	"dns-collector/internal/database"
+)
+
+// defaultRule labels the rows no retention rule matches
+const defaultRule = "default"
+
+// retentionStep is one scoped delete of a cleanup step: the rows of a retention
+// rule, or of the global settings, with their retention period
+type retentionStep struct {
+	rule  string
+	scope database.RetentionScope
+	days  int // 0 = keep forever
+}
+
+// retentionSteps evaluates the ordered retention rules for one kind of row: each rule
+// gets the rows it matches that no earlier rule matched, the global period applies to
+// the rest. days returns the period of a rule (0 = the global one, negative = never).
+// Client subnet rules are skipped for domains and IPs, which have no client.
+func retentionSteps(rules []config.RetentionRule, global int, days func(config.RetentionRule) int, withClients bool) []retentionStep {
+	var steps []retentionStep
+	var earlier []database.RetentionMatch
+	for _, rule := range rules {
+		if rule.ClientSubnet != "" && !withClients {
+			continue
+		}
+
+		match := database.RetentionMatch{
+			Suffix: strings.ToLower(strings.TrimSuffix(rule.Suffix, ".")),
+			Regex:  rule.Regex,
+			Subnet: rule.ClientSubnet,
+		}
+		period := days(rule)
+		switch {
+		case period == 0:
+			period = global
+		case period < 0:
+			period = 0
+		}
+
+		steps = append(steps, retentionStep{
+			rule:  rule.Name,
+			scope: database.RetentionScope{Match: &match, Exclude: slices.Clone(earlier)},
+			days:  period,
+		})
+		earlier = append(earlier, match)
+	}
+
+	return append(steps, retentionStep{
+		rule:  defaultRule,
+		scope: database.RetentionScope{Exclude: earlier},
+		days:  global,
+	})
+}
+
+func ruleStatsDays(rule config.RetentionRule) int {
+	return rule.StatsDays
+}
+
+// ruleIPTTLDays and ruleDomainTTLDays keep the domains of pinned rules and their IPs forever
+func ruleIPTTLDays(rule config.RetentionRule) int {
+	if rule.Pinned {
+		return -1
+	}
+	return rule.IPTTLDays
+}
+
+func ruleDomainTTLDays(rule config.RetentionRule) int {
+	if rule.Pinned {
+		return -1
+	}
+	return rule.DomainTTLDays
+}
+
+// maxStatsDays returns the longest statistics retention of the steps: partitions
+// older than it hold no row any rule keeps.
+func maxStatsDays(steps []retentionStep) int {
+	longest := 0
+	for _, step := range steps {
+		longest = max(longest, step.days)
+	}
+	return longest
+}
@@ -0,0 +1,65 @@
+package cleanup
+
+import (
+	"testing"
+
+	"dns-collector/internal/config"
+)
+
+func TestRetentionSteps(t *testing.T) {
+	rules := []config.RetentionRule{
+		{Name: "threats", Regex: `(^|\.)(malware|phish)`, StatsDays: 365},
+		{Name: "cdn", Suffix: "Akamaized.NET.", StatsDays: 3, IPTTLDays: 1},
+		{Name: "servers", ClientSubnet: "10.0.0.0/8", StatsDays: 60},
+		{Name: "pinned", Suffix: "corp.example.com", Pinned: true},
+	}
+
+	stats := retentionSteps(rules, 30, ruleStatsDays, true)
+	if len(stats) != 5 {
+		t.Fatalf("Expected 4 rules and the default, got %d steps", len(stats))
+	}
+	expected := []struct {
+		rule    string
+		days    int
+		exclude int
+	}{
+		{"threats", 365, 0},
+		{"cdn", 3, 1},
+		{"servers", 60, 2},
+		{"pinned", 30, 3},
+		{"default", 30, 4},
+	}
+	for i, e := range expected {
+		step := stats[i]
+		if step.rule != e.rule || step.days != e.days || len(step.scope.Exclude) != e.exclude {
+			t.Errorf("Step %d: expected %s with %d days excluding %d rules, got %s with %d days excluding %d",
+				i, e.rule, e.days, e.exclude, step.rule, step.days, len(step.scope.Exclude))
+		}
+	}
+	if stats[1].scope.Match.Suffix != "akamaized.net" {
+		t.Errorf("Expected normalized suffix, got %q", stats[1].scope.Match.Suffix)
+	}
+	if stats[4].scope.Match != nil {
+		t.Error("Expected the default step to match every row not excluded")
+	}
+	if days := maxStatsDays(stats); days != 365 {
+		t.Errorf("Expected partitions kept for 365 days, got %d", days)
+	}
+
+	// Subnet rules don't apply to IPs; pinned domains keep their IPs forever
+	ips := retentionSteps(rules, 3, ruleIPTTLDays, false)
+	if len(ips) != 4 {
+		t.Fatalf("Expected 3 rules and the default, got %d steps", len(ips))
+	}
+	if ips[0].days != 3 || ips[1].days != 1 || ips[2].rule != "pinned" || ips[2].days != 0 {
+		t.Errorf("Unexpected IP steps %+v", ips)
+	}
+	if len(ips[3].scope.Exclude) != 3 {
+		t.Errorf("Expected the default to exclude 3 rules, got %d", len(ips[3].scope.Exclude))
+	}
+
+	// Without rules the global retention applies to every row
+	if steps := retentionSteps(nil, 30, ruleStatsDays, true); len(steps) != 1 || steps[0].days != 30 || len(steps[0].scope.Exclude) != 0 {
+		t.Errorf("Expected a single default step, got %+v", steps)
+	}
+}
@@ -0,0 +1,237 @@
+package clickhouse
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"dns-collector/internal/config"
+	"dns-collector/internal/metrics"
+)
+
+// timestampFormat is the DateTime64(6) text format; timestamps are written in UTC
+const timestampFormat = "2006-01-02 15:04:05.000000"
+
+// event is one DNS query as inserted with FORMAT JSONEachRow
+type event struct {
+	Timestamp string  `json:"timestamp"`
+	Domain    string  `json:"domain"`
+	ClientIP  *string `json:"client_ip"` // nil for unknown clients
+	QType     string  `json:"qtype"`
+	RType     string  `json:"rtype"`
+}
+
+// Writer batches raw query events into a ClickHouse table over the HTTP interface.
+// WriteQuery only enqueues; a background goroutine inserts a batch once batchSize
+// events are pending or every flush interval. While ClickHouse is unreachable the
+// failed batch is retried on every flush interval and up to maxPending further
+// events are queued; events beyond that are dropped rather than blocking the server.
+type Writer struct {
+	cfg       config.ClickHouseConfig
+	statsDays int
+	metrics   *metrics.Registry
+	client    *http.Client
+	events    chan event
+	stopChan  chan struct{}
+	doneChan  chan struct{}
+	started   bool
+}
+
+func NewWriter(cfg *config.Config, m *metrics.Registry) *Writer {
+	return &Writer{
+		cfg:       cfg.ClickHouse,
+		statsDays: cfg.Retention.StatsDays,
+		metrics:   m,
+		client:    &http.Client{Timeout: time.Duration(cfg.ClickHouse.TimeoutSeconds) * time.Second},
+		events:    make(chan event, cfg.ClickHouse.MaxPending),
+		stopChan:  make(chan struct{}),
+		doneChan:  make(chan struct{}),
+	}
+}
+
+// Start creates the database and table if they don't exist and starts the batching
+func (w *Writer) Start() error {
+	if err := w.exec(fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", w.cfg.Database), nil); err != nil {
+		return fmt.Errorf("failed to create ClickHouse database: %w", err)
+	}
+	if err := w.exec(w.createTableQuery(), nil); err != nil {
+		return fmt.Errorf("failed to create ClickHouse table: %w", err)
+	}
+
+	log.Printf("ClickHouse sink writing to %s.%s at %s (batch: %d, flush: %ds)",
+		w.cfg.Database, w.cfg.Table, w.cfg.URL, w.cfg.BatchSize, w.cfg.FlushSeconds)
+
+	w.started = true
+	go w.run()
+	return nil
+}
+
+// Stop flushes the pending events and stops the writer
+func (w *Writer) Stop() {
+	if !w.started {
+		return
+	}
+
+	log.Println("Stopping ClickHouse sink...")
+	close(w.stopChan)
+	<-w.doneChan
+	log.Println("ClickHouse sink stopped")
+}
+
+// createTableQuery returns the DDL of the events table. Partitions are per day like
+// domain_stat in PostgreSQL; expired days are removed by the table TTL.
+func (w *Writer) createTableQuery() string {
+	query := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s.%s (
+	timestamp DateTime64(6, 'UTC'),
+	domain String,
+	client_ip Nullable(String),
+	qtype LowCardinality(String),
+	rtype LowCardinality(String)
+) ENGINE = MergeTree
+PARTITION BY toDate(timestamp)
+ORDER BY (timestamp, domain)`, w.cfg.Database, w.cfg.Table)
+
+	if w.statsDays > 0 {
+		query += fmt.Sprintf("\nTTL toDate(timestamp) + INTERVAL %d DAY", w.statsDays)
+	}
+	return query
+}
+
+// WriteQuery enqueues a query event. Returns false if the queue is full and the
+// event was dropped.
+func (w *Writer) WriteQuery(domain, clientIP, qtype, rtype string, t time.Time) bool {
+	e := event{
+		Timestamp: t.UTC().Format(timestampFormat),
+		Domain:    domain,
+		QType:     qtype,
+		RType:     rtype,
+	}
+	if net.ParseIP(clientIP) != nil {
+		e.ClientIP = &clientIP
+	}
+
+	select {
+	case w.events <- e:
+		return true
+	default:
+		w.recordMetric(func(m *metrics.Registry) {
+			m.ClickHouseEvents.WithLabelValues("dropped").Inc()
+		})
+		return false
+	}
+}
+
+func (w *Writer) run() {
+	defer close(w.doneChan)
+
+	ticker := time.NewTicker(time.Duration(w.cfg.FlushSeconds) * time.Second)
+	defer ticker.Stop()
+
+	batch := make([]event, 0, w.cfg.BatchSize)
+	for {
+		// A full batch that failed to insert waits for the next tick; meanwhile
+		// new events stay in the queue
+		events := w.events
+		if len(batch) >= w.cfg.BatchSize {
+			events = nil
+		}
+
+		select {
+		case e := <-events:
+			batch = append(batch, e)
+			if len(batch) < w.cfg.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+		case <-w.stopChan:
+			for len(w.events) > 0 {
+				batch = append(batch, <-w.events)
+			}
+			if len(batch) > 0 && !w.flush(batch) {
+				log.Printf("Dropping %d ClickHouse events on shutdown", len(batch))
+			}
+			return
+		}
+
+		if len(batch) > 0 && w.flush(batch) {
+			batch = batch[:0]
+		}
+		w.recordMetric(func(m *metrics.Registry) {
+			m.ClickHousePendingEvents.Set(float64(len(batch) + len(w.events)))
+		})
+	}
+}
+
+// flush inserts a batch of events. Returns false if the insert failed.
+func (w *Writer) flush(batch []event) bool {
+	start := time.Now()
+
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, e := range batch {
+		if err := enc.Encode(e); err != nil {
+			log.Printf("Error encoding ClickHouse event: %v", err)
+			return false
+		}
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s.%s (timestamp, domain, client_ip, qtype, rtype) FORMAT JSONEachRow",
+		w.cfg.Database, w.cfg.Table)
+	err := w.exec(query, &body)
+
+	w.recordMetric(func(m *metrics.Registry) {
+		m.ClickHouseFlushDuration.Observe(time.Since(start).Seconds())
+		if err != nil {
+			m.ClickHouseFlushes.WithLabelValues("error").Inc()
+			return
+		}
+		m.ClickHouseFlushes.WithLabelValues("success").Inc()
+		m.ClickHouseEvents.WithLabelValues("written").Add(float64(len(batch)))
+	})
+	if err != nil {
+		log.Printf("Error inserting %d events into ClickHouse: %v", len(batch), err)
+		return false
+	}
+	return true
+}
+
+// exec runs a statement over the HTTP interface; data (e.g. INSERT rows) is sent
+// as the request body after the query
+func (w *Writer) exec(query string, data io.Reader) error {
+	endpoint := strings.TrimRight(w.cfg.URL, "/") + "/?" + url.Values{"query": {query}}.Encode()
+	req, err := http.NewRequest(http.MethodPost, endpoint, data)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if w.cfg.User != "" {
+		req.Header.Set("X-ClickHouse-User", w.cfg.User)
+		req.Header.Set("X-ClickHouse-Key", w.cfg.Password)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach ClickHouse: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("ClickHouse returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// recordMetric safely records a metric if metrics are enabled.
+func (w *Writer) recordMetric(f func(m *metrics.Registry)) {
+	if w.metrics != nil {
+		f(w.metrics)
+	}
+}
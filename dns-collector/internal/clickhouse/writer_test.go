@@ -0,0 +1,186 @@
+package clickhouse
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"dns-collector/internal/config"
+)
+
+// fakeClickHouse records the statements and rows sent to the HTTP interface
+type fakeClickHouse struct {
+	mu      sync.Mutex
+	queries []string
+	rows    []event
+	fail    bool
+	user    string
+}
+
+func (f *fakeClickHouse) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.user = r.Header.Get("X-ClickHouse-User")
+	if f.fail {
+		http.Error(w, "Code: 210. DB::NetException: Connection refused", http.StatusServiceUnavailable)
+		return
+	}
+
+	query := r.URL.Query().Get("query")
+	f.queries = append(f.queries, query)
+	if strings.HasPrefix(query, "INSERT") {
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var e event
+			if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			f.rows = append(f.rows, e)
+		}
+	} else {
+		_, _ = io.Copy(io.Discard, r.Body)
+	}
+}
+
+func (f *fakeClickHouse) setFail(fail bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fail = fail
+}
+
+func (f *fakeClickHouse) rowCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.rows)
+}
+
+func newTestWriter(t *testing.T, fake *fakeClickHouse, batchSize, maxPending int) *Writer {
+	t.Helper()
+
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	cfg := &config.Config{
+		Retention: config.RetentionConfig{StatsDays: 30},
+		ClickHouse: config.ClickHouseConfig{
+			Enabled:        true,
+			URL:            srv.URL,
+			Database:       "dns_collector",
+			Table:          "domain_stat",
+			User:           "collector",
+			BatchSize:      batchSize,
+			FlushSeconds:   3600,
+			MaxPending:     maxPending,
+			TimeoutSeconds: 5,
+		},
+	}
+	return NewWriter(cfg, nil)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWriter_Start(t *testing.T) {
+	fake := &fakeClickHouse{}
+	w := newTestWriter(t, fake, 10, 100)
+
+	if err := w.Start(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	w.Stop()
+
+	if len(fake.queries) != 2 {
+		t.Fatalf("Expected 2 DDL statements, got %v", fake.queries)
+	}
+	if fake.queries[0] != "CREATE DATABASE IF NOT EXISTS dns_collector" {
+		t.Errorf("Unexpected statement %q", fake.queries[0])
+	}
+	if !strings.Contains(fake.queries[1], "CREATE TABLE IF NOT EXISTS dns_collector.domain_stat") ||
+		!strings.Contains(fake.queries[1], "TTL toDate(timestamp) + INTERVAL 30 DAY") {
+		t.Errorf("Unexpected table DDL %q", fake.queries[1])
+	}
+	if fake.user != "collector" {
+		t.Errorf("Expected user header, got %q", fake.user)
+	}
+
+	fake.setFail(true)
+	if err := newTestWriter(t, fake, 10, 100).Start(); err == nil {
+		t.Error("Expected error when ClickHouse fails")
+	}
+}
+
+func TestWriter_FlushesFullBatch(t *testing.T) {
+	fake := &fakeClickHouse{}
+	w := newTestWriter(t, fake, 2, 100)
+	if err := w.Start(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer w.Stop()
+
+	ts := time.Date(2024, 1, 15, 13, 30, 0, 123456000, time.FixedZone("MSK", 3*3600))
+	w.WriteQuery("example.com", "192.168.1.10", "A", "cache", ts)
+	w.WriteQuery("example.org", "unknown", "AAAA", "forward", ts)
+
+	waitFor(t, func() bool { return fake.rowCount() == 2 })
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if !strings.HasPrefix(fake.queries[2], "INSERT INTO dns_collector.domain_stat") {
+		t.Errorf("Unexpected insert %q", fake.queries[2])
+	}
+	first, second := fake.rows[0], fake.rows[1]
+	if first.Timestamp != "2024-01-15 10:30:00.123456" || first.ClientIP == nil || *first.ClientIP != "192.168.1.10" {
+		t.Errorf("Unexpected first row %+v", first)
+	}
+	if second.ClientIP != nil || second.QType != "AAAA" {
+		t.Errorf("Expected unknown client as null, got %+v", second)
+	}
+}
+
+func TestWriter_RetriesAndFlushesOnStop(t *testing.T) {
+	fake := &fakeClickHouse{}
+	w := newTestWriter(t, fake, 2, 2)
+	if err := w.Start(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	fake.setFail(true)
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		w.WriteQuery("example.com", "10.0.0.1", "A", "cache", now)
+	}
+	// The failed batch is held back, the next events fill the queue
+	waitFor(t, func() bool { return len(w.events) == 0 })
+	time.Sleep(50 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if !w.WriteQuery("example.com", "10.0.0.1", "A", "cache", now) {
+			t.Fatalf("Expected event %d to be queued", i)
+		}
+	}
+	if w.WriteQuery("example.com", "10.0.0.1", "A", "cache", now) {
+		t.Error("Expected event to be dropped when the queue is full")
+	}
+
+	fake.setFail(false)
+	w.Stop()
+
+	if fake.rowCount() != 4 {
+		t.Errorf("Expected 4 rows after stop, got %d", fake.rowCount())
+	}
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ByteSize is a size in bytes, written in YAML as a plain number of bytes or with a
+// binary unit: "512MB", "45GB", "1.5TB" (KB = 1024 bytes).
+type ByteSize int64
+
+// byteUnits are the accepted unit suffixes, longest first
+var byteUnits = []struct {
+	suffix string
+	bytes  float64
+}{
+	{"TIB", 1 << 40}, {"GIB", 1 << 30}, {"MIB", 1 << 20}, {"KIB", 1 << 10},
+	{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+	{"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10},
+	{"B", 1},
+}
+
+// ParseByteSize parses a size such as "45GB"; a number without unit is in bytes.
+func ParseByteSize(s string) (ByteSize, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := 1.0
+	for _, unit := range byteUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.bytes
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q (expected e.g. 512MB or 45GB)", s)
+	}
+	return ByteSize(n * multiplier), nil
+}
+
+// UnmarshalYAML accepts a number of bytes or a size with unit
+func (b *ByteSize) UnmarshalYAML(node *yaml.Node) error {
+	size, err := ParseByteSize(node.Value)
+	if err != nil {
+		return err
+	}
+	*b = size
+	return nil
+}
+
+// String formats the size with the largest unit it reaches, to one decimal
+func (b ByteSize) String() string {
+	for _, unit := range byteUnits[4:8] {
+		if float64(b) >= unit.bytes {
+			return strings.TrimSuffix(strconv.FormatFloat(float64(b)/unit.bytes, 'f', 1, 64), ".0") + unit.suffix
+		}
+	}
+	return strconv.FormatInt(int64(b), 10) + "B"
+}
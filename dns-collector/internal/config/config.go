@@ -2,19 +2,25 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
+	"regexp"
 
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	Server    ServerConfig    `yaml:"server"`
-	Database  DatabaseConfig  `yaml:"database"`
-	Resolver  ResolverConfig  `yaml:"resolver"`
-	Logging   LoggingConfig   `yaml:"logging"`
-	WebAPI    WebAPIConfig    `yaml:"webapi"`
-	Retention RetentionConfig `yaml:"retention"`
-	Metrics   MetricsConfig   `yaml:"metrics"`
+	Server     ServerConfig     `yaml:"server"`
+	Database   DatabaseConfig   `yaml:"database"`
+	Resolver   ResolverConfig   `yaml:"resolver"`
+	Logging    LoggingConfig    `yaml:"logging"`
+	WebAPI     WebAPIConfig     `yaml:"webapi"`
+	Retention  RetentionConfig  `yaml:"retention"`
+	Metrics    MetricsConfig    `yaml:"metrics"`
+	GeoIP      GeoIPConfig      `yaml:"geoip"`
+	Admin      AdminConfig      `yaml:"admin"`
+	Rollup     RollupConfig     `yaml:"rollup"`
+	ClickHouse ClickHouseConfig `yaml:"clickhouse"`
 }
 
 type ServerConfig struct {
@@ -22,21 +28,105 @@ type ServerConfig struct {
 }
 
 type DatabaseConfig struct {
+	Driver   string `yaml:"driver"` // Storage backend: postgres (default) or sqlite
 	Host     string `yaml:"host"`
 	Port     int    `yaml:"port"`
 	User     string `yaml:"user"`
 	Password string `yaml:"password"`
 	Database string `yaml:"database"`
 	SSLMode  string `yaml:"ssl_mode"`
+	Path     string `yaml:"path"` // SQLite database file
 }
 
 type ResolverConfig struct {
-	IntervalSeconds    int  `yaml:"interval_seconds"`
+	IntervalSeconds    int  `yaml:"interval_seconds"` // Minimum interval between resolutions of the same domain
 	MaxResolv          int  `yaml:"max_resolv"`
 	TimeoutSeconds     int  `yaml:"timeout_seconds"`
 	Workers            int  `yaml:"workers"`
 	CyclicResolv       bool `yaml:"cyclic_resolv"`        // Enable cyclic resolution (reset after max_resolv)
 	ResolvCooldownMins int  `yaml:"resolv_cooldown_mins"` // Cooldown between cycles in minutes
+	BackoffBaseSeconds int  `yaml:"backoff_base_seconds"` // Retry delay after the first failed resolution
+	BackoffMaxSeconds  int  `yaml:"backoff_max_seconds"`  // Upper bound for exponential backoff
+	PollSeconds        int  `yaml:"poll_seconds"`         // How often to look for due domains when the queue is drained
+	MaxQPS             int  `yaml:"max_qps"`              // Global cap on upstream DNS queries per second (0 = unlimited)
+	PriorityQueueSize  int  `yaml:"priority_queue_size"`  // Capacity of the lane for newly seen domains
+	PriorityBurst      int  `yaml:"priority_burst"`       // Max consecutive priority domains per worker before a routine one
+	LeaseSeconds       int  `yaml:"lease_seconds"`        // How long a claimed domain stays reserved for this instance
+
+	PriorityWeights PriorityWeightsConfig `yaml:"priority_weights"` // Scheduling score weights
+
+	// Raw upstream queries: EDNS Client Subnet resolution (every domain is additionally
+	// resolved once per site) and DNSSEC status checks
+	Upstream      string         `yaml:"upstream"`       // DNS server for ECS/DNSSEC queries (host:port), defaults to the first resolv.conf nameserver
+	VantagePoints []VantagePoint `yaml:"vantage_points"` // Sites resolved with their client subnet
+	DNSSEC        bool           `yaml:"dnssec"`         // Record DNSSEC status using the AD flag of a validating upstream
+
+	PTR PTRConfig `yaml:"ptr"` // Background reverse DNS lookups of resolved IPs
+
+	Cache CacheConfig `yaml:"cache"` // In-process DNS cache shared by all workers
+
+	Wildcard WildcardConfig `yaml:"wildcard"` // Detection of zones answering every subdomain
+
+	Policies []PolicyRule `yaml:"policies"` // Per-domain resolution rules, the first matching rule applies
+}
+
+// PolicyRule overrides resolution settings for domains matching a suffix or a regex.
+// Rules are applied when a domain is inserted (and re-applied to all domains on startup)
+// and honored by the scheduler and the resolver.
+type PolicyRule struct {
+	Name            string `yaml:"name"`             // Stored with matching domains (max 64 chars)
+	Suffix          string `yaml:"suffix"`           // Matches the domain itself and all its subdomains
+	Regex           string `yaml:"regex"`            // Go regular expression matched against the domain
+	Never           bool   `yaml:"never"`            // Never resolve matching domains
+	IntervalSeconds int    `yaml:"interval_seconds"` // Pinned refresh interval (0 = resolver.interval_seconds)
+	MaxResolv       int    `yaml:"max_resolv"`       // Resolution budget (0 = resolver.max_resolv)
+	Upstream        string `yaml:"upstream"`         // DNS server (host:port) for the domain's A/AAAA lookups
+	IPv4Only        bool   `yaml:"ipv4_only"`        // Skip AAAA lookups
+}
+
+// WildcardConfig controls wildcard zone detection. A parent zone with many children
+// sharing an identical IP set is probed with a random label; if the label resolves,
+// the zone is flagged as wildcard and its children are marked.
+type WildcardConfig struct {
+	Enabled     bool `yaml:"enabled"`
+	MinSiblings int  `yaml:"min_siblings"` // Children with identical IPv4 sets needed to probe a parent zone
+	CheckHours  int  `yaml:"check_hours"`  // How long a probe result is trusted before the zone is probed again
+	PollSeconds int  `yaml:"poll_seconds"` // Pause between detection passes
+	BatchSize   int  `yaml:"batch_size"`   // Zones probed per pass
+	Collapse    bool `yaml:"collapse"`     // Resolve only one child per wildcard zone
+}
+
+// CacheConfig controls the in-process DNS cache in front of the upstream servers.
+// Answers are cached for their TTL, NXDOMAIN and empty answers per RFC 2308
+// (for the SOA minimum); queries with client subnet and DNSSEC checks bypass the cache.
+type CacheConfig struct {
+	Enabled               bool `yaml:"enabled"`
+	MaxEntries            int  `yaml:"max_entries"`              // RRsets and negative answers kept; least recently used are evicted
+	MaxTTLSeconds         int  `yaml:"max_ttl_seconds"`          // Upper bound for cached TTLs
+	MaxNegativeTTLSeconds int  `yaml:"max_negative_ttl_seconds"` // Upper bound for cached NXDOMAIN/NODATA answers
+}
+
+// PTRConfig controls the background PTR resolver that caches reverse DNS names of resolved IPs.
+type PTRConfig struct {
+	Enabled      bool `yaml:"enabled"`
+	RefreshHours int  `yaml:"refresh_hours"` // How long a cached PTR name is considered fresh
+	PollSeconds  int  `yaml:"poll_seconds"`  // Pause between passes when no address is due
+	BatchSize    int  `yaml:"batch_size"`    // Addresses looked up per pass
+	Workers      int  `yaml:"workers"`       // Concurrent PTR lookups
+}
+
+// VantagePoint is a site whose client subnet is sent in the EDNS Client Subnet option
+type VantagePoint struct {
+	Name   string `yaml:"name"`   // Stored with every IP returned for the site (max 64 chars)
+	Subnet string `yaml:"subnet"` // Client subnet in CIDR notation, e.g. 10.20.0.0/24
+}
+
+// PriorityWeightsConfig weights the terms of the resolution scheduling score.
+// Domains with a higher score are resolved first.
+type PriorityWeightsConfig struct {
+	Popularity float64 `yaml:"popularity"` // Number of client queries (log scale)
+	Recency    float64 `yaml:"recency"`    // How recently the domain was queried
+	Staleness  float64 `yaml:"staleness"`  // Time since the last resolution (log scale)
 }
 
 type LoggingConfig struct {
@@ -50,8 +140,55 @@ type WebAPIConfig struct {
 type RetentionConfig struct {
 	StatsDays            int `yaml:"stats_days"`
 	CleanupIntervalHours int `yaml:"cleanup_interval_hours"`
-	IPTTLDays            int `yaml:"ip_ttl_days"`     // TTL for IP addresses in days
-	DomainTTLDays        int `yaml:"domain_ttl_days"` // TTL for domains in days
+	IPTTLDays            int `yaml:"ip_ttl_days"`           // TTL for IP addresses in days
+	DomainTTLDays        int `yaml:"domain_ttl_days"`       // TTL for domains in days
+	ChangeEventsDays     int `yaml:"change_events_days"`    // Retention of IP change events in days
+	RollupHourlyDays     int `yaml:"rollup_hourly_days"`    // Retention of hourly statistics rollups in days
+	RollupDailyDays      int `yaml:"rollup_daily_days"`     // Retention of daily statistics rollups in days
+	DeleteBatchSize      int `yaml:"delete_batch_size"`     // Rows deleted per statement by the cleanup
+	DeleteBatchPauseMs   int `yaml:"delete_batch_pause_ms"` // Pause between delete batches in milliseconds (negative = none)
+	VacuumThreshold      int `yaml:"vacuum_threshold"`      // Deleted rows of a table triggering VACUUM (ANALYZE), 0 = never
+
+	Archive ArchiveConfig `yaml:"archive"`
+
+	// Storage budget of the tables ("45GB"): beyond it the oldest statistics are dropped
+	// regardless of stats_days and rules (0 = no budget)
+	MaxDBSize ByteSize `yaml:"max_db_size"`
+
+	Rules []RetentionRule `yaml:"rules"` // Per-pattern retention, the first matching rule applies
+
+	ExportListsConfig string `yaml:"export_lists_config"` // Web API config whose export lists the dry run checks
+}
+
+// RetentionRule overrides the retention of the domains matching a suffix or a regex
+// and/or the statistics of clients within a subnet. Unset periods fall back to the
+// global settings.
+type RetentionRule struct {
+	Name          string `yaml:"name"`            // Label of the rule's deletion metrics (max 64 chars)
+	Suffix        string `yaml:"suffix"`          // Matches the domain itself and all its subdomains
+	Regex         string `yaml:"regex"`           // Go regular expression matched against the domain
+	ClientSubnet  string `yaml:"client_subnet"`   // Client subnet in CIDR notation (statistics only)
+	StatsDays     int    `yaml:"stats_days"`      // Statistics retention in days (0 = stats_days)
+	IPTTLDays     int    `yaml:"ip_ttl_days"`     // TTL for IP addresses in days (0 = ip_ttl_days, negative = never)
+	DomainTTLDays int    `yaml:"domain_ttl_days"` // TTL for domains in days (0 = domain_ttl_days, negative = never)
+	Pinned        bool   `yaml:"pinned"`          // Never delete matching domains and their IP addresses
+}
+
+// ArchiveConfig controls archiving of expired query statistics: before the cleanup
+// removes a day of domain_stat, its rows are written to a compressed NDJSON file.
+type ArchiveConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	Dir         string `yaml:"dir"`         // Directory of the archive files and their manifest.json
+	Compression string `yaml:"compression"` // gzip (default) or zstd
+}
+
+// GeoIPConfig controls offline ASN and country enrichment of resolved IPs from MMDB files.
+type GeoIPConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	ASNDB       string `yaml:"asn_db"`       // Path to an ASN database (e.g. GeoLite2-ASN.mmdb)
+	CountryDB   string `yaml:"country_db"`   // Path to a country or city database (e.g. GeoLite2-Country.mmdb)
+	PollSeconds int    `yaml:"poll_seconds"` // How often to check the files for changes and annotate new IPs
+	BatchSize   int    `yaml:"batch_size"`   // Addresses annotated per database round trip
 }
 
 type MetricsConfig struct {
@@ -61,6 +198,39 @@ type MetricsConfig struct {
 	InfluxDB InfluxDBConfig `yaml:"influxdb"`
 }
 
+// AdminConfig controls the authenticated HTTP control API of the collector
+// (on-demand resolution, requeue, pause/resume, cleanup trigger, scheduler state).
+type AdminConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Listen  string `yaml:"listen"` // Address to listen on (host:port), defaults to 127.0.0.1:9091
+	Token   string `yaml:"token"`  // Bearer token required on every request
+}
+
+// RollupConfig controls the hourly and daily rollups of query statistics
+// (domain_stat_hourly, domain_stat_daily) maintained from domain_stat.
+type RollupConfig struct {
+	Enabled         bool `yaml:"enabled"`
+	IntervalMinutes int  `yaml:"interval_minutes"` // How often complete hours are rolled up
+	BatchHours      int  `yaml:"batch_hours"`      // Hours of raw statistics aggregated per transaction (backfill)
+}
+
+// ClickHouseConfig controls the optional ClickHouse sink for raw query events. When
+// enabled, events are written to ClickHouse in batches over its HTTP interface instead
+// of domain_stat; domains and IPs stay in the database.
+type ClickHouseConfig struct {
+	Enabled        bool   `yaml:"enabled"`
+	URL            string `yaml:"url"` // HTTP interface, e.g. http://clickhouse:8123
+	Database       string `yaml:"database"`
+	Table          string `yaml:"table"`
+	User           string `yaml:"user"`
+	Password       string `yaml:"password"`
+	BatchSize      int    `yaml:"batch_size"`      // Events per INSERT
+	FlushSeconds   int    `yaml:"flush_seconds"`   // Max time an event waits for its batch
+	MaxPending     int    `yaml:"max_pending"`     // Events kept while ClickHouse is unreachable; older ones are dropped
+	KeepDatabase   bool   `yaml:"keep_database"`   // Also write domain_stat (e.g. for the rollups)
+	TimeoutSeconds int    `yaml:"timeout_seconds"` // HTTP request timeout
+}
+
 type InfluxDBConfig struct {
 	Enabled            bool   `yaml:"enabled"`
 	URL                string `yaml:"url"`
@@ -90,6 +260,18 @@ func Load(path string) (*Config, error) {
 		cfg.Database.SSLMode = envSSLMode
 	}
 
+	// Validate storage backend: PostgreSQL or an embedded SQLite file
+	switch cfg.Database.Driver {
+	case "":
+		cfg.Database.Driver = "postgres"
+	case "postgres", "sqlite":
+	default:
+		return nil, fmt.Errorf("invalid database driver: %s (expected postgres or sqlite)", cfg.Database.Driver)
+	}
+	if cfg.Database.Driver == "sqlite" && cfg.Database.Path == "" {
+		cfg.Database.Path = "data/dns-collector.db"
+	}
+
 	// Validate configuration
 	if cfg.Server.UDPPort <= 0 || cfg.Server.UDPPort > 65535 {
 		return nil, fmt.Errorf("invalid UDP port: %d", cfg.Server.UDPPort)
@@ -143,11 +325,223 @@ func Load(path string) (*Config, error) {
 		return nil, fmt.Errorf("retention domain_ttl_days must not exceed 365 days, got %d", cfg.Retention.DomainTTLDays)
 	}
 
+	// Set default and validate IP change events retention
+	if cfg.Retention.ChangeEventsDays <= 0 {
+		cfg.Retention.ChangeEventsDays = 90 // default 90 days
+	}
+	if cfg.Retention.ChangeEventsDays > 365 {
+		return nil, fmt.Errorf("retention change_events_days must not exceed 365 days, got %d", cfg.Retention.ChangeEventsDays)
+	}
+
+	// Validate rollup retention: rollups are kept much longer than raw statistics
+	if cfg.Retention.RollupHourlyDays <= 0 {
+		cfg.Retention.RollupHourlyDays = 90 // default 90 days
+	}
+	if cfg.Retention.RollupDailyDays <= 0 {
+		cfg.Retention.RollupDailyDays = 730 // default 2 years
+	}
+	if cfg.Retention.RollupDailyDays > 3650 {
+		return nil, fmt.Errorf("retention rollup_daily_days must not exceed 3650 days, got %d", cfg.Retention.RollupDailyDays)
+	}
+	if cfg.Retention.RollupHourlyDays > cfg.Retention.RollupDailyDays {
+		return nil, fmt.Errorf("retention rollup_hourly_days (%d) must not exceed rollup_daily_days (%d)",
+			cfg.Retention.RollupHourlyDays, cfg.Retention.RollupDailyDays)
+	}
+
+	// Validate per-pattern retention rules
+	if err := validateRetentionRules(cfg.Retention.Rules); err != nil {
+		return nil, err
+	}
+
+	// Set defaults and validate cleanup batching
+	if cfg.Retention.DeleteBatchSize <= 0 {
+		cfg.Retention.DeleteBatchSize = 10000
+	}
+	if cfg.Retention.DeleteBatchSize > 1000000 {
+		return nil, fmt.Errorf("retention delete_batch_size must not exceed 1000000, got %d", cfg.Retention.DeleteBatchSize)
+	}
+	if cfg.Retention.DeleteBatchPauseMs == 0 {
+		cfg.Retention.DeleteBatchPauseMs = 100 // default 100ms
+	} else if cfg.Retention.DeleteBatchPauseMs < 0 {
+		cfg.Retention.DeleteBatchPauseMs = 0 // no pause
+	}
+	if cfg.Retention.DeleteBatchPauseMs > 60000 {
+		return nil, fmt.Errorf("retention delete_batch_pause_ms must not exceed 60000, got %d", cfg.Retention.DeleteBatchPauseMs)
+	}
+	if cfg.Retention.VacuumThreshold < 0 {
+		cfg.Retention.VacuumThreshold = 0 // disabled
+	}
+	if cfg.Retention.MaxDBSize > 0 && cfg.Retention.MaxDBSize < 1<<20 {
+		return nil, fmt.Errorf("retention max_db_size must be at least 1MB, got %s", cfg.Retention.MaxDBSize)
+	}
+
+	// Validate statistics archiving
+	if cfg.Retention.Archive.Enabled && cfg.Retention.Archive.Dir == "" {
+		return nil, fmt.Errorf("retention archive requires dir")
+	}
+	switch cfg.Retention.Archive.Compression {
+	case "":
+		cfg.Retention.Archive.Compression = "gzip"
+	case "gzip", "zstd":
+	default:
+		return nil, fmt.Errorf("invalid retention archive compression: %s (expected gzip or zstd)", cfg.Retention.Archive.Compression)
+	}
+
 	// Validate cyclic resolv cooldown
 	if cfg.Resolver.CyclicResolv && cfg.Resolver.ResolvCooldownMins <= 0 {
 		cfg.Resolver.ResolvCooldownMins = 240 // default 4 hours
 	}
 
+	// Validate failure backoff: delay doubles with every consecutive failure up to the max
+	if cfg.Resolver.BackoffBaseSeconds <= 0 {
+		cfg.Resolver.BackoffBaseSeconds = 300 // default 5 minutes
+	}
+	if cfg.Resolver.BackoffMaxSeconds <= 0 {
+		cfg.Resolver.BackoffMaxSeconds = 86400 // default 1 day
+	}
+	if cfg.Resolver.BackoffMaxSeconds < cfg.Resolver.BackoffBaseSeconds {
+		return nil, fmt.Errorf("resolver backoff_max_seconds (%d) must not be less than backoff_base_seconds (%d)",
+			cfg.Resolver.BackoffMaxSeconds, cfg.Resolver.BackoffBaseSeconds)
+	}
+
+	// Validate scheduler settings
+	if cfg.Resolver.PollSeconds <= 0 {
+		cfg.Resolver.PollSeconds = 5 // default 5 seconds
+	}
+	if cfg.Resolver.PollSeconds > cfg.Resolver.IntervalSeconds {
+		cfg.Resolver.PollSeconds = cfg.Resolver.IntervalSeconds
+	}
+	if cfg.Resolver.MaxQPS < 0 {
+		cfg.Resolver.MaxQPS = 0 // unlimited
+	}
+	if cfg.Resolver.PriorityQueueSize <= 0 {
+		cfg.Resolver.PriorityQueueSize = 1000
+	}
+	if cfg.Resolver.PriorityBurst <= 0 {
+		cfg.Resolver.PriorityBurst = 4
+	}
+	if cfg.Resolver.LeaseSeconds <= 0 {
+		cfg.Resolver.LeaseSeconds = 300 // default 5 minutes
+	}
+	// A lease must outlive the lookups of a claimed domain, otherwise another instance may take it over
+	if minLease := cfg.Resolver.TimeoutSeconds * 2; cfg.Resolver.LeaseSeconds < minLease {
+		cfg.Resolver.LeaseSeconds = minLease
+	}
+
+	// Validate scheduling score weights (all zero = equal weights)
+	w := &cfg.Resolver.PriorityWeights
+	if w.Popularity < 0 || w.Recency < 0 || w.Staleness < 0 {
+		return nil, fmt.Errorf("resolver priority_weights must not be negative")
+	}
+	if w.Popularity == 0 && w.Recency == 0 && w.Staleness == 0 {
+		*w = PriorityWeightsConfig{Popularity: 1, Recency: 1, Staleness: 1}
+	}
+
+	// Validate EDNS Client Subnet vantage points
+	if err := validateVantagePoints(cfg.Resolver.VantagePoints); err != nil {
+		return nil, err
+	}
+	if cfg.Resolver.Upstream != "" {
+		if _, _, err := net.SplitHostPort(cfg.Resolver.Upstream); err != nil {
+			cfg.Resolver.Upstream = net.JoinHostPort(cfg.Resolver.Upstream, "53")
+		}
+	}
+
+	// Validate per-domain resolution policies
+	if err := validatePolicies(cfg.Resolver.Policies); err != nil {
+		return nil, err
+	}
+
+	// Set defaults for background PTR lookups
+	if cfg.Resolver.PTR.RefreshHours <= 0 {
+		cfg.Resolver.PTR.RefreshHours = 24 // default 1 day
+	}
+	if cfg.Resolver.PTR.PollSeconds <= 0 {
+		cfg.Resolver.PTR.PollSeconds = 60
+	}
+	if cfg.Resolver.PTR.BatchSize <= 0 {
+		cfg.Resolver.PTR.BatchSize = 100
+	}
+	if cfg.Resolver.PTR.Workers <= 0 {
+		cfg.Resolver.PTR.Workers = 2
+	}
+
+	// Set defaults for the DNS cache
+	if cfg.Resolver.Cache.MaxEntries <= 0 {
+		cfg.Resolver.Cache.MaxEntries = 10000
+	}
+	if cfg.Resolver.Cache.MaxTTLSeconds <= 0 {
+		cfg.Resolver.Cache.MaxTTLSeconds = 3600
+	}
+	if cfg.Resolver.Cache.MaxNegativeTTLSeconds <= 0 {
+		cfg.Resolver.Cache.MaxNegativeTTLSeconds = 300
+	}
+
+	// Set defaults for wildcard zone detection
+	if cfg.Resolver.Wildcard.MinSiblings <= 0 {
+		cfg.Resolver.Wildcard.MinSiblings = 5
+	}
+	if cfg.Resolver.Wildcard.CheckHours <= 0 {
+		cfg.Resolver.Wildcard.CheckHours = 24
+	}
+	if cfg.Resolver.Wildcard.PollSeconds <= 0 {
+		cfg.Resolver.Wildcard.PollSeconds = 300
+	}
+	if cfg.Resolver.Wildcard.BatchSize <= 0 {
+		cfg.Resolver.Wildcard.BatchSize = 50
+	}
+
+	// Validate GeoIP enrichment
+	if cfg.GeoIP.Enabled && cfg.GeoIP.ASNDB == "" && cfg.GeoIP.CountryDB == "" {
+		return nil, fmt.Errorf("geoip requires asn_db or country_db")
+	}
+	if cfg.GeoIP.PollSeconds <= 0 {
+		cfg.GeoIP.PollSeconds = 60
+	}
+	if cfg.GeoIP.BatchSize <= 0 {
+		cfg.GeoIP.BatchSize = 1000
+	}
+
+	// Set defaults for statistics rollups
+	if cfg.Rollup.IntervalMinutes <= 0 {
+		cfg.Rollup.IntervalMinutes = 5
+	}
+	if cfg.Rollup.IntervalMinutes > 60 {
+		return nil, fmt.Errorf("rollup interval_minutes must not exceed 60 minutes, got %d", cfg.Rollup.IntervalMinutes)
+	}
+	if cfg.Rollup.BatchHours <= 0 {
+		cfg.Rollup.BatchHours = 24
+	}
+
+	// Set defaults for the ClickHouse sink
+	if envPassword := os.Getenv("CLICKHOUSE_PASSWORD"); envPassword != "" {
+		cfg.ClickHouse.Password = envPassword
+	}
+	if cfg.ClickHouse.Enabled && cfg.ClickHouse.URL == "" {
+		return nil, fmt.Errorf("clickhouse requires url")
+	}
+	if cfg.ClickHouse.Database == "" {
+		cfg.ClickHouse.Database = "dns_collector"
+	}
+	if cfg.ClickHouse.Table == "" {
+		cfg.ClickHouse.Table = "domain_stat"
+	}
+	if !identifierRe.MatchString(cfg.ClickHouse.Database) || !identifierRe.MatchString(cfg.ClickHouse.Table) {
+		return nil, fmt.Errorf("invalid clickhouse database or table name: %s.%s", cfg.ClickHouse.Database, cfg.ClickHouse.Table)
+	}
+	if cfg.ClickHouse.BatchSize <= 0 {
+		cfg.ClickHouse.BatchSize = 10000
+	}
+	if cfg.ClickHouse.FlushSeconds <= 0 {
+		cfg.ClickHouse.FlushSeconds = 5
+	}
+	if cfg.ClickHouse.MaxPending < cfg.ClickHouse.BatchSize {
+		cfg.ClickHouse.MaxPending = cfg.ClickHouse.BatchSize * 10
+	}
+	if cfg.ClickHouse.TimeoutSeconds <= 0 {
+		cfg.ClickHouse.TimeoutSeconds = 30
+	}
+
 	// Set defaults for metrics configuration
 	if cfg.Metrics.Port <= 0 || cfg.Metrics.Port > 65535 {
 		cfg.Metrics.Port = 9090 // default metrics port
@@ -164,5 +558,132 @@ func Load(path string) (*Config, error) {
 		cfg.Metrics.InfluxDB.Token = envToken
 	}
 
+	// Set defaults for the admin API
+	if envToken := os.Getenv("ADMIN_TOKEN"); envToken != "" {
+		cfg.Admin.Token = envToken
+	}
+	if cfg.Admin.Listen == "" {
+		cfg.Admin.Listen = "127.0.0.1:9091"
+	}
+	if cfg.Admin.Enabled {
+		if _, _, err := net.SplitHostPort(cfg.Admin.Listen); err != nil {
+			return nil, fmt.Errorf("invalid admin listen address %q: %w", cfg.Admin.Listen, err)
+		}
+		if len(cfg.Admin.Token) < 16 {
+			return nil, fmt.Errorf("admin API requires a token of at least 16 characters")
+		}
+	}
+
 	return &cfg, nil
 }
+
+// identifierRe matches plain SQL identifiers (ClickHouse database and table names)
+var identifierRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// validateVantagePoints checks that vantage point names are unique and subnets are valid CIDRs
+func validateVantagePoints(points []VantagePoint) error {
+	names := make(map[string]bool)
+	for i, vp := range points {
+		if vp.Name == "" {
+			return fmt.Errorf("resolver vantage point at index %d: name is required", i)
+		}
+		if len(vp.Name) > 64 {
+			return fmt.Errorf("resolver vantage point '%s': name too long (max 64 characters)", vp.Name)
+		}
+		if names[vp.Name] {
+			return fmt.Errorf("resolver vantage point '%s': duplicate name", vp.Name)
+		}
+		names[vp.Name] = true
+
+		if _, _, err := net.ParseCIDR(vp.Subnet); err != nil {
+			return fmt.Errorf("resolver vantage point '%s': invalid subnet %q: %w", vp.Name, vp.Subnet, err)
+		}
+	}
+	return nil
+}
+
+func validateRetentionRules(rules []RetentionRule) error {
+	names := make(map[string]bool)
+	for i, rule := range rules {
+		if rule.Name == "" {
+			return fmt.Errorf("retention rule at index %d: name is required", i)
+		}
+		if len(rule.Name) > 64 {
+			return fmt.Errorf("retention rule '%s': name too long (max 64 characters)", rule.Name)
+		}
+		if rule.Name == "default" {
+			return fmt.Errorf("retention rule 'default': name is reserved for rows no rule matches")
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("retention rule '%s': duplicate name", rule.Name)
+		}
+		names[rule.Name] = true
+
+		if rule.Suffix != "" && rule.Regex != "" {
+			return fmt.Errorf("retention rule '%s': only one of suffix or regex is allowed", rule.Name)
+		}
+		if rule.Suffix == "" && rule.Regex == "" && rule.ClientSubnet == "" {
+			return fmt.Errorf("retention rule '%s': suffix, regex or client_subnet is required", rule.Name)
+		}
+		if rule.Regex != "" {
+			if _, err := regexp.Compile(rule.Regex); err != nil {
+				return fmt.Errorf("retention rule '%s': invalid regex: %w", rule.Name, err)
+			}
+		}
+		if rule.ClientSubnet != "" {
+			if _, _, err := net.ParseCIDR(rule.ClientSubnet); err != nil {
+				return fmt.Errorf("retention rule '%s': invalid client_subnet %q: %w", rule.Name, rule.ClientSubnet, err)
+			}
+			// Domains and IPs have no client: a subnet rule only applies to statistics
+			if rule.IPTTLDays != 0 || rule.DomainTTLDays != 0 || rule.Pinned {
+				return fmt.Errorf("retention rule '%s': client_subnet rules only set stats_days", rule.Name)
+			}
+		}
+
+		if rule.StatsDays < 0 || rule.StatsDays > 365 {
+			return fmt.Errorf("retention rule '%s': stats_days must be between 0 and 365, got %d", rule.Name, rule.StatsDays)
+		}
+		if rule.IPTTLDays > 90 {
+			return fmt.Errorf("retention rule '%s': ip_ttl_days must not exceed 90 days, got %d", rule.Name, rule.IPTTLDays)
+		}
+		if rule.DomainTTLDays > 365 {
+			return fmt.Errorf("retention rule '%s': domain_ttl_days must not exceed 365 days, got %d", rule.Name, rule.DomainTTLDays)
+		}
+	}
+	return nil
+}
+
+func validatePolicies(rules []PolicyRule) error {
+	names := make(map[string]bool)
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Name == "" {
+			return fmt.Errorf("resolver policy at index %d: name is required", i)
+		}
+		if len(rule.Name) > 64 {
+			return fmt.Errorf("resolver policy '%s': name too long (max 64 characters)", rule.Name)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("resolver policy '%s': duplicate name", rule.Name)
+		}
+		names[rule.Name] = true
+
+		if (rule.Suffix == "") == (rule.Regex == "") {
+			return fmt.Errorf("resolver policy '%s': exactly one of suffix or regex is required", rule.Name)
+		}
+		if rule.Regex != "" {
+			if _, err := regexp.Compile(rule.Regex); err != nil {
+				return fmt.Errorf("resolver policy '%s': invalid regex: %w", rule.Name, err)
+			}
+		}
+		if rule.IntervalSeconds < 0 || rule.MaxResolv < 0 {
+			return fmt.Errorf("resolver policy '%s': interval_seconds and max_resolv must not be negative", rule.Name)
+		}
+		if rule.Upstream != "" {
+			if _, _, err := net.SplitHostPort(rule.Upstream); err != nil {
+				rule.Upstream = net.JoinHostPort(rule.Upstream, "53")
+			}
+		}
+	}
+	return nil
+}
@@ -325,6 +325,11 @@ logging:
 	if cfg.Retention.StatsDays != 30 {
 		t.Errorf("Expected default Retention.StatsDays=30, got %d", cfg.Retention.StatsDays)
 	}
+
+	// Check default IP change events retention is 90 days
+	if cfg.Retention.ChangeEventsDays != 90 {
+		t.Errorf("Expected default Retention.ChangeEventsDays=90, got %d", cfg.Retention.ChangeEventsDays)
+	}
 }
 
 func TestLoad_RetentionConfig(t *testing.T) {
@@ -559,3 +564,1099 @@ retention:
 		})
 	}
 }
+
+func TestLoad_BackoffValidation(t *testing.T) {
+	tests := []struct {
+		name         string
+		backoff      string
+		expectError  bool
+		expectedBase int
+		expectedMax  int
+	}{
+		{"defaults", "", false, 300, 86400},
+		{"custom values", "  backoff_base_seconds: 60\n  backoff_max_seconds: 3600\n", false, 60, 3600},
+		{"default max on zero", "  backoff_base_seconds: 60\n  backoff_max_seconds: 0\n", false, 60, 86400},
+		{"invalid max below base", "  backoff_base_seconds: 600\n  backoff_max_seconds: 60\n", true, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+
+			configContent := `server:
+  udp_port: 5353
+database:
+  host: "localhost"
+  port: 5432
+  user: "test"
+  password: "test"
+  database: "test"
+  ssl_mode: "disable"
+resolver:
+  interval_seconds: 10
+  max_resolv: 5
+  timeout_seconds: 5
+` + tt.backoff + `logging:
+  level: "info"
+`
+
+			if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to create test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.expectError && err == nil {
+				t.Error("Expected error but got nil")
+			}
+			if !tt.expectError && err != nil {
+				t.Fatalf("Expected no error but got: %v", err)
+			}
+			if tt.expectError {
+				return
+			}
+			if cfg.Resolver.BackoffBaseSeconds != tt.expectedBase {
+				t.Errorf("Expected BackoffBaseSeconds=%d, got %d", tt.expectedBase, cfg.Resolver.BackoffBaseSeconds)
+			}
+			if cfg.Resolver.BackoffMaxSeconds != tt.expectedMax {
+				t.Errorf("Expected BackoffMaxSeconds=%d, got %d", tt.expectedMax, cfg.Resolver.BackoffMaxSeconds)
+			}
+		})
+	}
+}
+
+func TestLoad_SchedulerDefaults(t *testing.T) {
+	tests := []struct {
+		name         string
+		resolver     string
+		expectedPoll int
+		expectedQPS  int
+	}{
+		{"defaults", "  interval_seconds: 300\n", 5, 0},
+		{"custom values", "  interval_seconds: 300\n  poll_seconds: 2\n  max_qps: 50\n", 2, 50},
+		{"poll capped by interval", "  interval_seconds: 3\n  poll_seconds: 10\n", 3, 0},
+		{"negative qps disables limit", "  interval_seconds: 300\n  max_qps: -1\n", 5, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+
+			configContent := `server:
+  udp_port: 5353
+database:
+  host: "localhost"
+  port: 5432
+  user: "test"
+  password: "test"
+  database: "test"
+  ssl_mode: "disable"
+resolver:
+  max_resolv: 5
+  timeout_seconds: 5
+` + tt.resolver
+
+			if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to create test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if err != nil {
+				t.Fatalf("Expected no error but got: %v", err)
+			}
+			if cfg.Resolver.PollSeconds != tt.expectedPoll {
+				t.Errorf("Expected PollSeconds=%d, got %d", tt.expectedPoll, cfg.Resolver.PollSeconds)
+			}
+			if cfg.Resolver.MaxQPS != tt.expectedQPS {
+				t.Errorf("Expected MaxQPS=%d, got %d", tt.expectedQPS, cfg.Resolver.MaxQPS)
+			}
+		})
+	}
+}
+
+func TestLoad_LeaseSeconds(t *testing.T) {
+	tests := []struct {
+		name          string
+		resolver      string
+		expectedLease int
+	}{
+		{"default", "", 300},
+		{"custom value", "  lease_seconds: 120\n", 120},
+		{"raised to cover lookups", "  lease_seconds: 4\n", 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+
+			configContent := `server:
+  udp_port: 5353
+database:
+  host: "localhost"
+  port: 5432
+  user: "test"
+  password: "test"
+  database: "test"
+  ssl_mode: "disable"
+resolver:
+  interval_seconds: 300
+  max_resolv: 5
+  timeout_seconds: 5
+` + tt.resolver
+
+			if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to create test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if err != nil {
+				t.Fatalf("Expected no error but got: %v", err)
+			}
+			if cfg.Resolver.LeaseSeconds != tt.expectedLease {
+				t.Errorf("Expected LeaseSeconds=%d, got %d", tt.expectedLease, cfg.Resolver.LeaseSeconds)
+			}
+		})
+	}
+}
+
+func TestLoad_PriorityWeights(t *testing.T) {
+	tests := []struct {
+		name        string
+		resolver    string
+		expectError bool
+		expected    PriorityWeightsConfig
+	}{
+		{"defaults", "", false, PriorityWeightsConfig{Popularity: 1, Recency: 1, Staleness: 1}},
+		{"custom weights", "  priority_weights:\n    popularity: 2\n    recency: 0.5\n", false, PriorityWeightsConfig{Popularity: 2, Recency: 0.5}},
+		{"negative weight", "  priority_weights:\n    staleness: -1\n", true, PriorityWeightsConfig{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+
+			configContent := `server:
+  udp_port: 5353
+database:
+  host: "localhost"
+  port: 5432
+  user: "test"
+  password: "test"
+  database: "test"
+  ssl_mode: "disable"
+resolver:
+  interval_seconds: 300
+  max_resolv: 5
+  timeout_seconds: 5
+` + tt.resolver
+
+			if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to create test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error but got: %v", err)
+			}
+			if cfg.Resolver.PriorityWeights != tt.expected {
+				t.Errorf("Expected PriorityWeights=%+v, got %+v", tt.expected, cfg.Resolver.PriorityWeights)
+			}
+		})
+	}
+}
+
+func TestLoad_VantagePoints(t *testing.T) {
+	tests := []struct {
+		name             string
+		resolver         string
+		expectError      bool
+		expectedUpstream string
+		expectedPoints   int
+	}{
+		{"no vantage points", "", false, "", 0},
+		{"valid vantage points", "  upstream: \"10.0.0.53\"\n  vantage_points:\n    - name: msk\n      subnet: 10.1.0.0/24\n    - name: spb\n      subnet: 2001:db8::/56\n", false, "10.0.0.53:53", 2},
+		{"upstream with port", "  upstream: \"10.0.0.53:5353\"\n", false, "10.0.0.53:5353", 0},
+		{"missing name", "  vantage_points:\n    - subnet: 10.1.0.0/24\n", true, "", 0},
+		{"duplicate name", "  vantage_points:\n    - name: msk\n      subnet: 10.1.0.0/24\n    - name: msk\n      subnet: 10.2.0.0/24\n", true, "", 0},
+		{"invalid subnet", "  vantage_points:\n    - name: msk\n      subnet: 10.1.0.0\n", true, "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+
+			configContent := `server:
+  udp_port: 5353
+database:
+  host: "localhost"
+  port: 5432
+  user: "test"
+  password: "test"
+  database: "test"
+  ssl_mode: "disable"
+resolver:
+  interval_seconds: 300
+  max_resolv: 5
+  timeout_seconds: 5
+` + tt.resolver
+
+			if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to create test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error but got: %v", err)
+			}
+			if cfg.Resolver.Upstream != tt.expectedUpstream {
+				t.Errorf("Expected Upstream=%q, got %q", tt.expectedUpstream, cfg.Resolver.Upstream)
+			}
+			if len(cfg.Resolver.VantagePoints) != tt.expectedPoints {
+				t.Errorf("Expected %d vantage points, got %d", tt.expectedPoints, len(cfg.Resolver.VantagePoints))
+			}
+		})
+	}
+}
+
+func TestLoad_PriorityLaneDefaults(t *testing.T) {
+	tests := []struct {
+		name          string
+		resolver      string
+		expectedSize  int
+		expectedBurst int
+	}{
+		{"defaults", "", 1000, 4},
+		{"custom values", "  priority_queue_size: 50\n  priority_burst: 2\n", 50, 2},
+		{"invalid values use defaults", "  priority_queue_size: -1\n  priority_burst: 0\n", 1000, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+
+			configContent := `server:
+  udp_port: 5353
+database:
+  host: "localhost"
+  port: 5432
+  user: "test"
+  password: "test"
+  database: "test"
+  ssl_mode: "disable"
+resolver:
+  interval_seconds: 300
+  max_resolv: 5
+  timeout_seconds: 5
+` + tt.resolver
+
+			if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to create test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if err != nil {
+				t.Fatalf("Expected no error but got: %v", err)
+			}
+			if cfg.Resolver.PriorityQueueSize != tt.expectedSize {
+				t.Errorf("Expected PriorityQueueSize=%d, got %d", tt.expectedSize, cfg.Resolver.PriorityQueueSize)
+			}
+			if cfg.Resolver.PriorityBurst != tt.expectedBurst {
+				t.Errorf("Expected PriorityBurst=%d, got %d", tt.expectedBurst, cfg.Resolver.PriorityBurst)
+			}
+		})
+	}
+}
+
+func TestLoad_PTRDefaults(t *testing.T) {
+	tests := []struct {
+		name            string
+		ptr             string
+		expectedRefresh int
+		expectedBatch   int
+		expectedWorkers int
+	}{
+		{"defaults", "", 24, 100, 2},
+		{"custom values", "  ptr:\n    enabled: true\n    refresh_hours: 168\n    batch_size: 500\n    workers: 8\n", 168, 500, 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+
+			configContent := `server:
+  udp_port: 5353
+database:
+  host: "localhost"
+  port: 5432
+  user: "test"
+  password: "test"
+  database: "test"
+  ssl_mode: "disable"
+resolver:
+  interval_seconds: 300
+  max_resolv: 5
+  timeout_seconds: 5
+` + tt.ptr
+
+			if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to create test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if err != nil {
+				t.Fatalf("Expected no error but got: %v", err)
+			}
+			if cfg.Resolver.PTR.RefreshHours != tt.expectedRefresh {
+				t.Errorf("Expected RefreshHours=%d, got %d", tt.expectedRefresh, cfg.Resolver.PTR.RefreshHours)
+			}
+			if cfg.Resolver.PTR.BatchSize != tt.expectedBatch {
+				t.Errorf("Expected BatchSize=%d, got %d", tt.expectedBatch, cfg.Resolver.PTR.BatchSize)
+			}
+			if cfg.Resolver.PTR.Workers != tt.expectedWorkers {
+				t.Errorf("Expected Workers=%d, got %d", tt.expectedWorkers, cfg.Resolver.PTR.Workers)
+			}
+			if cfg.Resolver.PTR.PollSeconds != 60 {
+				t.Errorf("Expected PollSeconds=60, got %d", cfg.Resolver.PTR.PollSeconds)
+			}
+		})
+	}
+}
+
+func TestLoad_CacheDefaults(t *testing.T) {
+	tests := []struct {
+		name            string
+		cache           string
+		expectedEntries int
+		expectedTTL     int
+		expectedNegTTL  int
+	}{
+		{"defaults", "", 10000, 3600, 300},
+		{"custom values", "  cache:\n    enabled: true\n    max_entries: 50000\n    max_ttl_seconds: 600\n    max_negative_ttl_seconds: 60\n", 50000, 600, 60},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+
+			configContent := `server:
+  udp_port: 5353
+database:
+  host: "localhost"
+  port: 5432
+  user: "test"
+  password: "test"
+  database: "test"
+  ssl_mode: "disable"
+resolver:
+  interval_seconds: 300
+  max_resolv: 5
+  timeout_seconds: 5
+` + tt.cache
+
+			if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to create test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if err != nil {
+				t.Fatalf("Expected no error but got: %v", err)
+			}
+			if cfg.Resolver.Cache.MaxEntries != tt.expectedEntries {
+				t.Errorf("Expected MaxEntries=%d, got %d", tt.expectedEntries, cfg.Resolver.Cache.MaxEntries)
+			}
+			if cfg.Resolver.Cache.MaxTTLSeconds != tt.expectedTTL {
+				t.Errorf("Expected MaxTTLSeconds=%d, got %d", tt.expectedTTL, cfg.Resolver.Cache.MaxTTLSeconds)
+			}
+			if cfg.Resolver.Cache.MaxNegativeTTLSeconds != tt.expectedNegTTL {
+				t.Errorf("Expected MaxNegativeTTLSeconds=%d, got %d", tt.expectedNegTTL, cfg.Resolver.Cache.MaxNegativeTTLSeconds)
+			}
+		})
+	}
+}
+
+func TestLoad_GeoIP(t *testing.T) {
+	tests := []struct {
+		name        string
+		geoip       string
+		expectError bool
+	}{
+		{"disabled", "", false},
+		{"asn only", "geoip:\n  enabled: true\n  asn_db: /data/GeoLite2-ASN.mmdb\n", false},
+		{"both databases", "geoip:\n  enabled: true\n  asn_db: /data/asn.mmdb\n  country_db: /data/country.mmdb\n", false},
+		{"no databases", "geoip:\n  enabled: true\n", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+
+			configContent := `server:
+  udp_port: 5353
+database:
+  host: "localhost"
+  port: 5432
+  user: "test"
+  password: "test"
+  database: "test"
+  ssl_mode: "disable"
+resolver:
+  interval_seconds: 300
+  max_resolv: 5
+  timeout_seconds: 5
+` + tt.geoip
+
+			if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to create test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error but got: %v", err)
+			}
+			if cfg.GeoIP.PollSeconds != 60 {
+				t.Errorf("Expected PollSeconds=60, got %d", cfg.GeoIP.PollSeconds)
+			}
+			if cfg.GeoIP.BatchSize != 1000 {
+				t.Errorf("Expected BatchSize=1000, got %d", cfg.GeoIP.BatchSize)
+			}
+		})
+	}
+}
+
+func TestLoad_WildcardDefaults(t *testing.T) {
+	tests := []struct {
+		name                string
+		wildcard            string
+		expectedMinSiblings int
+		expectedCheckHours  int
+		expectedCollapse    bool
+	}{
+		{"defaults", "", 5, 24, false},
+		{"custom values", "  wildcard:\n    enabled: true\n    min_siblings: 20\n    check_hours: 72\n    collapse: true\n", 20, 72, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+
+			configContent := `server:
+  udp_port: 5353
+database:
+  host: "localhost"
+  port: 5432
+  user: "test"
+  password: "test"
+  database: "test"
+  ssl_mode: "disable"
+resolver:
+  interval_seconds: 300
+  max_resolv: 5
+  timeout_seconds: 5
+` + tt.wildcard
+
+			if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to create test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if err != nil {
+				t.Fatalf("Expected no error but got: %v", err)
+			}
+			if cfg.Resolver.Wildcard.MinSiblings != tt.expectedMinSiblings {
+				t.Errorf("Expected MinSiblings=%d, got %d", tt.expectedMinSiblings, cfg.Resolver.Wildcard.MinSiblings)
+			}
+			if cfg.Resolver.Wildcard.CheckHours != tt.expectedCheckHours {
+				t.Errorf("Expected CheckHours=%d, got %d", tt.expectedCheckHours, cfg.Resolver.Wildcard.CheckHours)
+			}
+			if cfg.Resolver.Wildcard.Collapse != tt.expectedCollapse {
+				t.Errorf("Expected Collapse=%v, got %v", tt.expectedCollapse, cfg.Resolver.Wildcard.Collapse)
+			}
+			if cfg.Resolver.Wildcard.PollSeconds != 300 || cfg.Resolver.Wildcard.BatchSize != 50 {
+				t.Errorf("Expected PollSeconds=300 and BatchSize=50, got %d and %d",
+					cfg.Resolver.Wildcard.PollSeconds, cfg.Resolver.Wildcard.BatchSize)
+			}
+		})
+	}
+}
+
+func TestLoad_Policies(t *testing.T) {
+	tests := []struct {
+		name        string
+		policies    string
+		expectError bool
+	}{
+		{"no policies", "", false},
+		{"suffix and regex", "  policies:\n    - name: corp\n      suffix: corp.local\n      never: true\n    - name: banking\n      regex: \"\\\\.bank\\\\.\"\n      interval_seconds: 60\n      upstream: 10.0.0.53\n      ipv4_only: true\n", false},
+		{"missing name", "  policies:\n    - suffix: corp.local\n", true},
+		{"duplicate name", "  policies:\n    - name: a\n      suffix: a.local\n    - name: a\n      suffix: b.local\n", true},
+		{"suffix and regex together", "  policies:\n    - name: a\n      suffix: a.local\n      regex: a\n", true},
+		{"no matcher", "  policies:\n    - name: a\n      never: true\n", true},
+		{"invalid regex", "  policies:\n    - name: a\n      regex: \"(\"\n", true},
+		{"negative interval", "  policies:\n    - name: a\n      suffix: a.local\n      interval_seconds: -1\n", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+
+			configContent := `server:
+  udp_port: 5353
+database:
+  host: "localhost"
+  port: 5432
+  user: "test"
+  password: "test"
+  database: "test"
+  ssl_mode: "disable"
+resolver:
+  interval_seconds: 300
+  max_resolv: 5
+  timeout_seconds: 5
+` + tt.policies
+
+			if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to create test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error but got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error but got: %v", err)
+			}
+			if tt.name == "suffix and regex" {
+				banking := cfg.Resolver.Policies[1]
+				if banking.Upstream != "10.0.0.53:53" {
+					t.Errorf("Expected upstream with default port, got %s", banking.Upstream)
+				}
+				if banking.Regex != "\\.bank\\." || !banking.IPv4Only || banking.IntervalSeconds != 60 {
+					t.Errorf("Unexpected policy: %+v", banking)
+				}
+			}
+		})
+	}
+}
+
+func TestLoad_Admin(t *testing.T) {
+	tests := []struct {
+		name        string
+		admin       string
+		expectError bool
+	}{
+		{"disabled", "", false},
+		{"enabled", "admin:\n  enabled: true\n  token: \"0123456789abcdef\"\n", false},
+		{"missing token", "admin:\n  enabled: true\n", true},
+		{"short token", "admin:\n  enabled: true\n  token: \"secret\"\n", true},
+		{"bad listen", "admin:\n  enabled: true\n  listen: \"9091\"\n  token: \"0123456789abcdef\"\n", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+
+			configContent := `server:
+  udp_port: 5353
+database:
+  host: "localhost"
+  port: 5432
+  user: "test"
+  password: "test"
+  database: "test"
+  ssl_mode: "disable"
+resolver:
+  interval_seconds: 300
+  max_resolv: 5
+  timeout_seconds: 5
+` + tt.admin
+
+			if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to create test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error but got: %v", err)
+			}
+			if cfg.Admin.Listen != "127.0.0.1:9091" {
+				t.Errorf("Expected Listen=127.0.0.1:9091, got %s", cfg.Admin.Listen)
+			}
+		})
+	}
+}
+
+func TestLoad_Rollup(t *testing.T) {
+	tests := []struct {
+		name        string
+		extra       string
+		hourlyDays  int
+		dailyDays   int
+		expectError bool
+	}{
+		{"defaults", "", 90, 730, false},
+		{"custom retention", "retention:\n  rollup_hourly_days: 30\n  rollup_daily_days: 365\n", 30, 365, false},
+		{"hourly longer than daily", "retention:\n  rollup_hourly_days: 400\n  rollup_daily_days: 365\n", 0, 0, true},
+		{"daily too long", "retention:\n  rollup_daily_days: 5000\n", 0, 0, true},
+		{"interval too long", "rollup:\n  enabled: true\n  interval_minutes: 120\n", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+
+			configContent := `server:
+  udp_port: 5353
+database:
+  host: "localhost"
+  port: 5432
+  user: "test"
+  password: "test"
+  database: "test"
+  ssl_mode: "disable"
+resolver:
+  interval_seconds: 300
+  max_resolv: 5
+  timeout_seconds: 5
+` + tt.extra
+
+			if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to create test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error but got: %v", err)
+			}
+			if cfg.Retention.RollupHourlyDays != tt.hourlyDays {
+				t.Errorf("Expected RollupHourlyDays=%d, got %d", tt.hourlyDays, cfg.Retention.RollupHourlyDays)
+			}
+			if cfg.Retention.RollupDailyDays != tt.dailyDays {
+				t.Errorf("Expected RollupDailyDays=%d, got %d", tt.dailyDays, cfg.Retention.RollupDailyDays)
+			}
+			if cfg.Rollup.IntervalMinutes != 5 || cfg.Rollup.BatchHours != 24 {
+				t.Errorf("Expected default interval 5 and batch 24, got %d and %d", cfg.Rollup.IntervalMinutes, cfg.Rollup.BatchHours)
+			}
+		})
+	}
+}
+
+func TestLoad_DatabaseDriver(t *testing.T) {
+	tests := []struct {
+		name        string
+		database    string
+		driver      string
+		path        string
+		expectError bool
+	}{
+		{"default postgres", "  host: \"localhost\"\n  port: 5432\n", "postgres", "", false},
+		{"sqlite default path", "  driver: \"sqlite\"\n", "sqlite", "data/dns-collector.db", false},
+		{"sqlite custom path", "  driver: \"sqlite\"\n  path: \"/var/lib/dns-collector/dns.db\"\n", "sqlite", "/var/lib/dns-collector/dns.db", false},
+		{"unknown driver", "  driver: \"mysql\"\n", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+
+			configContent := `server:
+  udp_port: 5353
+database:
+` + tt.database + `resolver:
+  interval_seconds: 300
+  max_resolv: 5
+  timeout_seconds: 5
+`
+
+			if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to create test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error but got: %v", err)
+			}
+			if cfg.Database.Driver != tt.driver {
+				t.Errorf("Expected Driver=%q, got %q", tt.driver, cfg.Database.Driver)
+			}
+			if cfg.Database.Path != tt.path {
+				t.Errorf("Expected Path=%q, got %q", tt.path, cfg.Database.Path)
+			}
+		})
+	}
+}
+
+func TestLoad_ClickHouse(t *testing.T) {
+	tests := []struct {
+		name        string
+		extra       string
+		table       string
+		maxPending  int
+		expectError bool
+	}{
+		{"defaults", "clickhouse:\n  enabled: true\n  url: \"http://clickhouse:8123\"\n", "domain_stat", 100000, false},
+		{"custom", "clickhouse:\n  enabled: true\n  url: \"http://clickhouse:8123\"\n  table: \"queries\"\n  batch_size: 500\n  max_pending: 2000\n", "queries", 2000, false},
+		{"max pending below batch", "clickhouse:\n  enabled: true\n  url: \"http://clickhouse:8123\"\n  batch_size: 500\n  max_pending: 100\n", "domain_stat", 5000, false},
+		{"missing url", "clickhouse:\n  enabled: true\n", "", 0, true},
+		{"invalid table", "clickhouse:\n  enabled: true\n  url: \"http://clickhouse:8123\"\n  table: \"stats; DROP TABLE x\"\n", "", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+
+			configContent := `server:
+  udp_port: 5353
+database:
+  host: "localhost"
+  port: 5432
+  user: "test"
+  password: "test"
+  database: "test"
+  ssl_mode: "disable"
+resolver:
+  interval_seconds: 300
+  max_resolv: 5
+  timeout_seconds: 5
+` + tt.extra
+
+			if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to create test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error but got: %v", err)
+			}
+			if cfg.ClickHouse.Database != "dns_collector" || cfg.ClickHouse.Table != tt.table {
+				t.Errorf("Expected table dns_collector.%s, got %s.%s", tt.table, cfg.ClickHouse.Database, cfg.ClickHouse.Table)
+			}
+			if cfg.ClickHouse.MaxPending != tt.maxPending {
+				t.Errorf("Expected MaxPending=%d, got %d", tt.maxPending, cfg.ClickHouse.MaxPending)
+			}
+			if cfg.ClickHouse.FlushSeconds != 5 {
+				t.Errorf("Expected default FlushSeconds=5, got %d", cfg.ClickHouse.FlushSeconds)
+			}
+		})
+	}
+}
+
+func TestLoad_Archive(t *testing.T) {
+	tests := []struct {
+		name        string
+		extra       string
+		compression string
+		expectError bool
+	}{
+		{"default compression", "retention:\n  archive:\n    enabled: true\n    dir: \"/var/lib/dns-collector/archive\"\n", "gzip", false},
+		{"zstd", "retention:\n  archive:\n    enabled: true\n    dir: \"archive\"\n    compression: \"zstd\"\n", "zstd", false},
+		{"missing dir", "retention:\n  archive:\n    enabled: true\n", "", true},
+		{"unknown compression", "retention:\n  archive:\n    enabled: true\n    dir: \"archive\"\n    compression: \"lz4\"\n", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+
+			configContent := `server:
+  udp_port: 5353
+database:
+  host: "localhost"
+  port: 5432
+  user: "test"
+  password: "test"
+  database: "test"
+  ssl_mode: "disable"
+resolver:
+  interval_seconds: 300
+  max_resolv: 5
+  timeout_seconds: 5
+` + tt.extra
+
+			if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to create test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error but got: %v", err)
+			}
+			if cfg.Retention.Archive.Compression != tt.compression {
+				t.Errorf("Expected Compression=%q, got %q", tt.compression, cfg.Retention.Archive.Compression)
+			}
+		})
+	}
+}
+
+func TestLoad_DeleteBatching(t *testing.T) {
+	tests := []struct {
+		name        string
+		extra       string
+		batchSize   int
+		pauseMs     int
+		vacuum      int
+		expectError bool
+	}{
+		{"defaults", "", 10000, 100, 0, false},
+		{"custom", "retention:\n  delete_batch_size: 500\n  delete_batch_pause_ms: 250\n  vacuum_threshold: 100000\n", 500, 250, 100000, false},
+		{"no pause", "retention:\n  delete_batch_pause_ms: -1\n", 10000, 0, 0, false},
+		{"batch too large", "retention:\n  delete_batch_size: 2000000\n", 0, 0, 0, true},
+		{"pause too long", "retention:\n  delete_batch_pause_ms: 120000\n", 0, 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+
+			configContent := `server:
+  udp_port: 5353
+database:
+  host: "localhost"
+  port: 5432
+  user: "test"
+  password: "test"
+  database: "test"
+  ssl_mode: "disable"
+resolver:
+  interval_seconds: 300
+  max_resolv: 5
+  timeout_seconds: 5
+` + tt.extra
+
+			if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to create test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error but got: %v", err)
+			}
+			r := cfg.Retention
+			if r.DeleteBatchSize != tt.batchSize || r.DeleteBatchPauseMs != tt.pauseMs || r.VacuumThreshold != tt.vacuum {
+				t.Errorf("Expected batch size %d, pause %dms, vacuum threshold %d, got %d, %dms, %d",
+					tt.batchSize, tt.pauseMs, tt.vacuum, r.DeleteBatchSize, r.DeleteBatchPauseMs, r.VacuumThreshold)
+			}
+		})
+	}
+}
+
+func TestLoad_MaxDBSize(t *testing.T) {
+	tests := []struct {
+		name        string
+		extra       string
+		expected    ByteSize
+		expectError bool
+	}{
+		{"disabled", "", 0, false},
+		{"gigabytes", "retention:\n  max_db_size: \"45GB\"\n", 45 << 30, false},
+		{"fraction", "retention:\n  max_db_size: 1.5tb\n", 3 << 39, false},
+		{"bytes", "retention:\n  max_db_size: 10485760\n", 10 << 20, false},
+		{"too small", "retention:\n  max_db_size: 512KB\n", 0, true},
+		{"invalid", "retention:\n  max_db_size: \"lots\"\n", 0, true},
+		{"negative", "retention:\n  max_db_size: -1GB\n", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+
+			configContent := `server:
+  udp_port: 5353
+database:
+  host: "localhost"
+  port: 5432
+  user: "test"
+  password: "test"
+  database: "test"
+  ssl_mode: "disable"
+resolver:
+  interval_seconds: 300
+  max_resolv: 5
+  timeout_seconds: 5
+` + tt.extra
+
+			if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to create test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error but got: %v", err)
+			}
+			if cfg.Retention.MaxDBSize != tt.expected {
+				t.Errorf("Expected max_db_size %d, got %d", tt.expected, cfg.Retention.MaxDBSize)
+			}
+		})
+	}
+}
+
+func TestByteSizeString(t *testing.T) {
+	tests := []struct {
+		size     ByteSize
+		expected string
+	}{
+		{45 << 30, "45GB"},
+		{3 << 39, "1.5TB"},
+		{1536, "1.5KB"},
+		{100, "100B"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.size.String(); got != tt.expected {
+			t.Errorf("Expected %s, got %s", tt.expected, got)
+		}
+	}
+}
+
+func TestLoad_RetentionRules(t *testing.T) {
+	tests := []struct {
+		name        string
+		rules       string
+		expectError bool
+	}{
+		{"valid", `
+    - name: threats
+      regex: "(^|\\.)(malware|phish)"
+      stats_days: 365
+    - name: cdn
+      suffix: akamaized.net
+      stats_days: 3
+      ip_ttl_days: 1
+    - name: servers
+      client_subnet: 10.0.0.0/8
+      stats_days: 60
+    - name: corp
+      suffix: corp.example.com
+      pinned: true
+`, false},
+		{"missing name", "\n    - suffix: example.com\n", true},
+		{"reserved name", "\n    - name: default\n      suffix: example.com\n", true},
+		{"duplicate name", "\n    - name: a\n      suffix: example.com\n    - name: a\n      suffix: example.org\n", true},
+		{"no match", "\n    - name: a\n      stats_days: 7\n", true},
+		{"suffix and regex", "\n    - name: a\n      suffix: example.com\n      regex: \"example\"\n", true},
+		{"invalid regex", "\n    - name: a\n      regex: \"[\"\n", true},
+		{"invalid subnet", "\n    - name: a\n      client_subnet: 10.0.0.0/33\n", true},
+		{"subnet with domain TTL", "\n    - name: a\n      client_subnet: 10.0.0.0/8\n      domain_ttl_days: 7\n", true},
+		{"stats too long", "\n    - name: a\n      suffix: example.com\n      stats_days: 400\n", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			configPath := filepath.Join(tmpDir, "config.yaml")
+
+			configContent := `server:
+  udp_port: 5353
+database:
+  host: "localhost"
+  port: 5432
+  user: "test"
+  password: "test"
+  database: "test"
+  ssl_mode: "disable"
+resolver:
+  interval_seconds: 300
+  max_resolv: 5
+  timeout_seconds: 5
+retention:
+  rules:` + tt.rules
+
+			if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+				t.Fatalf("Failed to create test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error but got: %v", err)
+			}
+			if len(cfg.Retention.Rules) != 4 || !cfg.Retention.Rules[3].Pinned {
+				t.Errorf("Expected 4 rules with the last pinned, got %+v", cfg.Retention.Rules)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ExportList is an export list of the web API, as far as the cleanup dry run needs it:
+// which domains it lists and whether it lists the domains or their IP addresses.
+type ExportList struct {
+	Name           string
+	DomainRegex    *regexp.Regexp
+	IncludeDomains bool
+	IncludeIPs     bool
+	// UnappliedFilters are the options of the list the dry run can't evaluate (they
+	// need the web API's queries or files), so its losses are upper bounds
+	UnappliedFilters []string
+}
+
+// LoadExportLists reads the export lists of a web API configuration file.
+func LoadExportLists(path string) ([]ExportList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read web API config: %w", err)
+	}
+
+	var cfg struct {
+		ExportLists []struct {
+			Name           string `yaml:"name"`
+			DomainRegex    string `yaml:"domain_regex"`
+			IncludeDomains bool   `yaml:"include_domains"`
+			IncludeIPv4    *bool  `yaml:"include_ipv4"`
+			IncludeIPv6    *bool  `yaml:"include_ipv6"`
+
+			ExcludeSharedIPs  bool     `yaml:"exclude_shared_ips"`
+			AdditionalIPsFile string   `yaml:"additional_ips_file"`
+			CollapseWildcards bool     `yaml:"collapse_wildcards"`
+			Vantage           string   `yaml:"vantage"`
+			ASNs              []int64  `yaml:"asns"`
+			ExcludeASNs       []int64  `yaml:"exclude_asns"`
+			Countries         []string `yaml:"countries"`
+			MinSeen           int      `yaml:"min_seen"`
+		} `yaml:"export_lists"`
+	}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse web API config: %w", err)
+	}
+
+	lists := make([]ExportList, 0, len(cfg.ExportLists))
+	for _, l := range cfg.ExportLists {
+		re, err := regexp.Compile(l.DomainRegex)
+		if err != nil {
+			return nil, fmt.Errorf("export list '%s': invalid domain_regex: %w", l.Name, err)
+		}
+		// IPv4 and IPv6 addresses are listed unless disabled
+		includeIPv4 := l.IncludeIPv4 == nil || *l.IncludeIPv4
+		includeIPv6 := l.IncludeIPv6 == nil || *l.IncludeIPv6
+
+		// Options the dry run can't apply: deleted IP addresses are counted per domain,
+		// whatever their type, vantage, ASN or stability
+		var unapplied []string
+		for _, f := range []struct {
+			name string
+			set  bool
+		}{
+			{"include_ipv4", !includeIPv4 && includeIPv6},
+			{"include_ipv6", includeIPv4 && !includeIPv6},
+			{"exclude_shared_ips", l.ExcludeSharedIPs},
+			{"additional_ips_file", l.AdditionalIPsFile != ""},
+			{"collapse_wildcards", l.CollapseWildcards},
+			{"vantage", l.Vantage != ""},
+			{"asns", len(l.ASNs) > 0},
+			{"exclude_asns", len(l.ExcludeASNs) > 0},
+			{"countries", len(l.Countries) > 0},
+			{"min_seen", l.MinSeen > 0},
+		} {
+			if f.set {
+				unapplied = append(unapplied, f.name)
+			}
+		}
+
+		lists = append(lists, ExportList{
+			Name:             l.Name,
+			DomainRegex:      re,
+			IncludeDomains:   l.IncludeDomains,
+			IncludeIPs:       includeIPv4 || includeIPv6,
+			UnappliedFilters: unapplied,
+		})
+	}
+	return lists, nil
+}
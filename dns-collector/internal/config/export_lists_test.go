@@ -0,0 +1,62 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadExportLists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "web-api.yaml")
+	if err := os.WriteFile(path, []byte(`
+server:
+  port: 8080
+export_lists:
+  - name: "Domains only"
+    endpoint: "/export/domains"
+    domain_regex: "^example\\.com$"
+    include_domains: true
+    include_ipv4: false
+    include_ipv6: false
+  - name: "IPs"
+    endpoint: "/export/ips"
+    domain_regex: ".*"
+  - name: "Stable IPv4 of one site"
+    endpoint: "/export/site"
+    domain_regex: ".*"
+    include_ipv6: false
+    vantage: "msk"
+    min_seen: 3
+    seen_window: 5
+`), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	lists, err := LoadExportLists(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(lists) != 3 {
+		t.Fatalf("Expected 3 export lists, got %d", len(lists))
+	}
+	if l := lists[0]; !l.IncludeDomains || l.IncludeIPs || !l.DomainRegex.MatchString("example.com") {
+		t.Errorf("Unexpected first list: %+v", l)
+	}
+	if l := lists[1]; l.IncludeDomains || !l.IncludeIPs || len(l.UnappliedFilters) != 0 {
+		t.Errorf("Expected IPs listed by default, got %+v", l)
+	}
+	if l := lists[2]; strings.Join(l.UnappliedFilters, ",") != "include_ipv6,vantage,min_seen" {
+		t.Errorf("Expected unapplied include_ipv6, vantage and min_seen, got %v", l.UnappliedFilters)
+	}
+
+	if err := os.WriteFile(path, []byte("export_lists:\n  - name: bad\n    domain_regex: \"(\"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if _, err := LoadExportLists(path); err == nil {
+		t.Error("Expected error for invalid domain_regex")
+	}
+	if _, err := LoadExportLists(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("Expected error for missing file")
+	}
+}
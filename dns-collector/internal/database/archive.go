@@ -0,0 +1,132 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// StatRecord is a raw domain_stat row as written to and read from statistics archives
+type StatRecord struct {
+	ID        int64     `json:"id"`
+	Domain    string    `json:"domain"`
+	ClientIP  string    `json:"client_ip,omitempty"` // empty for unknown clients (NULL)
+	QType     string    `json:"qtype"`
+	RType     string    `json:"rtype"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ScratchTableRe matches the tables archives may be imported into, so an import
+// can never write to the live schema
+var ScratchTableRe = regexp.MustCompile(`^domain_stat_archive_[a-z0-9_]{1,40}$`)
+
+// StatRetentionCutoff returns the start of the first day of statistics kept with
+// retentionDays: DropOldStatPartitions removes the days before it.
+func StatRetentionCutoff(retentionDays int, now time.Time) time.Time {
+	return startOfDay(now.AddDate(0, 0, -retentionDays))
+}
+
+// nullableClientIP converts an archived client IP to a statement argument
+func nullableClientIP(ip string) interface{} {
+	if ip == "" {
+		return nil
+	}
+	return ip
+}
+
+// GetStatDaysBefore returns the days with statistics before cutoff, oldest first
+func (db *Database) GetStatDaysBefore(cutoff time.Time) ([]time.Time, error) {
+	rows, err := db.DB.Query(
+		`SELECT DISTINCT date_trunc('day', timestamp) FROM domain_stat WHERE timestamp < $1 ORDER BY 1`, cutoff,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query statistics days: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var days []time.Time
+	for rows.Next() {
+		var day time.Time
+		if err := rows.Scan(&day); err != nil {
+			return nil, fmt.Errorf("failed to scan statistics day: %w", err)
+		}
+		days = append(days, localWallTime(day))
+	}
+	return days, rows.Err()
+}
+
+// ExportStats calls fn for every domain_stat row in [from, to) ordered by timestamp.
+// Returns the number of rows exported.
+func (db *Database) ExportStats(from, to time.Time, fn func(StatRecord) error) (int64, error) {
+	rows, err := db.DB.Query(
+		`SELECT id, domain, host(client_ip), qtype, rtype, timestamp FROM domain_stat
+		WHERE timestamp >= $1 AND timestamp < $2 ORDER BY timestamp, id`, from, to,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query statistics: %w", err)
+	}
+	return scanStatRecords(rows, fn)
+}
+
+// scanStatRecords calls fn for every exported domain_stat row and closes rows
+func scanStatRecords(rows *sql.Rows, fn func(StatRecord) error) (int64, error) {
+	defer func() { _ = rows.Close() }()
+
+	var n int64
+	for rows.Next() {
+		var r StatRecord
+		var clientIP sql.NullString
+		if err := rows.Scan(&r.ID, &r.Domain, &clientIP, &r.QType, &r.RType, &r.Timestamp); err != nil {
+			return n, fmt.Errorf("failed to scan statistics row: %w", err)
+		}
+		r.ClientIP = clientIP.String
+		r.Timestamp = localWallTime(r.Timestamp)
+		if err := fn(r); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return n, fmt.Errorf("failed to read statistics: %w", err)
+	}
+	return n, nil
+}
+
+// ImportStats inserts archived statistics into the scratch table, creating it with
+// the columns of domain_stat if needed.
+func (db *Database) ImportStats(table string, records []StatRecord) error {
+	if !ScratchTableRe.MatchString(table) {
+		return fmt.Errorf("invalid scratch table name: %s", table)
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.Exec(`CREATE TABLE IF NOT EXISTS ` + pq.QuoteIdentifier(table) + ` (LIKE domain_stat)`); err != nil {
+		return fmt.Errorf("failed to create scratch table %s: %w", table, err)
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO ` + pq.QuoteIdentifier(table) +
+		` (id, domain, client_ip, qtype, rtype, timestamp) VALUES ($1, $2, $3, $4, $5, $6)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare import: %w", err)
+	}
+	defer func() { _ = stmt.Close() }()
+
+	for _, r := range records {
+		if _, err := stmt.Exec(r.ID, r.Domain, nullableClientIP(r.ClientIP), r.QType, r.RType, r.Timestamp); err != nil {
+			return fmt.Errorf("failed to import statistics row %d: %w", r.ID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
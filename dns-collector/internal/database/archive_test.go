@@ -0,0 +1,88 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestStatRetentionCutoff(t *testing.T) {
+	now := time.Date(2024, 1, 15, 13, 30, 0, 0, time.Local)
+	expected := time.Date(2024, 1, 8, 0, 0, 0, 0, time.Local)
+	if got := StatRetentionCutoff(7, now); !got.Equal(expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestExportStats(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	database := &Database{DB: db}
+	from := time.Date(2024, 1, 10, 0, 0, 0, 0, time.Local)
+	ts := time.Date(2024, 1, 10, 8, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`SELECT id, domain, host\(client_ip\), qtype, rtype, timestamp FROM domain_stat`).
+		WithArgs(from, from.AddDate(0, 0, 1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "domain", "client_ip", "qtype", "rtype", "timestamp"}).
+			AddRow(1, "a.example.com", "192.168.1.10", "A", "cache", ts).
+			AddRow(2, "b.example.com", nil, "AAAA", "forward", ts))
+
+	var records []StatRecord
+	n, err := database.ExportStats(from, from.AddDate(0, 0, 1), func(r StatRecord) error {
+		records = append(records, r)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if n != 2 || records[0].ClientIP != "192.168.1.10" || records[1].ClientIP != "" {
+		t.Errorf("Unexpected records %+v", records)
+	}
+	// Timestamps are the local wall time stored in the column
+	if records[0].Timestamp.Location() != time.Local || records[0].Timestamp.Hour() != 8 {
+		t.Errorf("Expected local wall time, got %v", records[0].Timestamp)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestImportStats(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	database := &Database{DB: db}
+	ts := time.Date(2024, 1, 10, 8, 0, 0, 0, time.Local)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS "domain_stat_archive_20240110" \(LIKE domain_stat\)`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	prep := mock.ExpectPrepare(`INSERT INTO "domain_stat_archive_20240110"`)
+	prep.ExpectExec().WithArgs(int64(2), "b.example.com", nil, "AAAA", "forward", ts).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err = database.ImportStats("domain_stat_archive_20240110", []StatRecord{
+		{ID: 2, Domain: "b.example.com", QType: "AAAA", RType: "forward", Timestamp: ts},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if err := database.ImportStats("domain_stat", nil); err == nil {
+		t.Error("Expected error for a live table")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"net"
+	"sort"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type Database struct {
@@ -33,6 +35,27 @@ type Domain struct {
 	LastSeen       *time.Time // When domain was last queried by client (can be NULL)
 }
 
+// DomainPolicy holds the resolution settings a policy rule assigns to a domain
+type DomainPolicy struct {
+	Name            string // matched policy rule (empty = default policy)
+	MaxResolv       int    // resolution budget (0 = never resolve)
+	IntervalSeconds int    // pinned refresh interval (0 = resolver.interval_seconds)
+}
+
+// DomainPolicyRow is a stored domain with its policy settings
+type DomainPolicyRow struct {
+	ID     int64
+	Domain string
+	Policy DomainPolicy
+}
+
+// PriorityWeights are the weights of the domain_priority() scheduling score terms
+type PriorityWeights struct {
+	Popularity float64 // ln(1 + query_count)
+	Recency    float64 // exp(-days since last_seen)
+	Staleness  float64 // ln(1 + hours since last resolution)
+}
+
 type IPAddress struct {
 	ID       int64
 	DomainID int64
@@ -101,10 +124,25 @@ func (db *Database) initSchema() error {
 		resolv_count INTEGER NOT NULL DEFAULT 0,
 		max_resolv INTEGER NOT NULL,
 		last_resolv_time TIMESTAMP NOT NULL,
-		last_seen TIMESTAMP
+		last_seen TIMESTAMP,
+		last_error VARCHAR(20),
+		consecutive_failures INTEGER NOT NULL DEFAULT 0,
+		next_resolv_time TIMESTAMP,
+		leased_until TIMESTAMP,
+		query_count BIGINT NOT NULL DEFAULT 0,
+		dnssec_status VARCHAR(16),
+		wildcard_zone TEXT,
+		policy VARCHAR(64),
+		resolv_interval INTEGER
 	);
 	CREATE INDEX IF NOT EXISTS idx_domain_resolv ON domain(resolv_count, max_resolv);
 	CREATE INDEX IF NOT EXISTS idx_domain_last_seen ON domain(last_seen);
+	CREATE TABLE IF NOT EXISTS wildcard_zone (
+		zone TEXT PRIMARY KEY,
+		is_wildcard BOOLEAN NOT NULL,
+		detected_at TIMESTAMP,
+		checked_at TIMESTAMP NOT NULL
+	);
 	`
 
 	if _, err := db.DB.Exec(domainSchema); err != nil {
@@ -116,32 +154,92 @@ func (db *Database) initSchema() error {
 	CREATE TABLE IF NOT EXISTS ip (
 		id SERIAL PRIMARY KEY,
 		domain_id INTEGER NOT NULL,
-		ip TEXT NOT NULL,
+		ip INET NOT NULL,
 		type TEXT NOT NULL,
 		time TIMESTAMP NOT NULL,
+		asn BIGINT,
+		as_org TEXT,
+		country VARCHAR(2),
+		geo_time TIMESTAMP,
+		first_seen TIMESTAMP,
+		last_seen TIMESTAMP,
+		seen_count INTEGER NOT NULL DEFAULT 1,
+		first_source VARCHAR(16),
+		last_source VARCHAR(16),
+		seen_history BIGINT NOT NULL DEFAULT 0,
 		UNIQUE(domain_id, ip),
 		FOREIGN KEY(domain_id) REFERENCES domain(id) ON DELETE CASCADE
 	);
 	CREATE INDEX IF NOT EXISTS idx_ip_domain ON ip(domain_id);
 	CREATE INDEX IF NOT EXISTS idx_ip_time_cleanup ON ip(time);
+	CREATE TABLE IF NOT EXISTS ip_vantage (
+		ip_id INTEGER NOT NULL REFERENCES ip(id) ON DELETE CASCADE,
+		vantage VARCHAR(64) NOT NULL,
+		time TIMESTAMP NOT NULL,
+		PRIMARY KEY (ip_id, vantage)
+	);
+	CREATE TABLE IF NOT EXISTS ip_change_event (
+		id BIGSERIAL PRIMARY KEY,
+		domain_id INTEGER NOT NULL REFERENCES domain(id) ON DELETE CASCADE,
+		time TIMESTAMP NOT NULL,
+		added TEXT[] NOT NULL DEFAULT '{}',
+		removed TEXT[] NOT NULL DEFAULT '{}'
+	);
+	CREATE INDEX IF NOT EXISTS idx_ip_change_event_domain ON ip_change_event(domain_id, time);
+	CREATE INDEX IF NOT EXISTS idx_ip_change_event_time ON ip_change_event(time);
+	CREATE TABLE IF NOT EXISTS ip_ptr (
+		ip INET PRIMARY KEY,
+		ptr TEXT NOT NULL DEFAULT '',
+		time TIMESTAMP NOT NULL
+	);
 	`
 
 	if _, err := db.DB.Exec(ipSchema); err != nil {
 		return fmt.Errorf("failed to create ip table: %w", err)
 	}
 
-	// Create domain_stat table
+	// Create domain_stat table, partitioned by day (daily partitions are created by EnsureStatPartitions)
 	statSchema := `
 	CREATE TABLE IF NOT EXISTS domain_stat (
-		id SERIAL PRIMARY KEY,
+		id BIGSERIAL,
 		domain TEXT NOT NULL,
-		client_ip TEXT NOT NULL,
+		client_ip INET,
+		qtype TEXT NOT NULL DEFAULT '',
 		rtype TEXT NOT NULL,
 		timestamp TIMESTAMP NOT NULL
-	);
-	CREATE INDEX IF NOT EXISTS idx_domain_stat_timestamp ON domain_stat(timestamp);
+	) PARTITION BY RANGE (timestamp);
+	DO $$
+	BEGIN
+		-- Databases before migration 000016 still have a plain domain_stat
+		IF (SELECT relkind FROM pg_class WHERE oid = 'domain_stat'::regclass) = 'p' THEN
+			CREATE TABLE IF NOT EXISTS domain_stat_default PARTITION OF domain_stat DEFAULT;
+		END IF;
+	END $$;
+	CREATE INDEX IF NOT EXISTS idx_domain_stat_timestamp ON domain_stat(timestamp DESC);
 	CREATE INDEX IF NOT EXISTS idx_domain_stat_domain ON domain_stat(domain);
 	CREATE INDEX IF NOT EXISTS idx_domain_stat_client_ip ON domain_stat(client_ip);
+	CREATE TABLE IF NOT EXISTS domain_stat_hourly (
+		bucket TIMESTAMP NOT NULL,
+		domain TEXT NOT NULL,
+		client_ip INET,
+		qtype TEXT NOT NULL,
+		count BIGINT NOT NULL
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_domain_stat_hourly_key
+		ON domain_stat_hourly(bucket, domain, client_ip, qtype) NULLS NOT DISTINCT;
+	CREATE TABLE IF NOT EXISTS domain_stat_daily (
+		bucket TIMESTAMP NOT NULL,
+		domain TEXT NOT NULL,
+		client_ip INET,
+		qtype TEXT NOT NULL,
+		count BIGINT NOT NULL
+	);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_domain_stat_daily_key
+		ON domain_stat_daily(bucket, domain, client_ip, qtype) NULLS NOT DISTINCT;
+	CREATE TABLE IF NOT EXISTS stat_rollup_state (
+		rollup TEXT PRIMARY KEY,
+		rolled_up_to TIMESTAMP NOT NULL
+	);
 	`
 
 	if _, err := db.DB.Exec(statSchema); err != nil {
@@ -158,19 +256,19 @@ func (db *Database) Close() error {
 	return nil
 }
 
-// InsertOrGetDomain inserts a new domain or returns existing one.
+// InsertOrGetDomain inserts a new domain with the settings of its policy or returns existing one.
 // Returns the domain, a boolean indicating if it was newly created, and any error.
-func (db *Database) InsertOrGetDomain(domain string, maxResolv int) (*Domain, bool, error) {
+func (db *Database) InsertOrGetDomain(domain string, policy DomainPolicy) (*Domain, bool, error) {
 	now := time.Now()
 
 	// Use INSERT ... ON CONFLICT for upsert
 	var d Domain
 	err := db.DB.QueryRow(
-		`INSERT INTO domain (domain, time_insert, resolv_count, max_resolv, last_resolv_time, last_seen)
-		VALUES ($1, $2, 0, $3, $4, $5)
+		`INSERT INTO domain (domain, time_insert, resolv_count, max_resolv, last_resolv_time, last_seen, policy, resolv_interval)
+		VALUES ($1, $2, 0, $3, $4, $5, NULLIF($6, ''), NULLIF($7, 0))
 		ON CONFLICT (domain) DO NOTHING
 		RETURNING id, domain, time_insert, resolv_count, max_resolv, last_resolv_time, last_seen`,
-		domain, now, maxResolv, now, now,
+		domain, now, policy.MaxResolv, now, now, policy.Name, policy.IntervalSeconds,
 	).Scan(&d.ID, &d.Domain, &d.TimeInsert, &d.ResolvCount, &d.MaxResolv, &d.LastResolvTime, &d.LastSeen)
 
 	if err == sql.ErrNoRows {
@@ -191,39 +289,74 @@ func (db *Database) InsertOrGetDomain(domain string, maxResolv int) (*Domain, bo
 	return &d, true, nil // new domain
 }
 
-// GetDomainsToResolve returns domains that need to be resolved
+// dueDomainsFilter returns the WHERE clause selecting domains due for resolution
+// and its arguments ($1..$n). A domain is due when it is within its resolution budget,
+// was never resolved or not resolved for refreshInterval, is not in failure backoff
+// and is not leased by a resolver.
 // In cyclic mode, includes domains where resolv_count < max_resolv.
 // Note: With current cyclic reset logic (reset to 2/3), domains never reach max_resolv,
 // making the cooldown condition unreachable. The cooldown branch is preserved for compatibility.
-func (db *Database) GetDomainsToResolve(limit int, cyclicMode bool, cooldownMins int) ([]Domain, error) {
-	var query string
-	var args []interface{}
+// Domains with max_resolv = 0 (policy "never") are never due, and domains with a pinned
+// resolv_interval use it instead of refreshInterval.
+// With collapseWildcards only the oldest child of every wildcard zone is due; its siblings
+// share the zone's answers and are not resolved on their own.
+func dueDomainsFilter(cyclicMode bool, cooldownMins int, refreshInterval time.Duration, collapseWildcards bool) (string, []interface{}) {
+	now := time.Now()
+	refreshTime := now.Add(-refreshInterval)
+
+	// Never resolved domains (last_resolv_time is initialized to time_insert) are due immediately
+	freshness := `(last_resolv_time <= time_insert
+			   OR last_resolv_time <= COALESCE($2::TIMESTAMP - resolv_interval * INTERVAL '1 second', $1))
+			AND (next_resolv_time IS NULL OR next_resolv_time <= $2)
+			AND (leased_until IS NULL OR leased_until <= $2)`
+	if collapseWildcards {
+		freshness += `
+			AND (wildcard_zone IS NULL
+			   OR id = (SELECT MIN(c.id) FROM domain c WHERE c.wildcard_zone = domain.wildcard_zone))`
+	}
 
 	if cyclicMode {
 		// Cyclic mode: include domains that:
 		// 1. Still in current cycle (resolv_count < max_resolv), OR
 		// 2. Completed a cycle AND cooldown period has passed
-		cooldownTime := time.Now().Add(-time.Duration(cooldownMins) * time.Minute)
-		query = `SELECT id, domain, time_insert, resolv_count, max_resolv, last_resolv_time, last_seen
-			FROM domain
-			WHERE resolv_count < max_resolv
-			   OR (resolv_count >= max_resolv AND last_resolv_time < $1)
-			ORDER BY last_resolv_time ASC
-			LIMIT $2`
-		args = []interface{}{cooldownTime, limit}
-	} else {
-		// Legacy mode: only domains that haven't reached max_resolv
-		query = `SELECT id, domain, time_insert, resolv_count, max_resolv, last_resolv_time, last_seen
-			FROM domain
-			WHERE resolv_count < max_resolv
-			ORDER BY last_resolv_time ASC
-			LIMIT $1`
-		args = []interface{}{limit}
+		cooldownTime := now.Add(-time.Duration(cooldownMins) * time.Minute)
+		return `(resolv_count < max_resolv
+			   OR (resolv_count >= max_resolv AND max_resolv > 0 AND last_resolv_time < $3))
+			AND ` + freshness, []interface{}{refreshTime, now, cooldownTime}
 	}
 
+	// Legacy mode: only domains that haven't reached max_resolv
+	return `resolv_count < max_resolv
+			AND ` + freshness, []interface{}{refreshTime, now}
+}
+
+// ClaimDomainsToResolve leases up to limit due domains to the caller for leaseDuration
+// and returns them. Never resolved domains are claimed first, the rest by descending
+// domain_priority() score, so popular and recently queried domains are refreshed more often.
+// Rows are picked with FOR UPDATE SKIP LOCKED, so concurrent resolver instances never
+// claim the same domain. The lease is released by UpdateDomainResolvStats/UpdateDomainResolvFailure
+// or expires on its own if the worker crashed.
+// RETURNING does not preserve the subquery order; batches are small enough for this not to matter.
+func (db *Database) ClaimDomainsToResolve(limit int, cyclicMode bool, cooldownMins int, refreshInterval, leaseDuration time.Duration, weights PriorityWeights, collapseWildcards bool) ([]Domain, error) {
+	where, args := dueDomainsFilter(cyclicMode, cooldownMins, refreshInterval, collapseWildcards)
+	leaseUntil := time.Now().Add(leaseDuration)
+	n := len(args)
+	query := fmt.Sprintf(`UPDATE domain SET leased_until = $%d
+			WHERE id IN (
+				SELECT id FROM domain
+				WHERE %s
+				ORDER BY last_resolv_time <= time_insert DESC,
+					domain_priority(query_count, last_seen, last_resolv_time, $2, $%d, $%d, $%d) DESC
+				LIMIT $%d
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id, domain, time_insert, resolv_count, max_resolv, last_resolv_time, last_seen`,
+		n+1, where, n+2, n+3, n+4, n+5)
+	args = append(args, leaseUntil, weights.Popularity, weights.Recency, weights.Staleness, limit)
+
 	rows, err := db.DB.Query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query domains: %w", err)
+		return nil, fmt.Errorf("failed to claim domains: %w", err)
 	}
 	defer func() { _ = rows.Close() }()
 
@@ -239,17 +372,129 @@ func (db *Database) GetDomainsToResolve(limit int, cyclicMode bool, cooldownMins
 	return domains, rows.Err()
 }
 
-// InsertOrUpdateIP inserts or updates an IP address
-func (db *Database) InsertOrUpdateIP(domainID int64, ip, ipType string) error {
+// ClaimDomain leases a single domain (e.g. a newly seen one) for leaseDuration.
+// Returns false if the domain is currently leased by another resolver.
+func (db *Database) ClaimDomain(domainID int64, leaseDuration time.Duration) (bool, error) {
+	now := time.Now()
+
+	result, err := db.DB.Exec(
+		`UPDATE domain SET leased_until = $1
+		WHERE id = $2 AND (leased_until IS NULL OR leased_until <= $3)`,
+		now.Add(leaseDuration), domainID, now,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim domain: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// CountDomainsToResolve returns the number of domains currently due for resolution (the resolver backlog)
+func (db *Database) CountDomainsToResolve(cyclicMode bool, cooldownMins int, refreshInterval time.Duration, collapseWildcards bool) (int64, error) {
+	where, args := dueDomainsFilter(cyclicMode, cooldownMins, refreshInterval, collapseWildcards)
+
+	var count int64
+	err := db.DB.QueryRow(`SELECT COUNT(*) FROM domain WHERE `+where, args...).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count domains to resolve: %w", err)
+	}
+	return count, nil
+}
+
+// RequeueDomains makes domains matching a PostgreSQL regex due right away: they are
+// treated like never resolved domains (claimed first), their failure backoff and lease
+// are cleared and, if the resolution budget is used up, one more resolution is allowed.
+// Domains whose policy forbids resolution are left alone. Returns the number of domains requeued.
+func (db *Database) RequeueDomains(domainRegex string) (int64, error) {
+	result, err := db.DB.Exec(
+		`UPDATE domain
+		SET last_resolv_time = time_insert,
+			next_resolv_time = NULL,
+			leased_until = NULL,
+			resolv_count = LEAST(resolv_count, max_resolv - 1)
+		WHERE domain ~ $1 AND max_resolv > 0`,
+		domainRegex,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to requeue domains: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return affected, nil
+}
+
+// GetDomainPolicies returns up to limit domains with id greater than afterID and their
+// stored policy settings, ordered by id.
+func (db *Database) GetDomainPolicies(afterID int64, limit int) ([]DomainPolicyRow, error) {
+	rows, err := db.DB.Query(
+		`SELECT id, domain, COALESCE(policy, ''), max_resolv, COALESCE(resolv_interval, 0)
+		FROM domain
+		WHERE id > $1
+		ORDER BY id
+		LIMIT $2`,
+		afterID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get domain policies: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var domains []DomainPolicyRow
+	for rows.Next() {
+		var d DomainPolicyRow
+		if err := rows.Scan(&d.ID, &d.Domain, &d.Policy.Name, &d.Policy.MaxResolv, &d.Policy.IntervalSeconds); err != nil {
+			return nil, fmt.Errorf("failed to scan domain policy: %w", err)
+		}
+		domains = append(domains, d)
+	}
+
+	return domains, rows.Err()
+}
+
+// UpdateDomainPolicy stores the policy settings of a domain.
+func (db *Database) UpdateDomainPolicy(domainID int64, policy DomainPolicy) error {
+	_, err := db.DB.Exec(
+		`UPDATE domain SET policy = NULLIF($1, ''), max_resolv = $2, resolv_interval = NULLIF($3, 0)
+		WHERE id = $4`,
+		policy.Name, policy.MaxResolv, policy.IntervalSeconds, domainID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update domain policy: %w", err)
+	}
+	return nil
+}
+
+// Sources of IP observations
+const (
+	SourceResolver = "resolver" // returned by the collector's own resolution
+	SourcePassive  = "passive"  // seen in an answer reported by the DNS server
+)
+
+// seenHistoryBits is the number of recent resolutions kept in ip.seen_history
+const seenHistoryBits = 32
+
+// InsertOrUpdateIP inserts or updates an IP address observed by source
+// and updates its first_seen, last_seen and seen_count
+func (db *Database) InsertOrUpdateIP(domainID int64, ip, ipType, source string) error {
 	now := time.Now()
 
 	_, err := db.DB.Exec(
-		`INSERT INTO ip (domain_id, ip, type, time)
-		VALUES ($1, $2, $3, $4)
+		`INSERT INTO ip (domain_id, ip, type, time, first_seen, last_seen, seen_count, first_source, last_source)
+		VALUES ($1, $2, $3, $4, $4, $4, 1, $5, $5)
 		ON CONFLICT(domain_id, ip) DO UPDATE SET
-			time = $5,
-			type = $6`,
-		domainID, ip, ipType, now, now, ipType,
+			time = $4,
+			type = $3,
+			last_seen = $4,
+			seen_count = ip.seen_count + 1,
+			last_source = $5`,
+		domainID, ip, ipType, now, source,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to insert/update IP: %w", err)
@@ -258,83 +503,441 @@ func (db *Database) InsertOrUpdateIP(domainID int64, ip, ipType string) error {
 	return nil
 }
 
-// UpdateDomainResolvStats updates resolv_count and last_resolv_time
-// In cyclic mode, resets resolv_count to ⌊max_resolv × 2/3⌋ when it reaches max_resolv - 1
-// This prevents domains from completing a full cycle and triggering cooldown logic
-func (db *Database) UpdateDomainResolvStats(domainID int64, cyclicMode bool) error {
+// InsertOrUpdateIPVantage inserts or updates an IP address returned for a vantage point
+// (EDNS Client Subnet site) and records the vantage that produced it. counted tells
+// that the address was already stored in this resolution (by the default lookup or
+// another vantage): its seen_count is then left as is, so every resolution counts once.
+func (db *Database) InsertOrUpdateIPVantage(domainID int64, ip, ipType, vantage string, counted bool) error {
 	now := time.Now()
+	increment := 1
+	if counted {
+		increment = 0
+	}
 
-	var query string
-	if cyclicMode {
-		// Reset to ⌊max_resolv × 2/3⌋ when reaching max_resolv - 1
-		// This keeps domains in a partial cycle rather than full reset to 0
-		// Examples: max_resolv=10 → reset to 6, max_resolv=3 → reset to 2
-		query = `UPDATE domain
-			SET resolv_count = CASE
-				WHEN resolv_count >= max_resolv - 1 THEN CAST(max_resolv * 2.0 / 3.0 AS INTEGER)
-				ELSE resolv_count + 1
-			END,
-			last_resolv_time = $1
-			WHERE id = $2`
-	} else {
-		// Legacy mode: just increment
-		query = `UPDATE domain
-			SET resolv_count = resolv_count + 1,
-			    last_resolv_time = $1
-			WHERE id = $2`
+	_, err := db.DB.Exec(
+		`WITH upserted AS (
+			INSERT INTO ip (domain_id, ip, type, time, first_seen, last_seen, seen_count, first_source, last_source)
+			VALUES ($1, $2, $3, $4, $4, $4, 1, $6, $6)
+			ON CONFLICT(domain_id, ip) DO UPDATE SET
+				time = $4,
+				type = $3,
+				last_seen = $4,
+				seen_count = ip.seen_count + $7,
+				last_source = $6
+			RETURNING id
+		)
+		INSERT INTO ip_vantage (ip_id, vantage, time)
+		SELECT id, $5, $4 FROM upserted
+		ON CONFLICT(ip_id, vantage) DO UPDATE SET time = $4`,
+		domainID, ip, ipType, now, vantage, SourceResolver, increment,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert/update IP vantage: %w", err)
 	}
 
-	_, err := db.DB.Exec(query, now, domainID)
+	return nil
+}
+
+// IPChange is the difference between the IP sets of two consecutive resolutions of a domain
+type IPChange struct {
+	Added   []string
+	Removed []string
+}
+
+// RecordIPResolution appends the outcome of a resolution of the domain to the
+// seen_history of its IPs of ipTypes (the address types that were successfully looked up):
+// the lowest bit is set for the addresses in seen and cleared for the rest, older
+// resolutions shift up (the last 32 resolutions are kept).
+// When the set differs from the one of the previous resolution an ip_change_event is
+// recorded and the change is returned; otherwise the returned change is nil.
+func (db *Database) RecordIPResolution(domainID int64, ipTypes, seen []string) (*IPChange, error) {
+	tx, err := db.DB.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to update domain stats: %w", err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Addresses returned by the previous resolution
+	rows, err := tx.Query(
+		`SELECT ip FROM ip
+		WHERE domain_id = $1 AND type = ANY($2) AND seen_history & 1 = 1
+		FOR UPDATE`,
+		domainID, pq.Array(ipTypes),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get previous IPs: %w", err)
+	}
+	var previous []string
+	for rows.Next() {
+		var ip string
+		if err := rows.Scan(&ip); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan previous IP: %w", err)
+		}
+		previous = append(previous, ip)
+	}
+	if err := rows.Err(); err != nil {
+		_ = rows.Close()
+		return nil, err
+	}
+	_ = rows.Close()
+
+	_, err = tx.Exec(
+		`UPDATE ip SET seen_history =
+			((seen_history << 1) | CASE WHEN ip = ANY($2::inet[]) THEN 1 ELSE 0 END) & $3
+		WHERE domain_id = $1 AND type = ANY($4)`,
+		domainID, pq.Array(seen), int64(1)<<seenHistoryBits-1, pq.Array(ipTypes),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record IP resolution: %w", err)
+	}
+
+	change := diffIPSets(previous, seen)
+	if change != nil {
+		_, err = tx.Exec(
+			`INSERT INTO ip_change_event (domain_id, time, added, removed)
+			VALUES ($1, $2, $3, $4)`,
+			domainID, time.Now(), pq.Array(change.Added), pq.Array(change.Removed),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert IP change event: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return change, nil
+}
+
+// diffIPSets returns the addresses added and removed going from previous to current
+// (both sorted), or nil if the sets are equal. Duplicates are ignored.
+func diffIPSets(previous, current []string) *IPChange {
+	prev := make(map[string]bool, len(previous))
+	for _, ip := range previous {
+		prev[ip] = true
+	}
+	cur := make(map[string]bool, len(current))
+	for _, ip := range current {
+		cur[ip] = true
+	}
+
+	change := &IPChange{Added: []string{}, Removed: []string{}}
+	for ip := range cur {
+		if !prev[ip] {
+			change.Added = append(change.Added, ip)
+		}
+	}
+	for ip := range prev {
+		if !cur[ip] {
+			change.Removed = append(change.Removed, ip)
+		}
+	}
+	if len(change.Added) == 0 && len(change.Removed) == 0 {
+		return nil
+	}
+	sort.Strings(change.Added)
+	sort.Strings(change.Removed)
+	return change
+}
+
+// GetIPsForPTR returns up to limit distinct addresses whose PTR name was never looked up
+// or was looked up before refreshInterval ago, never-resolved addresses first.
+func (db *Database) GetIPsForPTR(refreshInterval time.Duration, limit int) ([]string, error) {
+	rows, err := db.DB.Query(
+		`SELECT ip.ip
+		FROM ip
+		LEFT JOIN ip_ptr p ON p.ip = ip.ip
+		WHERE p.ip IS NULL OR p.time <= $1
+		GROUP BY ip.ip, p.time
+		ORDER BY p.time NULLS FIRST
+		LIMIT $2`,
+		time.Now().Add(-refreshInterval), limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query IPs for PTR lookup: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var ips []string
+	for rows.Next() {
+		var ip string
+		if err := rows.Scan(&ip); err != nil {
+			return nil, fmt.Errorf("failed to scan IP: %w", err)
+		}
+		ips = append(ips, ip)
+	}
+
+	return ips, rows.Err()
+}
+
+// UpsertIPPTR caches the PTR name of an address (empty ptr = no PTR record).
+func (db *Database) UpsertIPPTR(ip, ptr string) error {
+	_, err := db.DB.Exec(
+		`INSERT INTO ip_ptr (ip, ptr, time)
+		VALUES ($1, $2, $3)
+		ON CONFLICT(ip) DO UPDATE SET
+			ptr = $2,
+			time = $3`,
+		ip, ptr, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to upsert IP PTR: %w", err)
 	}
 
 	return nil
 }
 
-// InsertDomainStat inserts a new statistics record
-func (db *Database) InsertDomainStat(domain, clientIP, rtype string) error {
-	now := time.Now()
+// GetIPsForGeo returns up to limit distinct addresses never annotated with ASN/country
+// data or annotated before enrichedBefore (the last update of the MMDB databases).
+func (db *Database) GetIPsForGeo(enrichedBefore time.Time, limit int) ([]string, error) {
+	rows, err := db.DB.Query(
+		`SELECT DISTINCT ip
+		FROM ip
+		WHERE geo_time IS NULL OR geo_time < $1
+		LIMIT $2`,
+		enrichedBefore, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query IPs for geo enrichment: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var ips []string
+	for rows.Next() {
+		var ip string
+		if err := rows.Scan(&ip); err != nil {
+			return nil, fmt.Errorf("failed to scan IP: %w", err)
+		}
+		ips = append(ips, ip)
+	}
+
+	return ips, rows.Err()
+}
 
+// UpdateIPGeo stores the ASN and country of an address on all its ip rows.
+// Zero asn and empty strings are stored as NULL (unknown).
+func (db *Database) UpdateIPGeo(ip string, asn int64, asOrg, country string) error {
 	_, err := db.DB.Exec(
-		`INSERT INTO domain_stat (domain, client_ip, rtype, timestamp)
-		VALUES ($1, $2, $3, $4)`,
-		domain, clientIP, rtype, now,
+		`UPDATE ip SET
+			asn = NULLIF($1::BIGINT, 0),
+			as_org = NULLIF($2, ''),
+			country = NULLIF($3, ''),
+			geo_time = $4
+		WHERE ip = $5`,
+		asn, asOrg, country, time.Now(), ip,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to insert domain stat: %w", err)
+		return fmt.Errorf("failed to update IP geo data: %w", err)
 	}
 
 	return nil
 }
 
-// DeleteOldStats deletes statistics records older than the specified number of days
-func (db *Database) DeleteOldStats(retentionDays int) (int64, error) {
-	cutoffTime := time.Now().AddDate(0, 0, -retentionDays)
+// GetWildcardCandidates returns parent zones worth probing for a wildcard: zones with at
+// least minSiblings unmarked children resolving to an identical IPv4 set that were not
+// probed since checkedBefore, and known wildcard zones due for a re-check.
+// Single-label parents (TLDs) are never returned.
+func (db *Database) GetWildcardCandidates(minSiblings int, checkedBefore time.Time, limit int) ([]string, error) {
+	rows, err := db.DB.Query(
+		`WITH children AS (
+			SELECT substr(d.domain, strpos(d.domain, '.') + 1) AS parent,
+				string_agg(host(ip.ip), ',' ORDER BY ip.ip) AS ips
+			FROM domain d
+			JOIN ip ON ip.domain_id = d.id AND ip.type = 'ipv4'
+			WHERE d.wildcard_zone IS NULL
+			GROUP BY d.id
+		)
+		(SELECT DISTINCT parent FROM children c
+		WHERE rtrim(parent, '.') LIKE '%.%'
+		AND NOT EXISTS (SELECT 1 FROM wildcard_zone z WHERE z.zone = c.parent AND z.checked_at > $2)
+		GROUP BY parent, ips
+		HAVING COUNT(*) >= $1)
+		UNION
+		(SELECT zone FROM wildcard_zone WHERE is_wildcard AND checked_at <= $2)
+		LIMIT $3`,
+		minSiblings, checkedBefore, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get wildcard candidates: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var zones []string
+	for rows.Next() {
+		var zone string
+		if err := rows.Scan(&zone); err != nil {
+			return nil, fmt.Errorf("failed to scan zone: %w", err)
+		}
+		zones = append(zones, zone)
+	}
+
+	return zones, rows.Err()
+}
+
+// RecordWildcardProbe stores the result of a wildcard probe of zone. Children of a wildcard
+// zone are marked with it (the most specific zone wins); when a zone stops being wildcard
+// its children are unmarked. Returns the number of domains marked or unmarked.
+func (db *Database) RecordWildcardProbe(zone string, wildcard bool) (int64, error) {
+	now := time.Now()
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.Exec(
+		`INSERT INTO wildcard_zone (zone, is_wildcard, detected_at, checked_at)
+		VALUES ($1, $2, CASE WHEN $2::BOOLEAN THEN $3::TIMESTAMP END, $3)
+		ON CONFLICT (zone) DO UPDATE SET
+			is_wildcard = EXCLUDED.is_wildcard,
+			detected_at = CASE WHEN EXCLUDED.is_wildcard
+				THEN COALESCE(wildcard_zone.detected_at, EXCLUDED.detected_at) END,
+			checked_at = EXCLUDED.checked_at`,
+		zone, wildcard, now,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record wildcard probe: %w", err)
+	}
+
+	var result sql.Result
+	if wildcard {
+		result, err = tx.Exec(
+			`UPDATE domain SET wildcard_zone = $1
+			WHERE right(domain, length($1) + 1) = '.' || $1
+			AND (wildcard_zone IS NULL OR length(wildcard_zone) < length($1))`,
+			zone,
+		)
+	} else {
+		result, err = tx.Exec(`UPDATE domain SET wildcard_zone = NULL WHERE wildcard_zone = $1`, zone)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to update wildcard children: %w", err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
 
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return updated, nil
+}
+
+// MarkWildcardChildren marks domains added under already known wildcard zones.
+func (db *Database) MarkWildcardChildren() (int64, error) {
 	result, err := db.DB.Exec(
-		`DELETE FROM domain_stat WHERE timestamp < $1`,
-		cutoffTime,
+		`UPDATE domain d SET wildcard_zone = z.zone
+		FROM wildcard_zone z
+		WHERE z.is_wildcard AND d.wildcard_zone IS NULL
+		AND right(d.domain, length(z.zone) + 1) = '.' || z.zone`,
 	)
 	if err != nil {
-		return 0, fmt.Errorf("failed to delete old stats: %w", err)
+		return 0, fmt.Errorf("failed to mark wildcard children: %w", err)
 	}
 
-	deleted, err := result.RowsAffected()
+	marked, err := result.RowsAffected()
 	if err != nil {
 		return 0, fmt.Errorf("failed to get rows affected: %w", err)
 	}
+	return marked, nil
+}
 
-	return deleted, nil
+// resolvCountExpr returns the SQL expression for the next resolv_count value
+// In cyclic mode, resets resolv_count to ⌊max_resolv × 2/3⌋ when it reaches max_resolv - 1
+// This keeps domains in a partial cycle rather than full reset to 0
+// Examples: max_resolv=10 → reset to 6, max_resolv=3 → reset to 2
+func resolvCountExpr(cyclicMode bool) string {
+	if cyclicMode {
+		return `CASE
+				WHEN resolv_count >= max_resolv - 1 THEN CAST(max_resolv * 2.0 / 3.0 AS INTEGER)
+				ELSE resolv_count + 1
+			END`
+	}
+	// Legacy mode: just increment
+	return `resolv_count + 1`
+}
+
+// UpdateDomainResolvStats updates resolv_count and last_resolv_time after a successful resolution
+// In cyclic mode, resets resolv_count to ⌊max_resolv × 2/3⌋ when it reaches max_resolv - 1
+// This prevents domains from completing a full cycle and triggering cooldown logic
+// Any failure backoff state and the resolver lease are cleared.
+func (db *Database) UpdateDomainResolvStats(domainID int64, cyclicMode bool) error {
+	now := time.Now()
+
+	query := fmt.Sprintf(`UPDATE domain
+		SET resolv_count = %s,
+		    last_resolv_time = $1,
+		    last_error = NULL,
+		    consecutive_failures = 0,
+		    next_resolv_time = NULL,
+		    leased_until = NULL
+		WHERE id = $2`, resolvCountExpr(cyclicMode))
+
+	_, err := db.DB.Exec(query, now, domainID)
+	if err != nil {
+		return fmt.Errorf("failed to update domain stats: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateDomainResolvFailure records a failed resolution of a domain
+// resolv_count and last_resolv_time advance as for a successful resolution, the
+// error class is stored and the next attempt is postponed with exponential backoff:
+// base × 2^(consecutive failures so far), capped at max.
+func (db *Database) UpdateDomainResolvFailure(domainID int64, cyclicMode bool, errClass string, backoffBase, backoffMax time.Duration) error {
+	now := time.Now()
+
+	query := fmt.Sprintf(`UPDATE domain
+		SET resolv_count = %s,
+		    last_resolv_time = $1,
+		    last_error = $2,
+		    consecutive_failures = consecutive_failures + 1,
+		    next_resolv_time = $1 + LEAST($3 * POWER(2, LEAST(consecutive_failures, 30)), $4) * INTERVAL '1 second',
+		    leased_until = NULL
+		WHERE id = $5`, resolvCountExpr(cyclicMode))
+
+	_, err := db.DB.Exec(query, now, errClass, backoffBase.Seconds(), backoffMax.Seconds(), domainID)
+	if err != nil {
+		return fmt.Errorf("failed to update domain failure stats: %w", err)
+	}
+
+	return nil
 }
 
-// UpdateDomainLastSeen updates the last_seen timestamp for a domain
+// InsertDomainStat inserts a new statistics record. A client IP that is not
+// a valid address (e.g. "unknown") is stored as NULL.
+func (db *Database) InsertDomainStat(domain, clientIP, qtype, rtype string) error {
+	now := time.Now()
+
+	var client interface{}
+	if net.ParseIP(clientIP) != nil {
+		client = clientIP
+	}
+
+	_, err := db.DB.Exec(
+		`INSERT INTO domain_stat (domain, client_ip, qtype, rtype, timestamp)
+		VALUES ($1, $2, $3, $4, $5)`,
+		domain, client, qtype, rtype, now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert domain stat: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateDomainLastSeen updates the last_seen timestamp and the query counter for a domain
 // Called when a DNS query is received for the domain
 func (db *Database) UpdateDomainLastSeen(domainID int64) error {
 	now := time.Now()
 
 	_, err := db.DB.Exec(
-		`UPDATE domain SET last_seen = $1 WHERE id = $2`,
+		`UPDATE domain SET last_seen = $1, query_count = query_count + 1 WHERE id = $2`,
 		now, domainID,
 	)
 	if err != nil {
@@ -364,26 +967,95 @@ func (db *Database) GetIPsCount() (int64, error) {
 	return count, nil
 }
 
-// DeleteExpiredIPs deletes IP addresses older than the specified TTL
+// GetBackoffDomainsCount returns the number of domains currently in failure backoff,
+// grouped by the error class of their last failed resolution.
+func (db *Database) GetBackoffDomainsCount() (map[string]int64, error) {
+	rows, err := db.DB.Query(
+		`SELECT COALESCE(last_error, 'error'), COUNT(*)
+		FROM domain
+		WHERE next_resolv_time > $1
+		GROUP BY 1`,
+		time.Now(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count domains in backoff: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var errClass string
+		var count int64
+		if err := rows.Scan(&errClass, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan backoff count: %w", err)
+		}
+		counts[errClass] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// UpdateDomainDNSSECStatus records the result of the domain's latest DNSSEC check.
+func (db *Database) UpdateDomainDNSSECStatus(domainID int64, status string) error {
+	_, err := db.DB.Exec(`UPDATE domain SET dnssec_status = $1 WHERE id = $2`, status, domainID)
+	if err != nil {
+		return fmt.Errorf("failed to update domain dnssec_status: %w", err)
+	}
+	return nil
+}
+
+// GetDNSSECStatusCounts returns the number of checked domains grouped by DNSSEC status.
+func (db *Database) GetDNSSECStatusCounts() (map[string]int64, error) {
+	rows, err := db.DB.Query(
+		`SELECT dnssec_status, COUNT(*)
+		FROM domain
+		WHERE dnssec_status IS NOT NULL
+		GROUP BY 1`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count domains by dnssec status: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var status string
+		var count int64
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan dnssec status count: %w", err)
+		}
+		counts[status] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// DeleteExpiredIPs deletes up to limit IP addresses older than the specified TTL
 // Only deletes IPs for domains that are still being queried (last_seen >= cutoff)
-// IPs of inactive domains are preserved
-func (db *Database) DeleteExpiredIPs(ttlDays int) (int64, error) {
+// and within scope. IPs of inactive domains are preserved
+func (db *Database) DeleteExpiredIPs(ttlDays int, scope RetentionScope, limit int) (int64, error) {
 	if ttlDays <= 0 {
 		return 0, nil // TTL disabled
 	}
 
 	cutoffTime := time.Now().AddDate(0, 0, -ttlDays)
+	r := &retentionSQL{domainCol: "domain", args: []interface{}{cutoffTime, limit}}
+	inScope := r.scope(scope)
 
 	// Delete old IPs only for active domains (domains that have been queried recently)
 	// This protects IPs of domains that are no longer being queried
 	result, err := db.DB.Exec(
 		`DELETE FROM ip
-		WHERE time < $1
-		AND domain_id IN (
-			SELECT id FROM domain
-			WHERE last_seen >= $1
+		WHERE id IN (
+			SELECT id FROM ip
+			WHERE time < $1
+			AND domain_id IN (
+				SELECT id FROM domain
+				WHERE last_seen >= $1`+inScope+`
+			)
+			LIMIT $2
 		)`,
-		cutoffTime,
+		r.args...,
 	)
 	if err != nil {
 		return 0, fmt.Errorf("failed to delete expired IPs: %w", err)
@@ -397,16 +1069,18 @@ func (db *Database) DeleteExpiredIPs(ttlDays int) (int64, error) {
 	return deleted, nil
 }
 
-// DeleteOldDomains deletes domains not seen in the specified TTL period
+// DeleteOldDomains deletes up to limit domains within scope not seen in the specified TTL period
 // Also explicitly deletes associated IPs first for better metrics tracking
 // Domains with NULL last_seen are preserved (never queried, only resolved)
 // Returns counts: (domains deleted, IPs deleted, error)
-func (db *Database) DeleteOldDomains(ttlDays int) (int64, int64, error) {
+func (db *Database) DeleteOldDomains(ttlDays int, scope RetentionScope, limit int) (int64, int64, error) {
 	if ttlDays <= 0 {
 		return 0, 0, nil // TTL disabled
 	}
 
 	cutoffTime := time.Now().AddDate(0, 0, -ttlDays)
+	r := &retentionSQL{domainCol: "domain", args: []interface{}{cutoffTime, limit}}
+	inScope := r.scope(scope)
 
 	// Start transaction for atomic operation
 	tx, err := db.DB.Begin()
@@ -414,22 +1088,45 @@ func (db *Database) DeleteOldDomains(ttlDays int) (int64, int64, error) {
 		return 0, 0, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer func() {
-		if err := tx.Rollback(); err != nil {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
 			log.Printf("Error rolling back transaction: %v", err)
 		}
 	}()
 
-	// Step 1: Explicitly delete IPs for old domains (for metrics tracking)
-	// Only delete domains where last_seen is NOT NULL and is old
-	ipResult, err := tx.Exec(
-		`DELETE FROM ip
-		WHERE domain_id IN (
-			SELECT id FROM domain
-			WHERE last_seen IS NOT NULL
-			AND last_seen < $1
-		)`,
-		cutoffTime,
+	// Step 1: Pick the batch of old domains (where last_seen is NOT NULL and is old).
+	// Domains with NULL last_seen are preserved (these are domains that were
+	// added for resolution but never actually queried by clients).
+	// The rows are locked, so a query arriving meanwhile can't refresh them.
+	rows, err := tx.Query(
+		`SELECT id FROM domain
+		WHERE last_seen IS NOT NULL
+		AND last_seen < $1`+inScope+`
+		ORDER BY id
+		LIMIT $2
+		FOR UPDATE`,
+		r.args...,
 	)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to query old domains: %w", err)
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			_ = rows.Close()
+			return 0, 0, fmt.Errorf("failed to scan old domain: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, 0, fmt.Errorf("failed to query old domains: %w", err)
+	}
+	if len(ids) == 0 {
+		return 0, 0, nil
+	}
+
+	// Step 2: Explicitly delete IPs of the batch (for metrics tracking)
+	ipResult, err := tx.Exec(`DELETE FROM ip WHERE domain_id = ANY($1)`, pq.Array(ids))
 	if err != nil {
 		return 0, 0, fmt.Errorf("failed to delete IPs for old domains: %w", err)
 	}
@@ -439,15 +1136,8 @@ func (db *Database) DeleteOldDomains(ttlDays int) (int64, int64, error) {
 		return 0, 0, fmt.Errorf("failed to get IP rows affected: %w", err)
 	}
 
-	// Step 2: Delete old domains (with non-NULL last_seen)
-	// Domains with NULL last_seen are preserved (these are domains that were
-	// added for resolution but never actually queried by clients)
-	domainResult, err := tx.Exec(
-		`DELETE FROM domain
-		WHERE last_seen IS NOT NULL
-		AND last_seen < $1`,
-		cutoffTime,
-	)
+	// Step 3: Delete the domains of the batch
+	domainResult, err := tx.Exec(`DELETE FROM domain WHERE id = ANY($1)`, pq.Array(ids))
 	if err != nil {
 		return 0, 0, fmt.Errorf("failed to delete old domains: %w", err)
 	}
@@ -464,3 +1154,56 @@ func (db *Database) DeleteOldDomains(ttlDays int) (int64, int64, error) {
 
 	return domainsDeleted, ipsDeleted, nil
 }
+
+// DeleteOldIPChangeEvents deletes up to limit IP change events older than the specified number of days.
+func (db *Database) DeleteOldIPChangeEvents(days, limit int) (int64, error) {
+	cutoff := time.Now().AddDate(0, 0, -days)
+
+	result, err := db.DB.Exec(
+		`DELETE FROM ip_change_event
+		WHERE id IN (SELECT id FROM ip_change_event WHERE time < $1 LIMIT $2)`,
+		cutoff, limit,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete old IP change events: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return deleted, nil
+}
+
+// DeleteOrphanedPTRs deletes up to limit cached PTR names of addresses no longer present in the ip table.
+func (db *Database) DeleteOrphanedPTRs(limit int) (int64, error) {
+	result, err := db.DB.Exec(
+		`DELETE FROM ip_ptr
+		WHERE ip IN (
+			SELECT p.ip FROM ip_ptr p
+			WHERE NOT EXISTS (SELECT 1 FROM ip WHERE ip.ip = p.ip)
+			LIMIT $1
+		)`,
+		limit,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete orphaned PTRs: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return deleted, nil
+}
+
+// VacuumAnalyze reclaims the space of deleted rows of a table and refreshes its
+// planner statistics. Run after large cleanups.
+func (db *Database) VacuumAnalyze(table string) error {
+	if _, err := db.DB.Exec(`VACUUM (ANALYZE) ` + pq.QuoteIdentifier(table)); err != nil {
+		return fmt.Errorf("failed to vacuum %s: %w", table, err)
+	}
+	return nil
+}
@@ -2,10 +2,12 @@ package database
 
 import (
 	"database/sql"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
 )
 
 func TestInsertOrGetDomain_NewDomain(t *testing.T) {
@@ -22,10 +24,10 @@ func TestInsertOrGetDomain_NewDomain(t *testing.T) {
 		AddRow(1, "example.com", now, 0, 10, now, now)
 
 	mock.ExpectQuery(`INSERT INTO domain`).
-		WithArgs("example.com", sqlmock.AnyArg(), 10, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WithArgs("example.com", sqlmock.AnyArg(), 10, sqlmock.AnyArg(), sqlmock.AnyArg(), "", 0).
 		WillReturnRows(rows)
 
-	domain, isNew, err := database.InsertOrGetDomain("example.com", 10)
+	domain, isNew, err := database.InsertOrGetDomain("example.com", DomainPolicy{MaxResolv: 10})
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -60,7 +62,7 @@ func TestInsertOrGetDomain_ExistingDomain(t *testing.T) {
 
 	// First query returns no rows (conflict)
 	mock.ExpectQuery(`INSERT INTO domain`).
-		WithArgs("example.com", sqlmock.AnyArg(), 10, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WithArgs("example.com", sqlmock.AnyArg(), 10, sqlmock.AnyArg(), sqlmock.AnyArg(), "", 0).
 		WillReturnError(sql.ErrNoRows)
 
 	// Second query fetches existing domain
@@ -71,7 +73,7 @@ func TestInsertOrGetDomain_ExistingDomain(t *testing.T) {
 		WithArgs("example.com").
 		WillReturnRows(rows)
 
-	domain, isNew, err := database.InsertOrGetDomain("example.com", 10)
+	domain, isNew, err := database.InsertOrGetDomain("example.com", DomainPolicy{MaxResolv: 10})
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -91,7 +93,7 @@ func TestInsertOrGetDomain_ExistingDomain(t *testing.T) {
 	}
 }
 
-func TestGetDomainsToResolve(t *testing.T) {
+func TestClaimDomainsToResolve(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
 		t.Fatalf("Failed to create mock: %v", err)
@@ -105,12 +107,13 @@ func TestGetDomainsToResolve(t *testing.T) {
 		AddRow(1, "example.com", now, 0, 10, now, now).
 		AddRow(2, "test.com", now, 3, 10, now, now)
 
-	mock.ExpectQuery(`SELECT id, domain, time_insert, resolv_count, max_resolv, last_resolv_time, last_seen FROM domain WHERE resolv_count < max_resolv ORDER BY last_resolv_time ASC LIMIT`).
-		WithArgs(10).
+	mock.ExpectQuery(`UPDATE domain SET leased_until = \$3 WHERE id IN \( SELECT id FROM domain WHERE resolv_count < max_resolv AND \(last_resolv_time <= time_insert OR last_resolv_time <= COALESCE\(\$2::TIMESTAMP - resolv_interval \* INTERVAL '1 second', \$1\)\) AND \(next_resolv_time IS NULL OR next_resolv_time <= \$2\) AND \(leased_until IS NULL OR leased_until <= \$2\) ORDER BY last_resolv_time <= time_insert DESC, domain_priority\(query_count, last_seen, last_resolv_time, \$2, \$4, \$5, \$6\) DESC LIMIT \$7 FOR UPDATE SKIP LOCKED \) RETURNING id, domain, time_insert, resolv_count, max_resolv, last_resolv_time, last_seen`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), 2.0, 1.0, 0.5, 10).
 		WillReturnRows(rows)
 
 	// Test legacy mode (cyclicMode = false)
-	domains, err := database.GetDomainsToResolve(10, false, 0)
+	weights := PriorityWeights{Popularity: 2, Recency: 1, Staleness: 0.5}
+	domains, err := database.ClaimDomainsToResolve(10, false, 0, 5*time.Minute, time.Minute, weights, false)
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -131,7 +134,7 @@ func TestGetDomainsToResolve(t *testing.T) {
 	}
 }
 
-func TestGetDomainsToResolve_Empty(t *testing.T) {
+func TestClaimDomainsToResolve_Empty(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
 		t.Fatalf("Failed to create mock: %v", err)
@@ -142,12 +145,12 @@ func TestGetDomainsToResolve_Empty(t *testing.T) {
 
 	rows := sqlmock.NewRows([]string{"id", "domain", "time_insert", "resolv_count", "max_resolv", "last_resolv_time", "last_seen"})
 
-	mock.ExpectQuery(`SELECT id, domain, time_insert, resolv_count, max_resolv, last_resolv_time, last_seen FROM domain WHERE resolv_count < max_resolv`).
-		WithArgs(10).
+	mock.ExpectQuery(`UPDATE domain SET leased_until = \$3 WHERE id IN \( SELECT id FROM domain WHERE resolv_count < max_resolv`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), 10).
 		WillReturnRows(rows)
 
 	// Test legacy mode (cyclicMode = false)
-	domains, err := database.GetDomainsToResolve(10, false, 0)
+	domains, err := database.ClaimDomainsToResolve(10, false, 0, 5*time.Minute, time.Minute, PriorityWeights{}, false)
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -161,6 +164,236 @@ func TestGetDomainsToResolve_Empty(t *testing.T) {
 	}
 }
 
+func TestClaimDomainsToResolve_CyclicMode(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	database := &Database{DB: db}
+	now := time.Now()
+
+	rows := sqlmock.NewRows([]string{"id", "domain", "time_insert", "resolv_count", "max_resolv", "last_resolv_time", "last_seen"}).
+		AddRow(1, "example.com", now, 7, 10, now, now)
+
+	mock.ExpectQuery(`UPDATE domain SET leased_until = \$4 WHERE id IN \( SELECT id FROM domain WHERE \(resolv_count < max_resolv OR \(resolv_count >= max_resolv AND max_resolv > 0 AND last_resolv_time < \$3\)\) AND \(last_resolv_time <= time_insert OR last_resolv_time <= COALESCE\(\$2::TIMESTAMP - resolv_interval \* INTERVAL '1 second', \$1\)\) AND \(next_resolv_time IS NULL OR next_resolv_time <= \$2\) AND \(leased_until IS NULL OR leased_until <= \$2\) ORDER BY last_resolv_time <= time_insert DESC, domain_priority\(query_count, last_seen, last_resolv_time, \$2, \$5, \$6, \$7\) DESC LIMIT \$8 FOR UPDATE SKIP LOCKED \)`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), 1.0, 1.0, 1.0, 50).
+		WillReturnRows(rows)
+
+	domains, err := database.ClaimDomainsToResolve(50, true, 240, time.Minute, time.Minute, PriorityWeights{Popularity: 1, Recency: 1, Staleness: 1}, false)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(domains) != 1 {
+		t.Fatalf("Expected 1 domain, got %d", len(domains))
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestInsertOrGetDomain_Policy(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	database := &Database{DB: db}
+	now := time.Now()
+
+	rows := sqlmock.NewRows([]string{"id", "domain", "time_insert", "resolv_count", "max_resolv", "last_resolv_time", "last_seen"}).
+		AddRow(1, "online.bank.example", now, 0, 100, now, now)
+
+	mock.ExpectQuery(`INSERT INTO domain \(domain, time_insert, resolv_count, max_resolv, last_resolv_time, last_seen, policy, resolv_interval\) VALUES \(\$1, \$2, 0, \$3, \$4, \$5, NULLIF\(\$6, ''\), NULLIF\(\$7, 0\)\)`).
+		WithArgs("online.bank.example", sqlmock.AnyArg(), 100, sqlmock.AnyArg(), sqlmock.AnyArg(), "banking", 60).
+		WillReturnRows(rows)
+
+	domain, isNew, err := database.InsertOrGetDomain("online.bank.example", DomainPolicy{Name: "banking", MaxResolv: 100, IntervalSeconds: 60})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !isNew || domain.MaxResolv != 100 {
+		t.Errorf("Expected new domain with MaxResolv=100, got isNew=%v MaxResolv=%d", isNew, domain.MaxResolv)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestGetDomainPolicies(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	database := &Database{DB: db}
+
+	rows := sqlmock.NewRows([]string{"id", "domain", "policy", "max_resolv", "resolv_interval"}).
+		AddRow(11, "example.com", "", 10, 0).
+		AddRow(12, "host.corp.local", "corp", 0, 0)
+
+	mock.ExpectQuery(`SELECT id, domain, COALESCE\(policy, ''\), max_resolv, COALESCE\(resolv_interval, 0\) FROM domain WHERE id > \$1 ORDER BY id LIMIT \$2`).
+		WithArgs(int64(10), 1000).
+		WillReturnRows(rows)
+
+	domains, err := database.GetDomainPolicies(10, 1000)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(domains) != 2 {
+		t.Fatalf("Expected 2 domains, got %d", len(domains))
+	}
+	if domains[1].Policy != (DomainPolicy{Name: "corp"}) {
+		t.Errorf("Unexpected policy: %+v", domains[1].Policy)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestUpdateDomainPolicy(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	database := &Database{DB: db}
+
+	mock.ExpectExec(`UPDATE domain SET policy = NULLIF\(\$1, ''\), max_resolv = \$2, resolv_interval = NULLIF\(\$3, 0\) WHERE id = \$4`).
+		WithArgs("corp", 0, 0, int64(12)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := database.UpdateDomainPolicy(12, DomainPolicy{Name: "corp"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestClaimDomain(t *testing.T) {
+	tests := []struct {
+		name     string
+		affected int64
+		expected bool
+	}{
+		{"claimed", 1, true},
+		{"leased by another resolver", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("Failed to create mock: %v", err)
+			}
+			defer func() { _ = db.Close() }()
+
+			database := &Database{DB: db}
+
+			mock.ExpectExec(`UPDATE domain SET leased_until = \$1 WHERE id = \$2 AND \(leased_until IS NULL OR leased_until <= \$3\)`).
+				WithArgs(sqlmock.AnyArg(), int64(42), sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(0, tt.affected))
+
+			claimed, err := database.ClaimDomain(42, time.Minute)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if claimed != tt.expected {
+				t.Errorf("Expected claimed=%v, got %v", tt.expected, claimed)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestUpdateDomainLastSeen(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	database := &Database{DB: db}
+
+	mock.ExpectExec(`UPDATE domain SET last_seen = \$1, query_count = query_count \+ 1 WHERE id = \$2`).
+		WithArgs(sqlmock.AnyArg(), int64(5)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := database.UpdateDomainLastSeen(5); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestCountDomainsToResolve(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	database := &Database{DB: db}
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM domain WHERE resolv_count < max_resolv AND`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1234))
+
+	count, err := database.CountDomainsToResolve(false, 0, time.Minute, false)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if count != 1234 {
+		t.Errorf("Expected backlog=1234, got %d", count)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRequeueDomains(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	database := &Database{DB: db}
+
+	mock.ExpectExec(`UPDATE domain\s+SET last_resolv_time = time_insert,.*WHERE domain ~ \$1 AND max_resolv > 0`).
+		WithArgs(`\.example\.com\.$`).
+		WillReturnResult(sqlmock.NewResult(0, 7))
+
+	requeued, err := database.RequeueDomains(`\.example\.com\.$`)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if requeued != 7 {
+		t.Errorf("Expected 7 requeued domains, got %d", requeued)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
 func TestInsertOrUpdateIP_New(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -170,14 +403,349 @@ func TestInsertOrUpdateIP_New(t *testing.T) {
 
 	database := &Database{DB: db}
 
-	mock.ExpectExec(`INSERT INTO ip`).
-		WithArgs(1, "192.168.1.1", "A", sqlmock.AnyArg(), sqlmock.AnyArg(), "A").
-		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`INSERT INTO ip .* ON CONFLICT\(domain_id, ip\) DO UPDATE SET time = \$4, type = \$3, last_seen = \$4, seen_count = ip.seen_count \+ 1, last_source = \$5`).
+		WithArgs(1, "192.168.1.1", "A", sqlmock.AnyArg(), SourceResolver).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err = database.InsertOrUpdateIP(1, "192.168.1.1", "A", SourceResolver)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestInsertOrUpdateIPVantage(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	database := &Database{DB: db}
+
+	mock.ExpectExec(`WITH upserted AS \( INSERT INTO ip .* RETURNING id \) INSERT INTO ip_vantage \(ip_id, vantage, time\) SELECT id, \$5, \$4 FROM upserted ON CONFLICT\(ip_id, vantage\) DO UPDATE SET time = \$4`).
+		WithArgs(int64(1), "203.0.113.10", "ipv4", sqlmock.AnyArg(), "msk", SourceResolver, 1).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	// A second vantage returning the address in the same resolution doesn't count it again
+	mock.ExpectExec(`seen_count = ip.seen_count \+ \$7`).
+		WithArgs(int64(1), "203.0.113.10", "ipv4", sqlmock.AnyArg(), "ams", SourceResolver, 0).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err = database.InsertOrUpdateIPVantage(1, "203.0.113.10", "ipv4", "msk", false)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	err = database.InsertOrUpdateIPVantage(1, "203.0.113.10", "ipv4", "ams", true)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestInsertOrUpdateIP_Passive(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	database := &Database{DB: db}
+
+	mock.ExpectExec(`INSERT INTO ip \(domain_id, ip, type, time, first_seen, last_seen, seen_count, first_source, last_source\) VALUES \(\$1, \$2, \$3, \$4, \$4, \$4, 1, \$5, \$5\)`).
+		WithArgs(int64(7), "203.0.113.20", "ipv4", sqlmock.AnyArg(), SourcePassive).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	if err := database.InsertOrUpdateIP(7, "203.0.113.20", "ipv4", SourcePassive); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRecordIPResolution(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	database := &Database{DB: db}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT ip FROM ip WHERE domain_id = \$1 AND type = ANY\(\$2\) AND seen_history & 1 = 1 FOR UPDATE`).
+		WithArgs(int64(1), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"ip"}).AddRow("203.0.113.10").AddRow("2001:db8::1"))
+	mock.ExpectExec(`UPDATE ip SET seen_history = \(\(seen_history << 1\) \| CASE WHEN ip = ANY\(\$2::inet\[\]\) THEN 1 ELSE 0 END\) & \$3 WHERE domain_id = \$1 AND type = ANY\(\$4\)`).
+		WithArgs(int64(1), sqlmock.AnyArg(), int64(0xFFFFFFFF), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	change, err := database.RecordIPResolution(1, []string{"ipv4", "ipv6"}, []string{"2001:db8::1", "203.0.113.10"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if change != nil {
+		t.Errorf("Expected no change for the same IP set, got %+v", change)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestGetIPsForPTR(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	database := &Database{DB: db}
+
+	rows := sqlmock.NewRows([]string{"ip"}).
+		AddRow("203.0.113.10").
+		AddRow("2001:db8::1")
+
+	mock.ExpectQuery(`SELECT ip.ip FROM ip LEFT JOIN ip_ptr p ON p.ip = ip.ip WHERE p.ip IS NULL OR p.time <= \$1 GROUP BY ip.ip, p.time ORDER BY p.time NULLS FIRST LIMIT \$2`).
+		WithArgs(sqlmock.AnyArg(), 50).
+		WillReturnRows(rows)
+
+	ips, err := database.GetIPsForPTR(24*time.Hour, 50)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(ips) != 2 || ips[0] != "203.0.113.10" {
+		t.Errorf("Unexpected IPs: %v", ips)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestUpsertIPPTR(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	database := &Database{DB: db}
+
+	mock.ExpectExec(`INSERT INTO ip_ptr \(ip, ptr, time\) VALUES \(\$1, \$2, \$3\) ON CONFLICT\(ip\) DO UPDATE SET ptr = \$2, time = \$3`).
+		WithArgs("203.0.113.10", "edge.example.net", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	if err := database.UpsertIPPTR("203.0.113.10", "edge.example.net"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestDeleteOrphanedPTRs(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	database := &Database{DB: db}
+
+	mock.ExpectExec(`DELETE FROM ip_ptr WHERE ip IN \( SELECT p.ip FROM ip_ptr p WHERE NOT EXISTS \(SELECT 1 FROM ip WHERE ip.ip = p.ip\) LIMIT \$1 \)`).
+		WithArgs(1000).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	deleted, err := database.DeleteOrphanedPTRs(1000)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if deleted != 3 {
+		t.Errorf("Expected 3 deleted PTRs, got %d", deleted)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestGetIPsForGeo(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	database := &Database{DB: db}
+
+	loadedAt := time.Now().Add(-time.Hour)
+	rows := sqlmock.NewRows([]string{"ip"}).AddRow("203.0.113.10")
+
+	mock.ExpectQuery(`SELECT DISTINCT ip FROM ip WHERE geo_time IS NULL OR geo_time < \$1 LIMIT \$2`).
+		WithArgs(loadedAt, 1000).
+		WillReturnRows(rows)
+
+	ips, err := database.GetIPsForGeo(loadedAt, 1000)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(ips) != 1 || ips[0] != "203.0.113.10" {
+		t.Errorf("Unexpected IPs: %v", ips)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestUpdateIPGeo(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	database := &Database{DB: db}
+
+	mock.ExpectExec(`UPDATE ip SET asn = NULLIF\(\$1::BIGINT, 0\), as_org = NULLIF\(\$2, ''\), country = NULLIF\(\$3, ''\), geo_time = \$4 WHERE ip = \$5`).
+		WithArgs(int64(13335), "CLOUDFLARENET", "US", sqlmock.AnyArg(), "104.16.0.1").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	if err := database.UpdateIPGeo("104.16.0.1", 13335, "CLOUDFLARENET", "US"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestCountDomainsToResolve_CollapseWildcards(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	database := &Database{DB: db}
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM domain WHERE .* AND \(wildcard_zone IS NULL OR id = \(SELECT MIN\(c.id\) FROM domain c WHERE c.wildcard_zone = domain.wildcard_zone\)\)`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(10))
+
+	count, err := database.CountDomainsToResolve(false, 0, time.Minute, true)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if count != 10 {
+		t.Errorf("Expected backlog=10, got %d", count)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestGetWildcardCandidates(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	database := &Database{DB: db}
+
+	mock.ExpectQuery(`WITH children AS .* GROUP BY parent, ips HAVING COUNT\(\*\) >= \$1\) UNION \(SELECT zone FROM wildcard_zone WHERE is_wildcard AND checked_at <= \$2\) LIMIT \$3`).
+		WithArgs(5, sqlmock.AnyArg(), 50).
+		WillReturnRows(sqlmock.NewRows([]string{"parent"}).AddRow("track.example.com").AddRow("cdn.example.net"))
+
+	zones, err := database.GetWildcardCandidates(5, time.Now(), 50)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(zones) != 2 || zones[0] != "track.example.com" {
+		t.Errorf("Unexpected zones: %v", zones)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRecordWildcardProbe(t *testing.T) {
+	tests := []struct {
+		name     string
+		wildcard bool
+		update   string
+	}{
+		{"wildcard", true, `UPDATE domain SET wildcard_zone = \$1 WHERE right\(domain, length\(\$1\) \+ 1\) = '\.' \|\| \$1`},
+		{"not wildcard", false, `UPDATE domain SET wildcard_zone = NULL WHERE wildcard_zone = \$1`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("Failed to create mock: %v", err)
+			}
+			defer func() { _ = db.Close() }()
+
+			database := &Database{DB: db}
+
+			mock.ExpectBegin()
+			mock.ExpectExec(`INSERT INTO wildcard_zone`).
+				WithArgs("track.example.com", tt.wildcard, sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(tt.update).
+				WithArgs("track.example.com").
+				WillReturnResult(sqlmock.NewResult(0, 12))
+			mock.ExpectCommit()
+
+			updated, err := database.RecordWildcardProbe("track.example.com", tt.wildcard)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if updated != 12 {
+				t.Errorf("Expected 12 updated domains, got %d", updated)
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unfulfilled expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestMarkWildcardChildren(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer func() { _ = db.Close() }()
 
-	err = database.InsertOrUpdateIP(1, "192.168.1.1", "A")
+	database := &Database{DB: db}
+
+	mock.ExpectExec(`UPDATE domain d SET wildcard_zone = z.zone FROM wildcard_zone z WHERE z.is_wildcard AND d.wildcard_zone IS NULL`).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	marked, err := database.MarkWildcardChildren()
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
+	if marked != 3 {
+		t.Errorf("Expected 3 marked domains, got %d", marked)
+	}
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("Unfulfilled expectations: %v", err)
@@ -364,7 +932,7 @@ func TestUpdateDomainResolvStats_ModesComparison(t *testing.T) {
 	}
 }
 
-func TestInsertDomainStat(t *testing.T) {
+func TestUpdateDomainResolvStats_ClearsBackoff(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
 		t.Fatalf("Failed to create mock: %v", err)
@@ -373,11 +941,56 @@ func TestInsertDomainStat(t *testing.T) {
 
 	database := &Database{DB: db}
 
-	mock.ExpectExec(`INSERT INTO domain_stat`).
-		WithArgs("example.com", "192.168.1.1", "A", sqlmock.AnyArg()).
-		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(`last_error = NULL, consecutive_failures = 0, next_resolv_time = NULL, leased_until = NULL WHERE id`).
+		WithArgs(sqlmock.AnyArg(), int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := database.UpdateDomainResolvStats(1, true); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestUpdateDomainResolvFailure(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	database := &Database{DB: db}
+
+	mock.ExpectExec(`UPDATE domain SET resolv_count = resolv_count \+ 1, last_resolv_time = \$1, last_error = \$2, consecutive_failures = consecutive_failures \+ 1, next_resolv_time = \$1 \+ LEAST\(\$3 \* POWER\(2, LEAST\(consecutive_failures, 30\)\), \$4\) \* INTERVAL '1 second', leased_until = NULL WHERE id = \$5`).
+		WithArgs(sqlmock.AnyArg(), "nxdomain", float64(300), float64(86400), int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = database.UpdateDomainResolvFailure(7, false, "nxdomain", 5*time.Minute, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestUpdateDomainResolvFailure_CyclicMode(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	database := &Database{DB: db}
 
-	err = database.InsertDomainStat("example.com", "192.168.1.1", "A")
+	mock.ExpectExec(`UPDATE domain SET resolv_count = CASE WHEN resolv_count >= max_resolv - 1 THEN CAST\(max_resolv \* 2\.0 / 3\.0 AS INTEGER\) ELSE resolv_count \+ 1 END, last_resolv_time = \$1, last_error = \$2`).
+		WithArgs(sqlmock.AnyArg(), "timeout", float64(60), float64(3600), int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err = database.UpdateDomainResolvFailure(7, true, "timeout", time.Minute, time.Hour)
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -387,7 +1000,7 @@ func TestInsertDomainStat(t *testing.T) {
 	}
 }
 
-func TestDeleteOldStats(t *testing.T) {
+func TestGetBackoffDomainsCount(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
 		t.Fatalf("Failed to create mock: %v", err)
@@ -396,17 +1009,24 @@ func TestDeleteOldStats(t *testing.T) {
 
 	database := &Database{DB: db}
 
-	mock.ExpectExec(`DELETE FROM domain_stat WHERE timestamp <`).
+	rows := sqlmock.NewRows([]string{"last_error", "count"}).
+		AddRow("nxdomain", 42).
+		AddRow("timeout", 3)
+
+	mock.ExpectQuery(`SELECT COALESCE\(last_error, 'error'\), COUNT\(\*\) FROM domain WHERE next_resolv_time > \$1 GROUP BY 1`).
 		WithArgs(sqlmock.AnyArg()).
-		WillReturnResult(sqlmock.NewResult(0, 42))
+		WillReturnRows(rows)
 
-	deleted, err := database.DeleteOldStats(30)
+	counts, err := database.GetBackoffDomainsCount()
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
 
-	if deleted != 42 {
-		t.Errorf("Expected 42 deleted records, got %d", deleted)
+	if counts["nxdomain"] != 42 {
+		t.Errorf("Expected nxdomain=42, got %d", counts["nxdomain"])
+	}
+	if counts["timeout"] != 3 {
+		t.Errorf("Expected timeout=3, got %d", counts["timeout"])
 	}
 
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -414,7 +1034,7 @@ func TestDeleteOldStats(t *testing.T) {
 	}
 }
 
-func TestDeleteOldStats_NoneDeleted(t *testing.T) {
+func TestGetDNSSECStatusCounts(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
 		t.Fatalf("Failed to create mock: %v", err)
@@ -423,17 +1043,89 @@ func TestDeleteOldStats_NoneDeleted(t *testing.T) {
 
 	database := &Database{DB: db}
 
-	mock.ExpectExec(`DELETE FROM domain_stat WHERE timestamp <`).
-		WithArgs(sqlmock.AnyArg()).
-		WillReturnResult(sqlmock.NewResult(0, 0))
+	rows := sqlmock.NewRows([]string{"dnssec_status", "count"}).
+		AddRow("secure", 5).
+		AddRow("bogus", 1)
+
+	mock.ExpectQuery(`SELECT dnssec_status, COUNT\(\*\) FROM domain WHERE dnssec_status IS NOT NULL GROUP BY 1`).
+		WillReturnRows(rows)
+
+	counts, err := database.GetDNSSECStatusCounts()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if counts["secure"] != 5 || counts["bogus"] != 1 {
+		t.Errorf("Expected secure=5 bogus=1, got %v", counts)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestUpdateDomainDNSSECStatus(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	database := &Database{DB: db}
+
+	mock.ExpectExec(`UPDATE domain SET dnssec_status = \$1 WHERE id = \$2`).
+		WithArgs("secure", int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := database.UpdateDomainDNSSECStatus(7, "secure"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestInsertDomainStat(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer func() { _ = db.Close() }()
 
-	deleted, err := database.DeleteOldStats(30)
+	database := &Database{DB: db}
+
+	mock.ExpectExec(`INSERT INTO domain_stat`).
+		WithArgs("example.com", "192.168.1.1", "AAAA", "A", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err = database.InsertDomainStat("example.com", "192.168.1.1", "AAAA", "A")
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
 
-	if deleted != 0 {
-		t.Errorf("Expected 0 deleted records, got %d", deleted)
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestInsertDomainStat_UnknownClient(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	database := &Database{DB: db}
+
+	// client_ip is inet: an unparseable client is stored as NULL
+	mock.ExpectExec(`INSERT INTO domain_stat`).
+		WithArgs("example.com", nil, "A", "A", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err = database.InsertDomainStat("example.com", "unknown", "A", "A")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
 	}
 
 	if err := mock.ExpectationsWereMet(); err != nil {
@@ -453,20 +1145,25 @@ func TestDeleteOldDomains_Success(t *testing.T) {
 	// Expect transaction begin
 	mock.ExpectBegin()
 
+	// Expect the batch of old domains to be locked
+	mock.ExpectQuery(`SELECT id FROM domain WHERE last_seen IS NOT NULL AND last_seen < \$1 ORDER BY id LIMIT \$2 FOR UPDATE`).
+		WithArgs(sqlmock.AnyArg(), 100).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3).AddRow(7))
+
 	// Expect IP deletion
-	mock.ExpectExec(`DELETE FROM ip WHERE domain_id IN`).
-		WithArgs(sqlmock.AnyArg()).
+	mock.ExpectExec(`DELETE FROM ip WHERE domain_id = ANY\(\$1\)`).
+		WithArgs(pq.Array([]int64{3, 7})).
 		WillReturnResult(sqlmock.NewResult(0, 5))
 
 	// Expect domain deletion
-	mock.ExpectExec(`DELETE FROM domain WHERE last_seen IS NOT NULL AND last_seen <`).
-		WithArgs(sqlmock.AnyArg()).
+	mock.ExpectExec(`DELETE FROM domain WHERE id = ANY\(\$1\)`).
+		WithArgs(pq.Array([]int64{3, 7})).
 		WillReturnResult(sqlmock.NewResult(0, 2))
 
 	// Expect transaction commit
 	mock.ExpectCommit()
 
-	domainsDeleted, ipsDeleted, err := database.DeleteOldDomains(30)
+	domainsDeleted, ipsDeleted, err := database.DeleteOldDomains(30, RetentionScope{}, 100)
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -493,16 +1190,14 @@ func TestDeleteOldDomains_NoneDeleted(t *testing.T) {
 
 	database := &Database{DB: db}
 
+	// Nothing is deleted when no domain is old enough
 	mock.ExpectBegin()
-	mock.ExpectExec(`DELETE FROM ip WHERE domain_id IN`).
-		WithArgs(sqlmock.AnyArg()).
-		WillReturnResult(sqlmock.NewResult(0, 0))
-	mock.ExpectExec(`DELETE FROM domain WHERE last_seen IS NOT NULL AND last_seen <`).
-		WithArgs(sqlmock.AnyArg()).
-		WillReturnResult(sqlmock.NewResult(0, 0))
-	mock.ExpectCommit()
+	mock.ExpectQuery(`SELECT id FROM domain WHERE last_seen IS NOT NULL`).
+		WithArgs(sqlmock.AnyArg(), 100).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectRollback()
 
-	domainsDeleted, ipsDeleted, err := database.DeleteOldDomains(30)
+	domainsDeleted, ipsDeleted, err := database.DeleteOldDomains(30, RetentionScope{}, 100)
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -530,7 +1225,7 @@ func TestDeleteOldDomains_Disabled(t *testing.T) {
 	database := &Database{DB: db}
 
 	// Should not execute any queries when TTL is 0 or negative
-	domainsDeleted, ipsDeleted, err := database.DeleteOldDomains(0)
+	domainsDeleted, ipsDeleted, err := database.DeleteOldDomains(0, RetentionScope{}, 100)
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -558,12 +1253,15 @@ func TestDeleteOldDomains_TransactionError(t *testing.T) {
 	database := &Database{DB: db}
 
 	mock.ExpectBegin()
-	mock.ExpectExec(`DELETE FROM ip WHERE domain_id IN`).
-		WithArgs(sqlmock.AnyArg()).
+	mock.ExpectQuery(`SELECT id FROM domain WHERE last_seen IS NOT NULL`).
+		WithArgs(sqlmock.AnyArg(), 100).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectExec(`DELETE FROM ip WHERE domain_id = ANY`).
+		WithArgs(pq.Array([]int64{3})).
 		WillReturnError(sql.ErrConnDone)
 	mock.ExpectRollback()
 
-	domainsDeleted, ipsDeleted, err := database.DeleteOldDomains(30)
+	domainsDeleted, ipsDeleted, err := database.DeleteOldDomains(30, RetentionScope{}, 100)
 	if err == nil {
 		t.Error("Expected error but got nil")
 	}
@@ -582,3 +1280,106 @@ func TestDeleteOldDomains_TransactionError(t *testing.T) {
 }
 
 
+
+func TestRecordIPResolution_Change(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	database := &Database{DB: db}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT ip FROM ip`).
+		WithArgs(int64(1), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"ip"}).AddRow("203.0.113.10").AddRow("203.0.113.11"))
+	mock.ExpectExec(`UPDATE ip SET seen_history`).
+		WithArgs(int64(1), sqlmock.AnyArg(), int64(0xFFFFFFFF), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(`INSERT INTO ip_change_event \(domain_id, time, added, removed\) VALUES \(\$1, \$2, \$3, \$4\)`).
+		WithArgs(int64(1), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	change, err := database.RecordIPResolution(1, []string{"ipv4"}, []string{"203.0.113.10", "198.51.100.7"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if change == nil {
+		t.Fatal("Expected a change")
+	}
+	if len(change.Added) != 1 || change.Added[0] != "198.51.100.7" {
+		t.Errorf("Expected added [198.51.100.7], got %v", change.Added)
+	}
+	if len(change.Removed) != 1 || change.Removed[0] != "203.0.113.11" {
+		t.Errorf("Expected removed [203.0.113.11], got %v", change.Removed)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestDiffIPSets(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous []string
+		current  []string
+		added    []string
+		removed  []string
+	}{
+		{"unchanged", []string{"a", "b"}, []string{"b", "a"}, nil, nil},
+		{"first resolution", nil, []string{"b", "a"}, []string{"a", "b"}, []string{}},
+		{"moved", []string{"a", "b"}, []string{"c", "b"}, []string{"c"}, []string{"a"}},
+		{"duplicates", []string{"a"}, []string{"a", "a", "b", "b"}, []string{"b"}, []string{}},
+		{"all removed", []string{"a"}, nil, []string{}, []string{"a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			change := diffIPSets(tt.previous, tt.current)
+			if tt.added == nil && tt.removed == nil {
+				if change != nil {
+					t.Errorf("Expected no change, got %+v", change)
+				}
+				return
+			}
+			if change == nil {
+				t.Fatal("Expected a change")
+			}
+			if strings.Join(change.Added, ",") != strings.Join(tt.added, ",") {
+				t.Errorf("Expected added %v, got %v", tt.added, change.Added)
+			}
+			if strings.Join(change.Removed, ",") != strings.Join(tt.removed, ",") {
+				t.Errorf("Expected removed %v, got %v", tt.removed, change.Removed)
+			}
+		})
+	}
+}
+
+func TestDeleteOldIPChangeEvents(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	database := &Database{DB: db}
+
+	mock.ExpectExec(`DELETE FROM ip_change_event WHERE id IN \(SELECT id FROM ip_change_event WHERE time < \$1 LIMIT \$2\)`).
+		WithArgs(sqlmock.AnyArg(), 500).
+		WillReturnResult(sqlmock.NewResult(0, 12))
+
+	deleted, err := database.DeleteOldIPChangeEvents(90, 500)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if deleted != 12 {
+		t.Errorf("Expected 12 deleted events, got %d", deleted)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,10 @@
+-- Lease-based claiming of domains for resolution
+-- A resolver instance claims due domains with SELECT ... FOR UPDATE SKIP LOCKED
+-- and marks them leased, so several collector replicas share the work without
+-- resolving the same domain twice. Leases of crashed workers simply expire.
+-- Version: 1.0.0
+
+-- Domain is claimed by a resolver until this time (NULL = not leased)
+ALTER TABLE domain ADD COLUMN IF NOT EXISTS leased_until TIMESTAMP;
+
+COMMENT ON COLUMN domain.leased_until IS 'Domain is claimed by a resolver instance until this time';
@@ -0,0 +1,5 @@
+-- Rollback popularity-weighted priority
+-- Version: 1.0.0
+
+DROP FUNCTION IF EXISTS domain_priority(BIGINT, TIMESTAMP, TIMESTAMP, TIMESTAMP, DOUBLE PRECISION, DOUBLE PRECISION, DOUBLE PRECISION);
+ALTER TABLE domain DROP COLUMN IF EXISTS query_count;
@@ -0,0 +1,5 @@
+-- Rollback DNSSEC validation status
+-- Version: 1.0.0
+
+DROP INDEX IF EXISTS idx_domain_dnssec_status;
+ALTER TABLE domain DROP COLUMN IF EXISTS dnssec_status;
@@ -0,0 +1,13 @@
+-- DNSSEC validation status per domain
+-- When resolver.dnssec is enabled the collector queries the upstream with the
+-- DO bit set and records how a validating resolver classified the answer.
+-- Version: 1.0.0
+
+-- DNSSEC status of the last check: secure, insecure, bogus, indeterminate (NULL = never checked)
+ALTER TABLE domain ADD COLUMN IF NOT EXISTS dnssec_status VARCHAR(16);
+
+-- Web-api filters domains by status
+CREATE INDEX IF NOT EXISTS idx_domain_dnssec_status ON domain(dnssec_status)
+    WHERE dnssec_status IS NOT NULL;
+
+COMMENT ON COLUMN domain.dnssec_status IS 'DNSSEC status of the last check: secure, insecure, bogus or indeterminate';
@@ -0,0 +1,4 @@
+-- Rollback reverse DNS (PTR) cache
+-- Version: 1.0.0
+
+DROP TABLE IF EXISTS ip_ptr;
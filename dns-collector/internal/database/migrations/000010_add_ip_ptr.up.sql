@@ -0,0 +1,18 @@
+-- Reverse DNS (PTR) cache for resolved IPs
+-- A background PTR resolver in the collector looks up every distinct address
+-- from the ip table and refreshes it periodically. Names are cached per
+-- address, so an IP shared by many domains is looked up once.
+-- Version: 1.0.0
+
+CREATE TABLE IF NOT EXISTS ip_ptr (
+    ip TEXT PRIMARY KEY,
+    ptr TEXT NOT NULL DEFAULT '',
+    time TIMESTAMP NOT NULL
+);
+
+-- PTR resolver picks the entries with the oldest lookups
+CREATE INDEX IF NOT EXISTS idx_ip_ptr_time ON ip_ptr(time);
+
+COMMENT ON TABLE ip_ptr IS 'Cached reverse DNS names of resolved IP addresses';
+COMMENT ON COLUMN ip_ptr.ptr IS 'PTR name without the trailing dot (empty = no PTR record)';
+COMMENT ON COLUMN ip_ptr.time IS 'Time of the last PTR lookup';
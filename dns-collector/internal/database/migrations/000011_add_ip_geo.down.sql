@@ -0,0 +1,10 @@
+-- Rollback ASN and GeoIP enrichment
+-- Version: 1.0.0
+
+DROP INDEX IF EXISTS idx_ip_geo_time;
+DROP INDEX IF EXISTS idx_ip_country;
+DROP INDEX IF EXISTS idx_ip_asn;
+ALTER TABLE ip DROP COLUMN IF EXISTS geo_time;
+ALTER TABLE ip DROP COLUMN IF EXISTS country;
+ALTER TABLE ip DROP COLUMN IF EXISTS as_org;
+ALTER TABLE ip DROP COLUMN IF EXISTS asn;
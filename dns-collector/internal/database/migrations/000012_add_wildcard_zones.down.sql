@@ -0,0 +1,6 @@
+-- Rollback wildcard zone detection
+-- Version: 1.0.0
+
+DROP INDEX IF EXISTS idx_domain_wildcard_zone;
+ALTER TABLE domain DROP COLUMN IF EXISTS wildcard_zone;
+DROP TABLE IF EXISTS wildcard_zone;
@@ -0,0 +1,26 @@
+-- Wildcard zone detection
+-- Some zones answer every subdomain with the same IPs. When many children of a
+-- parent zone share an identical IP set, the collector probes a random label
+-- under the parent; if it resolves, the parent is flagged as wildcard and its
+-- children are marked, so they can be resolved and exported as one zone.
+-- Version: 1.0.0
+
+CREATE TABLE IF NOT EXISTS wildcard_zone (
+    zone TEXT PRIMARY KEY,
+    is_wildcard BOOLEAN NOT NULL,
+    detected_at TIMESTAMP,
+    checked_at TIMESTAMP NOT NULL
+);
+
+-- Wildcard zone the domain belongs to (NULL = not under a known wildcard zone)
+ALTER TABLE domain ADD COLUMN IF NOT EXISTS wildcard_zone TEXT;
+
+-- Scheduler picks one child per zone, web-api collapses children in exports
+CREATE INDEX IF NOT EXISTS idx_domain_wildcard_zone ON domain(wildcard_zone, id)
+    WHERE wildcard_zone IS NOT NULL;
+
+COMMENT ON TABLE wildcard_zone IS 'Results of wildcard probes of parent zones';
+COMMENT ON COLUMN wildcard_zone.is_wildcard IS 'A random label under the zone resolved on the last probe';
+COMMENT ON COLUMN wildcard_zone.detected_at IS 'When the zone was first found to be wildcard';
+COMMENT ON COLUMN wildcard_zone.checked_at IS 'Time of the last probe';
+COMMENT ON COLUMN domain.wildcard_zone IS 'Wildcard zone the domain belongs to';
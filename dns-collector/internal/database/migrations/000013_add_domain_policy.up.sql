@@ -0,0 +1,19 @@
+-- Per-domain resolution policies
+-- Rules from resolver.policies in the collector config are matched by domain
+-- suffix or regex. The matching rule is stored with the domain together with
+-- the settings the scheduler needs: a policy that forbids resolution sets
+-- max_resolv to 0, a pinned refresh interval goes to resolv_interval.
+-- Version: 1.0.0
+
+-- Name of the matching policy rule (NULL = default policy)
+ALTER TABLE domain ADD COLUMN IF NOT EXISTS policy VARCHAR(64);
+
+-- Refresh interval pinned by the policy, seconds (NULL = resolver.interval_seconds)
+ALTER TABLE domain ADD COLUMN IF NOT EXISTS resolv_interval INTEGER;
+
+-- Listing and filtering domains by policy in web-api
+CREATE INDEX IF NOT EXISTS idx_domain_policy ON domain(policy)
+    WHERE policy IS NOT NULL;
+
+COMMENT ON COLUMN domain.policy IS 'Name of the resolution policy rule matching the domain';
+COMMENT ON COLUMN domain.resolv_interval IS 'Refresh interval pinned by the policy, seconds';
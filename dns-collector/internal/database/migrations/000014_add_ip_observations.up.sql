@@ -0,0 +1,30 @@
+-- IP observation history
+-- ip.time is overwritten on every sighting; first_seen, last_seen and seen_count
+-- keep how long and how often an address was seen for the domain, by the
+-- collector's resolver or passively in answers reported by the DNS server.
+-- seen_history is a bitmask of the domain's last 32 resolutions (lowest bit =
+-- latest) telling in which of them the address was returned.
+-- Version: 1.0.0
+
+ALTER TABLE ip ADD COLUMN IF NOT EXISTS first_seen TIMESTAMP;
+ALTER TABLE ip ADD COLUMN IF NOT EXISTS last_seen TIMESTAMP;
+ALTER TABLE ip ADD COLUMN IF NOT EXISTS seen_count INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE ip ADD COLUMN IF NOT EXISTS first_source VARCHAR(16);
+ALTER TABLE ip ADD COLUMN IF NOT EXISTS last_source VARCHAR(16);
+ALTER TABLE ip ADD COLUMN IF NOT EXISTS seen_history BIGINT NOT NULL DEFAULT 0;
+
+-- Existing addresses were last returned by the resolver at ip.time
+UPDATE ip SET
+    first_seen = time,
+    last_seen = time,
+    first_source = 'resolver',
+    last_source = 'resolver',
+    seen_history = 1
+WHERE first_seen IS NULL;
+
+COMMENT ON COLUMN ip.first_seen IS 'When the address was first seen for the domain';
+COMMENT ON COLUMN ip.last_seen IS 'When the address was last seen for the domain';
+COMMENT ON COLUMN ip.seen_count IS 'Number of observations of the address';
+COMMENT ON COLUMN ip.first_source IS 'Source of the first observation: resolver or passive';
+COMMENT ON COLUMN ip.last_source IS 'Source of the last observation: resolver or passive';
+COMMENT ON COLUMN ip.seen_history IS 'Bitmask of the last 32 resolutions of the domain that returned the address (bit 0 = latest)';
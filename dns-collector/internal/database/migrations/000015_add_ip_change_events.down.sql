@@ -0,0 +1,6 @@
+-- Rollback IP set change events
+-- Version: 1.0.0
+
+DROP INDEX IF EXISTS idx_ip_change_event_time;
+DROP INDEX IF EXISTS idx_ip_change_event_domain;
+DROP TABLE IF EXISTS ip_change_event;
@@ -0,0 +1,71 @@
+-- Partition domain_stat by day
+-- Query statistics move to declarative range partitioning on timestamp, so
+-- retention drops whole daily partitions instead of deleting rows.
+-- Existing rows are not copied: the old table is attached as the partition
+-- domain_stat_legacy covering everything before the day after the migration
+-- and is dropped by the retention once that day has expired.
+-- Daily partitions are named domain_stat_pYYYYMMDD and created ahead by the collector.
+-- Days are UTC dates whatever the session time zone, as the collector computes them;
+-- rows no partition covers go to domain_stat_default instead of failing.
+-- Version: 1.0.0
+
+DO $$
+DECLARE
+    now_utc TIMESTAMP := now() AT TIME ZONE 'UTC';
+    next_day TIMESTAMP;
+    part_day TIMESTAMP;
+BEGIN
+    -- Fresh databases get a partitioned table from the collector already
+    IF (SELECT relkind FROM pg_class WHERE oid = 'domain_stat'::regclass) = 'p' THEN
+        RETURN;
+    END IF;
+
+    -- The day after the migration, or after the newest row when the collector's
+    -- wall time is ahead of UTC
+    SELECT date_trunc('day', GREATEST(now_utc, MAX(timestamp))) + INTERVAL '1 day'
+        INTO next_day FROM domain_stat;
+
+    ALTER TABLE domain_stat RENAME TO domain_stat_legacy;
+    ALTER INDEX IF EXISTS idx_domain_stat_timestamp RENAME TO idx_domain_stat_legacy_timestamp;
+    ALTER INDEX IF EXISTS idx_domain_stat_client_ip RENAME TO idx_domain_stat_legacy_client_ip;
+    ALTER INDEX IF EXISTS idx_domain_stat_domain RENAME TO idx_domain_stat_legacy_domain;
+    ALTER INDEX IF EXISTS idx_domain_stat_rtype RENAME TO idx_domain_stat_legacy_rtype;
+    ALTER INDEX IF EXISTS idx_domain_stat_time_client RENAME TO idx_domain_stat_legacy_time_client;
+    ALTER INDEX IF EXISTS idx_domain_stat_time_domain RENAME TO idx_domain_stat_legacy_time_domain;
+
+    -- The partition key must be NOT NULL; rows without a timestamp (never written
+    -- by the collector) are dated at migration time. The validated CHECK lets
+    -- SET NOT NULL and ATTACH PARTITION skip their own table scans.
+    UPDATE domain_stat_legacy SET timestamp = now_utc WHERE timestamp IS NULL;
+    EXECUTE format('ALTER TABLE domain_stat_legacy ADD CONSTRAINT domain_stat_legacy_bound
+        CHECK (timestamp IS NOT NULL AND timestamp < %L)', next_day);
+    ALTER TABLE domain_stat_legacy ALTER COLUMN timestamp SET NOT NULL;
+
+    CREATE TABLE domain_stat (LIKE domain_stat_legacy INCLUDING DEFAULTS)
+        PARTITION BY RANGE (timestamp);
+    EXECUTE format('ALTER TABLE domain_stat ATTACH PARTITION domain_stat_legacy
+        FOR VALUES FROM (MINVALUE) TO (%L)', next_day);
+    ALTER TABLE domain_stat_legacy DROP CONSTRAINT domain_stat_legacy_bound;
+
+    -- Keep the id sequence when the legacy partition is dropped
+    EXECUTE format('ALTER SEQUENCE %s OWNED BY domain_stat.id',
+        pg_get_serial_sequence('domain_stat_legacy', 'id'));
+
+    -- A week of daily partitions until the collector takes over
+    FOR part_day IN SELECT generate_series(next_day, next_day + INTERVAL '6 days', INTERVAL '1 day') LOOP
+        EXECUTE format('CREATE TABLE IF NOT EXISTS %I PARTITION OF domain_stat FOR VALUES FROM (%L) TO (%L)',
+            'domain_stat_p' || to_char(part_day, 'YYYYMMDD'), part_day, part_day + INTERVAL '1 day');
+    END LOOP;
+END $$;
+
+CREATE TABLE IF NOT EXISTS domain_stat_default PARTITION OF domain_stat DEFAULT;
+
+-- Indexes of the partitioned table; matching indexes of domain_stat_legacy are attached, not rebuilt
+CREATE INDEX IF NOT EXISTS idx_domain_stat_timestamp ON domain_stat(timestamp DESC);
+CREATE INDEX IF NOT EXISTS idx_domain_stat_client_ip ON domain_stat(client_ip);
+CREATE INDEX IF NOT EXISTS idx_domain_stat_domain ON domain_stat(domain);
+CREATE INDEX IF NOT EXISTS idx_domain_stat_rtype ON domain_stat(rtype);
+CREATE INDEX IF NOT EXISTS idx_domain_stat_time_client ON domain_stat(timestamp DESC, client_ip);
+CREATE INDEX IF NOT EXISTS idx_domain_stat_time_domain ON domain_stat(timestamp DESC, domain);
+
+COMMENT ON TABLE domain_stat IS 'Stores statistics for DNS queries, partitioned by day on timestamp';
@@ -0,0 +1,49 @@
+-- Hourly and daily rollups of query statistics
+-- Raw domain_stat rows are kept for retention.stats_days only and every
+-- aggregate over them scans all matching rows. The collector folds complete
+-- hours of domain_stat into domain_stat_hourly and complete days of the
+-- hourly rollup into domain_stat_daily; both are kept much longer.
+-- Version: 1.0.0
+
+-- Query type (A, AAAA, HTTPS, ...) as reported by the DNS server
+ALTER TABLE domain_stat ADD COLUMN IF NOT EXISTS qtype TEXT NOT NULL DEFAULT '';
+
+COMMENT ON COLUMN domain_stat.qtype IS 'Query type requested by the client (empty for rows recorded before it was stored)';
+
+CREATE TABLE IF NOT EXISTS domain_stat_hourly (
+    bucket TIMESTAMP NOT NULL,
+    domain TEXT NOT NULL,
+    client_ip TEXT NOT NULL,
+    qtype TEXT NOT NULL,
+    count BIGINT NOT NULL,
+    PRIMARY KEY (bucket, domain, client_ip, qtype)
+);
+
+CREATE INDEX IF NOT EXISTS idx_domain_stat_hourly_domain ON domain_stat_hourly(domain, bucket);
+CREATE INDEX IF NOT EXISTS idx_domain_stat_hourly_client_ip ON domain_stat_hourly(client_ip, bucket);
+
+CREATE TABLE IF NOT EXISTS domain_stat_daily (
+    bucket TIMESTAMP NOT NULL,
+    domain TEXT NOT NULL,
+    client_ip TEXT NOT NULL,
+    qtype TEXT NOT NULL,
+    count BIGINT NOT NULL,
+    PRIMARY KEY (bucket, domain, client_ip, qtype)
+);
+
+CREATE INDEX IF NOT EXISTS idx_domain_stat_daily_domain ON domain_stat_daily(domain, bucket);
+CREATE INDEX IF NOT EXISTS idx_domain_stat_daily_client_ip ON domain_stat_daily(client_ip, bucket);
+
+-- Progress of each rollup: everything before rolled_up_to has been aggregated.
+-- The collector creates the rows on its first run, starting at the oldest statistics.
+CREATE TABLE IF NOT EXISTS stat_rollup_state (
+    rollup TEXT PRIMARY KEY,
+    rolled_up_to TIMESTAMP NOT NULL
+);
+
+COMMENT ON TABLE domain_stat_hourly IS 'Number of queries per domain, client and query type for each hour';
+COMMENT ON TABLE domain_stat_daily IS 'Number of queries per domain, client and query type for each day';
+COMMENT ON COLUMN domain_stat_hourly.bucket IS 'Start of the hour';
+COMMENT ON COLUMN domain_stat_daily.bucket IS 'Start of the day';
+COMMENT ON TABLE stat_rollup_state IS 'Watermarks of the statistics rollups maintained by the collector';
+COMMENT ON COLUMN stat_rollup_state.rolled_up_to IS 'Statistics before this time are included in the rollup';
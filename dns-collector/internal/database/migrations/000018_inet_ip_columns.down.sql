@@ -0,0 +1,22 @@
+-- Rollback native inet type for IP address columns
+-- Unknown clients are stored as 'unknown' again.
+-- Version: 1.0.0
+
+DROP INDEX IF EXISTS idx_domain_stat_client_ip_spgist;
+DROP INDEX IF EXISTS idx_ip_address_gist;
+
+DROP INDEX IF EXISTS idx_domain_stat_daily_key;
+ALTER TABLE domain_stat_daily ALTER COLUMN client_ip TYPE TEXT USING COALESCE(host(client_ip), 'unknown');
+ALTER TABLE domain_stat_daily ALTER COLUMN client_ip SET NOT NULL;
+ALTER TABLE domain_stat_daily ADD PRIMARY KEY (bucket, domain, client_ip, qtype);
+
+DROP INDEX IF EXISTS idx_domain_stat_hourly_key;
+ALTER TABLE domain_stat_hourly ALTER COLUMN client_ip TYPE TEXT USING COALESCE(host(client_ip), 'unknown');
+ALTER TABLE domain_stat_hourly ALTER COLUMN client_ip SET NOT NULL;
+ALTER TABLE domain_stat_hourly ADD PRIMARY KEY (bucket, domain, client_ip, qtype);
+
+ALTER TABLE domain_stat ALTER COLUMN client_ip TYPE VARCHAR(45) USING COALESCE(host(client_ip), 'unknown');
+ALTER TABLE domain_stat ALTER COLUMN client_ip SET NOT NULL;
+
+ALTER TABLE ip_ptr ALTER COLUMN ip TYPE TEXT USING host(ip);
+ALTER TABLE ip ALTER COLUMN ip TYPE VARCHAR(45) USING host(ip);
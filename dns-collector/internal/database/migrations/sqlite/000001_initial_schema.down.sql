@@ -0,0 +1,14 @@
+-- Rollback initial schema
+-- SQLite migration script
+-- Version: 1.0.0
+
+DROP TABLE IF EXISTS stat_rollup_state;
+DROP TABLE IF EXISTS domain_stat_daily;
+DROP TABLE IF EXISTS domain_stat_hourly;
+DROP TABLE IF EXISTS domain_stat;
+DROP TABLE IF EXISTS ip_ptr;
+DROP TABLE IF EXISTS ip_change_event;
+DROP TABLE IF EXISTS ip_vantage;
+DROP TABLE IF EXISTS ip;
+DROP TABLE IF EXISTS wildcard_zone;
+DROP TABLE IF EXISTS domain;
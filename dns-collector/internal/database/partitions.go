@@ -0,0 +1,271 @@
+package database
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// StatPartitionsAhead is how many days of domain_stat partitions are kept created ahead of today
+const StatPartitionsAhead = 7
+
+// statDefaultPartition receives the domain_stat rows no daily partition covers
+const statDefaultPartition = "domain_stat_default"
+
+// statBoundLayout is the format of timestamp literals in partition bounds
+const statBoundLayout = "2006-01-02 15:04:05"
+
+// statBoundRe extracts the lower and upper bound of a range partition
+var statBoundRe = regexp.MustCompile(`FOR VALUES FROM \((.+)\) TO \((.+)\)`)
+
+// StatPartition is a partition of domain_stat covering [From, To).
+// A zero From or To means the range is unbounded on that side (MINVALUE/MAXVALUE).
+type StatPartition struct {
+	Name  string
+	From  time.Time
+	To    time.Time
+	Rows  int64 // planner estimate, 0 if the partition was never analyzed
+	Bytes int64 // on-disk size including indexes and TOAST
+}
+
+// covers reports whether the partition overlaps the day starting at day.
+func (p StatPartition) covers(day time.Time) bool {
+	next := day.AddDate(0, 0, 1)
+	return (p.From.IsZero() || p.From.Before(next)) && (p.To.IsZero() || p.To.After(day))
+}
+
+// statPartitionName returns the name of the daily domain_stat partition for day
+func statPartitionName(day time.Time) string {
+	return "domain_stat_p" + day.Format("20060102")
+}
+
+// startOfDay truncates t to midnight of its day in t's location
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// GetStatPartitions returns the range partitions of domain_stat ordered by name.
+// Timestamps are stored as the collector's local wall time, so bounds are read in time.Local.
+func (db *Database) GetStatPartitions() ([]StatPartition, error) {
+	rows, err := db.DB.Query(
+		`SELECT c.relname, pg_get_expr(c.relpartbound, c.oid), GREATEST(c.reltuples, 0)::BIGINT,
+			pg_total_relation_size(c.oid)
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = 'domain_stat'::regclass
+		ORDER BY c.relname`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query domain_stat partitions: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var partitions []StatPartition
+	for rows.Next() {
+		var p StatPartition
+		var bound string
+		if err := rows.Scan(&p.Name, &bound, &p.Rows, &p.Bytes); err != nil {
+			return nil, fmt.Errorf("failed to scan domain_stat partition: %w", err)
+		}
+
+		m := statBoundRe.FindStringSubmatch(bound)
+		if m == nil {
+			continue // DEFAULT partition
+		}
+		if p.From, err = parseStatBound(m[1]); err != nil {
+			return nil, fmt.Errorf("failed to parse bound of partition %s: %w", p.Name, err)
+		}
+		if p.To, err = parseStatBound(m[2]); err != nil {
+			return nil, fmt.Errorf("failed to parse bound of partition %s: %w", p.Name, err)
+		}
+		partitions = append(partitions, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating domain_stat partitions: %w", err)
+	}
+
+	return partitions, nil
+}
+
+// parseStatBound parses a partition bound literal such as '2024-01-15 00:00:00';
+// MINVALUE and MAXVALUE yield the zero time.
+func parseStatBound(bound string) (time.Time, error) {
+	if bound == "MINVALUE" || bound == "MAXVALUE" {
+		return time.Time{}, nil
+	}
+	if len(bound) < 2 || bound[0] != '\'' || bound[len(bound)-1] != '\'' {
+		return time.Time{}, fmt.Errorf("unexpected bound %q", bound)
+	}
+	return time.ParseInLocation(statBoundLayout, bound[1:len(bound)-1], time.Local)
+}
+
+// statPartitionToday returns the day of now partitions are created from: the UTC date,
+// as migration 000016 computes it, whatever the time zone of the collector or the
+// database session. Like the bounds, the day is expressed in time.Local.
+func statPartitionToday(now time.Time) time.Time {
+	y, m, d := now.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
+
+// EnsureStatPartitions creates the daily domain_stat partitions from the day before
+// the UTC date of now through StatPartitionsAhead days ahead; statistics carry the
+// collector's wall time, which may still be on the previous UTC date. Days already
+// covered by a partition (including domain_stat_legacy) are skipped. Rows of a day that
+// landed in domain_stat_default are moved into its new partition. Returns the number
+// of partitions created.
+func (db *Database) EnsureStatPartitions(now time.Time) (int, error) {
+	partitions, err := db.GetStatPartitions()
+	if err != nil {
+		return 0, err
+	}
+
+	created := 0
+	today := statPartitionToday(now)
+	for i := -1; i <= StatPartitionsAhead; i++ {
+		day := today.AddDate(0, 0, i)
+
+		covered := false
+		for _, p := range partitions {
+			if p.covers(day) {
+				covered = true
+				break
+			}
+		}
+		if covered {
+			continue
+		}
+
+		// A partition can't be created over rows of the default partition: the day is
+		// built as a plain table, takes those rows over and is attached, in one implicit
+		// transaction. Bounds can't be bind parameters in DDL; both are formatted timestamps.
+		_, err := db.DB.Exec(fmt.Sprintf(
+			`CREATE TABLE %[1]s (LIKE domain_stat INCLUDING DEFAULTS);
+			WITH moved AS (
+				DELETE FROM %[2]s WHERE timestamp >= '%[3]s' AND timestamp < '%[4]s' RETURNING *
+			)
+			INSERT INTO %[1]s SELECT * FROM moved;
+			ALTER TABLE domain_stat ATTACH PARTITION %[1]s FOR VALUES FROM ('%[3]s') TO ('%[4]s')`,
+			pq.QuoteIdentifier(statPartitionName(day)), pq.QuoteIdentifier(statDefaultPartition),
+			day.Format(statBoundLayout), day.AddDate(0, 0, 1).Format(statBoundLayout),
+		))
+		if err != nil {
+			return created, fmt.Errorf("failed to create domain_stat partition for %s: %w", day.Format("2006-01-02"), err)
+		}
+		created++
+	}
+
+	return created, nil
+}
+
+// DropOldStatPartitions drops domain_stat partitions whose whole range is older than
+// retentionDays. A partition is dropped only once its newest day has expired, so up to
+// a day of extra statistics is kept. Returns the number of partitions dropped and the
+// estimated number of rows they held.
+func (db *Database) DropOldStatPartitions(retentionDays int) (int, int64, error) {
+	return db.DropStatPartitionsBefore(time.Now().AddDate(0, 0, -retentionDays))
+}
+
+// DropStatPartitionsBefore drops the domain_stat partitions ending at or before cutoff
+// and deletes the rows before cutoff from domain_stat_default. Returns the number of
+// partitions dropped and the estimated number of rows they held, plus the deleted rows.
+func (db *Database) DropStatPartitionsBefore(cutoff time.Time) (int, int64, error) {
+	partitions, err := db.GetStatPartitions()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	dropped := 0
+	var rows int64
+	for _, p := range partitions {
+		if p.To.IsZero() || p.To.After(cutoff) {
+			continue
+		}
+		if _, err := db.DB.Exec(`DROP TABLE IF EXISTS ` + pq.QuoteIdentifier(p.Name)); err != nil {
+			return dropped, rows, fmt.Errorf("failed to drop domain_stat partition %s: %w", p.Name, err)
+		}
+		dropped++
+		rows += p.Rows
+	}
+
+	// The default partition is normally empty; what it holds expires row by row
+	result, err := db.DB.Exec(`DELETE FROM `+pq.QuoteIdentifier(statDefaultPartition)+` WHERE timestamp < $1`, cutoff)
+	if err != nil {
+		return dropped, rows, fmt.Errorf("failed to delete old statistics of %s: %w", statDefaultPartition, err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return dropped, rows, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return dropped, rows + deleted, nil
+}
+
+// GetTableSizes returns the on-disk size of every table of the schema in bytes,
+// including indexes and TOAST (pg_total_relation_size). Partitions are counted in
+// their parent table.
+func (db *Database) GetTableSizes() (map[string]int64, error) {
+	rows, err := db.DB.Query(
+		`SELECT COALESCE(parent.relname, c.relname), SUM(pg_total_relation_size(c.oid))::BIGINT
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		LEFT JOIN pg_inherits i ON i.inhrelid = c.oid
+		LEFT JOIN pg_class parent ON parent.oid = i.inhparent
+		WHERE n.nspname = current_schema() AND c.relkind = 'r'
+		GROUP BY 1`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query table sizes: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	sizes := make(map[string]int64)
+	for rows.Next() {
+		var table string
+		var bytes int64
+		if err := rows.Scan(&table, &bytes); err != nil {
+			return nil, fmt.Errorf("failed to scan table size: %w", err)
+		}
+		sizes[table] = bytes
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating table sizes: %w", err)
+	}
+
+	return sizes, nil
+}
+
+// DeleteOldStats deletes up to limit domain_stat rows within scope of the days
+// entirely older than retentionDays. Used for rules with a shorter retention than
+// the partitions, which are dropped at the longest one.
+func (db *Database) DeleteOldStats(retentionDays int, scope RetentionScope, limit int) (int64, error) {
+	r := &retentionSQL{
+		domainCol: "domain",
+		clientCol: "client_ip",
+		args:      []interface{}{StatRetentionCutoff(retentionDays, time.Now()), limit},
+	}
+	inScope := r.scope(scope)
+
+	// The partitions have no unique index: rows are addressed by (timestamp, id)
+	result, err := db.DB.Exec(
+		`DELETE FROM domain_stat
+		WHERE (timestamp, id) IN (
+			SELECT timestamp, id FROM domain_stat
+			WHERE timestamp < $1`+inScope+`
+			LIMIT $2
+		)`,
+		r.args...,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete old statistics: %w", err)
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,201 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func partitionRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"relname", "bound", "rows", "bytes"})
+}
+
+func TestParseStatBound(t *testing.T) {
+	tests := []struct {
+		bound       string
+		expected    time.Time
+		expectError bool
+	}{
+		{"'2024-01-15 00:00:00'", time.Date(2024, 1, 15, 0, 0, 0, 0, time.Local), false},
+		{"MINVALUE", time.Time{}, false},
+		{"MAXVALUE", time.Time{}, false},
+		{"2024-01-15", time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.bound, func(t *testing.T) {
+			got, err := parseStatBound(tt.bound)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if !got.Equal(tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestGetStatPartitions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	database := &Database{DB: db}
+
+	mock.ExpectQuery(`SELECT c.relname, pg_get_expr\(c.relpartbound, c.oid\)`).
+		WillReturnRows(partitionRows().
+			AddRow("domain_stat_default", "DEFAULT", 0, 0).
+			AddRow("domain_stat_legacy", "FOR VALUES FROM (MINVALUE) TO ('2024-01-16 00:00:00')", 200000000, 30<<30).
+			AddRow("domain_stat_p20240116", "FOR VALUES FROM ('2024-01-16 00:00:00') TO ('2024-01-17 00:00:00')", 0, 0))
+
+	partitions, err := database.GetStatPartitions()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(partitions) != 2 {
+		t.Fatalf("Expected 2 range partitions, got %d", len(partitions))
+	}
+	if partitions[0].Name != "domain_stat_legacy" || !partitions[0].From.IsZero() || partitions[0].Rows != 200000000 ||
+		partitions[0].Bytes != 30<<30 {
+		t.Errorf("Unexpected legacy partition: %+v", partitions[0])
+	}
+	if !partitions[1].From.Equal(time.Date(2024, 1, 16, 0, 0, 0, 0, time.Local)) ||
+		!partitions[1].To.Equal(time.Date(2024, 1, 17, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("Unexpected daily partition: %+v", partitions[1])
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestEnsureStatPartitions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	database := &Database{DB: db}
+	now := time.Date(2024, 1, 15, 13, 45, 0, 0, time.UTC)
+
+	// The legacy partition covers yesterday and today, tomorrow's partition exists already
+	mock.ExpectQuery(`SELECT c.relname, pg_get_expr\(c.relpartbound, c.oid\)`).
+		WillReturnRows(partitionRows().
+			AddRow("domain_stat_legacy", "FOR VALUES FROM (MINVALUE) TO ('2024-01-16 00:00:00')", 0, 0).
+			AddRow("domain_stat_p20240116", "FOR VALUES FROM ('2024-01-16 00:00:00') TO ('2024-01-17 00:00:00')", 0, 0))
+
+	for day := 17; day <= 15+StatPartitionsAhead; day++ {
+		from := time.Date(2024, 1, day, 0, 0, 0, 0, time.Local)
+		name := `"` + statPartitionName(from) + `"`
+		lower, upper := `'`+from.Format(statBoundLayout)+`'`, `'`+from.AddDate(0, 0, 1).Format(statBoundLayout)+`'`
+		mock.ExpectExec(`CREATE TABLE ` + name + ` \(LIKE domain_stat INCLUDING DEFAULTS\); ` +
+			`WITH moved AS \( DELETE FROM "domain_stat_default" WHERE timestamp >= ` + lower + ` AND timestamp < ` + upper + ` RETURNING \* \) ` +
+			`INSERT INTO ` + name + ` SELECT \* FROM moved; ` +
+			`ALTER TABLE domain_stat ATTACH PARTITION ` + name + ` FOR VALUES FROM \(` + lower + `\) TO \(` + upper + `\)`).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+
+	created, err := database.EnsureStatPartitions(now)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if created != StatPartitionsAhead-1 {
+		t.Errorf("Expected %d partitions created, got %d", StatPartitionsAhead-1, created)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestStatPartitionToday(t *testing.T) {
+	// Late evening west of UTC is already the next UTC date
+	now := time.Date(2024, 1, 15, 23, 0, 0, 0, time.FixedZone("UTC-5", -5*3600))
+
+	today := statPartitionToday(now)
+	if !today.Equal(time.Date(2024, 1, 16, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("Expected 2024-01-16 00:00 local, got %v", today)
+	}
+}
+
+func TestDropOldStatPartitions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	database := &Database{DB: db}
+	today := startOfDay(time.Now())
+	bound := func(days int) string {
+		return "'" + today.AddDate(0, 0, days).Format(statBoundLayout) + "'"
+	}
+
+	// With 30 days of retention only partitions ending at least 30 days ago are dropped
+	mock.ExpectQuery(`SELECT c.relname, pg_get_expr\(c.relpartbound, c.oid\)`).
+		WillReturnRows(partitionRows().
+			AddRow("domain_stat_legacy", "FOR VALUES FROM (MINVALUE) TO ("+bound(-40)+")", 1000, 0).
+			AddRow("domain_stat_old", "FOR VALUES FROM ("+bound(-31)+") TO ("+bound(-30)+")", 50, 0).
+			AddRow("domain_stat_edge", "FOR VALUES FROM ("+bound(-30)+") TO ("+bound(-29)+")", 60, 0).
+			AddRow("domain_stat_today", "FOR VALUES FROM ("+bound(0)+") TO ("+bound(1)+")", 70, 0).
+			AddRow("domain_stat_future", "FOR VALUES FROM ("+bound(1)+") TO (MAXVALUE)", 0, 0))
+
+	mock.ExpectExec(`DROP TABLE IF EXISTS "domain_stat_legacy"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DROP TABLE IF EXISTS "domain_stat_old"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DELETE FROM "domain_stat_default" WHERE timestamp < \$1`).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 5))
+
+	dropped, rows, err := database.DropOldStatPartitions(30)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if dropped != 2 {
+		t.Errorf("Expected 2 partitions dropped, got %d", dropped)
+	}
+	if rows != 1055 {
+		t.Errorf("Expected ~1055 rows, got %d", rows)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestGetTableSizes(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	database := &Database{DB: db}
+
+	mock.ExpectQuery(`SELECT COALESCE\(parent.relname, c.relname\), SUM\(pg_total_relation_size\(c.oid\)\)`).
+		WillReturnRows(sqlmock.NewRows([]string{"table", "bytes"}).
+			AddRow("domain_stat", int64(40<<30)).
+			AddRow("ip", int64(512<<20)))
+
+	sizes, err := database.GetTableSizes()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(sizes) != 2 || sizes["domain_stat"] != 40<<30 || sizes["ip"] != 512<<20 {
+		t.Errorf("Unexpected table sizes: %v", sizes)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
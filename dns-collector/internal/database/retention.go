@@ -0,0 +1,210 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RetentionMatch selects the rows of a retention rule: domains equal to Suffix or
+// below it, domains matching Regex and statistics of clients within Subnet.
+// Empty fields match every row.
+type RetentionMatch struct {
+	Suffix string // lower case, without the trailing dot
+	Regex  string
+	Subnet string // CIDR; tables without a client column never match a subnet
+}
+
+// RetentionScope restricts a cleanup delete to the rows of one retention rule: the
+// rows matching Match (nil = every row) and none of Exclude, the rules evaluated
+// before it. The default retention excludes every rule.
+type RetentionScope struct {
+	Match   *RetentionMatch
+	Exclude []RetentionMatch
+}
+
+// retentionSQL builds the conditions of a scope for one backend
+type retentionSQL struct {
+	sqlite    bool
+	domainCol string
+	clientCol string // empty for tables without clients
+	args      []interface{}
+}
+
+func (r *retentionSQL) param(v interface{}) string {
+	r.args = append(r.args, v)
+	return fmt.Sprintf("$%d", len(r.args))
+}
+
+// match returns the condition of a rule
+func (r *retentionSQL) match(m RetentionMatch) string {
+	var conds []string
+	if m.Suffix != "" {
+		conds = append(conds, fmt.Sprintf(`(%s = %s OR %s LIKE %s ESCAPE '\')`,
+			r.domainCol, r.param(m.Suffix), r.domainCol, r.param("%."+escapeLike(m.Suffix))))
+	}
+	if m.Regex != "" {
+		op := "~"
+		if r.sqlite {
+			op = "REGEXP"
+		}
+		conds = append(conds, fmt.Sprintf("%s %s %s", r.domainCol, op, r.param(m.Regex)))
+	}
+	if m.Subnet != "" {
+		switch {
+		case r.clientCol == "":
+			conds = append(conds, "FALSE")
+		case r.sqlite:
+			conds = append(conds, fmt.Sprintf("ip_in_subnet(%s, %s)", r.clientCol, r.param(m.Subnet)))
+		default:
+			// Unknown clients are NULL and belong to no subnet
+			conds = append(conds, fmt.Sprintf("COALESCE(%s <<= %s::inet, FALSE)", r.clientCol, r.param(m.Subnet)))
+		}
+	}
+	if len(conds) == 0 {
+		return "TRUE"
+	}
+	return "(" + strings.Join(conds, " AND ") + ")"
+}
+
+// scope returns the conditions of s prefixed with AND (empty if s selects every row)
+func (r *retentionSQL) scope(s RetentionScope) string {
+	var where string
+	if s.Match != nil {
+		where += " AND " + r.match(*s.Match)
+	}
+	for _, m := range s.Exclude {
+		where += " AND NOT " + r.match(m)
+	}
+	return where
+}
+
+// escapeLike escapes the LIKE wildcards of a literal (domains may contain '_')
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// DomainCount is the number of rows of one domain a cleanup step would delete
+type DomainCount struct {
+	Domain string
+	Rows   int64
+}
+
+// scanDomainCounts reads (domain, count) rows and closes rows
+func scanDomainCounts(rows *sql.Rows) ([]DomainCount, error) {
+	defer func() { _ = rows.Close() }()
+
+	var counts []DomainCount
+	for rows.Next() {
+		var c DomainCount
+		if err := rows.Scan(&c.Domain, &c.Rows); err != nil {
+			return nil, fmt.Errorf("failed to scan domain count: %w", err)
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// PreviewOldStats returns, per domain, the domain_stat rows within scope in [from, before)
+// that a cleanup would delete. Nothing is modified.
+func (db *Database) PreviewOldStats(from, before time.Time, scope RetentionScope) ([]DomainCount, error) {
+	r := &retentionSQL{domainCol: "domain", clientCol: "client_ip", args: []interface{}{from, before}}
+	inScope := r.scope(scope)
+
+	rows, err := db.DB.Query(
+		`SELECT domain, COUNT(*) FROM domain_stat
+		WHERE timestamp >= $1 AND timestamp < $2`+inScope+`
+		GROUP BY domain`,
+		r.args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to preview old statistics: %w", err)
+	}
+	return scanDomainCounts(rows)
+}
+
+// PreviewExpiredIPs returns, per domain, the IP addresses DeleteExpiredIPs would delete
+func (db *Database) PreviewExpiredIPs(ttlDays int, scope RetentionScope) ([]DomainCount, error) {
+	if ttlDays <= 0 {
+		return nil, nil // TTL disabled
+	}
+
+	r := &retentionSQL{domainCol: "d.domain", args: []interface{}{time.Now().AddDate(0, 0, -ttlDays)}}
+	inScope := r.scope(scope)
+
+	rows, err := db.DB.Query(
+		`SELECT d.domain, COUNT(*) FROM ip
+		JOIN domain d ON d.id = ip.domain_id
+		WHERE ip.time < $1 AND d.last_seen >= $1`+inScope+`
+		GROUP BY d.domain`,
+		r.args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to preview expired IPs: %w", err)
+	}
+	return scanDomainCounts(rows)
+}
+
+// PreviewOldDomains returns the domains DeleteOldDomains would delete with the number
+// of their IP addresses
+func (db *Database) PreviewOldDomains(ttlDays int, scope RetentionScope) ([]DomainCount, error) {
+	if ttlDays <= 0 {
+		return nil, nil // TTL disabled
+	}
+
+	r := &retentionSQL{domainCol: "d.domain", args: []interface{}{time.Now().AddDate(0, 0, -ttlDays)}}
+	inScope := r.scope(scope)
+
+	rows, err := db.DB.Query(
+		`SELECT d.domain, COUNT(ip.id) FROM domain d
+		LEFT JOIN ip ON ip.domain_id = d.id
+		WHERE d.last_seen IS NOT NULL AND d.last_seen < $1`+inScope+`
+		GROUP BY d.domain`,
+		r.args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to preview old domains: %w", err)
+	}
+	return scanDomainCounts(rows)
+}
+
+// CountOrphanedPTRs returns the number of cached PTR names DeleteOrphanedPTRs would delete
+func (db *Database) CountOrphanedPTRs() (int64, error) {
+	var count int64
+	err := db.DB.QueryRow(
+		`SELECT COUNT(*) FROM ip_ptr p
+		WHERE NOT EXISTS (SELECT 1 FROM ip WHERE ip.ip = p.ip)`,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count orphaned PTRs: %w", err)
+	}
+	return count, nil
+}
+
+// CountOldIPChangeEvents returns the number of IP change events DeleteOldIPChangeEvents would delete
+func (db *Database) CountOldIPChangeEvents(days int) (int64, error) {
+	var count int64
+	err := db.DB.QueryRow(
+		`SELECT COUNT(*) FROM ip_change_event WHERE time < $1`, time.Now().AddDate(0, 0, -days),
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count old IP change events: %w", err)
+	}
+	return count, nil
+}
+
+// CountOldRollups returns the number of hourly and daily rollup rows DeleteOldRollups would delete
+func (db *Database) CountOldRollups(hourlyDays, dailyDays int) (int64, int64, error) {
+	var hourly, daily int64
+	err := db.DB.QueryRow(
+		`SELECT
+			(SELECT COUNT(*) FROM `+hourlyRollup.table+` WHERE bucket < $1),
+			(SELECT COUNT(*) FROM `+dailyRollup.table+` WHERE bucket < $2)`,
+		startOfDay(time.Now().AddDate(0, 0, -hourlyDays)), startOfDay(time.Now().AddDate(0, 0, -dailyDays)),
+	).Scan(&hourly, &daily)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count old rollups: %w", err)
+	}
+	return hourly, daily, nil
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestRetentionSQL_Scope(t *testing.T) {
+	scope := RetentionScope{
+		Match: &RetentionMatch{Suffix: "cdn_1.example.com", Subnet: "10.0.0.0/8"},
+		Exclude: []RetentionMatch{
+			{Regex: `(^|\.)evil\.`},
+		},
+	}
+
+	pg := &retentionSQL{domainCol: "domain", clientCol: "client_ip", args: []interface{}{"cutoff"}}
+	expected := ` AND ((domain = $2 OR domain LIKE $3 ESCAPE '\') AND COALESCE(client_ip <<= $4::inet, FALSE)) AND NOT (domain ~ $5)`
+	if where := pg.scope(scope); where != expected {
+		t.Errorf("Expected %q, got %q", expected, where)
+	}
+	if len(pg.args) != 5 || pg.args[2] != `%.cdn\_1.example.com` {
+		t.Errorf("Unexpected args %v", pg.args)
+	}
+
+	// Without a client column a subnet rule matches nothing
+	lite := &retentionSQL{sqlite: true, domainCol: "domain"}
+	expected = ` AND NOT ((domain = $1 OR domain LIKE $2 ESCAPE '\') AND FALSE) AND NOT (domain REGEXP $3)`
+	if where := lite.scope(RetentionScope{Exclude: append([]RetentionMatch{*scope.Match}, scope.Exclude...)}); where != expected {
+		t.Errorf("Expected %q, got %q", expected, where)
+	}
+
+	if where := pg.scope(RetentionScope{}); where != "" {
+		t.Errorf("Expected no condition for an empty scope, got %q", where)
+	}
+}
+
+func TestDeleteOldStats(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	database := &Database{DB: db}
+
+	mock.ExpectExec(`DELETE FROM domain_stat WHERE \(timestamp, id\) IN \( SELECT timestamp, id FROM domain_stat WHERE timestamp < \$1 AND \(\(domain = \$3 OR domain LIKE \$4 ESCAPE '\\'\)\) LIMIT \$2 \)`).
+		WithArgs(StatRetentionCutoff(3, time.Now()), 1000, "akamaized.net", "%.akamaized.net").
+		WillReturnResult(sqlmock.NewResult(0, 1000))
+
+	deleted, err := database.DeleteOldStats(3, RetentionScope{Match: &RetentionMatch{Suffix: "akamaized.net"}}, 1000)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if deleted != 1000 {
+		t.Errorf("Expected 1000 deleted rows, got %d", deleted)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// statRollup describes how a rollup table is computed from its source table
+type statRollup struct {
+	name   string // key in stat_rollup_state
+	table  string
+	source string
+	column string // time column of the source
+	unit   string // date_trunc unit of the buckets
+	count  string // aggregate of the source rows
+}
+
+var (
+	hourlyRollup = statRollup{
+		name: "hourly", table: "domain_stat_hourly",
+		source: "domain_stat", column: "timestamp", unit: "hour", count: "COUNT(*)",
+	}
+	dailyRollup = statRollup{
+		name: "daily", table: "domain_stat_daily",
+		source: "domain_stat_hourly", column: "bucket", unit: "day", count: "SUM(count)",
+	}
+)
+
+// startOfHour truncates t to the start of its hour in t's location
+func startOfHour(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, t.Hour(), 0, 0, 0, t.Location())
+}
+
+// localWallTime reinterprets a scanned TIMESTAMP (returned as UTC) as the collector's
+// local wall time, which is how statistics timestamps are written
+func localWallTime(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.Local)
+}
+
+// RollUpHourlyStats aggregates the domain_stat rows of complete hours before upTo into
+// domain_stat_hourly, at most maxHours hours per call. Returns the new watermark (all
+// statistics before it are rolled up) and the number of rollup rows written.
+func (db *Database) RollUpHourlyStats(upTo time.Time, maxHours int) (time.Time, int64, error) {
+	return db.rollUp(hourlyRollup, startOfHour(upTo), func(from time.Time) time.Time {
+		return from.Add(time.Duration(maxHours) * time.Hour)
+	})
+}
+
+// RollUpDailyStats aggregates complete days of domain_stat_hourly before upTo (the hourly
+// watermark) into domain_stat_daily, at most maxDays days per call. Returns the new
+// watermark and the number of rollup rows written.
+func (db *Database) RollUpDailyStats(upTo time.Time, maxDays int) (time.Time, int64, error) {
+	return db.rollUp(dailyRollup, startOfDay(upTo), func(from time.Time) time.Time {
+		return from.AddDate(0, 0, maxDays)
+	})
+}
+
+// rollUp advances one rollup from its watermark to min(step(watermark), limit) in a
+// single transaction, so every source row is counted exactly once. The first run
+// starts at the oldest source row.
+func (db *Database) rollUp(r statRollup, limit time.Time, step func(from time.Time) time.Time) (time.Time, int64, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.Exec(fmt.Sprintf(
+		`INSERT INTO stat_rollup_state (rollup, rolled_up_to)
+		SELECT $1, date_trunc('%s', COALESCE(MIN(%s), $2::TIMESTAMP)) FROM %s
+		ON CONFLICT (rollup) DO NOTHING`, r.unit, r.column, r.source),
+		r.name, limit,
+	)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("failed to initialize %s rollup: %w", r.name, err)
+	}
+
+	// Locking the state row keeps concurrent collectors from rolling up the same range
+	var from time.Time
+	err = tx.QueryRow(
+		`SELECT rolled_up_to FROM stat_rollup_state WHERE rollup = $1 FOR UPDATE`, r.name,
+	).Scan(&from)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("failed to get %s rollup watermark: %w", r.name, err)
+	}
+	from = localWallTime(from)
+
+	to := step(from)
+	if to.After(limit) {
+		to = limit
+	}
+	if !to.After(from) {
+		return from, 0, nil
+	}
+
+	result, err := tx.Exec(fmt.Sprintf(
+		`INSERT INTO %[1]s (bucket, domain, client_ip, qtype, count)
+		SELECT date_trunc('%[2]s', %[3]s), domain, client_ip, qtype, %[4]s
+		FROM %[5]s
+		WHERE %[3]s >= $1 AND %[3]s < $2
+		GROUP BY 1, 2, 3, 4
+		ON CONFLICT (bucket, domain, client_ip, qtype) DO UPDATE SET count = %[1]s.count + EXCLUDED.count`,
+		r.table, r.unit, r.column, r.count, r.source),
+		from, to,
+	)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("failed to roll up %s stats: %w", r.name, err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if _, err := tx.Exec(
+		`UPDATE stat_rollup_state SET rolled_up_to = $2 WHERE rollup = $1`, r.name, to,
+	); err != nil {
+		return time.Time{}, 0, fmt.Errorf("failed to update %s rollup watermark: %w", r.name, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return time.Time{}, 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return to, rows, nil
+}
+
+// DeleteOldRollups deletes up to limit rollup buckets older than the given number of
+// days from each of domain_stat_hourly and domain_stat_daily. Returns the rows
+// deleted from each.
+func (db *Database) DeleteOldRollups(hourlyDays, dailyDays, limit int) (int64, int64, error) {
+	var deleted [2]int64
+	for i, t := range []struct {
+		table string
+		days  int
+	}{
+		{hourlyRollup.table, hourlyDays},
+		{dailyRollup.table, dailyDays},
+	} {
+		cutoff := startOfDay(time.Now().AddDate(0, 0, -t.days))
+		result, err := db.DB.Exec(
+			`DELETE FROM `+t.table+` WHERE (bucket, domain, client_ip, qtype) IN (
+				SELECT bucket, domain, client_ip, qtype FROM `+t.table+` WHERE bucket < $1 LIMIT $2
+			)`,
+			cutoff, limit,
+		)
+		if err != nil {
+			return deleted[0], deleted[1], fmt.Errorf("failed to delete old rows of %s: %w", t.table, err)
+		}
+		if deleted[i], err = result.RowsAffected(); err != nil {
+			return deleted[0], deleted[1], fmt.Errorf("failed to get rows affected: %w", err)
+		}
+	}
+
+	return deleted[0], deleted[1], nil
+}
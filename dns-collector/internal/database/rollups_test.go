@@ -0,0 +1,152 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestRollUpHourlyStats(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	database := &Database{DB: db}
+	upTo := time.Date(2024, 1, 15, 13, 45, 0, 0, time.Local)
+	from := time.Date(2024, 1, 14, 0, 0, 0, 0, time.Local)
+	to := from.Add(24 * time.Hour)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO stat_rollup_state \(rollup, rolled_up_to\) SELECT \$1, date_trunc\('hour', COALESCE\(MIN\(timestamp\), \$2::TIMESTAMP\)\) FROM domain_stat ON CONFLICT \(rollup\) DO NOTHING`).
+		WithArgs("hourly", time.Date(2024, 1, 15, 13, 0, 0, 0, time.Local)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	// TIMESTAMP columns are scanned as UTC wall time
+	mock.ExpectQuery(`SELECT rolled_up_to FROM stat_rollup_state WHERE rollup = \$1 FOR UPDATE`).
+		WithArgs("hourly").
+		WillReturnRows(sqlmock.NewRows([]string{"rolled_up_to"}).AddRow(time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC)))
+	mock.ExpectExec(`INSERT INTO domain_stat_hourly \(bucket, domain, client_ip, qtype, count\) SELECT date_trunc\('hour', timestamp\), domain, client_ip, qtype, COUNT\(\*\) FROM domain_stat WHERE timestamp >= \$1 AND timestamp < \$2 GROUP BY 1, 2, 3, 4 ON CONFLICT \(bucket, domain, client_ip, qtype\) DO UPDATE SET count = domain_stat_hourly.count \+ EXCLUDED.count`).
+		WithArgs(from, to).
+		WillReturnResult(sqlmock.NewResult(0, 1500))
+	mock.ExpectExec(`UPDATE stat_rollup_state SET rolled_up_to = \$2 WHERE rollup = \$1`).
+		WithArgs("hourly", to).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	watermark, rows, err := database.RollUpHourlyStats(upTo, 24)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !watermark.Equal(to) {
+		t.Errorf("Expected watermark %v, got %v", to, watermark)
+	}
+	if rows != 1500 {
+		t.Errorf("Expected 1500 rows, got %d", rows)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRollUpHourlyStats_UpToDate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	database := &Database{DB: db}
+	upTo := time.Date(2024, 1, 15, 13, 45, 0, 0, time.Local)
+
+	// The current hour is incomplete: nothing is rolled up
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO stat_rollup_state`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT rolled_up_to FROM stat_rollup_state`).
+		WillReturnRows(sqlmock.NewRows([]string{"rolled_up_to"}).AddRow(time.Date(2024, 1, 15, 13, 0, 0, 0, time.UTC)))
+	mock.ExpectRollback()
+
+	watermark, rows, err := database.RollUpHourlyStats(upTo, 24)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !watermark.Equal(time.Date(2024, 1, 15, 13, 0, 0, 0, time.Local)) || rows != 0 {
+		t.Errorf("Expected unchanged watermark and no rows, got %v and %d", watermark, rows)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestRollUpDailyStats(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	database := &Database{DB: db}
+	hourly := time.Date(2024, 1, 15, 13, 0, 0, 0, time.Local)
+	from := time.Date(2024, 1, 14, 0, 0, 0, 0, time.Local)
+	to := time.Date(2024, 1, 15, 0, 0, 0, 0, time.Local)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO stat_rollup_state \(rollup, rolled_up_to\) SELECT \$1, date_trunc\('day', COALESCE\(MIN\(bucket\), \$2::TIMESTAMP\)\) FROM domain_stat_hourly`).
+		WithArgs("daily", to).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT rolled_up_to FROM stat_rollup_state WHERE rollup = \$1 FOR UPDATE`).
+		WithArgs("daily").
+		WillReturnRows(sqlmock.NewRows([]string{"rolled_up_to"}).AddRow(time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC)))
+	mock.ExpectExec(`INSERT INTO domain_stat_daily \(bucket, domain, client_ip, qtype, count\) SELECT date_trunc\('day', bucket\), domain, client_ip, qtype, SUM\(count\) FROM domain_stat_hourly`).
+		WithArgs(from, to).
+		WillReturnResult(sqlmock.NewResult(0, 300))
+	mock.ExpectExec(`UPDATE stat_rollup_state SET rolled_up_to = \$2 WHERE rollup = \$1`).
+		WithArgs("daily", to).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	// A batch of 7 days is capped at the last day completely covered by the hourly rollup
+	watermark, rows, err := database.RollUpDailyStats(hourly, 7)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !watermark.Equal(to) || rows != 300 {
+		t.Errorf("Expected watermark %v and 300 rows, got %v and %d", to, watermark, rows)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
+
+func TestDeleteOldRollups(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	database := &Database{DB: db}
+
+	mock.ExpectExec(`DELETE FROM domain_stat_hourly WHERE \(bucket, domain, client_ip, qtype\) IN \(\s*SELECT .* FROM domain_stat_hourly WHERE bucket < \$1 LIMIT \$2`).
+		WithArgs(startOfDay(time.Now().AddDate(0, 0, -90)), 1000).
+		WillReturnResult(sqlmock.NewResult(0, 1000))
+	mock.ExpectExec(`DELETE FROM domain_stat_daily WHERE \(bucket, domain, client_ip, qtype\) IN \(\s*SELECT .* FROM domain_stat_daily WHERE bucket < \$1 LIMIT \$2`).
+		WithArgs(startOfDay(time.Now().AddDate(0, 0, -730)), 1000).
+		WillReturnResult(sqlmock.NewResult(0, 20))
+
+	hourly, daily, err := database.DeleteOldRollups(90, 730, 1000)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if hourly != 1000 || daily != 20 {
+		t.Errorf("Expected 1000 hourly and 20 daily rows deleted, got %d and %d", hourly, daily)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,1006 @@
+package database
+
+import (
+	"container/list"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+// sqliteTimeLayout is the format of timestamps stored by SQLiteDatabase: the collector's
+// local wall time (as in PostgreSQL TIMESTAMP columns) with fixed-width fractional
+// seconds, so stored timestamps compare correctly as text.
+const sqliteTimeLayout = "2006-01-02 15:04:05.000000"
+
+// sqliteOptions are the connection settings of the SQLite file: foreign keys (ON DELETE
+// CASCADE), WAL so the web-api can read while the collector writes, waiting on locks of
+// other processes, and transactions taking the write lock right away.
+const sqliteOptions = "?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_txlock=immediate"
+
+// SQLiteDatabase is the embedded storage backend: a single SQLite file for small
+// deployments without a PostgreSQL server. It keeps the schema and the semantics of
+// Database; statistics live in one table and retention deletes expired days from it.
+// The collector must be the only writer of the file.
+type SQLiteDatabase struct {
+	DB   *sql.DB
+	path string
+}
+
+func init() {
+	// Functions the PostgreSQL schema provides: domain_priority(), the regex operator
+	// and the inet <<= operator
+	sqlite.MustRegisterDeterministicScalarFunction("domain_priority", 7, sqliteDomainPriority)
+	sqlite.MustRegisterDeterministicScalarFunction("regexp", 2, sqliteRegexp)
+	sqlite.MustRegisterDeterministicScalarFunction("ip_in_subnet", 2, sqliteIPInSubnet)
+}
+
+// NewSQLite opens (creating it if needed) the SQLite database file at path.
+func NewSQLite(path string) (*SQLiteDatabase, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create database directory: %w", err)
+		}
+	}
+
+	db, err := sql.Open("sqlite", path+sqliteOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	// SQLite has a single writer: one connection serializes the collector's statements
+	// instead of failing them with SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+
+	return &SQLiteDatabase{DB: db, path: path}, nil
+}
+
+func (db *SQLiteDatabase) Close() error {
+	if db.DB != nil {
+		return db.DB.Close()
+	}
+	return nil
+}
+
+// sqliteTime formats t as a stored SQLite timestamp
+func sqliteTime(t time.Time) string {
+	return t.In(time.Local).Format(sqliteTimeLayout)
+}
+
+// sqliteArgs formats the time.Time arguments of a statement as stored timestamps
+func sqliteArgs(args []interface{}) []interface{} {
+	out := make([]interface{}, len(args))
+	for i, arg := range args {
+		if t, ok := arg.(time.Time); ok {
+			arg = sqliteTime(t)
+		}
+		out[i] = arg
+	}
+	return out
+}
+
+// sqliteJSON encodes a list of strings as a JSON array (SQLite has no array type)
+func sqliteJSON(values []string) string {
+	if values == nil {
+		values = []string{}
+	}
+	data, _ := json.Marshal(values)
+	return string(data)
+}
+
+func (db *SQLiteDatabase) exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.DB.Exec(query, sqliteArgs(args)...)
+}
+
+func (db *SQLiteDatabase) query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.DB.Query(query, sqliteArgs(args)...)
+}
+
+func (db *SQLiteDatabase) queryRow(query string, args ...interface{}) *sql.Row {
+	return db.DB.QueryRow(query, sqliteArgs(args)...)
+}
+
+// sqliteRegexpCacheSize bounds the compiled patterns kept by sqliteRegexp: patterns
+// come from filters and rules, so any number of distinct ones may be seen over time
+const sqliteRegexpCacheSize = 64
+
+// regexpCache keeps the most recently used compiled patterns
+type regexpCache struct {
+	mu         sync.Mutex
+	entries    map[string]*list.Element
+	lru        *list.List // front = most recently used, values are *regexpCacheEntry
+	maxEntries int
+}
+
+type regexpCacheEntry struct {
+	pattern string
+	re      *regexp.Regexp
+}
+
+func newRegexpCache(maxEntries int) *regexpCache {
+	return &regexpCache{
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+		maxEntries: maxEntries,
+	}
+}
+
+// get returns the compiled pattern, compiling and caching it on a miss
+func (c *regexpCache) get(pattern string) (*regexp.Regexp, error) {
+	c.mu.Lock()
+	if el, ok := c.entries[pattern]; ok {
+		c.lru.MoveToFront(el)
+		c.mu.Unlock()
+		return el.Value.(*regexpCacheEntry).re, nil
+	}
+	c.mu.Unlock()
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[pattern]; ok {
+		c.lru.MoveToFront(el)
+		return el.Value.(*regexpCacheEntry).re, nil
+	}
+	c.entries[pattern] = c.lru.PushFront(&regexpCacheEntry{pattern: pattern, re: re})
+	for c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*regexpCacheEntry).pattern)
+	}
+	return re, nil
+}
+
+var sqliteRegexps = newRegexpCache(sqliteRegexpCacheSize)
+
+// sqliteRegexp implements the REGEXP operator (x REGEXP pattern calls regexp(pattern, x)).
+// Patterns use Go (RE2) syntax, which covers the PostgreSQL regexes used for domains.
+func sqliteRegexp(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+	pattern, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("regexp: pattern must be text")
+	}
+	value, ok := args[1].(string)
+	if !ok {
+		return false, nil
+	}
+
+	re, err := sqliteRegexps.get(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression: %w", err)
+	}
+	return re.MatchString(value), nil
+}
+
+// sqliteIPInSubnet is the inet <<= operator: whether ip is within the CIDR subnet
+func sqliteIPInSubnet(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+	ip, _ := args[0].(string)
+	cidr, _ := args[1].(string)
+	_, subnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subnet format: %w", err)
+	}
+	addr := net.ParseIP(ip)
+	return addr != nil && subnet.Contains(addr), nil
+}
+
+// sqliteDomainPriority is domain_priority() of PostgreSQL migration 000007:
+// w_popularity * ln(1 + query_count) + w_recency * exp(-days since last_seen)
+// + w_staleness * ln(1 + hours since last resolution)
+func sqliteDomainPriority(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+	queryCount := sqliteFloat(args[0])
+	ref, _ := sqliteParseTime(args[3])
+
+	score := sqliteFloat(args[4]) * math.Log(1+math.Max(queryCount, 0))
+	if lastSeen, ok := sqliteParseTime(args[1]); ok {
+		days := math.Max(ref.Sub(lastSeen).Hours()/24, 0)
+		score += sqliteFloat(args[5]) * math.Exp(-days)
+	}
+	if lastResolv, ok := sqliteParseTime(args[2]); ok {
+		hours := math.Max(ref.Sub(lastResolv).Hours(), 0)
+		score += sqliteFloat(args[6]) * math.Log(1+hours)
+	}
+	return score, nil
+}
+
+// sqliteFloat converts a numeric function argument to float64
+func sqliteFloat(v driver.Value) float64 {
+	switch n := v.(type) {
+	case int64:
+		return float64(n)
+	case float64:
+		return n
+	}
+	return 0
+}
+
+// sqliteParseTime parses a stored timestamp passed to a function; false for NULL
+func sqliteParseTime(v driver.Value) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case string:
+		parsed, err := time.ParseInLocation("2006-01-02 15:04:05.999999999", t, time.Local)
+		return parsed, err == nil
+	}
+	return time.Time{}, false
+}
+
+// InsertOrGetDomain inserts a new domain with the settings of its policy or returns existing one.
+// Returns the domain, a boolean indicating if it was newly created, and any error.
+func (db *SQLiteDatabase) InsertOrGetDomain(domain string, policy DomainPolicy) (*Domain, bool, error) {
+	now := time.Now()
+
+	var d Domain
+	err := db.queryRow(
+		`INSERT INTO domain (domain, time_insert, resolv_count, max_resolv, last_resolv_time, last_seen, policy, resolv_interval)
+		VALUES ($1, $2, 0, $3, $2, $2, NULLIF($4, ''), NULLIF($5, 0))
+		ON CONFLICT (domain) DO NOTHING
+		RETURNING id, domain, time_insert, resolv_count, max_resolv, last_resolv_time, last_seen`,
+		domain, now, policy.MaxResolv, policy.Name, policy.IntervalSeconds,
+	).Scan(&d.ID, &d.Domain, &d.TimeInsert, &d.ResolvCount, &d.MaxResolv, &d.LastResolvTime, &d.LastSeen)
+
+	if err == sql.ErrNoRows {
+		// Domain already exists, fetch it
+		err = db.queryRow(
+			`SELECT id, domain, time_insert, resolv_count, max_resolv, last_resolv_time, last_seen
+			FROM domain WHERE domain = $1`,
+			domain,
+		).Scan(&d.ID, &d.Domain, &d.TimeInsert, &d.ResolvCount, &d.MaxResolv, &d.LastResolvTime, &d.LastSeen)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to get existing domain: %w", err)
+		}
+		return &d, false, nil // existing domain
+	} else if err != nil {
+		return nil, false, fmt.Errorf("failed to insert domain: %w", err)
+	}
+
+	return &d, true, nil // new domain
+}
+
+// UpdateDomainLastSeen updates the last_seen timestamp and the query counter for a domain
+func (db *SQLiteDatabase) UpdateDomainLastSeen(domainID int64) error {
+	_, err := db.exec(
+		`UPDATE domain SET last_seen = $1, query_count = query_count + 1 WHERE id = $2`,
+		time.Now(), domainID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update domain last_seen: %w", err)
+	}
+	return nil
+}
+
+// sqliteDueDomainsFilter is dueDomainsFilter for SQLite: pinned resolution intervals
+// are compared as Julian days.
+func sqliteDueDomainsFilter(cyclicMode bool, cooldownMins int, refreshInterval time.Duration, collapseWildcards bool) (string, []interface{}) {
+	now := time.Now()
+	refreshTime := now.Add(-refreshInterval)
+
+	// Never resolved domains (last_resolv_time is initialized to time_insert) are due immediately
+	freshness := `(last_resolv_time <= time_insert
+			   OR (resolv_interval IS NULL AND last_resolv_time <= $1)
+			   OR julianday(last_resolv_time) <= julianday($2) - resolv_interval / 86400.0)
+			AND (next_resolv_time IS NULL OR next_resolv_time <= $2)
+			AND (leased_until IS NULL OR leased_until <= $2)`
+	if collapseWildcards {
+		freshness += `
+			AND (wildcard_zone IS NULL
+			   OR id = (SELECT MIN(c.id) FROM domain c WHERE c.wildcard_zone = domain.wildcard_zone))`
+	}
+
+	if cyclicMode {
+		cooldownTime := now.Add(-time.Duration(cooldownMins) * time.Minute)
+		return `(resolv_count < max_resolv
+			   OR (resolv_count >= max_resolv AND max_resolv > 0 AND last_resolv_time < $3))
+			AND ` + freshness, []interface{}{refreshTime, now, cooldownTime}
+	}
+
+	return `resolv_count < max_resolv
+			AND ` + freshness, []interface{}{refreshTime, now}
+}
+
+// ClaimDomainsToResolve leases up to limit due domains to the caller for leaseDuration
+// and returns them, never resolved domains first, the rest by descending domain_priority().
+func (db *SQLiteDatabase) ClaimDomainsToResolve(limit int, cyclicMode bool, cooldownMins int, refreshInterval, leaseDuration time.Duration, weights PriorityWeights, collapseWildcards bool) ([]Domain, error) {
+	where, args := sqliteDueDomainsFilter(cyclicMode, cooldownMins, refreshInterval, collapseWildcards)
+	leaseUntil := time.Now().Add(leaseDuration)
+	n := len(args)
+	query := fmt.Sprintf(`UPDATE domain SET leased_until = $%d
+			WHERE id IN (
+				SELECT id FROM domain
+				WHERE %s
+				ORDER BY last_resolv_time <= time_insert DESC,
+					domain_priority(query_count, last_seen, last_resolv_time, $2, $%d, $%d, $%d) DESC
+				LIMIT $%d
+			)
+			RETURNING id, domain, time_insert, resolv_count, max_resolv, last_resolv_time, last_seen`,
+		n+1, where, n+2, n+3, n+4, n+5)
+	args = append(args, leaseUntil, weights.Popularity, weights.Recency, weights.Staleness, limit)
+
+	rows, err := db.query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim domains: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var domains []Domain
+	for rows.Next() {
+		var d Domain
+		if err := rows.Scan(&d.ID, &d.Domain, &d.TimeInsert, &d.ResolvCount, &d.MaxResolv, &d.LastResolvTime, &d.LastSeen); err != nil {
+			return nil, fmt.Errorf("failed to scan domain: %w", err)
+		}
+		domains = append(domains, d)
+	}
+
+	return domains, rows.Err()
+}
+
+// ClaimDomain leases a single domain for leaseDuration.
+// Returns false if the domain is currently leased.
+func (db *SQLiteDatabase) ClaimDomain(domainID int64, leaseDuration time.Duration) (bool, error) {
+	now := time.Now()
+
+	result, err := db.exec(
+		`UPDATE domain SET leased_until = $1
+		WHERE id = $2 AND (leased_until IS NULL OR leased_until <= $3)`,
+		now.Add(leaseDuration), domainID, now,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim domain: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// CountDomainsToResolve returns the number of domains currently due for resolution
+func (db *SQLiteDatabase) CountDomainsToResolve(cyclicMode bool, cooldownMins int, refreshInterval time.Duration, collapseWildcards bool) (int64, error) {
+	where, args := sqliteDueDomainsFilter(cyclicMode, cooldownMins, refreshInterval, collapseWildcards)
+
+	var count int64
+	err := db.queryRow(`SELECT COUNT(*) FROM domain WHERE `+where, args...).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count domains to resolve: %w", err)
+	}
+	return count, nil
+}
+
+// RequeueDomains makes domains matching a regex due right away (see Database.RequeueDomains).
+func (db *SQLiteDatabase) RequeueDomains(domainRegex string) (int64, error) {
+	result, err := db.exec(
+		`UPDATE domain
+		SET last_resolv_time = time_insert,
+			next_resolv_time = NULL,
+			leased_until = NULL,
+			resolv_count = MIN(resolv_count, max_resolv - 1)
+		WHERE domain REGEXP $1 AND max_resolv > 0`,
+		domainRegex,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to requeue domains: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return affected, nil
+}
+
+// GetDomainPolicies returns up to limit domains with id greater than afterID and their
+// stored policy settings, ordered by id.
+func (db *SQLiteDatabase) GetDomainPolicies(afterID int64, limit int) ([]DomainPolicyRow, error) {
+	rows, err := db.query(
+		`SELECT id, domain, COALESCE(policy, ''), max_resolv, COALESCE(resolv_interval, 0)
+		FROM domain
+		WHERE id > $1
+		ORDER BY id
+		LIMIT $2`,
+		afterID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get domain policies: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var domains []DomainPolicyRow
+	for rows.Next() {
+		var d DomainPolicyRow
+		if err := rows.Scan(&d.ID, &d.Domain, &d.Policy.Name, &d.Policy.MaxResolv, &d.Policy.IntervalSeconds); err != nil {
+			return nil, fmt.Errorf("failed to scan domain policy: %w", err)
+		}
+		domains = append(domains, d)
+	}
+
+	return domains, rows.Err()
+}
+
+// UpdateDomainPolicy stores the policy settings of a domain.
+func (db *SQLiteDatabase) UpdateDomainPolicy(domainID int64, policy DomainPolicy) error {
+	_, err := db.exec(
+		`UPDATE domain SET policy = NULLIF($1, ''), max_resolv = $2, resolv_interval = NULLIF($3, 0)
+		WHERE id = $4`,
+		policy.Name, policy.MaxResolv, policy.IntervalSeconds, domainID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update domain policy: %w", err)
+	}
+	return nil
+}
+
+// UpdateDomainResolvStats updates resolv_count and last_resolv_time after a successful
+// resolution and clears the failure backoff and the lease.
+func (db *SQLiteDatabase) UpdateDomainResolvStats(domainID int64, cyclicMode bool) error {
+	query := fmt.Sprintf(`UPDATE domain
+		SET resolv_count = %s,
+		    last_resolv_time = $1,
+		    last_error = NULL,
+		    consecutive_failures = 0,
+		    next_resolv_time = NULL,
+		    leased_until = NULL
+		WHERE id = $2`, resolvCountExpr(cyclicMode))
+
+	if _, err := db.exec(query, time.Now(), domainID); err != nil {
+		return fmt.Errorf("failed to update domain stats: %w", err)
+	}
+	return nil
+}
+
+// UpdateDomainResolvFailure records a failed resolution of a domain and postpones the
+// next attempt by base × 2^(consecutive failures so far), capped at max.
+func (db *SQLiteDatabase) UpdateDomainResolvFailure(domainID int64, cyclicMode bool, errClass string, backoffBase, backoffMax time.Duration) error {
+	// strftime('%f') has millisecond precision; pad it to the stored microseconds
+	query := fmt.Sprintf(`UPDATE domain
+		SET resolv_count = %s,
+		    last_resolv_time = $1,
+		    last_error = $2,
+		    consecutive_failures = consecutive_failures + 1,
+		    next_resolv_time = strftime('%%Y-%%m-%%d %%H:%%M:%%f', $1,
+		        '+' || MIN($3 * power(2, MIN(consecutive_failures, 30)), $4) || ' seconds') || '000',
+		    leased_until = NULL
+		WHERE id = $5`, resolvCountExpr(cyclicMode))
+
+	_, err := db.exec(query, time.Now(), errClass, backoffBase.Seconds(), backoffMax.Seconds(), domainID)
+	if err != nil {
+		return fmt.Errorf("failed to update domain failure stats: %w", err)
+	}
+	return nil
+}
+
+// UpdateDomainDNSSECStatus records the result of the domain's latest DNSSEC check.
+func (db *SQLiteDatabase) UpdateDomainDNSSECStatus(domainID int64, status string) error {
+	_, err := db.exec(`UPDATE domain SET dnssec_status = $1 WHERE id = $2`, status, domainID)
+	if err != nil {
+		return fmt.Errorf("failed to update domain dnssec_status: %w", err)
+	}
+	return nil
+}
+
+// InsertOrUpdateIP inserts or updates an IP address observed by source
+// and updates its first_seen, last_seen and seen_count
+func (db *SQLiteDatabase) InsertOrUpdateIP(domainID int64, ip, ipType, source string) error {
+	_, err := db.exec(
+		`INSERT INTO ip (domain_id, ip, type, time, first_seen, last_seen, seen_count, first_source, last_source)
+		VALUES ($1, $2, $3, $4, $4, $4, 1, $5, $5)
+		ON CONFLICT(domain_id, ip) DO UPDATE SET
+			time = $4,
+			type = $3,
+			last_seen = $4,
+			seen_count = ip.seen_count + 1,
+			last_source = $5`,
+		domainID, ip, ipType, time.Now(), source,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert/update IP: %w", err)
+	}
+	return nil
+}
+
+// InsertOrUpdateIPVantage inserts or updates an IP address returned for a vantage point
+// and records the vantage that produced it; seen_count is left as is when counted
+func (db *SQLiteDatabase) InsertOrUpdateIPVantage(domainID int64, ip, ipType, vantage string, counted bool) error {
+	now := sqliteTime(time.Now())
+	increment := 1
+	if counted {
+		increment = 0
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var ipID int64
+	err = tx.QueryRow(
+		`INSERT INTO ip (domain_id, ip, type, time, first_seen, last_seen, seen_count, first_source, last_source)
+		VALUES ($1, $2, $3, $4, $4, $4, 1, $5, $5)
+		ON CONFLICT(domain_id, ip) DO UPDATE SET
+			time = $4,
+			type = $3,
+			last_seen = $4,
+			seen_count = ip.seen_count + $6,
+			last_source = $5
+		RETURNING id`,
+		domainID, ip, ipType, now, SourceResolver, increment,
+	).Scan(&ipID)
+	if err != nil {
+		return fmt.Errorf("failed to insert/update IP vantage: %w", err)
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO ip_vantage (ip_id, vantage, time)
+		VALUES ($1, $2, $3)
+		ON CONFLICT(ip_id, vantage) DO UPDATE SET time = $3`,
+		ipID, vantage, now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert/update IP vantage: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// RecordIPResolution appends the outcome of a resolution of the domain to the seen_history
+// of its IPs of ipTypes and records an ip_change_event when the set of addresses changed
+// (see Database.RecordIPResolution).
+func (db *SQLiteDatabase) RecordIPResolution(domainID int64, ipTypes, seen []string) (*IPChange, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Addresses returned by the previous resolution
+	rows, err := tx.Query(
+		`SELECT ip FROM ip
+		WHERE domain_id = $1 AND type IN (SELECT value FROM json_each($2)) AND seen_history & 1 = 1`,
+		domainID, sqliteJSON(ipTypes),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get previous IPs: %w", err)
+	}
+	var previous []string
+	for rows.Next() {
+		var ip string
+		if err := rows.Scan(&ip); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("failed to scan previous IP: %w", err)
+		}
+		previous = append(previous, ip)
+	}
+	if err := rows.Err(); err != nil {
+		_ = rows.Close()
+		return nil, err
+	}
+	_ = rows.Close()
+
+	_, err = tx.Exec(
+		`UPDATE ip SET seen_history =
+			((seen_history << 1) | CASE WHEN ip IN (SELECT value FROM json_each($2)) THEN 1 ELSE 0 END) & $3
+		WHERE domain_id = $1 AND type IN (SELECT value FROM json_each($4))`,
+		domainID, sqliteJSON(seen), int64(1)<<seenHistoryBits-1, sqliteJSON(ipTypes),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record IP resolution: %w", err)
+	}
+
+	change := diffIPSets(previous, seen)
+	if change != nil {
+		_, err = tx.Exec(
+			`INSERT INTO ip_change_event (domain_id, time, added, removed)
+			VALUES ($1, $2, $3, $4)`,
+			domainID, sqliteTime(time.Now()), sqliteJSON(change.Added), sqliteJSON(change.Removed),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert IP change event: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return change, nil
+}
+
+// GetIPsForPTR returns up to limit distinct addresses whose PTR name was never looked up
+// or was looked up before refreshInterval ago, never-resolved addresses first.
+func (db *SQLiteDatabase) GetIPsForPTR(refreshInterval time.Duration, limit int) ([]string, error) {
+	return db.queryStrings("failed to query IPs for PTR lookup",
+		`SELECT ip.ip
+		FROM ip
+		LEFT JOIN ip_ptr p ON p.ip = ip.ip
+		WHERE p.ip IS NULL OR p.time <= $1
+		GROUP BY ip.ip, p.time
+		ORDER BY p.time NULLS FIRST
+		LIMIT $2`,
+		time.Now().Add(-refreshInterval), limit,
+	)
+}
+
+// UpsertIPPTR caches the PTR name of an address (empty ptr = no PTR record).
+func (db *SQLiteDatabase) UpsertIPPTR(ip, ptr string) error {
+	_, err := db.exec(
+		`INSERT INTO ip_ptr (ip, ptr, time)
+		VALUES ($1, $2, $3)
+		ON CONFLICT(ip) DO UPDATE SET
+			ptr = $2,
+			time = $3`,
+		ip, ptr, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to upsert IP PTR: %w", err)
+	}
+	return nil
+}
+
+// GetIPsForGeo returns up to limit distinct addresses never annotated with ASN/country
+// data or annotated before enrichedBefore.
+func (db *SQLiteDatabase) GetIPsForGeo(enrichedBefore time.Time, limit int) ([]string, error) {
+	return db.queryStrings("failed to query IPs for geo enrichment",
+		`SELECT DISTINCT ip
+		FROM ip
+		WHERE geo_time IS NULL OR geo_time < $1
+		LIMIT $2`,
+		enrichedBefore, limit,
+	)
+}
+
+// UpdateIPGeo stores the ASN and country of an address on all its ip rows.
+// Zero asn and empty strings are stored as NULL (unknown).
+func (db *SQLiteDatabase) UpdateIPGeo(ip string, asn int64, asOrg, country string) error {
+	_, err := db.exec(
+		`UPDATE ip SET
+			asn = NULLIF($1, 0),
+			as_org = NULLIF($2, ''),
+			country = NULLIF($3, ''),
+			geo_time = $4
+		WHERE ip = $5`,
+		asn, asOrg, country, time.Now(), ip,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update IP geo data: %w", err)
+	}
+	return nil
+}
+
+// GetWildcardCandidates returns parent zones worth probing for a wildcard
+// (see Database.GetWildcardCandidates).
+func (db *SQLiteDatabase) GetWildcardCandidates(minSiblings int, checkedBefore time.Time, limit int) ([]string, error) {
+	return db.queryStrings("failed to get wildcard candidates",
+		`WITH children AS (
+			SELECT substr(d.domain, instr(d.domain, '.') + 1) AS parent,
+				group_concat(ip.ip, ',' ORDER BY ip.ip) AS ips
+			FROM domain d
+			JOIN ip ON ip.domain_id = d.id AND ip.type = 'ipv4'
+			WHERE d.wildcard_zone IS NULL
+			GROUP BY d.id
+		)
+		SELECT DISTINCT parent FROM children c
+		WHERE rtrim(parent, '.') LIKE '%.%'
+		AND NOT EXISTS (SELECT 1 FROM wildcard_zone z WHERE z.zone = c.parent AND z.checked_at > $2)
+		GROUP BY parent, ips
+		HAVING COUNT(*) >= $1
+		UNION
+		SELECT zone FROM wildcard_zone WHERE is_wildcard AND checked_at <= $2
+		LIMIT $3`,
+		minSiblings, checkedBefore, limit,
+	)
+}
+
+// RecordWildcardProbe stores the result of a wildcard probe of zone and marks or unmarks
+// its children. Returns the number of domains marked or unmarked.
+func (db *SQLiteDatabase) RecordWildcardProbe(zone string, wildcard bool) (int64, error) {
+	now := sqliteTime(time.Now())
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.Exec(
+		`INSERT INTO wildcard_zone (zone, is_wildcard, detected_at, checked_at)
+		VALUES ($1, $2, CASE WHEN $2 THEN $3 END, $3)
+		ON CONFLICT (zone) DO UPDATE SET
+			is_wildcard = excluded.is_wildcard,
+			detected_at = CASE WHEN excluded.is_wildcard
+				THEN COALESCE(wildcard_zone.detected_at, excluded.detected_at) END,
+			checked_at = excluded.checked_at`,
+		zone, wildcard, now,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record wildcard probe: %w", err)
+	}
+
+	var result sql.Result
+	if wildcard {
+		result, err = tx.Exec(
+			`UPDATE domain SET wildcard_zone = $1
+			WHERE substr(domain, -(length($1) + 1)) = '.' || $1
+			AND (wildcard_zone IS NULL OR length(wildcard_zone) < length($1))`,
+			zone,
+		)
+	} else {
+		result, err = tx.Exec(`UPDATE domain SET wildcard_zone = NULL WHERE wildcard_zone = $1`, zone)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to update wildcard children: %w", err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return updated, nil
+}
+
+// MarkWildcardChildren marks domains added under already known wildcard zones.
+func (db *SQLiteDatabase) MarkWildcardChildren() (int64, error) {
+	result, err := db.exec(
+		`UPDATE domain AS d SET wildcard_zone = z.zone
+		FROM wildcard_zone z
+		WHERE z.is_wildcard AND d.wildcard_zone IS NULL
+		AND substr(d.domain, -(length(z.zone) + 1)) = '.' || z.zone`,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark wildcard children: %w", err)
+	}
+
+	marked, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return marked, nil
+}
+
+// InsertDomainStat inserts a new statistics record. A client IP that is not
+// a valid address (e.g. "unknown") is stored as NULL.
+func (db *SQLiteDatabase) InsertDomainStat(domain, clientIP, qtype, rtype string) error {
+	var client interface{}
+	if net.ParseIP(clientIP) != nil {
+		client = clientIP
+	}
+
+	_, err := db.exec(
+		`INSERT INTO domain_stat (domain, client_ip, qtype, rtype, timestamp)
+		VALUES ($1, $2, $3, $4, $5)`,
+		domain, client, qtype, rtype, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert domain stat: %w", err)
+	}
+	return nil
+}
+
+// GetDomainsCount returns the total number of domains in the database.
+func (db *SQLiteDatabase) GetDomainsCount() (int64, error) {
+	var count int64
+	if err := db.queryRow(`SELECT COUNT(*) FROM domain`).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count domains: %w", err)
+	}
+	return count, nil
+}
+
+// GetIPsCount returns the total number of IP addresses in the database.
+func (db *SQLiteDatabase) GetIPsCount() (int64, error) {
+	var count int64
+	if err := db.queryRow(`SELECT COUNT(*) FROM ip`).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count IPs: %w", err)
+	}
+	return count, nil
+}
+
+// GetBackoffDomainsCount returns the number of domains currently in failure backoff,
+// grouped by the error class of their last failed resolution.
+func (db *SQLiteDatabase) GetBackoffDomainsCount() (map[string]int64, error) {
+	return db.queryCounts("failed to count domains in backoff",
+		`SELECT COALESCE(last_error, 'error'), COUNT(*)
+		FROM domain
+		WHERE next_resolv_time > $1
+		GROUP BY 1`,
+		time.Now(),
+	)
+}
+
+// GetDNSSECStatusCounts returns the number of checked domains grouped by DNSSEC status.
+func (db *SQLiteDatabase) GetDNSSECStatusCounts() (map[string]int64, error) {
+	return db.queryCounts("failed to count domains by dnssec status",
+		`SELECT dnssec_status, COUNT(*)
+		FROM domain
+		WHERE dnssec_status IS NOT NULL
+		GROUP BY 1`,
+	)
+}
+
+// DeleteExpiredIPs deletes up to limit IP addresses older than the specified TTL,
+// only for domains within scope that are still being queried (last_seen >= cutoff)
+func (db *SQLiteDatabase) DeleteExpiredIPs(ttlDays int, scope RetentionScope, limit int) (int64, error) {
+	if ttlDays <= 0 {
+		return 0, nil // TTL disabled
+	}
+
+	r := &retentionSQL{sqlite: true, domainCol: "domain", args: []interface{}{time.Now().AddDate(0, 0, -ttlDays), limit}}
+	inScope := r.scope(scope)
+
+	return db.execCount("failed to delete expired IPs",
+		`DELETE FROM ip
+		WHERE id IN (
+			SELECT id FROM ip
+			WHERE time < $1
+			AND domain_id IN (
+				SELECT id FROM domain
+				WHERE last_seen >= $1`+inScope+`
+			)
+			LIMIT $2
+		)`,
+		r.args...,
+	)
+}
+
+// DeleteOldDomains deletes up to limit domains within scope not seen in the specified TTL
+// period and their IPs. Domains with NULL last_seen are preserved. Returns (domains
+// deleted, IPs deleted, error).
+func (db *SQLiteDatabase) DeleteOldDomains(ttlDays int, scope RetentionScope, limit int) (int64, int64, error) {
+	if ttlDays <= 0 {
+		return 0, 0, nil // TTL disabled
+	}
+
+	r := &retentionSQL{sqlite: true, domainCol: "domain", args: []interface{}{time.Now().AddDate(0, 0, -ttlDays), limit}}
+	inScope := r.scope(scope)
+	args := sqliteArgs(r.args)
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.Printf("Error rolling back transaction: %v", err)
+		}
+	}()
+
+	// Both statements select the same batch: writers are serialized, so nothing
+	// changes the domains in between
+	batch := `SELECT id FROM domain
+		WHERE last_seen IS NOT NULL
+		AND last_seen < $1` + inScope + `
+		ORDER BY id
+		LIMIT $2`
+
+	ipResult, err := tx.Exec(`DELETE FROM ip WHERE domain_id IN (`+batch+`)`, args...)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to delete IPs for old domains: %w", err)
+	}
+	ipsDeleted, err := ipResult.RowsAffected()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get IP rows affected: %w", err)
+	}
+
+	domainResult, err := tx.Exec(`DELETE FROM domain WHERE id IN (`+batch+`)`, args...)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to delete old domains: %w", err)
+	}
+	domainsDeleted, err := domainResult.RowsAffected()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get domain rows affected: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return domainsDeleted, ipsDeleted, nil
+}
+
+// DeleteOldIPChangeEvents deletes up to limit IP change events older than the specified number of days.
+func (db *SQLiteDatabase) DeleteOldIPChangeEvents(days, limit int) (int64, error) {
+	return db.execCount("failed to delete old IP change events",
+		`DELETE FROM ip_change_event
+		WHERE id IN (SELECT id FROM ip_change_event WHERE time < $1 LIMIT $2)`,
+		time.Now().AddDate(0, 0, -days), limit)
+}
+
+// DeleteOrphanedPTRs deletes up to limit cached PTR names of addresses no longer present in the ip table.
+func (db *SQLiteDatabase) DeleteOrphanedPTRs(limit int) (int64, error) {
+	return db.execCount("failed to delete orphaned PTRs",
+		`DELETE FROM ip_ptr
+		WHERE ip IN (
+			SELECT p.ip FROM ip_ptr AS p
+			WHERE NOT EXISTS (SELECT 1 FROM ip WHERE ip.ip = p.ip)
+			LIMIT $1
+		)`, limit)
+}
+
+// VacuumAnalyze refreshes the query planner statistics of a table. SQLite has no
+// per-table VACUUM; freed pages are reused by later inserts.
+func (db *SQLiteDatabase) VacuumAnalyze(table string) error {
+	if _, err := db.exec(`ANALYZE ` + table); err != nil {
+		return fmt.Errorf("failed to analyze %s: %w", table, err)
+	}
+	return nil
+}
+
+// queryStrings runs a query returning a single text column
+func (db *SQLiteDatabase) queryStrings(errMsg, query string, args ...interface{}) ([]string, error) {
+	rows, err := db.query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errMsg, err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, fmt.Errorf("%s: %w", errMsg, err)
+		}
+		values = append(values, v)
+	}
+
+	return values, rows.Err()
+}
+
+// queryCounts runs a query returning (key, count) rows
+func (db *SQLiteDatabase) queryCounts(errMsg, query string, args ...interface{}) (map[string]int64, error) {
+	rows, err := db.query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", errMsg, err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var key string
+		var count int64
+		if err := rows.Scan(&key, &count); err != nil {
+			return nil, fmt.Errorf("%s: %w", errMsg, err)
+		}
+		counts[key] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// execCount runs a statement and returns the number of affected rows
+func (db *SQLiteDatabase) execCount(errMsg, query string, args ...interface{}) (int64, error) {
+	result, err := db.exec(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", errMsg, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return affected, nil
+}
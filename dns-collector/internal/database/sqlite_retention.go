@@ -0,0 +1,109 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// PreviewOldStats returns, per domain, the domain_stat rows within scope in [from, before)
+// that a cleanup would delete. Nothing is modified.
+func (db *SQLiteDatabase) PreviewOldStats(from, before time.Time, scope RetentionScope) ([]DomainCount, error) {
+	r := &retentionSQL{sqlite: true, domainCol: "domain", clientCol: "client_ip", args: []interface{}{from, before}}
+	inScope := r.scope(scope)
+
+	rows, err := db.query(
+		`SELECT domain, COUNT(*) FROM domain_stat
+		WHERE timestamp >= $1 AND timestamp < $2`+inScope+`
+		GROUP BY domain`,
+		r.args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to preview old statistics: %w", err)
+	}
+	return scanDomainCounts(rows)
+}
+
+// PreviewExpiredIPs returns, per domain, the IP addresses DeleteExpiredIPs would delete
+func (db *SQLiteDatabase) PreviewExpiredIPs(ttlDays int, scope RetentionScope) ([]DomainCount, error) {
+	if ttlDays <= 0 {
+		return nil, nil // TTL disabled
+	}
+
+	r := &retentionSQL{sqlite: true, domainCol: "d.domain", args: []interface{}{time.Now().AddDate(0, 0, -ttlDays)}}
+	inScope := r.scope(scope)
+
+	rows, err := db.query(
+		`SELECT d.domain, COUNT(*) FROM ip
+		JOIN domain d ON d.id = ip.domain_id
+		WHERE ip.time < $1 AND d.last_seen >= $1`+inScope+`
+		GROUP BY d.domain`,
+		r.args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to preview expired IPs: %w", err)
+	}
+	return scanDomainCounts(rows)
+}
+
+// PreviewOldDomains returns the domains DeleteOldDomains would delete with the number
+// of their IP addresses
+func (db *SQLiteDatabase) PreviewOldDomains(ttlDays int, scope RetentionScope) ([]DomainCount, error) {
+	if ttlDays <= 0 {
+		return nil, nil // TTL disabled
+	}
+
+	r := &retentionSQL{sqlite: true, domainCol: "d.domain", args: []interface{}{time.Now().AddDate(0, 0, -ttlDays)}}
+	inScope := r.scope(scope)
+
+	rows, err := db.query(
+		`SELECT d.domain, COUNT(ip.id) FROM domain d
+		LEFT JOIN ip ON ip.domain_id = d.id
+		WHERE d.last_seen IS NOT NULL AND d.last_seen < $1`+inScope+`
+		GROUP BY d.domain`,
+		r.args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to preview old domains: %w", err)
+	}
+	return scanDomainCounts(rows)
+}
+
+// CountOrphanedPTRs returns the number of cached PTR names DeleteOrphanedPTRs would delete
+func (db *SQLiteDatabase) CountOrphanedPTRs() (int64, error) {
+	var count int64
+	err := db.queryRow(
+		`SELECT COUNT(*) FROM ip_ptr AS p
+		WHERE NOT EXISTS (SELECT 1 FROM ip WHERE ip.ip = p.ip)`,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count orphaned PTRs: %w", err)
+	}
+	return count, nil
+}
+
+// CountOldIPChangeEvents returns the number of IP change events DeleteOldIPChangeEvents would delete
+func (db *SQLiteDatabase) CountOldIPChangeEvents(days int) (int64, error) {
+	var count int64
+	err := db.queryRow(
+		`SELECT COUNT(*) FROM ip_change_event WHERE time < $1`, time.Now().AddDate(0, 0, -days),
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count old IP change events: %w", err)
+	}
+	return count, nil
+}
+
+// CountOldRollups returns the number of hourly and daily rollup rows DeleteOldRollups would delete
+func (db *SQLiteDatabase) CountOldRollups(hourlyDays, dailyDays int) (int64, int64, error) {
+	var hourly, daily int64
+	err := db.queryRow(
+		`SELECT
+			(SELECT COUNT(*) FROM `+hourlyRollup.table+` WHERE bucket < $1),
+			(SELECT COUNT(*) FROM `+dailyRollup.table+` WHERE bucket < $2)`,
+		startOfDay(time.Now().AddDate(0, 0, -hourlyDays)), startOfDay(time.Now().AddDate(0, 0, -dailyDays)),
+	).Scan(&hourly, &daily)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count old rollups: %w", err)
+	}
+	return hourly, daily, nil
+}
@@ -0,0 +1,326 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// sqliteTruncFormats are the strftime formats truncating a stored timestamp to
+// the date_trunc units of the rollups
+var sqliteTruncFormats = map[string]string{
+	"hour": "%Y-%m-%d %H:00:00.000000",
+	"day":  "%Y-%m-%d 00:00:00.000000",
+}
+
+// EnsureStatPartitions is a no-op: SQLite keeps domain_stat in a single table.
+func (db *SQLiteDatabase) EnsureStatPartitions(now time.Time) (int, error) {
+	return 0, nil
+}
+
+// DropOldStatPartitions deletes domain_stat rows of the days entirely older than
+// retentionDays, matching the day-granular retention of the PostgreSQL partitions.
+// Returns the number of days and rows deleted.
+func (db *SQLiteDatabase) DropOldStatPartitions(retentionDays int) (int, int64, error) {
+	return db.DropStatPartitionsBefore(time.Now().AddDate(0, 0, -retentionDays))
+}
+
+// DropStatPartitionsBefore deletes the domain_stat rows of the days ending at or
+// before cutoff. Returns the number of days and rows deleted.
+func (db *SQLiteDatabase) DropStatPartitionsBefore(cutoff time.Time) (int, int64, error) {
+	cutoff = startOfDay(cutoff)
+
+	var days int
+	err := db.queryRow(
+		`SELECT COUNT(DISTINCT substr(timestamp, 1, 10)) FROM domain_stat WHERE timestamp < $1`, cutoff,
+	).Scan(&days)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count expired domain_stat days: %w", err)
+	}
+	if days == 0 {
+		return 0, 0, nil
+	}
+
+	rows, err := db.execCount("failed to delete expired domain_stat rows",
+		`DELETE FROM domain_stat WHERE timestamp < $1`, cutoff)
+	if err != nil {
+		return 0, 0, err
+	}
+	return days, rows, nil
+}
+
+// GetStatPartitions returns a pseudo-partition per day of domain_stat, oldest first.
+// Bytes is the day's share of the table size by row count.
+func (db *SQLiteDatabase) GetStatPartitions() ([]StatPartition, error) {
+	sizes, err := db.GetTableSizes()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.query(
+		`SELECT substr(timestamp, 1, 10), COUNT(*) FROM domain_stat GROUP BY 1 ORDER BY 1`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query domain_stat days: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var partitions []StatPartition
+	var total int64
+	for rows.Next() {
+		var day string
+		var p StatPartition
+		if err := rows.Scan(&day, &p.Rows); err != nil {
+			return nil, fmt.Errorf("failed to scan domain_stat day: %w", err)
+		}
+		if p.From, err = time.ParseInLocation("2006-01-02", day, time.Local); err != nil {
+			return nil, fmt.Errorf("failed to parse domain_stat day %q: %w", day, err)
+		}
+		p.Name = statPartitionName(p.From)
+		p.To = p.From.AddDate(0, 0, 1)
+		partitions = append(partitions, p)
+		total += p.Rows
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating domain_stat days: %w", err)
+	}
+
+	for i := range partitions {
+		partitions[i].Bytes = sizes["domain_stat"] * partitions[i].Rows / total
+	}
+	return partitions, nil
+}
+
+// GetTableSizes returns the size of the pages used by every table and its indexes in
+// bytes (dbstat). Free pages of the file are not counted.
+func (db *SQLiteDatabase) GetTableSizes() (map[string]int64, error) {
+	rows, err := db.query(
+		`SELECT m.tbl_name, SUM(s.pgsize) FROM dbstat s
+		JOIN sqlite_master m ON m.name = s.name
+		GROUP BY m.tbl_name`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query table sizes: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	sizes := make(map[string]int64)
+	for rows.Next() {
+		var table string
+		var bytes int64
+		if err := rows.Scan(&table, &bytes); err != nil {
+			return nil, fmt.Errorf("failed to scan table size: %w", err)
+		}
+		sizes[table] = bytes
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating table sizes: %w", err)
+	}
+
+	return sizes, nil
+}
+
+// DeleteOldStats deletes up to limit domain_stat rows within scope of the days
+// entirely older than retentionDays.
+func (db *SQLiteDatabase) DeleteOldStats(retentionDays int, scope RetentionScope, limit int) (int64, error) {
+	r := &retentionSQL{
+		sqlite:    true,
+		domainCol: "domain",
+		clientCol: "client_ip",
+		args:      []interface{}{StatRetentionCutoff(retentionDays, time.Now()), limit},
+	}
+	inScope := r.scope(scope)
+
+	return db.execCount("failed to delete old statistics",
+		`DELETE FROM domain_stat
+		WHERE rowid IN (
+			SELECT rowid FROM domain_stat
+			WHERE timestamp < $1`+inScope+`
+			LIMIT $2
+		)`,
+		r.args...,
+	)
+}
+
+// RollUpHourlyStats aggregates the domain_stat rows of complete hours before upTo into
+// domain_stat_hourly, at most maxHours hours per call (see Database.RollUpHourlyStats).
+func (db *SQLiteDatabase) RollUpHourlyStats(upTo time.Time, maxHours int) (time.Time, int64, error) {
+	return db.rollUp(hourlyRollup, startOfHour(upTo), func(from time.Time) time.Time {
+		return from.Add(time.Duration(maxHours) * time.Hour)
+	})
+}
+
+// RollUpDailyStats aggregates complete days of domain_stat_hourly before upTo into
+// domain_stat_daily, at most maxDays days per call (see Database.RollUpDailyStats).
+func (db *SQLiteDatabase) RollUpDailyStats(upTo time.Time, maxDays int) (time.Time, int64, error) {
+	return db.rollUp(dailyRollup, startOfDay(upTo), func(from time.Time) time.Time {
+		return from.AddDate(0, 0, maxDays)
+	})
+}
+
+// rollUp advances one rollup like Database.rollUp. The transaction holds the write
+// lock of the file from its start, so no row locking is needed.
+func (db *SQLiteDatabase) rollUp(r statRollup, limit time.Time, step func(from time.Time) time.Time) (time.Time, int64, error) {
+	trunc := sqliteTruncFormats[r.unit]
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.Exec(fmt.Sprintf(
+		`INSERT INTO stat_rollup_state (rollup, rolled_up_to)
+		SELECT $1, strftime('%s', COALESCE(MIN(%s), $2)) FROM %s WHERE true
+		ON CONFLICT (rollup) DO NOTHING`, trunc, r.column, r.source),
+		r.name, sqliteTime(limit),
+	)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("failed to initialize %s rollup: %w", r.name, err)
+	}
+
+	var from time.Time
+	err = tx.QueryRow(`SELECT rolled_up_to FROM stat_rollup_state WHERE rollup = $1`, r.name).Scan(&from)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("failed to get %s rollup watermark: %w", r.name, err)
+	}
+	from = localWallTime(from)
+
+	to := step(from)
+	if to.After(limit) {
+		to = limit
+	}
+	if !to.After(from) {
+		return from, 0, nil
+	}
+
+	// Unknown clients are matched by the IFNULL(client_ip, '') expression of the unique index
+	result, err := tx.Exec(fmt.Sprintf(
+		`INSERT INTO %[1]s (bucket, domain, client_ip, qtype, count)
+		SELECT strftime('%[2]s', %[3]s), domain, client_ip, qtype, %[4]s
+		FROM %[5]s
+		WHERE %[3]s >= $1 AND %[3]s < $2
+		GROUP BY 1, 2, 3, 4
+		ON CONFLICT (bucket, domain, IFNULL(client_ip, ''), qtype) DO UPDATE SET count = %[1]s.count + excluded.count`,
+		r.table, trunc, r.column, r.count, r.source),
+		sqliteTime(from), sqliteTime(to),
+	)
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("failed to roll up %s stats: %w", r.name, err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return time.Time{}, 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if _, err := tx.Exec(
+		`UPDATE stat_rollup_state SET rolled_up_to = $2 WHERE rollup = $1`, r.name, sqliteTime(to),
+	); err != nil {
+		return time.Time{}, 0, fmt.Errorf("failed to update %s rollup watermark: %w", r.name, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return time.Time{}, 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return to, rows, nil
+}
+
+// DeleteOldRollups deletes up to limit rollup buckets older than the given number of
+// days from each of domain_stat_hourly and domain_stat_daily. Returns the rows
+// deleted from each.
+func (db *SQLiteDatabase) DeleteOldRollups(hourlyDays, dailyDays, limit int) (int64, int64, error) {
+	hourly, err := db.execCount("failed to delete old rows of "+hourlyRollup.table,
+		`DELETE FROM `+hourlyRollup.table+` WHERE rowid IN (
+			SELECT rowid FROM `+hourlyRollup.table+` WHERE bucket < $1 LIMIT $2
+		)`, startOfDay(time.Now().AddDate(0, 0, -hourlyDays)), limit)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	daily, err := db.execCount("failed to delete old rows of "+dailyRollup.table,
+		`DELETE FROM `+dailyRollup.table+` WHERE rowid IN (
+			SELECT rowid FROM `+dailyRollup.table+` WHERE bucket < $1 LIMIT $2
+		)`, startOfDay(time.Now().AddDate(0, 0, -dailyDays)), limit)
+	if err != nil {
+		return hourly, 0, err
+	}
+
+	return hourly, daily, nil
+}
+
+// GetStatDaysBefore returns the days with statistics before cutoff, oldest first
+func (db *SQLiteDatabase) GetStatDaysBefore(cutoff time.Time) ([]time.Time, error) {
+	rows, err := db.query(
+		`SELECT DISTINCT substr(timestamp, 1, 10) FROM domain_stat WHERE timestamp < $1 ORDER BY 1`, cutoff,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query statistics days: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var days []time.Time
+	for rows.Next() {
+		var day string
+		if err := rows.Scan(&day); err != nil {
+			return nil, fmt.Errorf("failed to scan statistics day: %w", err)
+		}
+		t, err := time.ParseInLocation(time.DateOnly, day, time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse statistics day %q: %w", day, err)
+		}
+		days = append(days, t)
+	}
+	return days, rows.Err()
+}
+
+// ExportStats calls fn for every domain_stat row in [from, to) ordered by timestamp.
+// Returns the number of rows exported.
+func (db *SQLiteDatabase) ExportStats(from, to time.Time, fn func(StatRecord) error) (int64, error) {
+	rows, err := db.query(
+		`SELECT id, domain, client_ip, qtype, rtype, timestamp FROM domain_stat
+		WHERE timestamp >= $1 AND timestamp < $2 ORDER BY timestamp, id`, from, to,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query statistics: %w", err)
+	}
+	return scanStatRecords(rows, fn)
+}
+
+// ImportStats inserts archived statistics into the scratch table, creating it with
+// the columns of domain_stat if needed.
+func (db *SQLiteDatabase) ImportStats(table string, records []StatRecord) error {
+	if !ScratchTableRe.MatchString(table) {
+		return fmt.Errorf("invalid scratch table name: %s", table)
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.Exec(`CREATE TABLE IF NOT EXISTS ` + table + ` (
+		id INTEGER, domain TEXT NOT NULL, client_ip TEXT, qtype TEXT NOT NULL DEFAULT '',
+		rtype TEXT NOT NULL, timestamp TIMESTAMP NOT NULL)`)
+	if err != nil {
+		return fmt.Errorf("failed to create scratch table %s: %w", table, err)
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO ` + table +
+		` (id, domain, client_ip, qtype, rtype, timestamp) VALUES ($1, $2, $3, $4, $5, $6)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare import: %w", err)
+	}
+	defer func() { _ = stmt.Close() }()
+
+	for _, r := range records {
+		if _, err := stmt.Exec(r.ID, r.Domain, nullableClientIP(r.ClientIP), r.QType, r.RType, sqliteTime(r.Timestamp)); err != nil {
+			return fmt.Errorf("failed to import statistics row %d: %w", r.ID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
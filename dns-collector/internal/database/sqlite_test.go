@@ -0,0 +1,580 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestSQLite opens a migrated SQLite database in a temporary directory
+func newTestSQLite(t *testing.T) *SQLiteDatabase {
+	t.Helper()
+
+	db, err := NewSQLite(filepath.Join(t.TempDir(), "data", "collector.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite database: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	if err := db.RunMigrations(); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+	return db
+}
+
+func TestSQLite_InsertOrGetDomain(t *testing.T) {
+	db := newTestSQLite(t)
+
+	d, created, err := db.InsertOrGetDomain("example.com", DomainPolicy{MaxResolv: 10})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !created || d.ID == 0 || d.Domain != "example.com" || d.MaxResolv != 10 {
+		t.Errorf("Expected new domain example.com, got %+v (created: %v)", d, created)
+	}
+
+	again, created, err := db.InsertOrGetDomain("example.com", DomainPolicy{MaxResolv: 5})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if created || again.ID != d.ID || again.MaxResolv != 10 {
+		t.Errorf("Expected existing domain %d, got %+v (created: %v)", d.ID, again, created)
+	}
+	if !again.TimeInsert.Equal(d.TimeInsert) {
+		t.Errorf("Expected time_insert %v, got %v", d.TimeInsert, again.TimeInsert)
+	}
+}
+
+func TestSQLite_ClaimDomainsToResolve(t *testing.T) {
+	db := newTestSQLite(t)
+
+	for _, name := range []string{"a.example.com", "b.example.com"} {
+		if _, _, err := db.InsertOrGetDomain(name, DomainPolicy{MaxResolv: 3}); err != nil {
+			t.Fatalf("Failed to insert domain: %v", err)
+		}
+	}
+	if _, _, err := db.InsertOrGetDomain("never.example.com", DomainPolicy{}); err != nil {
+		t.Fatalf("Failed to insert domain: %v", err)
+	}
+
+	weights := PriorityWeights{Popularity: 1, Recency: 1, Staleness: 1}
+	count, err := db.CountDomainsToResolve(false, 0, time.Hour, false)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 domains due, got %d", count)
+	}
+
+	claimed, err := db.ClaimDomainsToResolve(10, false, 0, time.Hour, time.Minute, weights, false)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(claimed) != 2 {
+		t.Fatalf("Expected 2 claimed domains, got %d", len(claimed))
+	}
+
+	// Leased domains are not handed out again
+	claimed, err = db.ClaimDomainsToResolve(10, false, 0, time.Hour, time.Minute, weights, false)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(claimed) != 0 {
+		t.Errorf("Expected no claimed domains, got %d", len(claimed))
+	}
+}
+
+func TestSQLite_ResolutionFailureBackoff(t *testing.T) {
+	db := newTestSQLite(t)
+
+	d, _, err := db.InsertOrGetDomain("example.com", DomainPolicy{MaxResolv: 3})
+	if err != nil {
+		t.Fatalf("Failed to insert domain: %v", err)
+	}
+
+	if err := db.UpdateDomainResolvFailure(d.ID, false, "timeout", time.Minute, time.Hour); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	backoff, err := db.GetBackoffDomainsCount()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if backoff["timeout"] != 1 {
+		t.Errorf("Expected 1 domain in timeout backoff, got %v", backoff)
+	}
+
+	count, err := db.CountDomainsToResolve(false, 0, 0, false)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected no domains due during backoff, got %d", count)
+	}
+
+	// A successful resolution clears the backoff
+	if err := db.UpdateDomainResolvStats(d.ID, false); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if backoff, _ := db.GetBackoffDomainsCount(); len(backoff) != 0 {
+		t.Errorf("Expected no domains in backoff, got %v", backoff)
+	}
+}
+
+func TestSQLite_RecordIPResolution(t *testing.T) {
+	db := newTestSQLite(t)
+
+	d, _, err := db.InsertOrGetDomain("example.com", DomainPolicy{MaxResolv: 3})
+	if err != nil {
+		t.Fatalf("Failed to insert domain: %v", err)
+	}
+
+	resolve := func(ips ...string) *IPChange {
+		t.Helper()
+		for _, ip := range ips {
+			if err := db.InsertOrUpdateIPVantage(d.ID, ip, "ipv4", "default", false); err != nil {
+				t.Fatalf("Failed to insert IP: %v", err)
+			}
+		}
+		change, err := db.RecordIPResolution(d.ID, []string{"ipv4"}, ips)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		return change
+	}
+
+	if change := resolve("192.0.2.1", "192.0.2.2"); change == nil || len(change.Added) != 2 {
+		t.Errorf("Expected 2 added addresses, got %+v", change)
+	}
+	if change := resolve("192.0.2.1", "192.0.2.2"); change != nil {
+		t.Errorf("Expected no change, got %+v", change)
+	}
+	change := resolve("192.0.2.1", "192.0.2.3")
+	if change == nil || len(change.Added) != 1 || change.Added[0] != "192.0.2.3" ||
+		len(change.Removed) != 1 || change.Removed[0] != "192.0.2.2" {
+		t.Errorf("Expected 192.0.2.3 added and 192.0.2.2 removed, got %+v", change)
+	}
+
+	var events int
+	if err := db.DB.QueryRow(`SELECT COUNT(*) FROM ip_change_event`).Scan(&events); err != nil {
+		t.Fatalf("Failed to count events: %v", err)
+	}
+	if events != 2 {
+		t.Errorf("Expected 2 change events, got %d", events)
+	}
+}
+
+func TestSQLite_InsertOrUpdateIPVantage_CountsOncePerResolution(t *testing.T) {
+	db := newTestSQLite(t)
+
+	d, _, err := db.InsertOrGetDomain("example.com", DomainPolicy{MaxResolv: 3})
+	if err != nil {
+		t.Fatalf("Failed to insert domain: %v", err)
+	}
+
+	// Two resolutions, each returning the address from two vantages
+	for i := 0; i < 2; i++ {
+		for _, v := range []struct {
+			name    string
+			counted bool
+		}{{"msk", false}, {"ams", true}} {
+			if err := db.InsertOrUpdateIPVantage(d.ID, "192.0.2.1", "ipv4", v.name, v.counted); err != nil {
+				t.Fatalf("Failed to insert IP: %v", err)
+			}
+		}
+	}
+
+	var seenCount, vantages int
+	if err := db.DB.QueryRow(`SELECT seen_count FROM ip WHERE ip = '192.0.2.1'`).Scan(&seenCount); err != nil {
+		t.Fatalf("Failed to read seen_count: %v", err)
+	}
+	if err := db.DB.QueryRow(`SELECT COUNT(*) FROM ip_vantage`).Scan(&vantages); err != nil {
+		t.Fatalf("Failed to count vantages: %v", err)
+	}
+	if seenCount != 2 || vantages != 2 {
+		t.Errorf("Expected seen_count 2 and 2 vantages, got %d and %d", seenCount, vantages)
+	}
+}
+
+func TestSQLite_Wildcards(t *testing.T) {
+	db := newTestSQLite(t)
+
+	for _, name := range []string{"a.cdn.example.com", "b.cdn.example.com", "c.cdn.example.com"} {
+		d, _, err := db.InsertOrGetDomain(name, DomainPolicy{MaxResolv: 3})
+		if err != nil {
+			t.Fatalf("Failed to insert domain: %v", err)
+		}
+		if err := db.InsertOrUpdateIP(d.ID, "192.0.2.10", "ipv4", SourceResolver); err != nil {
+			t.Fatalf("Failed to insert IP: %v", err)
+		}
+	}
+
+	zones, err := db.GetWildcardCandidates(3, time.Now(), 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(zones) != 1 || zones[0] != "cdn.example.com" {
+		t.Fatalf("Expected candidate cdn.example.com, got %v", zones)
+	}
+
+	marked, err := db.RecordWildcardProbe("cdn.example.com", true)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if marked != 3 {
+		t.Errorf("Expected 3 domains marked, got %d", marked)
+	}
+
+	if _, _, err := db.InsertOrGetDomain("d.cdn.example.com", DomainPolicy{MaxResolv: 3}); err != nil {
+		t.Fatalf("Failed to insert domain: %v", err)
+	}
+	if marked, err := db.MarkWildcardChildren(); err != nil || marked != 1 {
+		t.Errorf("Expected 1 new child marked, got %d (%v)", marked, err)
+	}
+
+	// Only one domain of a wildcard zone is resolved
+	count, err := db.CountDomainsToResolve(false, 0, time.Hour, true)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 domain due, got %d", count)
+	}
+}
+
+func TestSQLite_RollUpStats(t *testing.T) {
+	db := newTestSQLite(t)
+
+	hour := startOfHour(time.Now()).Add(-2 * time.Hour)
+	for i, clientIP := range []interface{}{"192.168.1.10", "192.168.1.10", nil, nil} {
+		_, err := db.exec(
+			`INSERT INTO domain_stat (domain, client_ip, qtype, rtype, timestamp) VALUES ($1, $2, 'A', 'cache', $3)`,
+			"example.com", clientIP, hour.Add(time.Duration(i)*time.Minute),
+		)
+		if err != nil {
+			t.Fatalf("Failed to insert stat: %v", err)
+		}
+	}
+
+	watermark, rows, err := db.RollUpHourlyStats(time.Now(), 24)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !watermark.Equal(startOfHour(time.Now())) {
+		t.Errorf("Expected watermark %v, got %v", startOfHour(time.Now()), watermark)
+	}
+	// One row for the client and one for the unknown clients
+	if rows != 2 {
+		t.Errorf("Expected 2 rollup rows, got %d", rows)
+	}
+
+	var unknown int
+	err = db.DB.QueryRow(`SELECT count FROM domain_stat_hourly WHERE client_ip IS NULL`).Scan(&unknown)
+	if err != nil {
+		t.Fatalf("Failed to read rollup: %v", err)
+	}
+	if unknown != 2 {
+		t.Errorf("Expected 2 queries of unknown clients, got %d", unknown)
+	}
+
+	// A second run finds nothing new
+	again, rows, err := db.RollUpHourlyStats(time.Now(), 24)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !again.Equal(watermark) || rows != 0 {
+		t.Errorf("Expected unchanged watermark and no rows, got %v and %d", again, rows)
+	}
+}
+
+func TestSQLite_DropOldStatPartitions(t *testing.T) {
+	db := newTestSQLite(t)
+
+	now := time.Now()
+	for _, ts := range []time.Time{now.AddDate(0, 0, -10), now.AddDate(0, 0, -9), now} {
+		_, err := db.exec(
+			`INSERT INTO domain_stat (domain, client_ip, qtype, rtype, timestamp) VALUES ('example.com', NULL, 'A', 'cache', $1)`, ts,
+		)
+		if err != nil {
+			t.Fatalf("Failed to insert stat: %v", err)
+		}
+	}
+
+	days, rows, err := db.DropOldStatPartitions(7)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if days != 2 || rows != 2 {
+		t.Errorf("Expected 2 days and 2 rows deleted, got %d and %d", days, rows)
+	}
+}
+
+func TestSQLite_DeleteOldDomains(t *testing.T) {
+	db := newTestSQLite(t)
+
+	d, _, err := db.InsertOrGetDomain("old.example.com", DomainPolicy{MaxResolv: 3})
+	if err != nil {
+		t.Fatalf("Failed to insert domain: %v", err)
+	}
+	if err := db.InsertOrUpdateIPVantage(d.ID, "192.0.2.1", "ipv4", "default", false); err != nil {
+		t.Fatalf("Failed to insert IP: %v", err)
+	}
+	if _, err := db.exec(`UPDATE domain SET last_seen = $1 WHERE id = $2`, time.Now().AddDate(0, 0, -60), d.ID); err != nil {
+		t.Fatalf("Failed to age domain: %v", err)
+	}
+	if _, _, err := db.InsertOrGetDomain("new.example.com", DomainPolicy{MaxResolv: 3}); err != nil {
+		t.Fatalf("Failed to insert domain: %v", err)
+	}
+
+	domains, ips, err := db.DeleteOldDomains(30, RetentionScope{}, 100)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if domains != 1 || ips != 1 {
+		t.Errorf("Expected 1 domain and 1 IP deleted, got %d and %d", domains, ips)
+	}
+
+	var vantages int
+	if err := db.DB.QueryRow(`SELECT COUNT(*) FROM ip_vantage`).Scan(&vantages); err != nil {
+		t.Fatalf("Failed to count vantages: %v", err)
+	}
+	if vantages != 0 {
+		t.Errorf("Expected vantages deleted with their IP, got %d", vantages)
+	}
+}
+
+func TestSQLite_StorageBudget(t *testing.T) {
+	db := newTestSQLite(t)
+
+	today := startOfDay(time.Now())
+	for days, rows := range map[int]int{3: 30, 2: 10, 0: 20} {
+		for i := 0; i < rows; i++ {
+			if _, err := db.exec(`INSERT INTO domain_stat (domain, client_ip, qtype, rtype, timestamp) VALUES ($1, NULL, 'A', 'cache', $2)`,
+				"www.example.com", today.AddDate(0, 0, -days).Add(time.Hour)); err != nil {
+				t.Fatalf("Failed to insert stat: %v", err)
+			}
+		}
+	}
+
+	sizes, err := db.GetTableSizes()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if sizes["domain_stat"] <= 0 || sizes["domain"] <= 0 {
+		t.Errorf("Expected sizes of domain_stat and domain, got %v", sizes)
+	}
+
+	partitions, err := db.GetStatPartitions()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(partitions) != 3 || partitions[0].Rows != 30 || !partitions[0].To.Equal(today.AddDate(0, 0, -2)) {
+		t.Fatalf("Expected 3 days starting with 30 rows, got %+v", partitions)
+	}
+	if partitions[0].Bytes != sizes["domain_stat"]*30/60 {
+		t.Errorf("Expected half of the table size for half of the rows, got %d of %d", partitions[0].Bytes, sizes["domain_stat"])
+	}
+
+	days, rows, err := db.DropStatPartitionsBefore(partitions[1].To)
+	if err != nil || days != 2 || rows != 40 {
+		t.Errorf("Expected 2 days with 40 rows dropped, got %d and %d (%v)", days, rows, err)
+	}
+}
+
+func TestSQLite_DeleteOldRollups_Batched(t *testing.T) {
+	db := newTestSQLite(t)
+
+	old := time.Now().AddDate(0, 0, -100)
+	for i, domain := range []string{"a.example.com", "b.example.com", "c.example.com"} {
+		if _, err := db.exec(`INSERT INTO domain_stat_hourly (bucket, domain, client_ip, qtype, count) VALUES ($1, $2, '10.0.0.1', 'A', 1)`,
+			old.Add(time.Duration(i)*time.Hour), domain); err != nil {
+			t.Fatalf("Failed to insert rollup: %v", err)
+		}
+	}
+
+	hourly, daily, err := db.DeleteOldRollups(90, 730, 2)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if hourly != 2 || daily != 0 {
+		t.Errorf("Expected a batch of 2 hourly rows, got %d hourly and %d daily", hourly, daily)
+	}
+
+	if hourly, _, err = db.DeleteOldRollups(90, 730, 2); err != nil || hourly != 1 {
+		t.Errorf("Expected the remaining hourly row, got %d (%v)", hourly, err)
+	}
+
+	if err := db.VacuumAnalyze("domain_stat_hourly"); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func TestSQLite_DeleteOldStats_Scoped(t *testing.T) {
+	db := newTestSQLite(t)
+
+	old := time.Now().AddDate(0, 0, -10)
+	for _, row := range [][2]interface{}{
+		{"img.akamaized.net", "192.168.1.10"},
+		{"evil.example.com", "192.168.1.10"},
+		{"www.example.com", "10.1.2.3"},
+		{"www.example.com", nil},
+	} {
+		if _, err := db.exec(`INSERT INTO domain_stat (domain, client_ip, qtype, rtype, timestamp) VALUES ($1, $2, 'A', 'cache', $3)`,
+			row[0], row[1], old); err != nil {
+			t.Fatalf("Failed to insert stat: %v", err)
+		}
+	}
+
+	cdn := RetentionMatch{Suffix: "akamaized.net"}
+	servers := RetentionMatch{Subnet: "10.0.0.0/8"}
+
+	// The CDN rule deletes its own rows only
+	deleted, err := db.DeleteOldStats(3, RetentionScope{Match: &cdn}, 100)
+	if err != nil || deleted != 1 {
+		t.Fatalf("Expected 1 CDN row deleted, got %d (%v)", deleted, err)
+	}
+
+	// The default retention skips the rows of every rule
+	deleted, err = db.DeleteOldStats(7, RetentionScope{Exclude: []RetentionMatch{cdn, servers}}, 100)
+	if err != nil || deleted != 2 {
+		t.Fatalf("Expected 2 default rows deleted, got %d (%v)", deleted, err)
+	}
+
+	var client string
+	if err := db.DB.QueryRow(`SELECT client_ip FROM domain_stat`).Scan(&client); err != nil || client != "10.1.2.3" {
+		t.Errorf("Expected only the server subnet row kept, got %q (%v)", client, err)
+	}
+}
+
+func TestSQLite_DeleteOldDomains_Scoped(t *testing.T) {
+	db := newTestSQLite(t)
+
+	for _, name := range []string{"pinned.example.com", "old.example.org"} {
+		if _, _, err := db.InsertOrGetDomain(name, DomainPolicy{MaxResolv: 3}); err != nil {
+			t.Fatalf("Failed to insert domain: %v", err)
+		}
+	}
+	if _, err := db.exec(`UPDATE domain SET last_seen = $1`, time.Now().AddDate(0, 0, -60)); err != nil {
+		t.Fatalf("Failed to age domains: %v", err)
+	}
+
+	pinned := RetentionScope{Exclude: []RetentionMatch{{Regex: `^pinned\.`}}}
+	domains, _, err := db.DeleteOldDomains(30, pinned, 100)
+	if err != nil || domains != 1 {
+		t.Fatalf("Expected 1 domain deleted, got %d (%v)", domains, err)
+	}
+
+	var name string
+	if err := db.DB.QueryRow(`SELECT domain FROM domain`).Scan(&name); err != nil || name != "pinned.example.com" {
+		t.Errorf("Expected the pinned domain kept, got %q (%v)", name, err)
+	}
+}
+
+func TestSQLite_PreviewCleanup(t *testing.T) {
+	db := newTestSQLite(t)
+
+	old, _, err := db.InsertOrGetDomain("old.example.com", DomainPolicy{MaxResolv: 3})
+	if err != nil {
+		t.Fatalf("Failed to insert domain: %v", err)
+	}
+	active, _, err := db.InsertOrGetDomain("active.example.org", DomainPolicy{MaxResolv: 3})
+	if err != nil {
+		t.Fatalf("Failed to insert domain: %v", err)
+	}
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2"} {
+		if err := db.InsertOrUpdateIPVantage(old.ID, ip, "ipv4", "default", false); err != nil {
+			t.Fatalf("Failed to insert IP: %v", err)
+		}
+	}
+	if err := db.InsertOrUpdateIPVantage(active.ID, "198.51.100.1", "ipv4", "default", false); err != nil {
+		t.Fatalf("Failed to insert IP: %v", err)
+	}
+	aged := time.Now().AddDate(0, 0, -60)
+	if _, err := db.exec(`UPDATE domain SET last_seen = $1 WHERE id = $2`, aged, old.ID); err != nil {
+		t.Fatalf("Failed to age domain: %v", err)
+	}
+	if _, err := db.exec(`UPDATE ip SET time = $1 WHERE domain_id = $2`, aged, active.ID); err != nil {
+		t.Fatalf("Failed to age IP: %v", err)
+	}
+
+	domains, err := db.PreviewOldDomains(30, RetentionScope{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(domains) != 1 || domains[0] != (DomainCount{Domain: "old.example.com", Rows: 2}) {
+		t.Errorf("Expected old.example.com with 2 IPs, got %+v", domains)
+	}
+
+	ips, err := db.PreviewExpiredIPs(30, RetentionScope{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(ips) != 1 || ips[0] != (DomainCount{Domain: "active.example.org", Rows: 1}) {
+		t.Errorf("Expected 1 expired IP of active.example.org, got %+v", ips)
+	}
+
+	excluded := RetentionScope{Exclude: []RetentionMatch{{Suffix: "example.com"}}}
+	if domains, err := db.PreviewOldDomains(30, excluded); err != nil || len(domains) != 0 {
+		t.Errorf("Expected no domains outside the rule, got %+v (%v)", domains, err)
+	}
+
+	// Nothing is deleted
+	var count int
+	if err := db.DB.QueryRow(`SELECT COUNT(*) FROM ip`).Scan(&count); err != nil || count != 3 {
+		t.Errorf("Expected 3 IPs kept, got %d (%v)", count, err)
+	}
+}
+
+func TestSQLite_RequeueDomains(t *testing.T) {
+	db := newTestSQLite(t)
+
+	for _, name := range []string{"a.example.com", "b.example.org"} {
+		d, _, err := db.InsertOrGetDomain(name, DomainPolicy{MaxResolv: 1})
+		if err != nil {
+			t.Fatalf("Failed to insert domain: %v", err)
+		}
+		if err := db.UpdateDomainResolvStats(d.ID, false); err != nil {
+			t.Fatalf("Failed to update domain: %v", err)
+		}
+	}
+
+	requeued, err := db.RequeueDomains(`\.com$`)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if requeued != 1 {
+		t.Errorf("Expected 1 domain requeued, got %d", requeued)
+	}
+
+	if _, err := db.RequeueDomains(`(`); err == nil {
+		t.Error("Expected error for invalid regex")
+	}
+}
+
+func TestRegexpCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	c := newRegexpCache(2)
+
+	first, err := c.get(`^a\.`)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := c.get(`^b\.`); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if again, _ := c.get(`^a\.`); again != first {
+		t.Error("Expected the cached pattern to be reused")
+	}
+	if _, err := c.get(`^c\.`); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(c.entries) != 2 || c.lru.Len() != 2 {
+		t.Fatalf("Expected 2 cached patterns, got %d", len(c.entries))
+	}
+	if _, ok := c.entries[`^b\.`]; ok {
+		t.Error("Expected the least recently used pattern to be evicted")
+	}
+	if _, err := c.get(`(`); err == nil {
+		t.Error("Expected error for invalid pattern")
+	}
+}
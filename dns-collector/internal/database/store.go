@@ -0,0 +1,108 @@
+package database
+
+import (
+	"time"
+
+	"dns-collector/internal/config"
+)
+
+// Storage backends selected by database.driver
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// Store is the storage backend of the collector: everything the UDP server, the
+// resolver, the cleanup, rollup and GeoIP services and the DB metrics collector
+// read and write. Database (PostgreSQL) and SQLiteDatabase (embedded file) implement it.
+type Store interface {
+	RunMigrations() error
+	Close() error
+
+	// Domains and their resolution schedule
+	InsertOrGetDomain(domain string, policy DomainPolicy) (*Domain, bool, error)
+	UpdateDomainLastSeen(domainID int64) error
+	ClaimDomainsToResolve(limit int, cyclicMode bool, cooldownMins int, refreshInterval, leaseDuration time.Duration, weights PriorityWeights, collapseWildcards bool) ([]Domain, error)
+	ClaimDomain(domainID int64, leaseDuration time.Duration) (bool, error)
+	CountDomainsToResolve(cyclicMode bool, cooldownMins int, refreshInterval time.Duration, collapseWildcards bool) (int64, error)
+	RequeueDomains(domainRegex string) (int64, error)
+	GetDomainPolicies(afterID int64, limit int) ([]DomainPolicyRow, error)
+	UpdateDomainPolicy(domainID int64, policy DomainPolicy) error
+	UpdateDomainResolvStats(domainID int64, cyclicMode bool) error
+	UpdateDomainResolvFailure(domainID int64, cyclicMode bool, errClass string, backoffBase, backoffMax time.Duration) error
+	UpdateDomainDNSSECStatus(domainID int64, status string) error
+
+	// Resolved addresses
+	InsertOrUpdateIP(domainID int64, ip, ipType, source string) error
+	InsertOrUpdateIPVantage(domainID int64, ip, ipType, vantage string, counted bool) error
+	RecordIPResolution(domainID int64, ipTypes, seen []string) (*IPChange, error)
+	GetIPsForPTR(refreshInterval time.Duration, limit int) ([]string, error)
+	UpsertIPPTR(ip, ptr string) error
+	GetIPsForGeo(enrichedBefore time.Time, limit int) ([]string, error)
+	UpdateIPGeo(ip string, asn int64, asOrg, country string) error
+
+	// Wildcard zones
+	GetWildcardCandidates(minSiblings int, checkedBefore time.Time, limit int) ([]string, error)
+	RecordWildcardProbe(zone string, wildcard bool) (int64, error)
+	MarkWildcardChildren() (int64, error)
+
+	// Query statistics
+	InsertDomainStat(domain, clientIP, qtype, rtype string) error
+	EnsureStatPartitions(now time.Time) (int, error)
+	RollUpHourlyStats(upTo time.Time, maxHours int) (time.Time, int64, error)
+	RollUpDailyStats(upTo time.Time, maxDays int) (time.Time, int64, error)
+
+	// Metrics
+	GetDomainsCount() (int64, error)
+	GetIPsCount() (int64, error)
+	GetBackoffDomainsCount() (map[string]int64, error)
+	GetDNSSECStatusCounts() (map[string]int64, error)
+	GetTableSizes() (map[string]int64, error)
+
+	// Retention
+	DropOldStatPartitions(retentionDays int) (int, int64, error)
+	DropStatPartitionsBefore(cutoff time.Time) (int, int64, error)
+	GetStatPartitions() ([]StatPartition, error)
+	DeleteOldStats(retentionDays int, scope RetentionScope, limit int) (int64, error)
+	DeleteExpiredIPs(ttlDays int, scope RetentionScope, limit int) (int64, error)
+	DeleteOldDomains(ttlDays int, scope RetentionScope, limit int) (int64, int64, error)
+	DeleteOldIPChangeEvents(days, limit int) (int64, error)
+	DeleteOrphanedPTRs(limit int) (int64, error)
+	DeleteOldRollups(hourlyDays, dailyDays, limit int) (int64, int64, error)
+	VacuumAnalyze(table string) error
+
+	// Retention dry run: what the deletes above would remove
+	PreviewOldStats(from, before time.Time, scope RetentionScope) ([]DomainCount, error)
+	PreviewExpiredIPs(ttlDays int, scope RetentionScope) ([]DomainCount, error)
+	PreviewOldDomains(ttlDays int, scope RetentionScope) ([]DomainCount, error)
+	CountOrphanedPTRs() (int64, error)
+	CountOldIPChangeEvents(days int) (int64, error)
+	CountOldRollups(hourlyDays, dailyDays int) (int64, int64, error)
+
+	// Statistics archives
+	GetStatDaysBefore(cutoff time.Time) ([]time.Time, error)
+	ExportStats(from, to time.Time, fn func(StatRecord) error) (int64, error)
+	ImportStats(table string, records []StatRecord) error
+}
+
+var (
+	_ Store = (*Database)(nil)
+	_ Store = (*SQLiteDatabase)(nil)
+)
+
+// Open connects to the storage backend selected by cfg.Driver.
+func Open(cfg config.DatabaseConfig) (Store, error) {
+	if cfg.Driver == DriverSQLite {
+		db, err := NewSQLite(cfg.Path)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	}
+
+	db, err := New(cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Database, cfg.SSLMode)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
@@ -0,0 +1,151 @@
+package geoip
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Info is the ASN and country of an IP address (zero values mean unknown)
+type Info struct {
+	ASN     int64
+	ASOrg   string
+	Country string
+}
+
+// asnRecord is the record layout of GeoLite2-ASN compatible databases
+type asnRecord struct {
+	Number       uint32 `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// countryRecord is the record layout of GeoLite2-Country and GeoLite2-City compatible databases
+type countryRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+}
+
+// mmdbFile is an MMDB database reopened whenever the file's modification time changes.
+// An empty path disables the database.
+type mmdbFile struct {
+	path    string
+	modTime time.Time
+	reader  *maxminddb.Reader
+}
+
+// reload opens the file if it changed since the last load. The previous reader is kept
+// when the new file can't be opened, so a half-written update doesn't drop enrichment.
+func (f *mmdbFile) reload() (bool, error) {
+	if f.path == "" {
+		return false, nil
+	}
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat %s: %w", f.path, err)
+	}
+	if f.reader != nil && info.ModTime().Equal(f.modTime) {
+		return false, nil
+	}
+
+	// Read into memory rather than mmap: an update written in place must not
+	// change the database under a loaded reader
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", f.path, err)
+	}
+	reader, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return false, fmt.Errorf("failed to open %s: %w", f.path, err)
+	}
+
+	if f.reader != nil {
+		_ = f.reader.Close()
+	}
+	f.reader = reader
+	f.modTime = info.ModTime()
+	return true, nil
+}
+
+func (f *mmdbFile) close() {
+	if f.reader != nil {
+		_ = f.reader.Close()
+		f.reader = nil
+	}
+}
+
+// Databases holds the ASN and country databases. It is not safe for concurrent use.
+type Databases struct {
+	asn     mmdbFile
+	country mmdbFile
+}
+
+// Open loads the ASN and country databases; either path may be empty.
+func Open(asnPath, countryPath string) (*Databases, error) {
+	d := &Databases{
+		asn:     mmdbFile{path: asnPath},
+		country: mmdbFile{path: countryPath},
+	}
+	if _, err := d.Reload(); err != nil {
+		d.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// Reload reopens the databases whose files changed. Returns true if any was reloaded.
+func (d *Databases) Reload() (bool, error) {
+	asnReloaded, err := d.asn.reload()
+	if err != nil {
+		return false, err
+	}
+	countryReloaded, err := d.country.reload()
+	if err != nil {
+		return asnReloaded, err
+	}
+	return asnReloaded || countryReloaded, nil
+}
+
+// UpdatedAt returns the modification time of the newest loaded database file.
+// Annotations made before this time are stale.
+func (d *Databases) UpdatedAt() time.Time {
+	if d.country.modTime.After(d.asn.modTime) {
+		return d.country.modTime
+	}
+	return d.asn.modTime
+}
+
+// Lookup returns the ASN and country of ip. Addresses missing from a database
+// leave the corresponding fields empty.
+func (d *Databases) Lookup(ip net.IP) (Info, error) {
+	var info Info
+
+	if d.asn.reader != nil {
+		var rec asnRecord
+		if err := d.asn.reader.Lookup(ip, &rec); err != nil {
+			return info, fmt.Errorf("ASN lookup of %s: %w", ip, err)
+		}
+		info.ASN = int64(rec.Number)
+		info.ASOrg = rec.Organization
+	}
+
+	if d.country.reader != nil {
+		var rec countryRecord
+		if err := d.country.reader.Lookup(ip, &rec); err != nil {
+			return info, fmt.Errorf("country lookup of %s: %w", ip, err)
+		}
+		info.Country = rec.Country.ISOCode
+	}
+
+	return info, nil
+}
+
+// Close releases the database files.
+func (d *Databases) Close() {
+	d.asn.close()
+	d.country.close()
+}
@@ -0,0 +1,228 @@
+package geoip
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// encodeMMDB encodes a value in the MaxMind DB data section format
+// (only the types needed by the tests, sizes below 285).
+func encodeMMDB(v interface{}) []byte {
+	control := func(typ, size int) []byte {
+		var out []byte
+		sizeBits, extra := size, []byte(nil)
+		if size >= 29 {
+			sizeBits, extra = 29, []byte{byte(size - 29)}
+		}
+		if typ <= 7 {
+			out = []byte{byte(typ<<5 | sizeBits)}
+		} else {
+			out = []byte{byte(sizeBits), byte(typ - 7)} // extended type
+		}
+		return append(out, extra...)
+	}
+	uintBytes := func(n uint64) []byte {
+		var b []byte
+		for ; n > 0; n >>= 8 {
+			b = append([]byte{byte(n)}, b...)
+		}
+		return b
+	}
+
+	switch x := v.(type) {
+	case string:
+		return append(control(2, len(x)), x...)
+	case uint16:
+		b := uintBytes(uint64(x))
+		return append(control(5, len(b)), b...)
+	case uint32:
+		b := uintBytes(uint64(x))
+		return append(control(6, len(b)), b...)
+	case uint64:
+		b := uintBytes(x)
+		return append(control(9, len(b)), b...)
+	case []string:
+		out := control(11, len(x))
+		for _, s := range x {
+			out = append(out, encodeMMDB(s)...)
+		}
+		return out
+	case map[string]interface{}:
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := control(7, len(x))
+		for _, k := range keys {
+			out = append(out, encodeMMDB(k)...)
+			out = append(out, encodeMMDB(x[k])...)
+		}
+		return out
+	}
+	panic("unsupported type")
+}
+
+// writeTestMMDB writes an IPv4 database with a single search tree node:
+// 0.0.0.0/1 maps to low and 128.0.0.0/1 maps to high.
+func writeTestMMDB(t *testing.T, path string, low, high map[string]interface{}) {
+	t.Helper()
+
+	const nodeCount = 1
+	lowData := encodeMMDB(low)
+	highData := encodeMMDB(high)
+
+	// 24-bit records point past the node count and the 16-byte data section separator
+	record := func(offset int) []byte {
+		v := nodeCount + 16 + offset
+		return []byte{byte(v >> 16), byte(v >> 8), byte(v)}
+	}
+
+	var buf []byte
+	buf = append(buf, record(0)...)
+	buf = append(buf, record(len(lowData))...)
+	buf = append(buf, make([]byte, 16)...)
+	buf = append(buf, lowData...)
+	buf = append(buf, highData...)
+	buf = append(buf, "\xAB\xCD\xEFMaxMind.com"...)
+	buf = append(buf, encodeMMDB(map[string]interface{}{
+		"node_count":                  uint32(nodeCount),
+		"record_size":                 uint16(24),
+		"ip_version":                  uint16(4),
+		"database_type":               "Test",
+		"languages":                   []string{"en"},
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(time.Now().Unix()),
+		"description":                 map[string]interface{}{"en": "test database"},
+	})...)
+
+	if err := os.WriteFile(path, buf, 0644); err != nil {
+		t.Fatalf("Failed to write test database: %v", err)
+	}
+}
+
+func asnData(asn uint32, org string) map[string]interface{} {
+	return map[string]interface{}{
+		"autonomous_system_number":       asn,
+		"autonomous_system_organization": org,
+	}
+}
+
+func countryData(code string) map[string]interface{} {
+	return map[string]interface{}{
+		"country": map[string]interface{}{"iso_code": code},
+	}
+}
+
+func TestDatabasesLookup(t *testing.T) {
+	dir := t.TempDir()
+	asnPath := filepath.Join(dir, "asn.mmdb")
+	countryPath := filepath.Join(dir, "country.mmdb")
+	writeTestMMDB(t, asnPath, asnData(64500, "EXAMPLE-NET"), asnData(13335, "CLOUDFLARENET"))
+	writeTestMMDB(t, countryPath, countryData("DE"), countryData("US"))
+
+	databases, err := Open(asnPath, countryPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer databases.Close()
+
+	tests := []struct {
+		ip       string
+		expected Info
+	}{
+		{"10.0.0.1", Info{ASN: 64500, ASOrg: "EXAMPLE-NET", Country: "DE"}},
+		{"200.0.0.1", Info{ASN: 13335, ASOrg: "CLOUDFLARENET", Country: "US"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			info, err := databases.Lookup(net.ParseIP(tt.ip))
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if info != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, info)
+			}
+		})
+	}
+}
+
+func TestDatabasesOptionalFiles(t *testing.T) {
+	dir := t.TempDir()
+	countryPath := filepath.Join(dir, "country.mmdb")
+	writeTestMMDB(t, countryPath, countryData("DE"), countryData("US"))
+
+	databases, err := Open("", countryPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer databases.Close()
+
+	info, err := databases.Lookup(net.ParseIP("200.0.0.1"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if info.ASN != 0 || info.Country != "US" {
+		t.Errorf("Expected only country data, got %+v", info)
+	}
+
+	if _, err := Open(filepath.Join(dir, "missing.mmdb"), ""); err == nil {
+		t.Error("Expected error for a missing database file")
+	}
+}
+
+func TestDatabasesReload(t *testing.T) {
+	dir := t.TempDir()
+	asnPath := filepath.Join(dir, "asn.mmdb")
+	writeTestMMDB(t, asnPath, asnData(64500, "OLD"), asnData(64501, "OLD"))
+
+	databases, err := Open(asnPath, "")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer databases.Close()
+
+	if reloaded, err := databases.Reload(); err != nil || reloaded {
+		t.Errorf("Expected no reload for an unchanged file, got reloaded=%v err=%v", reloaded, err)
+	}
+
+	// Replace the file with a newer version
+	writeTestMMDB(t, asnPath, asnData(64510, "NEW"), asnData(64511, "NEW"))
+	updated := time.Now().Add(time.Minute).Truncate(time.Second)
+	if err := os.Chtimes(asnPath, updated, updated); err != nil {
+		t.Fatalf("Failed to update mtime: %v", err)
+	}
+
+	reloaded, err := databases.Reload()
+	if err != nil || !reloaded {
+		t.Fatalf("Expected reload, got reloaded=%v err=%v", reloaded, err)
+	}
+	if !databases.UpdatedAt().Equal(updated) {
+		t.Errorf("Expected UpdatedAt=%v, got %v", updated, databases.UpdatedAt())
+	}
+	if info, _ := databases.Lookup(net.ParseIP("10.0.0.1")); info.ASN != 64510 {
+		t.Errorf("Expected ASN 64510 after reload, got %d", info.ASN)
+	}
+
+	// A broken update keeps the loaded database
+	if err := os.WriteFile(asnPath, []byte("not a database"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	broken := updated.Add(time.Minute)
+	if err := os.Chtimes(asnPath, broken, broken); err != nil {
+		t.Fatalf("Failed to update mtime: %v", err)
+	}
+
+	if _, err := databases.Reload(); err == nil {
+		t.Error("Expected error for a broken database file")
+	}
+	if info, _ := databases.Lookup(net.ParseIP("10.0.0.1")); info.ASN != 64510 {
+		t.Errorf("Expected previous database to stay loaded, got ASN %d", info.ASN)
+	}
+}
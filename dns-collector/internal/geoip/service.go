@@ -0,0 +1,158 @@
+package geoip
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"dns-collector/internal/config"
+	"dns-collector/internal/database"
+	"dns-collector/internal/metrics"
+)
+
+// Service annotates ip rows with ASN and country data from local MMDB files.
+// New addresses are annotated every poll interval; when a database file changes it is
+// reloaded and all addresses are annotated again.
+type Service struct {
+	db        database.Store
+	metrics   *metrics.Registry
+	databases *Databases
+	interval  time.Duration
+	batchSize int
+	stopChan  chan struct{}
+	doneChan  chan struct{}
+}
+
+func NewService(cfg *config.Config, db database.Store, m *metrics.Registry) (*Service, error) {
+	databases, err := Open(cfg.GeoIP.ASNDB, cfg.GeoIP.CountryDB)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load GeoIP databases: %w", err)
+	}
+
+	return &Service{
+		db:        db,
+		metrics:   m,
+		databases: databases,
+		interval:  time.Duration(cfg.GeoIP.PollSeconds) * time.Second,
+		batchSize: cfg.GeoIP.BatchSize,
+		stopChan:  make(chan struct{}),
+		doneChan:  make(chan struct{}),
+	}, nil
+}
+
+func (s *Service) Start() {
+	log.Printf("Starting GeoIP enrichment (databases updated: %s)", s.databases.UpdatedAt().Format(time.RFC3339))
+	go s.run()
+}
+
+func (s *Service) Stop() {
+	log.Println("Stopping GeoIP enrichment...")
+	close(s.stopChan)
+	<-s.doneChan
+	s.databases.Close()
+	log.Println("GeoIP enrichment stopped")
+}
+
+func (s *Service) run() {
+	defer close(s.doneChan)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.enrich()
+
+		select {
+		case <-ticker.C:
+			s.reload()
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+// reload picks up updated database files
+func (s *Service) reload() {
+	reloaded, err := s.databases.Reload()
+	if err != nil {
+		log.Printf("Error reloading GeoIP databases (keeping the loaded ones): %v", err)
+		s.recordMetric(func(m *metrics.Registry) {
+			m.GeoIPReloads.WithLabelValues("error").Inc()
+		})
+		return
+	}
+	if reloaded {
+		log.Printf("GeoIP databases reloaded (updated: %s), re-annotating IPs", s.databases.UpdatedAt().Format(time.RFC3339))
+		s.recordMetric(func(m *metrics.Registry) {
+			m.GeoIPReloads.WithLabelValues("success").Inc()
+		})
+	}
+}
+
+// enrich annotates all addresses that are new or were annotated before the last
+// database update, one batch at a time.
+func (s *Service) enrich() {
+	updatedAt := s.databases.UpdatedAt()
+	total := 0
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		default:
+		}
+
+		ips, err := s.db.GetIPsForGeo(updatedAt, s.batchSize)
+		if err != nil {
+			log.Printf("Error getting IPs for GeoIP enrichment: %v", err)
+			return
+		}
+
+		annotated := 0
+		for _, ip := range ips {
+			if s.annotate(ip) {
+				annotated++
+			}
+		}
+		total += annotated
+
+		// Stop on a partial batch, or when nothing could be stored to avoid spinning
+		if len(ips) < s.batchSize || annotated == 0 {
+			break
+		}
+	}
+
+	if total > 0 {
+		log.Printf("GeoIP enrichment: annotated %d addresses", total)
+	}
+}
+
+// annotate looks up and stores the ASN and country of one address
+func (s *Service) annotate(ip string) bool {
+	var info Info
+	if parsed := net.ParseIP(ip); parsed != nil {
+		var err error
+		if info, err = s.databases.Lookup(parsed); err != nil {
+			log.Printf("Error looking up GeoIP data: %v", err)
+		}
+	}
+
+	// Unparseable and unknown addresses are stored as NULLs so they aren't picked up again
+	if err := s.db.UpdateIPGeo(ip, info.ASN, info.ASOrg, info.Country); err != nil {
+		log.Printf("Error storing GeoIP data for %s: %v", ip, err)
+		return false
+	}
+
+	s.recordMetric(func(m *metrics.Registry) {
+		m.GeoIPAnnotated.Inc()
+	})
+	return true
+}
+
+// recordMetric safely records a metric if metrics are enabled.
+func (s *Service) recordMetric(f func(m *metrics.Registry)) {
+	if s.metrics != nil {
+		f(s.metrics)
+	}
+}
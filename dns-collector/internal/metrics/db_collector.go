@@ -9,6 +9,9 @@ import (
 type DBStatsProvider interface {
 	GetDomainsCount() (int64, error)
 	GetIPsCount() (int64, error)
+	GetBackoffDomainsCount() (map[string]int64, error)
+	GetDNSSECStatusCounts() (map[string]int64, error)
+	GetTableSizes() (map[string]int64, error)
 }
 
 // DBCollector periodically collects database statistics and updates metrics.
@@ -84,4 +87,37 @@ func (c *DBCollector) collect() {
 	} else {
 		c.registry.DBIPsTotal.Set(float64(ipCount))
 	}
+
+	// Collect backoff population (reset first so recovered error classes drop to zero)
+	backoffCounts, err := c.db.GetBackoffDomainsCount()
+	if err != nil {
+		log.Printf("Error getting backoff domains count: %v", err)
+	} else {
+		c.registry.DBDomainsInBackoff.Reset()
+		for errClass, count := range backoffCounts {
+			c.registry.DBDomainsInBackoff.WithLabelValues(errClass).Set(float64(count))
+		}
+	}
+
+	// Collect DNSSEC status breakdown
+	dnssecCounts, err := c.db.GetDNSSECStatusCounts()
+	if err != nil {
+		log.Printf("Error getting DNSSEC status counts: %v", err)
+	} else {
+		c.registry.DBDomainsByDNSSEC.Reset()
+		for status, count := range dnssecCounts {
+			c.registry.DBDomainsByDNSSEC.WithLabelValues(status).Set(float64(count))
+		}
+	}
+
+	// Collect table sizes (reset first so dropped tables disappear)
+	tableSizes, err := c.db.GetTableSizes()
+	if err != nil {
+		log.Printf("Error getting table sizes: %v", err)
+	} else {
+		c.registry.DBTableSizeBytes.Reset()
+		for table, bytes := range tableSizes {
+			c.registry.DBTableSizeBytes.WithLabelValues(table).Set(float64(bytes))
+		}
+	}
 }
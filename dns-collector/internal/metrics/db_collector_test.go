@@ -12,6 +12,12 @@ type MockDBStatsProvider struct {
 	ipsCount     int64
 	domainsErr   error
 	ipsErr       error
+	backoff      map[string]int64
+	backoffErr   error
+	dnssec       map[string]int64
+	dnssecErr    error
+	tableSizes   map[string]int64
+	tableErr     error
 }
 
 func (m *MockDBStatsProvider) GetDomainsCount() (int64, error) {
@@ -22,6 +28,18 @@ func (m *MockDBStatsProvider) GetIPsCount() (int64, error) {
 	return m.ipsCount, m.ipsErr
 }
 
+func (m *MockDBStatsProvider) GetBackoffDomainsCount() (map[string]int64, error) {
+	return m.backoff, m.backoffErr
+}
+
+func (m *MockDBStatsProvider) GetDNSSECStatusCounts() (map[string]int64, error) {
+	return m.dnssec, m.dnssecErr
+}
+
+func (m *MockDBStatsProvider) GetTableSizes() (map[string]int64, error) {
+	return m.tableSizes, m.tableErr
+}
+
 func TestNewDBCollector(t *testing.T) {
 	db := &MockDBStatsProvider{
 		domainsCount: 100,
@@ -118,6 +136,109 @@ func TestDBCollectorCollect(t *testing.T) {
 	}
 }
 
+func TestDBCollectorCollectBackoffDomains(t *testing.T) {
+	db := &MockDBStatsProvider{
+		backoff: map[string]int64{"nxdomain": 12, "servfail": 2},
+	}
+	registry := NewRegistry()
+
+	collector := NewDBCollector(db, registry, 30)
+	collector.collect()
+
+	// A recovered error class must disappear on the next collection
+	db.backoff = map[string]int64{"nxdomain": 10}
+	collector.collect()
+
+	mfs, err := registry.GetRegistry().Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+
+	var found bool
+	for _, mf := range mfs {
+		if mf.GetName() != "dns_db_domains_in_backoff" {
+			continue
+		}
+		found = true
+		if len(mf.GetMetric()) != 1 {
+			t.Fatalf("Expected 1 error class, got %d", len(mf.GetMetric()))
+		}
+		m := mf.GetMetric()[0]
+		if m.GetLabel()[0].GetValue() != "nxdomain" {
+			t.Errorf("Expected error_class=nxdomain, got %s", m.GetLabel()[0].GetValue())
+		}
+		if m.GetGauge().GetValue() != 10 {
+			t.Errorf("Expected 10 domains in backoff, got %f", m.GetGauge().GetValue())
+		}
+	}
+
+	if !found {
+		t.Error("dns_db_domains_in_backoff metric not found")
+	}
+}
+
+func TestDBCollectorCollectDNSSECStatus(t *testing.T) {
+	db := &MockDBStatsProvider{
+		dnssec: map[string]int64{"secure": 7, "insecure": 40},
+	}
+	registry := NewRegistry()
+
+	collector := NewDBCollector(db, registry, 30)
+	collector.collect()
+
+	mfs, err := registry.GetRegistry().Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+
+	values := make(map[string]float64)
+	for _, mf := range mfs {
+		if mf.GetName() != "dns_db_domains_by_dnssec_status" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			values[m.GetLabel()[0].GetValue()] = m.GetGauge().GetValue()
+		}
+	}
+
+	if values["secure"] != 7 || values["insecure"] != 40 {
+		t.Errorf("Expected secure=7 insecure=40, got %v", values)
+	}
+}
+
+func TestDBCollectorCollectTableSizes(t *testing.T) {
+	db := &MockDBStatsProvider{
+		tableSizes: map[string]int64{"domain_stat": 40 << 30, "ip": 512 << 20},
+	}
+	registry := NewRegistry()
+
+	collector := NewDBCollector(db, registry, 30)
+	collector.collect()
+
+	// A dropped table disappears from the gauge
+	db.tableSizes = map[string]int64{"domain_stat": 30 << 30}
+	collector.collect()
+
+	mfs, err := registry.GetRegistry().Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+
+	values := make(map[string]float64)
+	for _, mf := range mfs {
+		if mf.GetName() != "dns_db_table_size_bytes" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			values[m.GetLabel()[0].GetValue()] = m.GetGauge().GetValue()
+		}
+	}
+
+	if len(values) != 1 || values["domain_stat"] != 30<<30 {
+		t.Errorf("Expected only domain_stat=30GiB, got %v", values)
+	}
+}
+
 func TestDBCollectorCollectWithErrors(t *testing.T) {
 	db := &MockDBStatsProvider{
 		domainsCount: 100,
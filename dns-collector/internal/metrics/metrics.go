@@ -15,12 +15,24 @@ type Registry struct {
 	ResolverLookupDuration   *prometheus.HistogramVec
 	ResolverBatchSize        prometheus.Gauge
 	ResolverActiveWorkers    prometheus.Gauge
+	ResolverFailures         *prometheus.CounterVec
+	ResolverBacklog          prometheus.Gauge
+	ResolverFirstResolution  prometheus.Histogram
+	ResolverPriorityQueued   *prometheus.CounterVec
+	ResolverECSLookups       *prometheus.CounterVec
+	ResolverDNSSECChecks     *prometheus.CounterVec
+	ResolverPTRLookups       *prometheus.CounterVec
+	ResolverWildcardProbes   *prometheus.CounterVec
+	ResolverIPChanges        prometheus.Counter
+	ResolverCacheRequests    *prometheus.CounterVec
+	ResolverCacheEntries     prometheus.Gauge
 
 	// UDP Server metrics
 	ServerMessagesReceived *prometheus.CounterVec
 	ServerDomainsReceived  *prometheus.CounterVec
 	ServerNewDomains       prometheus.Counter
 	ServerProcessingTime   prometheus.Histogram
+	ServerPassiveIPs       *prometheus.CounterVec
 
 	// Cleanup metrics
 	CleanupStatsDeleted     prometheus.Counter
@@ -29,10 +41,33 @@ type Registry struct {
 	CleanupDomainIPsDeleted prometheus.Counter
 	CleanupDuration         prometheus.Histogram
 	CleanupRuns             prometheus.Counter
+	CleanupBatches          *prometheus.CounterVec
+	CleanupBatchRows        *prometheus.CounterVec
+	CleanupBatchDuration    *prometheus.HistogramVec
+	CleanupVacuums          *prometheus.CounterVec
+	CleanupRuleDeleted      *prometheus.CounterVec
+	CleanupBudgetDropped    prometheus.Counter
+
+	// GeoIP enrichment metrics
+	GeoIPAnnotated prometheus.Counter
+	GeoIPReloads   *prometheus.CounterVec
+
+	// Statistics rollup metrics
+	RollupRows *prometheus.CounterVec
+	RollupLag  *prometheus.GaugeVec
+
+	// ClickHouse sink metrics
+	ClickHouseEvents        *prometheus.CounterVec
+	ClickHouseFlushes       *prometheus.CounterVec
+	ClickHouseFlushDuration prometheus.Histogram
+	ClickHousePendingEvents prometheus.Gauge
 
 	// Database metrics
-	DBDomainsTotal prometheus.Gauge
-	DBIPsTotal     prometheus.Gauge
+	DBDomainsTotal     prometheus.Gauge
+	DBIPsTotal         prometheus.Gauge
+	DBDomainsInBackoff *prometheus.GaugeVec
+	DBDomainsByDNSSEC  *prometheus.GaugeVec
+	DBTableSizeBytes   *prometheus.GaugeVec
 }
 
 // NewRegistry creates a new metrics registry with all collectors registered.
@@ -81,6 +116,80 @@ func NewRegistry() *Registry {
 				Help: "Number of currently active resolver workers",
 			},
 		),
+		ResolverFailures: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "dns_resolver_failures_total",
+				Help: "Total number of failed domain resolutions by error class",
+			},
+			[]string{"error_class"},
+		),
+		ResolverBacklog: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "dns_resolver_backlog_domains",
+				Help: "Number of domains currently due for resolution",
+			},
+		),
+		ResolverFirstResolution: prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "dns_resolver_time_to_first_resolution_seconds",
+				Help:    "Time from first sighting of a domain to its first resolution",
+				Buckets: []float64{1, 5, 10, 30, 60, 120, 300, 600, 1800, 3600, 7200, 21600, 86400},
+			},
+		),
+		ResolverPriorityQueued: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "dns_resolver_priority_queued_total",
+				Help: "Total number of new domains offered to the priority lane",
+			},
+			[]string{"status"},
+		),
+		ResolverECSLookups: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "dns_resolver_ecs_lookups_total",
+				Help: "Total number of EDNS Client Subnet lookups by vantage point",
+			},
+			[]string{"vantage", "ip_version", "status"},
+		),
+		ResolverDNSSECChecks: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "dns_resolver_dnssec_checks_total",
+				Help: "Total number of DNSSEC status checks by resulting status",
+			},
+			[]string{"status"},
+		),
+		ResolverPTRLookups: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "dns_resolver_ptr_lookups_total",
+				Help: "Total number of background reverse DNS lookups of resolved IPs",
+			},
+			[]string{"status"},
+		),
+		ResolverWildcardProbes: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "dns_resolver_wildcard_probes_total",
+				Help: "Total number of wildcard probes of parent zones by result",
+			},
+			[]string{"result"},
+		),
+		ResolverIPChanges: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "dns_resolver_ip_changes_total",
+				Help: "Total number of resolutions whose IP set differed from the previous one",
+			},
+		),
+		ResolverCacheRequests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "dns_resolver_cache_requests_total",
+				Help: "Total number of resolver queries answered by the DNS cache by result",
+			},
+			[]string{"result"},
+		),
+		ResolverCacheEntries: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "dns_resolver_cache_entries",
+				Help: "Current number of RRsets and negative answers in the DNS cache",
+			},
+		),
 
 		// UDP Server metrics
 		ServerMessagesReceived: prometheus.NewCounterVec(
@@ -110,6 +219,13 @@ func NewRegistry() *Registry {
 				Buckets: []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.025, 0.05, 0.1},
 			},
 		),
+		ServerPassiveIPs: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "dns_server_passive_ips_total",
+				Help: "Total number of answer IPs recorded from DNS server messages",
+			},
+			[]string{"type"},
+		),
 
 		// Cleanup metrics
 		CleanupStatsDeleted: prometheus.NewCounter(
@@ -149,6 +265,108 @@ func NewRegistry() *Registry {
 				Help: "Total number of cleanup runs",
 			},
 		),
+		CleanupBatches: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "dns_cleanup_batches_total",
+				Help: "Total number of cleanup delete batches by step and status",
+			},
+			[]string{"step", "status"},
+		),
+		CleanupBatchRows: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "dns_cleanup_batch_rows_total",
+				Help: "Total number of rows deleted by cleanup batches by step",
+			},
+			[]string{"step"},
+		),
+		CleanupBatchDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "dns_cleanup_batch_duration_seconds",
+				Help:    "Duration of cleanup delete batches by step",
+				Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+			},
+			[]string{"step"},
+		),
+		CleanupVacuums: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "dns_cleanup_vacuums_total",
+				Help: "Total number of VACUUM (ANALYZE) runs after cleanup by table and status",
+			},
+			[]string{"table", "status"},
+		),
+		CleanupRuleDeleted: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "dns_cleanup_rule_deleted_total",
+				Help: "Total number of rows deleted by the retention of each rule (default = no rule matched) by kind (stats, ips, domains, domain_ips)",
+			},
+			[]string{"rule", "kind"},
+		),
+		CleanupBudgetDropped: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "dns_cleanup_budget_partitions_dropped_total",
+				Help: "Total number of statistics partitions (days in SQLite) dropped to stay within retention.max_db_size",
+			},
+		),
+
+		// GeoIP enrichment metrics
+		GeoIPAnnotated: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "dns_geoip_annotated_total",
+				Help: "Total number of IP addresses annotated with ASN and country data",
+			},
+		),
+		GeoIPReloads: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "dns_geoip_reloads_total",
+				Help: "Total number of GeoIP database reloads after a file change",
+			},
+			[]string{"status"},
+		),
+
+		// Statistics rollup metrics
+		RollupRows: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "dns_stats_rollup_rows_total",
+				Help: "Total number of rollup rows written by statistics rollups",
+			},
+			[]string{"rollup"},
+		),
+		RollupLag: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "dns_stats_rollup_lag_seconds",
+				Help: "Age of the newest statistics included in each rollup",
+			},
+			[]string{"rollup"},
+		),
+
+		// ClickHouse sink metrics
+		ClickHouseEvents: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "dns_clickhouse_events_total",
+				Help: "Total number of query events handled by the ClickHouse sink by outcome (written, dropped)",
+			},
+			[]string{"status"},
+		),
+		ClickHouseFlushes: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "dns_clickhouse_flushes_total",
+				Help: "Total number of batch inserts into ClickHouse by status",
+			},
+			[]string{"status"},
+		),
+		ClickHouseFlushDuration: prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "dns_clickhouse_flush_duration_seconds",
+				Help:    "Duration of batch inserts into ClickHouse",
+				Buckets: prometheus.DefBuckets,
+			},
+		),
+		ClickHousePendingEvents: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "dns_clickhouse_pending_events",
+				Help: "Number of query events waiting to be written to ClickHouse",
+			},
+		),
 
 		// Database metrics
 		DBDomainsTotal: prometheus.NewGauge(
@@ -163,6 +381,27 @@ func NewRegistry() *Registry {
 				Help: "Total number of IP addresses in the database",
 			},
 		),
+		DBDomainsInBackoff: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "dns_db_domains_in_backoff",
+				Help: "Number of domains currently in failure backoff by last error class",
+			},
+			[]string{"error_class"},
+		),
+		DBDomainsByDNSSEC: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "dns_db_domains_by_dnssec_status",
+				Help: "Number of domains by recorded DNSSEC status",
+			},
+			[]string{"status"},
+		),
+		DBTableSizeBytes: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "dns_db_table_size_bytes",
+				Help: "On-disk size of each database table including its indexes in bytes",
+			},
+			[]string{"table"},
+		),
 	}
 
 	// Register all metrics
@@ -172,18 +411,47 @@ func NewRegistry() *Registry {
 		r.ResolverLookupDuration,
 		r.ResolverBatchSize,
 		r.ResolverActiveWorkers,
+		r.ResolverFailures,
+		r.ResolverBacklog,
+		r.ResolverFirstResolution,
+		r.ResolverPriorityQueued,
+		r.ResolverECSLookups,
+		r.ResolverDNSSECChecks,
+		r.ResolverPTRLookups,
+		r.ResolverWildcardProbes,
+		r.ResolverIPChanges,
+		r.ResolverCacheRequests,
+		r.ResolverCacheEntries,
 		r.ServerMessagesReceived,
 		r.ServerDomainsReceived,
 		r.ServerNewDomains,
 		r.ServerProcessingTime,
+		r.ServerPassiveIPs,
 		r.CleanupStatsDeleted,
 		r.CleanupIPsDeleted,
 		r.CleanupDomainsDeleted,
 		r.CleanupDomainIPsDeleted,
 		r.CleanupDuration,
 		r.CleanupRuns,
+		r.CleanupBatches,
+		r.CleanupBatchRows,
+		r.CleanupBatchDuration,
+		r.CleanupVacuums,
+		r.CleanupRuleDeleted,
+		r.CleanupBudgetDropped,
+		r.GeoIPAnnotated,
+		r.GeoIPReloads,
+		r.RollupRows,
+		r.RollupLag,
+		r.ClickHouseEvents,
+		r.ClickHouseFlushes,
+		r.ClickHouseFlushDuration,
+		r.ClickHousePendingEvents,
 		r.DBDomainsTotal,
 		r.DBIPsTotal,
+		r.DBDomainsInBackoff,
+		r.DBDomainsByDNSSEC,
+		r.DBTableSizeBytes,
 	)
 
 	return r
@@ -33,6 +33,39 @@ func TestNewRegistry(t *testing.T) {
 	if r.ResolverActiveWorkers == nil {
 		t.Error("ResolverActiveWorkers is nil")
 	}
+	if r.ResolverFailures == nil {
+		t.Error("ResolverFailures is nil")
+	}
+	if r.ResolverBacklog == nil {
+		t.Error("ResolverBacklog is nil")
+	}
+	if r.ResolverFirstResolution == nil {
+		t.Error("ResolverFirstResolution is nil")
+	}
+	if r.ResolverPriorityQueued == nil {
+		t.Error("ResolverPriorityQueued is nil")
+	}
+	if r.ResolverECSLookups == nil {
+		t.Error("ResolverECSLookups is nil")
+	}
+	if r.ResolverDNSSECChecks == nil {
+		t.Error("ResolverDNSSECChecks is nil")
+	}
+	if r.ResolverPTRLookups == nil {
+		t.Error("ResolverPTRLookups is nil")
+	}
+	if r.ResolverWildcardProbes == nil {
+		t.Error("ResolverWildcardProbes is nil")
+	}
+	if r.ResolverIPChanges == nil {
+		t.Error("ResolverIPChanges is nil")
+	}
+	if r.ResolverCacheRequests == nil {
+		t.Error("ResolverCacheRequests is nil")
+	}
+	if r.ResolverCacheEntries == nil {
+		t.Error("ResolverCacheEntries is nil")
+	}
 	if r.ServerMessagesReceived == nil {
 		t.Error("ServerMessagesReceived is nil")
 	}
@@ -45,6 +78,9 @@ func TestNewRegistry(t *testing.T) {
 	if r.ServerProcessingTime == nil {
 		t.Error("ServerProcessingTime is nil")
 	}
+	if r.ServerPassiveIPs == nil {
+		t.Error("ServerPassiveIPs is nil")
+	}
 	if r.CleanupStatsDeleted == nil {
 		t.Error("CleanupStatsDeleted is nil")
 	}
@@ -57,12 +93,36 @@ func TestNewRegistry(t *testing.T) {
 	if r.CleanupRuns == nil {
 		t.Error("CleanupRuns is nil")
 	}
+	if r.GeoIPAnnotated == nil {
+		t.Error("GeoIPAnnotated is nil")
+	}
+	if r.GeoIPReloads == nil {
+		t.Error("GeoIPReloads is nil")
+	}
+	if r.RollupRows == nil {
+		t.Error("RollupRows is nil")
+	}
+	if r.RollupLag == nil {
+		t.Error("RollupLag is nil")
+	}
+	if r.ClickHouseEvents == nil {
+		t.Error("ClickHouseEvents is nil")
+	}
+	if r.ClickHouseFlushes == nil {
+		t.Error("ClickHouseFlushes is nil")
+	}
 	if r.DBDomainsTotal == nil {
 		t.Error("DBDomainsTotal is nil")
 	}
 	if r.DBIPsTotal == nil {
 		t.Error("DBIPsTotal is nil")
 	}
+	if r.DBDomainsInBackoff == nil {
+		t.Error("DBDomainsInBackoff is nil")
+	}
+	if r.DBDomainsByDNSSEC == nil {
+		t.Error("DBDomainsByDNSSEC is nil")
+	}
 }
 
 func TestRegistryMetricsCanBeUsed(t *testing.T) {
@@ -0,0 +1,170 @@
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"dns-collector/internal/config"
+	"dns-collector/internal/database"
+)
+
+// Policy is the resolution policy of domains matching a rule.
+type Policy struct {
+	Name      string
+	Never     bool          // never resolve
+	Interval  time.Duration // pinned refresh interval (0 = resolver.interval_seconds)
+	MaxResolv int           // resolution budget (0 = resolver.max_resolv)
+	Upstream  string        // DNS server for A/AAAA lookups (empty = system resolver)
+	IPv4Only  bool          // skip AAAA lookups
+}
+
+type rule struct {
+	policy Policy
+	suffix string
+	regex  *regexp.Regexp
+}
+
+func (r *rule) matches(domain string) bool {
+	if r.regex != nil {
+		return r.regex.MatchString(domain)
+	}
+	return domain == r.suffix || strings.HasSuffix(domain, "."+r.suffix)
+}
+
+// Set is an ordered list of policy rules. A nil *Set has no rules.
+type Set struct {
+	rules []rule
+}
+
+// New compiles the configured rules.
+func New(rules []config.PolicyRule) (*Set, error) {
+	s := &Set{}
+	for _, cfgRule := range rules {
+		r := rule{
+			policy: Policy{
+				Name:      cfgRule.Name,
+				Never:     cfgRule.Never,
+				Interval:  time.Duration(cfgRule.IntervalSeconds) * time.Second,
+				MaxResolv: cfgRule.MaxResolv,
+				Upstream:  cfgRule.Upstream,
+				IPv4Only:  cfgRule.IPv4Only,
+			},
+			suffix: normalize(cfgRule.Suffix),
+		}
+		if cfgRule.Regex != "" {
+			re, err := regexp.Compile(cfgRule.Regex)
+			if err != nil {
+				return nil, fmt.Errorf("policy '%s': invalid regex: %w", cfgRule.Name, err)
+			}
+			r.regex = re
+		}
+		s.rules = append(s.rules, r)
+	}
+	return s, nil
+}
+
+// Match returns the policy of the first rule matching domain, or nil if none does.
+// Suffixes are matched case-insensitively and ignoring the trailing dot; regexes
+// are matched against the domain as received.
+func (s *Set) Match(domain string) *Policy {
+	if s == nil {
+		return nil
+	}
+	normalized := normalize(domain)
+	for i := range s.rules {
+		r := &s.rules[i]
+		name := normalized
+		if r.regex != nil {
+			name = domain
+		}
+		if r.matches(name) {
+			return &r.policy
+		}
+	}
+	return nil
+}
+
+// Upstreams returns the distinct upstreams used by the rules.
+func (s *Set) Upstreams() []string {
+	if s == nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var upstreams []string
+	for _, r := range s.rules {
+		if r.policy.Upstream != "" && !seen[r.policy.Upstream] {
+			seen[r.policy.Upstream] = true
+			upstreams = append(upstreams, r.policy.Upstream)
+		}
+	}
+	return upstreams
+}
+
+// DomainPolicy returns the settings stored with a domain matching p
+// (p may be nil for the default policy).
+func DomainPolicy(p *Policy, defaultMaxResolv int) database.DomainPolicy {
+	if p == nil {
+		return database.DomainPolicy{MaxResolv: defaultMaxResolv}
+	}
+
+	dp := database.DomainPolicy{
+		Name:            p.Name,
+		MaxResolv:       p.MaxResolv,
+		IntervalSeconds: int(p.Interval / time.Second),
+	}
+	if dp.MaxResolv == 0 {
+		dp.MaxResolv = defaultMaxResolv
+	}
+	if p.Never {
+		dp.MaxResolv = 0
+	}
+	return dp
+}
+
+func normalize(domain string) string {
+	return strings.ToLower(strings.TrimSuffix(domain, "."))
+}
+
+// applyBatchSize is the number of domains re-matched per database round trip
+const applyBatchSize = 1000
+
+// domainStore is the part of the database used to re-apply policies
+type domainStore interface {
+	GetDomainPolicies(afterID int64, limit int) ([]database.DomainPolicyRow, error)
+	UpdateDomainPolicy(domainID int64, policy database.DomainPolicy) error
+}
+
+// Apply re-matches all stored domains against the rules, so rule changes also affect
+// domains inserted before them. Domains that stay on the default policy are left alone.
+// Returns the number of updated domains.
+func (s *Set) Apply(db domainStore, defaultMaxResolv int) (int, error) {
+	updated := 0
+	var afterID int64
+	for {
+		domains, err := db.GetDomainPolicies(afterID, applyBatchSize)
+		if err != nil {
+			return updated, err
+		}
+
+		for _, d := range domains {
+			want := DomainPolicy(s.Match(d.Domain), defaultMaxResolv)
+			if d.Policy.Name == "" && want.Name == "" {
+				continue
+			}
+			if d.Policy == want {
+				continue
+			}
+			if err := db.UpdateDomainPolicy(d.ID, want); err != nil {
+				return updated, err
+			}
+			updated++
+		}
+
+		if len(domains) < applyBatchSize {
+			return updated, nil
+		}
+		afterID = domains[len(domains)-1].ID
+	}
+}
@@ -0,0 +1,135 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"dns-collector/internal/config"
+	"dns-collector/internal/database"
+)
+
+func testRules() []config.PolicyRule {
+	return []config.PolicyRule{
+		{Name: "corp", Suffix: "corp.local", Never: true},
+		{Name: "banking", Regex: `\.bank\.`, IntervalSeconds: 60, MaxResolv: 100, Upstream: "10.0.0.53:53", IPv4Only: true},
+		{Name: "example", Suffix: "example.com."},
+	}
+}
+
+func TestMatch(t *testing.T) {
+	set, err := New(testRules())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	tests := []struct {
+		domain   string
+		expected string
+	}{
+		{"corp.local", "corp"},
+		{"Host.Corp.Local.", "corp"},
+		{"notcorp.local", ""},
+		{"online.bank.example.com", "banking"},
+		{"www.example.com", "example"},
+		{"example.com", "example"},
+		{"example.org", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			p := set.Match(tt.domain)
+			name := ""
+			if p != nil {
+				name = p.Name
+			}
+			if name != tt.expected {
+				t.Errorf("Expected policy %q, got %q", tt.expected, name)
+			}
+		})
+	}
+
+	var empty *Set
+	if empty.Match("corp.local") != nil {
+		t.Error("Expected nil set to match nothing")
+	}
+}
+
+func TestUpstreams(t *testing.T) {
+	set, _ := New(testRules())
+	if upstreams := set.Upstreams(); len(upstreams) != 1 || upstreams[0] != "10.0.0.53:53" {
+		t.Errorf("Expected [10.0.0.53:53], got %v", upstreams)
+	}
+}
+
+func TestDomainPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   *Policy
+		expected database.DomainPolicy
+	}{
+		{"default", nil, database.DomainPolicy{MaxResolv: 10}},
+		{"never", &Policy{Name: "corp", Never: true, MaxResolv: 5}, database.DomainPolicy{Name: "corp"}},
+		{"pinned", &Policy{Name: "banking", Interval: time.Minute, MaxResolv: 100}, database.DomainPolicy{Name: "banking", MaxResolv: 100, IntervalSeconds: 60}},
+		{"default budget", &Policy{Name: "example"}, database.DomainPolicy{Name: "example", MaxResolv: 10}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DomainPolicy(tt.policy, 10); got != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+// fakeStore serves stored domains page by page and records updates
+type fakeStore struct {
+	domains []database.DomainPolicyRow
+	updates map[int64]database.DomainPolicy
+}
+
+func (f *fakeStore) GetDomainPolicies(afterID int64, limit int) ([]database.DomainPolicyRow, error) {
+	var page []database.DomainPolicyRow
+	for _, d := range f.domains {
+		if d.ID > afterID && len(page) < limit {
+			page = append(page, d)
+		}
+	}
+	return page, nil
+}
+
+func (f *fakeStore) UpdateDomainPolicy(domainID int64, policy database.DomainPolicy) error {
+	f.updates[domainID] = policy
+	return nil
+}
+
+func TestApply(t *testing.T) {
+	set, _ := New(testRules())
+
+	store := &fakeStore{updates: make(map[int64]database.DomainPolicy)}
+	// Enough default domains to span several batches
+	for i := int64(1); i <= applyBatchSize+10; i++ {
+		store.domains = append(store.domains, database.DomainPolicyRow{
+			ID: i, Domain: "example.org", Policy: database.DomainPolicy{MaxResolv: 7},
+		})
+	}
+	store.domains = append(store.domains,
+		database.DomainPolicyRow{ID: 2000, Domain: "host.corp.local", Policy: database.DomainPolicy{MaxResolv: 10}},
+		database.DomainPolicyRow{ID: 2001, Domain: "www.example.com", Policy: database.DomainPolicy{Name: "example", MaxResolv: 10}},
+		database.DomainPolicyRow{ID: 2002, Domain: "www.example.net", Policy: database.DomainPolicy{Name: "removed", MaxResolv: 0}},
+	)
+
+	updated, err := set.Apply(store, 10)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if updated != 2 {
+		t.Errorf("Expected 2 updated domains, got %d (%v)", updated, store.updates)
+	}
+	if store.updates[2000] != (database.DomainPolicy{Name: "corp"}) {
+		t.Errorf("Expected host.corp.local to get the never policy, got %+v", store.updates[2000])
+	}
+	if store.updates[2002] != (database.DomainPolicy{MaxResolv: 10}) {
+		t.Errorf("Expected www.example.net to return to the default policy, got %+v", store.updates[2002])
+	}
+}
@@ -0,0 +1,109 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Error classes stored in domain.last_error for failed resolutions
+const (
+	errClassNXDomain = "nxdomain"
+	errClassServFail = "servfail"
+	errClassTimeout  = "timeout"
+	errClassOther    = "error"
+)
+
+// errClassNoData is the outcome of a name that exists without A/AAAA records
+// (NOERROR without answers). It is not a failure: the domain isn't backed off.
+const errClassNoData = "nodata"
+
+// classifyError maps a lookup error to one of the error classes.
+// The Go resolver reports NXDOMAIN (and empty answers) as "not found" and
+// SERVFAIL/REFUSED as "server misbehaving".
+func classifyError(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return errClassTimeout
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		switch {
+		case dnsErr.IsNotFound:
+			return errClassNXDomain
+		case dnsErr.IsTimeout:
+			return errClassTimeout
+		case dnsErr.Err == "server misbehaving":
+			return errClassServFail
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return errClassTimeout
+	}
+
+	return errClassOther
+}
+
+// failureClass returns the class of a resolution whose lookups all failed. A lookup
+// that found nothing doesn't hide a real failure of another one. When every lookup
+// found nothing, the nameservers tell NXDOMAIN from NODATA, which the Go resolver
+// reports alike.
+func (r *Resolver) failureClass(name string, nameservers []string, errs ...error) string {
+	for _, err := range errs {
+		if class := classifyError(err); class != errClassNXDomain {
+			return class
+		}
+	}
+	if r.isNoData(name, nameservers) {
+		return errClassNoData
+	}
+	return errClassNXDomain
+}
+
+// isNoData asks the nameservers in turn, as the Go resolver does, whether name exists
+// without addresses. The first NOERROR or NXDOMAIN answer decides; servers that fail
+// or don't answer are skipped. Returns false if no server decides.
+func (r *Resolver) isNoData(name string, nameservers []string) bool {
+	timeout := time.Duration(r.cfg.Resolver.TimeoutSeconds) * time.Second
+	client := &dns.Client{Net: "udp", Timeout: timeout}
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(name), dns.TypeA)
+
+	for _, server := range nameservers {
+		if !r.limiter.Wait(r.stopCh) {
+			return false
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		resp, _, err := client.ExchangeContext(ctx, msg, server)
+		cancel()
+		if err != nil || (resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError) {
+			continue
+		}
+		return resp.Rcode == dns.RcodeSuccess
+	}
+	return false
+}
+
+// systemNameservers returns the resolv.conf nameservers (host:port) the Go resolver
+// queries, in order.
+func systemNameservers() ([]string, error) {
+	conf, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read resolv.conf: %w", err)
+	}
+	servers := make([]string, 0, len(conf.Servers))
+	for _, s := range conf.Servers {
+		servers = append(servers, net.JoinHostPort(s, conf.Port))
+	}
+	return servers, nil
+}
@@ -0,0 +1,110 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+
+	"dns-collector/internal/config"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"nil error", nil, ""},
+		{"nxdomain", &net.DNSError{Err: "no such host", Name: "nx.example", IsNotFound: true}, errClassNXDomain},
+		{"servfail", &net.DNSError{Err: "server misbehaving", Name: "broken.example", IsTemporary: true}, errClassServFail},
+		{"dns timeout", &net.DNSError{Err: "i/o timeout", Name: "slow.example", IsTimeout: true}, errClassTimeout},
+		{"context deadline", context.DeadlineExceeded, errClassTimeout},
+		{"wrapped context deadline", fmt.Errorf("lookup: %w", context.DeadlineExceeded), errClassTimeout},
+		{"unknown error", errors.New("connection refused"), errClassOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyError(tt.err); got != tt.expected {
+				t.Errorf("Expected class %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// startNoDataServer starts a local DNS server answering NXDOMAIN for nx.example.com,
+// SERVFAIL for broken.example.com and NOERROR without answers (NODATA) otherwise
+func startNoDataServer(t *testing.T) string {
+	t.Helper()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	mux := dns.NewServeMux()
+	mux.HandleFunc(".", func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		resp.RecursionAvailable = true
+		switch req.Question[0].Name {
+		case "nx.example.com.":
+			resp.Rcode = dns.RcodeNameError
+		case "broken.example.com.":
+			resp.Rcode = dns.RcodeServerFailure
+		}
+		_ = w.WriteMsg(resp)
+	})
+
+	server := &dns.Server{PacketConn: pc, Handler: mux}
+	go func() { _ = server.ActivateAndServe() }()
+	t.Cleanup(func() { _ = server.Shutdown() })
+
+	return pc.LocalAddr().String()
+}
+
+func TestFailureClass(t *testing.T) {
+	server := startNoDataServer(t)
+	cfg := &config.Config{Resolver: config.ResolverConfig{TimeoutSeconds: 1, Workers: 1}}
+	resolver := NewResolver(cfg, nil, nil)
+	notFound := &net.DNSError{Err: "no such host", IsNotFound: true}
+	timeout := &net.DNSError{Err: "i/o timeout", IsTimeout: true}
+
+	// An unreachable server is skipped like the Go resolver does
+	down, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	unreachable := down.LocalAddr().String()
+	_ = down.Close()
+	nameservers := []string{unreachable, server}
+
+	tests := []struct {
+		name     string
+		domain   string
+		errs     []error
+		expected string
+	}{
+		{"nxdomain", "nx.example.com", []error{notFound, notFound}, errClassNXDomain},
+		{"nodata", "mx-only.example.com", []error{notFound, notFound}, errClassNoData},
+		{"no server decides", "broken.example.com", []error{notFound, notFound}, errClassNXDomain},
+		{"ipv6 timeout", "mx-only.example.com", []error{notFound, timeout}, errClassTimeout},
+		{"ipv4 timeout", "nx.example.com", []error{timeout, notFound}, errClassTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolver.failureClass(tt.domain, nameservers, tt.errs...); got != tt.expected {
+				t.Errorf("Expected class %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	if resolver.failureClass("mx-only.example.com", nil, notFound, notFound) != errClassNXDomain {
+		t.Error("Expected NXDOMAIN without nameservers to ask")
+	}
+}
@@ -0,0 +1,357 @@
+package resolver
+
+import (
+	"container/list"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"dns-collector/internal/config"
+	"dns-collector/internal/metrics"
+)
+
+// maxCNAMEChain bounds how many cached CNAME links are followed for one query
+const maxCNAMEChain = 8
+
+// cacheKey identifies an RRset (or a negative answer) of one upstream server.
+// NXDOMAIN answers are stored with qtype dns.TypeNone: they cover every type of the name.
+type cacheKey struct {
+	server string
+	name   string
+	qtype  uint16
+}
+
+type cacheEntry struct {
+	key     cacheKey
+	rrs     []dns.RR // cached RRset, nil for negative answers
+	rcode   int      // dns.RcodeNameError or dns.RcodeSuccess (NODATA) for negative answers
+	soa     dns.RR   // SOA of a negative answer, returned in the authority section
+	expires time.Time
+}
+
+// dnsCache is an in-process DNS cache shared by all resolver workers. It sits between
+// the Go resolver and the upstream servers (see cacheConn), keeps answer RRsets for
+// their TTL and NXDOMAIN/NODATA answers per RFC 2308, and follows cached CNAME links,
+// so siblings pointing at the same CDN target only ask the upstream for their own CNAME.
+type dnsCache struct {
+	mu         sync.Mutex
+	entries    map[cacheKey]*list.Element
+	lru        *list.List // front = most recently used
+	maxEntries int
+	maxTTL     time.Duration
+	maxNegTTL  time.Duration
+	timeout    time.Duration
+	metrics    *metrics.Registry
+	now        func() time.Time
+}
+
+func newDNSCache(cfg config.CacheConfig, timeout time.Duration, m *metrics.Registry) *dnsCache {
+	return &dnsCache{
+		entries:    make(map[cacheKey]*list.Element),
+		lru:        list.New(),
+		maxEntries: cfg.MaxEntries,
+		maxTTL:     time.Duration(cfg.MaxTTLSeconds) * time.Second,
+		maxNegTTL:  time.Duration(cfg.MaxNegativeTTLSeconds) * time.Second,
+		timeout:    timeout,
+		metrics:    m,
+		now:        time.Now,
+	}
+}
+
+// dial returns a connection the Go resolver uses instead of a socket to server.
+func (c *dnsCache) dial(ctx context.Context, server string) net.Conn {
+	return &cacheConn{ctx: ctx, cache: c, server: server}
+}
+
+// exchange answers a query from the cache or forwards it to server and caches the answer.
+// A partially cached CNAME chain is completed by asking the upstream for its last target only.
+func (c *dnsCache) exchange(ctx context.Context, server string, query *dns.Msg) (*dns.Msg, error) {
+	upstream := newUpstreamClient(server, c.timeout)
+	if len(query.Question) != 1 || query.Question[0].Qclass != dns.ClassINET {
+		return upstream.exchange(ctx, query)
+	}
+
+	q := query.Question[0]
+	now := c.now()
+	chain, name, entry := c.lookup(server, q.Name, q.Qtype, now)
+	if entry != nil {
+		result := "hit"
+		if entry.rrs == nil {
+			result = "negative_hit"
+		}
+		c.recordMetric(func(m *metrics.Registry) {
+			m.ResolverCacheRequests.WithLabelValues(result).Inc()
+		})
+		return reply(query, chain, entry, now), nil
+	}
+	c.recordMetric(func(m *metrics.Registry) {
+		m.ResolverCacheRequests.WithLabelValues("miss").Inc()
+	})
+
+	forward := query.Copy()
+	forward.Question[0].Name = name
+	resp, err := upstream.exchange(ctx, forward)
+	if err != nil {
+		return nil, err
+	}
+	c.store(server, name, q.Qtype, resp, now)
+
+	if len(chain) > 0 {
+		resp.Question = query.Question
+		resp.Answer = append(chain, resp.Answer...)
+	}
+	return resp, nil
+}
+
+// lookup follows cached CNAME links from name. Returns the links found (with their
+// remaining TTLs), the last name of the chain and the cached answer for it, or a nil
+// entry if the upstream has to be asked for that name.
+func (c *dnsCache) lookup(server, name string, qtype uint16, now time.Time) ([]dns.RR, string, *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var chain []dns.RR
+	for i := 0; i < maxCNAMEChain; i++ {
+		key := cacheKey{server: server, name: strings.ToLower(name), qtype: qtype}
+		if entry := c.get(key, now); entry != nil {
+			return chain, name, entry
+		}
+		if entry := c.get(cacheKey{server: server, name: key.name, qtype: dns.TypeNone}, now); entry != nil {
+			return chain, name, entry
+		}
+		if qtype == dns.TypeCNAME {
+			break
+		}
+		link := c.get(cacheKey{server: server, name: key.name, qtype: dns.TypeCNAME}, now)
+		if link == nil {
+			break
+		}
+		chain = append(chain, withRemainingTTL(link.rrs, link.expires, now)...)
+		name = link.rrs[0].(*dns.CNAME).Target
+	}
+	return chain, name, nil
+}
+
+// store caches the RRsets of an upstream answer and, for NXDOMAIN and empty answers
+// with a SOA in the authority section, a negative entry for the end of the CNAME chain.
+// Other response codes (SERVFAIL, REFUSED) are not cached.
+func (c *dnsCache) store(server, name string, qtype uint16, resp *dns.Msg, now time.Time) {
+	if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Group the answer section into RRsets; an RRset lives as long as its lowest TTL
+	rrsets := make(map[cacheKey][]dns.RR)
+	var order []cacheKey
+	for _, rr := range resp.Answer {
+		hdr := rr.Header()
+		if hdr.Class != dns.ClassINET {
+			continue
+		}
+		key := cacheKey{server: server, name: strings.ToLower(hdr.Name), qtype: hdr.Rrtype}
+		if _, ok := rrsets[key]; !ok {
+			order = append(order, key)
+		}
+		rrsets[key] = append(rrsets[key], dns.Copy(rr))
+	}
+	for _, key := range order {
+		rrs := rrsets[key]
+		ttl := time.Duration(minTTL(rrs)) * time.Second
+		if ttl > c.maxTTL {
+			ttl = c.maxTTL
+		}
+		if ttl > 0 {
+			c.set(&cacheEntry{key: key, rrs: rrs, expires: now.Add(ttl)})
+		}
+	}
+
+	// Follow the chain within the answer to find the name the answer ends at
+	final := strings.ToLower(name)
+	for i := 0; i < maxCNAMEChain; i++ {
+		if _, ok := rrsets[cacheKey{server: server, name: final, qtype: qtype}]; ok {
+			return // positive answer
+		}
+		link, ok := rrsets[cacheKey{server: server, name: final, qtype: dns.TypeCNAME}]
+		if !ok || qtype == dns.TypeCNAME {
+			break
+		}
+		final = strings.ToLower(link[0].(*dns.CNAME).Target)
+	}
+
+	// RFC 2308: negative answers are cached for min(SOA TTL, SOA MINIMUM),
+	// answers without a SOA are not cached
+	var soa *dns.SOA
+	for _, rr := range resp.Ns {
+		if s, ok := rr.(*dns.SOA); ok {
+			soa = s
+			break
+		}
+	}
+	if soa == nil {
+		return
+	}
+	ttl := time.Duration(min(soa.Hdr.Ttl, soa.Minttl)) * time.Second
+	if ttl > c.maxNegTTL {
+		ttl = c.maxNegTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	key := cacheKey{server: server, name: final, qtype: qtype}
+	if resp.Rcode == dns.RcodeNameError {
+		key.qtype = dns.TypeNone
+	}
+	c.set(&cacheEntry{key: key, rcode: resp.Rcode, soa: dns.Copy(soa), expires: now.Add(ttl)})
+}
+
+// get returns a live entry and marks it recently used; expired entries are dropped.
+// Must be called with mu held.
+func (c *dnsCache) get(key cacheKey, now time.Time) *cacheEntry {
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !now.Before(entry.expires) {
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+		c.reportSize()
+		return nil
+	}
+	c.lru.MoveToFront(elem)
+	return entry
+}
+
+// set adds or replaces an entry, evicting the least recently used ones beyond maxEntries.
+// Must be called with mu held.
+func (c *dnsCache) set(entry *cacheEntry) {
+	if elem, ok := c.entries[entry.key]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+
+	c.entries[entry.key] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+	c.reportSize()
+}
+
+// reportSize publishes the number of cached entries. Must be called with mu held.
+func (c *dnsCache) reportSize() {
+	size := c.lru.Len()
+	c.recordMetric(func(m *metrics.Registry) {
+		m.ResolverCacheEntries.Set(float64(size))
+	})
+}
+
+// recordMetric safely records a metric if metrics are enabled.
+func (c *dnsCache) recordMetric(f func(m *metrics.Registry)) {
+	if c.metrics != nil {
+		f(c.metrics)
+	}
+}
+
+// reply builds the response to query from cached data: the CNAME links followed
+// and either the final RRset or the negative answer with its SOA.
+func reply(query *dns.Msg, chain []dns.RR, entry *cacheEntry, now time.Time) *dns.Msg {
+	msg := new(dns.Msg)
+	msg.SetReply(query)
+	msg.RecursionAvailable = true
+	msg.Answer = chain
+	if entry.rrs != nil {
+		msg.Answer = append(msg.Answer, withRemainingTTL(entry.rrs, entry.expires, now)...)
+		return msg
+	}
+	msg.Rcode = entry.rcode
+	msg.Ns = withRemainingTTL([]dns.RR{entry.soa}, entry.expires, now)
+	return msg
+}
+
+// withRemainingTTL returns copies of rrs with the TTL left until expires.
+func withRemainingTTL(rrs []dns.RR, expires, now time.Time) []dns.RR {
+	ttl := uint32(expires.Sub(now).Seconds())
+	out := make([]dns.RR, len(rrs))
+	for i, rr := range rrs {
+		out[i] = dns.Copy(rr)
+		out[i].Header().Ttl = ttl
+	}
+	return out
+}
+
+// minTTL returns the lowest TTL of an RRset.
+func minTTL(rrs []dns.RR) uint32 {
+	ttl := rrs[0].Header().Ttl
+	for _, rr := range rrs[1:] {
+		ttl = min(ttl, rr.Header().Ttl)
+	}
+	return ttl
+}
+
+// cacheConn is the connection handed to the Go resolver when the cache is enabled.
+// It is not a net.PacketConn, so the resolver frames messages as over TCP
+// (two-byte length prefix); every complete query written is answered by the cache.
+type cacheConn struct {
+	ctx    context.Context
+	cache  *dnsCache
+	server string
+	req    []byte // query bytes written so far
+	resp   []byte // framed responses not read yet
+}
+
+func (c *cacheConn) Write(b []byte) (int, error) {
+	c.req = append(c.req, b...)
+	for len(c.req) >= 2 {
+		size := int(binary.BigEndian.Uint16(c.req))
+		if len(c.req) < 2+size {
+			break
+		}
+
+		query := new(dns.Msg)
+		if err := query.Unpack(c.req[2 : 2+size]); err != nil {
+			return 0, err
+		}
+		c.req = c.req[2+size:]
+
+		resp, err := c.cache.exchange(c.ctx, c.server, query)
+		if err != nil {
+			return 0, err
+		}
+		packed, err := resp.Pack()
+		if err != nil {
+			return 0, err
+		}
+		c.resp = binary.BigEndian.AppendUint16(c.resp, uint16(len(packed)))
+		c.resp = append(c.resp, packed...)
+	}
+	return len(b), nil
+}
+
+func (c *cacheConn) Read(b []byte) (int, error) {
+	if len(c.resp) == 0 {
+		return 0, errors.New("no pending DNS response")
+	}
+	n := copy(b, c.resp)
+	c.resp = c.resp[n:]
+	return n, nil
+}
+
+func (c *cacheConn) Close() error                       { return nil }
+func (c *cacheConn) LocalAddr() net.Addr                { return nil }
+func (c *cacheConn) RemoteAddr() net.Addr               { return nil }
+func (c *cacheConn) SetDeadline(_ time.Time) error      { return nil }
+func (c *cacheConn) SetReadDeadline(_ time.Time) error  { return nil }
+func (c *cacheConn) SetWriteDeadline(_ time.Time) error { return nil }
@@ -0,0 +1,280 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"dns-collector/internal/config"
+)
+
+// cdnServer is a local DNS server where a.example.com and b.example.com are CNAMEs
+// of the same CDN target. It counts the queries it receives per name and type.
+type cdnServer struct {
+	addr    string
+	mu      sync.Mutex
+	queries map[string]int
+}
+
+func (s *cdnServer) count(name string, qtype uint16) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queries[name+"/"+dns.TypeToString[qtype]]
+}
+
+func startCDNServer(t *testing.T) *cdnServer {
+	t.Helper()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	s := &cdnServer{addr: pc.LocalAddr().String(), queries: make(map[string]int)}
+	soa := &dns.SOA{
+		Hdr:     dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 60},
+		Ns:      "ns.example.com.",
+		Mbox:    "hostmaster.example.com.",
+		Minttl:  30,
+		Serial:  1,
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+	}
+
+	mux := dns.NewServeMux()
+	mux.HandleFunc(".", func(w dns.ResponseWriter, req *dns.Msg) {
+		q := req.Question[0]
+		s.mu.Lock()
+		s.queries[q.Name+"/"+dns.TypeToString[q.Qtype]]++
+		s.mu.Unlock()
+
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		resp.RecursionAvailable = true
+
+		name := q.Name
+		switch name {
+		case "a.example.com.", "b.example.com.":
+			resp.Answer = append(resp.Answer, &dns.CNAME{
+				Hdr:    dns.RR_Header{Name: name, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 300},
+				Target: "cdn.example.net.",
+			})
+			name = "cdn.example.net."
+		case "nx.example.com.":
+			resp.Rcode = dns.RcodeNameError
+			resp.Ns = append(resp.Ns, soa)
+		case "nosoa.example.com.":
+			resp.Rcode = dns.RcodeNameError
+		case "v4only.example.com.":
+			if q.Qtype == dns.TypeAAAA {
+				resp.Ns = append(resp.Ns, soa)
+			} else {
+				resp.Answer = append(resp.Answer, &dns.A{
+					Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+					A:   net.IPv4(192, 0, 2, 20),
+				})
+			}
+		}
+
+		if name == "cdn.example.net." {
+			switch q.Qtype {
+			case dns.TypeA:
+				resp.Answer = append(resp.Answer, &dns.A{
+					Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+					A:   net.IPv4(192, 0, 2, 10),
+				})
+			case dns.TypeAAAA:
+				resp.Answer = append(resp.Answer, &dns.AAAA{
+					Hdr:  dns.RR_Header{Name: name, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: 60},
+					AAAA: net.ParseIP("2001:db8::10"),
+				})
+			}
+		}
+		_ = w.WriteMsg(resp)
+	})
+
+	server := &dns.Server{PacketConn: pc, Handler: mux}
+	go func() { _ = server.ActivateAndServe() }()
+	t.Cleanup(func() { _ = server.Shutdown() })
+
+	return s
+}
+
+func newTestCache(maxEntries int) *dnsCache {
+	return newDNSCache(config.CacheConfig{
+		Enabled:               true,
+		MaxEntries:            maxEntries,
+		MaxTTLSeconds:         3600,
+		MaxNegativeTTLSeconds: 300,
+	}, 2*time.Second, nil)
+}
+
+func lookupIPs(t *testing.T, r *net.Resolver, network, host string) ([]net.IP, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return r.LookupIP(ctx, network, host)
+}
+
+func TestDNSCache_RepeatedLookup(t *testing.T) {
+	server := startCDNServer(t)
+	r := newNetResolver(2*time.Second, server.addr, newTestCache(100))
+
+	for i := 0; i < 3; i++ {
+		ips, err := lookupIPs(t, r, "ip4", "a.example.com.")
+		if err != nil {
+			t.Fatalf("Lookup %d: expected no error, got %v", i, err)
+		}
+		if len(ips) != 1 || !ips[0].Equal(net.IPv4(192, 0, 2, 10)) {
+			t.Fatalf("Lookup %d: expected [192.0.2.10], got %v", i, ips)
+		}
+	}
+
+	if n := server.count("a.example.com.", dns.TypeA); n != 1 {
+		t.Errorf("Expected 1 upstream query, got %d", n)
+	}
+}
+
+func TestDNSCache_SharedCNAMETarget(t *testing.T) {
+	server := startCDNServer(t)
+	r := newNetResolver(2*time.Second, server.addr, newTestCache(100))
+
+	// a.example.com caches the CDN target's AAAA record
+	if _, err := lookupIPs(t, r, "ip6", "a.example.com."); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// b.example.com's A lookup caches its own CNAME link
+	if _, err := lookupIPs(t, r, "ip4", "b.example.com."); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// b.example.com's AAAA lookup is answered from the cached link and target
+	ips, err := lookupIPs(t, r, "ip6", "b.example.com.")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(ips) != 1 || !ips[0].Equal(net.ParseIP("2001:db8::10")) {
+		t.Errorf("Expected [2001:db8::10], got %v", ips)
+	}
+
+	if n := server.count("b.example.com.", dns.TypeAAAA); n != 0 {
+		t.Errorf("Expected no upstream AAAA query for b.example.com, got %d", n)
+	}
+}
+
+func TestDNSCache_ExpiredTargetOnly(t *testing.T) {
+	server := startCDNServer(t)
+	cache := newTestCache(100)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	r := newNetResolver(2*time.Second, server.addr, cache)
+
+	if _, err := lookupIPs(t, r, "ip4", "a.example.com."); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// The A record (TTL 60) expires, the CNAME link (TTL 300) does not:
+	// only the target is asked for again
+	now = now.Add(2 * time.Minute)
+	ips, err := lookupIPs(t, r, "ip4", "a.example.com.")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(ips) != 1 || !ips[0].Equal(net.IPv4(192, 0, 2, 10)) {
+		t.Errorf("Expected [192.0.2.10], got %v", ips)
+	}
+
+	if n := server.count("a.example.com.", dns.TypeA); n != 1 {
+		t.Errorf("Expected 1 upstream query for a.example.com, got %d", n)
+	}
+	if n := server.count("cdn.example.net.", dns.TypeA); n != 1 {
+		t.Errorf("Expected 1 upstream query for the CDN target, got %d", n)
+	}
+}
+
+func TestDNSCache_NegativeAnswers(t *testing.T) {
+	server := startCDNServer(t)
+	cache := newTestCache(100)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	r := newNetResolver(2*time.Second, server.addr, cache)
+
+	tests := []struct {
+		name     string
+		network  string
+		host     string
+		qtype    uint16
+		expected int // upstream queries after two lookups
+	}{
+		{"nxdomain", "ip4", "nx.example.com.", dns.TypeA, 1},
+		{"nodata", "ip6", "v4only.example.com.", dns.TypeAAAA, 1},
+		{"nxdomain without soa", "ip4", "nosoa.example.com.", dns.TypeA, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 2; i++ {
+				_, err := lookupIPs(t, r, tt.network, tt.host)
+				if classifyError(err) != errClassNXDomain {
+					t.Fatalf("Lookup %d: expected not found error, got %v", i, err)
+				}
+			}
+			if n := server.count(tt.host, tt.qtype); n != tt.expected {
+				t.Errorf("Expected %d upstream queries, got %d", tt.expected, n)
+			}
+		})
+	}
+
+	// NXDOMAIN covers every type of the name
+	if _, err := lookupIPs(t, r, "ip6", "nx.example.com."); classifyError(err) != errClassNXDomain {
+		t.Errorf("Expected not found error for AAAA, got %v", err)
+	}
+	if n := server.count("nx.example.com.", dns.TypeAAAA); n != 0 {
+		t.Errorf("Expected AAAA to be answered from the cached NXDOMAIN, got %d upstream queries", n)
+	}
+
+	// Negative answers live for min(SOA TTL, SOA MINIMUM) = 30s
+	now = now.Add(31 * time.Second)
+	if _, err := lookupIPs(t, r, "ip4", "nx.example.com."); classifyError(err) != errClassNXDomain {
+		t.Fatalf("Expected not found error, got %v", err)
+	}
+	if n := server.count("nx.example.com.", dns.TypeA); n != 2 {
+		t.Errorf("Expected expired NXDOMAIN to be asked again, got %d upstream queries", n)
+	}
+}
+
+func TestDNSCache_Eviction(t *testing.T) {
+	cache := newTestCache(2)
+	now := time.Now()
+
+	keys := []cacheKey{
+		{server: "ns:53", name: "a.example.com.", qtype: dns.TypeA},
+		{server: "ns:53", name: "b.example.com.", qtype: dns.TypeA},
+		{server: "ns:53", name: "c.example.com.", qtype: dns.TypeA},
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.set(&cacheEntry{key: keys[0], rcode: dns.RcodeNameError, expires: now.Add(time.Minute)})
+	cache.set(&cacheEntry{key: keys[1], rcode: dns.RcodeNameError, expires: now.Add(time.Minute)})
+	cache.get(keys[0], now) // a is now the most recently used
+	cache.set(&cacheEntry{key: keys[2], rcode: dns.RcodeNameError, expires: now.Add(time.Minute)})
+
+	if cache.get(keys[0], now) == nil {
+		t.Error("Expected recently used entry to be kept")
+	}
+	if cache.get(keys[1], now) != nil {
+		t.Error("Expected least recently used entry to be evicted")
+	}
+	if cache.get(keys[2], now) == nil {
+		t.Error("Expected new entry to be cached")
+	}
+	if cache.lru.Len() != 2 {
+		t.Errorf("Expected 2 entries, got %d", cache.lru.Len())
+	}
+}
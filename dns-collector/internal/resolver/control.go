@@ -0,0 +1,150 @@
+package resolver
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"dns-collector/internal/policy"
+)
+
+var (
+	// ErrInvalidDomain is returned by ResolveDomain for names that are not valid domain names
+	ErrInvalidDomain = errors.New("invalid domain name")
+	// ErrDisabledByPolicy is returned by ResolveDomain for domains whose policy forbids resolution
+	ErrDisabledByPolicy = errors.New("resolution disabled by policy")
+	// ErrInFlight is returned by ResolveDomain while the domain is queued or being resolved
+	ErrInFlight = errors.New("domain is already queued or being resolved")
+)
+
+// Result is the outcome of one resolution of a domain
+type Result struct {
+	Domain string   `json:"domain"`
+	IPv4   []string `json:"ipv4"`
+	IPv6   []string `json:"ipv6"`
+	Error  string   `json:"error,omitempty"` // Error class when both lookups failed (nodata: no A/AAAA records)
+}
+
+// Status is a snapshot of the scheduler state
+type Status struct {
+	Paused         bool       `json:"paused"`
+	Workers        int        `json:"workers"`
+	ActiveWorkers  int        `json:"active_workers"`
+	Queued         int        `json:"queued"`          // Claimed domains waiting for a worker
+	PriorityQueued int        `json:"priority_queued"` // New domains waiting in the priority lane
+	InFlight       int        `json:"in_flight"`       // Domains queued or being resolved
+	Backlog        int64      `json:"backlog"`         // Domains due for resolution in the database
+	LastScheduled  *time.Time `json:"last_scheduled"`  // Last time the scheduler claimed a batch
+	LastResolved   *time.Time `json:"last_resolved"`   // Last time a domain was resolved
+}
+
+// ResolveDomain resolves a domain right away, bypassing the scheduler, and returns
+// the addresses found. Unknown domains are inserted first. Works while paused.
+func (r *Resolver) ResolveDomain(name string) (*Result, error) {
+	name = dns.Fqdn(strings.ToLower(strings.TrimSpace(name)))
+	if _, ok := dns.IsDomainName(name); !ok || name == "." {
+		return nil, ErrInvalidDomain
+	}
+
+	domainPolicy := policy.DomainPolicy(r.policies.Match(name), r.cfg.Resolver.MaxResolv)
+	domain, _, err := r.db.InsertOrGetDomain(name, domainPolicy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get domain: %w", err)
+	}
+	if domain.MaxResolv <= 0 {
+		return nil, ErrDisabledByPolicy
+	}
+
+	if !r.markInFlight(domain.ID) {
+		return nil, ErrInFlight
+	}
+	defer r.releaseInFlight(domain.ID)
+
+	result := r.resolveDomain(*domain)
+	return &result, nil
+}
+
+// Pause stops the scheduler and the workers from taking further domains. Lookups
+// already in progress finish; queued domains wait until Resume.
+func (r *Resolver) Pause() {
+	r.pauseMu.Lock()
+	defer r.pauseMu.Unlock()
+
+	if r.resumeCh == nil {
+		r.resumeCh = make(chan struct{})
+	}
+}
+
+// Resume lets a paused resolver continue.
+func (r *Resolver) Resume() {
+	r.pauseMu.Lock()
+	defer r.pauseMu.Unlock()
+
+	if r.resumeCh != nil {
+		close(r.resumeCh)
+		r.resumeCh = nil
+	}
+}
+
+// Paused reports whether the resolver is paused.
+func (r *Resolver) Paused() bool {
+	r.pauseMu.Lock()
+	defer r.pauseMu.Unlock()
+	return r.resumeCh != nil
+}
+
+// waitResumed blocks while the resolver is paused. Returns false if it was stopped.
+func (r *Resolver) waitResumed() bool {
+	r.pauseMu.Lock()
+	resumeCh := r.resumeCh
+	r.pauseMu.Unlock()
+
+	if resumeCh == nil {
+		return true
+	}
+	select {
+	case <-resumeCh:
+		return true
+	case <-r.stopCh:
+		return false
+	}
+}
+
+// Status returns the current scheduler state including the database backlog.
+func (r *Resolver) Status() (Status, error) {
+	r.inFlightMu.Lock()
+	inFlight := len(r.inFlight)
+	r.inFlightMu.Unlock()
+
+	status := Status{
+		Paused:         r.Paused(),
+		Workers:        r.cfg.Resolver.Workers,
+		ActiveWorkers:  int(atomic.LoadInt32(&r.activeWorkers)),
+		Queued:         len(r.queue),
+		PriorityQueued: len(r.priority),
+		InFlight:       inFlight,
+		LastScheduled:  unixNanoTime(r.lastScheduled.Load()),
+		LastResolved:   unixNanoTime(r.lastResolved.Load()),
+	}
+
+	backlog, err := r.db.CountDomainsToResolve(r.cfg.Resolver.CyclicResolv,
+		r.cfg.Resolver.ResolvCooldownMins, r.refreshInterval(), r.cfg.Resolver.Wildcard.Collapse)
+	if err != nil {
+		return status, err
+	}
+	status.Backlog = backlog
+	return status, nil
+}
+
+// unixNanoTime converts a stored Unix nanosecond timestamp, nil if never set.
+func unixNanoTime(ns int64) *time.Time {
+	if ns == 0 {
+		return nil
+	}
+	t := time.Unix(0, ns)
+	return &t
+}
@@ -0,0 +1,67 @@
+package resolver
+
+import (
+	"context"
+
+	"github.com/miekg/dns"
+)
+
+// DNSSEC validation states stored in domain.dnssec_status
+const (
+	dnssecSecure        = "secure"        // upstream validated the answer (AD flag set)
+	dnssecInsecure      = "insecure"      // zone is not signed
+	dnssecBogus         = "bogus"         // signatures present but validation failed
+	dnssecIndeterminate = "indeterminate" // status could not be established
+)
+
+// dnssecStatus queries the domain's A record with the DO bit set and interprets the answer
+// of a validating upstream: the AD flag means secure, a SERVFAIL that goes away with
+// checking disabled means bogus, an unsigned answer means insecure.
+func (c *upstreamClient) dnssecStatus(ctx context.Context, domain string) string {
+	resp, err := c.exchange(ctx, newDNSSECQuery(domain, false))
+	if err != nil {
+		return dnssecIndeterminate
+	}
+
+	switch resp.Rcode {
+	case dns.RcodeSuccess, dns.RcodeNameError:
+		if resp.AuthenticatedData {
+			return dnssecSecure
+		}
+		if hasRRSIG(resp) {
+			// Signed, but the upstream did not validate it
+			return dnssecIndeterminate
+		}
+		return dnssecInsecure
+	case dns.RcodeServerFailure:
+		// Validating resolvers report bogus data as SERVFAIL; ask again without
+		// validation to tell a signature failure from a broken zone
+		resp, err = c.exchange(ctx, newDNSSECQuery(domain, true))
+		if err == nil && (resp.Rcode == dns.RcodeSuccess || resp.Rcode == dns.RcodeNameError) && hasRRSIG(resp) {
+			return dnssecBogus
+		}
+	}
+	return dnssecIndeterminate
+}
+
+// newDNSSECQuery builds a recursive A query with the DO bit set.
+func newDNSSECQuery(domain string, checkingDisabled bool) *dns.Msg {
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(domain), dns.TypeA)
+	msg.RecursionDesired = true
+	msg.CheckingDisabled = checkingDisabled
+	msg.SetEdns0(dns.DefaultMsgSize, true)
+	return msg
+}
+
+// hasRRSIG reports whether the answer or authority section carries signatures.
+func hasRRSIG(msg *dns.Msg) bool {
+	for _, section := range [][]dns.RR{msg.Answer, msg.Ns} {
+		for _, rr := range section {
+			if rr.Header().Rrtype == dns.TypeRRSIG {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// startDNSSECServer starts a local DNS server emulating a validating resolver:
+// secure.example.com is validated, bogus.example.com fails validation unless
+// checking is disabled, unsigned.example.com is not signed, signed.example.com
+// is signed but not validated and broken.example.com always fails.
+func startDNSSECServer(t *testing.T) string {
+	t.Helper()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	mux := dns.NewServeMux()
+	mux.HandleFunc(".", func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+
+		name := req.Question[0].Name
+		answer := &dns.A{
+			Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+			A:   net.IPv4(10, 0, 0, 1),
+		}
+		sig := &dns.RRSIG{
+			Hdr:         dns.RR_Header{Name: name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: 60},
+			TypeCovered: dns.TypeA,
+			SignerName:  "example.com.",
+		}
+
+		switch name {
+		case "secure.example.com.":
+			resp.AuthenticatedData = true
+			resp.Answer = append(resp.Answer, answer, sig)
+		case "bogus.example.com.":
+			if !req.CheckingDisabled {
+				resp.Rcode = dns.RcodeServerFailure
+			} else {
+				resp.Answer = append(resp.Answer, answer, sig)
+			}
+		case "signed.example.com.":
+			resp.Answer = append(resp.Answer, answer, sig)
+		case "broken.example.com.":
+			resp.Rcode = dns.RcodeServerFailure
+		default:
+			resp.Answer = append(resp.Answer, answer)
+		}
+		_ = w.WriteMsg(resp)
+	})
+
+	server := &dns.Server{PacketConn: pc, Handler: mux}
+	go func() { _ = server.ActivateAndServe() }()
+	t.Cleanup(func() { _ = server.Shutdown() })
+
+	return pc.LocalAddr().String()
+}
+
+func TestDNSSECStatus(t *testing.T) {
+	client := newUpstreamClient(startDNSSECServer(t), 2*time.Second)
+
+	tests := []struct {
+		domain   string
+		expected string
+	}{
+		{"secure.example.com", dnssecSecure},
+		{"unsigned.example.com", dnssecInsecure},
+		{"bogus.example.com", dnssecBogus},
+		{"signed.example.com", dnssecIndeterminate},
+		{"broken.example.com", dnssecIndeterminate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+
+			if status := client.dnssecStatus(ctx, tt.domain); status != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, status)
+			}
+		})
+	}
+}
+
+func TestNewDNSSECQuery(t *testing.T) {
+	msg := newDNSSECQuery("example.com", true)
+
+	opt := msg.IsEdns0()
+	if opt == nil || !opt.Do() {
+		t.Error("Expected DO bit to be set")
+	}
+	if !msg.CheckingDisabled {
+		t.Error("Expected CD bit to be set")
+	}
+	if msg.Question[0].Qtype != dns.TypeA {
+		t.Errorf("Expected A query, got %s", dns.TypeToString[msg.Question[0].Qtype])
+	}
+}
@@ -0,0 +1,87 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/miekg/dns"
+
+	"dns-collector/internal/config"
+)
+
+// vantage is a site resolved with its EDNS Client Subnet
+type vantage struct {
+	name   string
+	subnet *net.IPNet
+}
+
+// parseVantagePoints converts configured vantage points (validated by config.Load).
+func parseVantagePoints(points []config.VantagePoint) []vantage {
+	vantages := make([]vantage, 0, len(points))
+	for _, vp := range points {
+		_, subnet, err := net.ParseCIDR(vp.Subnet)
+		if err != nil {
+			continue
+		}
+		vantages = append(vantages, vantage{name: vp.Name, subnet: subnet})
+	}
+	return vantages
+}
+
+// lookupECS resolves domain for the given query type (dns.TypeA or dns.TypeAAAA) on behalf
+// of subnet using the EDNS Client Subnet option (RFC 7871), so CDN domains answer as they
+// would for clients of that subnet.
+func (c *upstreamClient) lookupECS(ctx context.Context, domain string, qtype uint16, subnet *net.IPNet) ([]net.IP, error) {
+	resp, err := c.exchange(ctx, newECSQuery(domain, qtype, subnet))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Rcode != dns.RcodeSuccess {
+		return nil, fmt.Errorf("lookup %s: %s", domain, dns.RcodeToString[resp.Rcode])
+	}
+
+	var ips []net.IP
+	for _, rr := range resp.Answer {
+		switch rec := rr.(type) {
+		case *dns.A:
+			if qtype == dns.TypeA {
+				ips = append(ips, rec.A)
+			}
+		case *dns.AAAA:
+			if qtype == dns.TypeAAAA {
+				ips = append(ips, rec.AAAA)
+			}
+		}
+	}
+	return ips, nil
+}
+
+// newECSQuery builds a recursive query with an EDNS0 OPT record holding the client subnet.
+func newECSQuery(domain string, qtype uint16, subnet *net.IPNet) *dns.Msg {
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(domain), qtype)
+	msg.RecursionDesired = true
+
+	ones, _ := subnet.Mask.Size()
+	ecs := &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		SourceNetmask: uint8(ones),
+		SourceScope:   0,
+	}
+	if ip4 := subnet.IP.To4(); ip4 != nil {
+		ecs.Family = 1
+		ecs.Address = ip4
+	} else {
+		ecs.Family = 2
+		ecs.Address = subnet.IP
+	}
+
+	opt := &dns.OPT{Hdr: dns.RR_Header{Name: ".", Rrtype: dns.TypeOPT}}
+	opt.SetUDPSize(dns.DefaultMsgSize)
+	opt.Option = append(opt.Option, ecs)
+	msg.Extra = append(msg.Extra, opt)
+
+	return msg
+}
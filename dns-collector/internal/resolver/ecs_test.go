@@ -0,0 +1,163 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"dns-collector/internal/config"
+)
+
+// startECSServer starts a local DNS server answering A queries with an address
+// derived from the client subnet: 10.0.0.1 without ECS, 10.0.0.<prefix len> with ECS.
+func startECSServer(t *testing.T) string {
+	t.Helper()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	mux := dns.NewServeMux()
+	mux.HandleFunc(".", func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+
+		if req.Question[0].Name == "nx.example.com." {
+			resp.Rcode = dns.RcodeNameError
+			_ = w.WriteMsg(resp)
+			return
+		}
+
+		last := byte(1)
+		if opt := req.IsEdns0(); opt != nil {
+			for _, o := range opt.Option {
+				if ecs, ok := o.(*dns.EDNS0_SUBNET); ok {
+					last = ecs.SourceNetmask
+				}
+			}
+		}
+
+		if req.Question[0].Qtype == dns.TypeA {
+			resp.Answer = append(resp.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+				A:   net.IPv4(10, 0, 0, last),
+			})
+		}
+		_ = w.WriteMsg(resp)
+	})
+
+	server := &dns.Server{PacketConn: pc, Handler: mux}
+	go func() { _ = server.ActivateAndServe() }()
+	t.Cleanup(func() { _ = server.Shutdown() })
+
+	return pc.LocalAddr().String()
+}
+
+func TestLookupECS(t *testing.T) {
+	client := newUpstreamClient(startECSServer(t), 2*time.Second)
+	_, subnet, _ := net.ParseCIDR("192.0.2.0/24")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	ips, err := client.lookupECS(ctx, "cdn.example.com", dns.TypeA, subnet)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(ips) != 1 || !ips[0].Equal(net.IPv4(10, 0, 0, 24)) {
+		t.Errorf("Expected [10.0.0.24] for a /24 client subnet, got %v", ips)
+	}
+
+	// AAAA query gets no A records back
+	ips, err = client.lookupECS(ctx, "cdn.example.com", dns.TypeAAAA, subnet)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(ips) != 0 {
+		t.Errorf("Expected no IPv6 addresses, got %v", ips)
+	}
+
+	if _, err := client.lookupECS(ctx, "nx.example.com", dns.TypeA, subnet); err == nil {
+		t.Error("Expected error for NXDOMAIN")
+	}
+}
+
+func TestNewECSQuery(t *testing.T) {
+	tests := []struct {
+		name           string
+		subnet         string
+		expectedFamily uint16
+		expectedMask   uint8
+	}{
+		{"ipv4 subnet", "10.20.30.0/24", 1, 24},
+		{"ipv6 subnet", "2001:db8:1::/56", 2, 56},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, subnet, _ := net.ParseCIDR(tt.subnet)
+			msg := newECSQuery("example.com", dns.TypeA, subnet)
+
+			if msg.Question[0].Name != "example.com." {
+				t.Errorf("Expected fully qualified name, got %s", msg.Question[0].Name)
+			}
+
+			opt := msg.IsEdns0()
+			if opt == nil || len(opt.Option) != 1 {
+				t.Fatal("Expected a single EDNS0 option")
+			}
+			ecs, ok := opt.Option[0].(*dns.EDNS0_SUBNET)
+			if !ok {
+				t.Fatalf("Expected EDNS0_SUBNET option, got %T", opt.Option[0])
+			}
+			if ecs.Family != tt.expectedFamily {
+				t.Errorf("Expected family %d, got %d", tt.expectedFamily, ecs.Family)
+			}
+			if ecs.SourceNetmask != tt.expectedMask {
+				t.Errorf("Expected source netmask %d, got %d", tt.expectedMask, ecs.SourceNetmask)
+			}
+		})
+	}
+}
+
+func TestParseVantagePoints(t *testing.T) {
+	vantages := parseVantagePoints([]config.VantagePoint{
+		{Name: "msk", Subnet: "10.1.0.0/24"},
+		{Name: "spb", Subnet: "2001:db8::/56"},
+	})
+
+	if len(vantages) != 2 {
+		t.Fatalf("Expected 2 vantages, got %d", len(vantages))
+	}
+	if vantages[0].name != "msk" || vantages[0].subnet.String() != "10.1.0.0/24" {
+		t.Errorf("Unexpected first vantage: %s %s", vantages[0].name, vantages[0].subnet)
+	}
+}
+
+func TestComparedIPs(t *testing.T) {
+	// Main AAAA lookup failed: the vantage's IPv6 addresses are not compared
+	ipTypes, ips := comparedIPs(map[string]*typeLookup{
+		"ipv4": {ips: []string{"10.0.0.1", "10.0.0.24"}},
+		"ipv6": {ips: []string{"2001:db8::1"}, failed: true},
+	})
+	if len(ipTypes) != 1 || ipTypes[0] != "ipv4" || len(ips) != 2 {
+		t.Errorf("Expected the 2 IPv4 addresses only, got %v %v", ipTypes, ips)
+	}
+
+	// A failed vantage lookup leaves its type out instead of reporting it as removed
+	ipTypes, ips = comparedIPs(map[string]*typeLookup{
+		"ipv4": {ips: []string{"10.0.0.1"}, failed: true},
+		"ipv6": {ips: []string{"2001:db8::1"}},
+	})
+	if len(ipTypes) != 1 || ipTypes[0] != "ipv6" || len(ips) != 1 || ips[0] != "2001:db8::1" {
+		t.Errorf("Expected the IPv6 address only, got %v %v", ipTypes, ips)
+	}
+
+	if ipTypes, _ := comparedIPs(map[string]*typeLookup{"ipv4": {failed: true}, "ipv6": {failed: true}}); len(ipTypes) != 0 {
+		t.Errorf("Expected nothing to compare, got %v", ipTypes)
+	}
+}
@@ -0,0 +1,127 @@
+package resolver
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"dns-collector/internal/metrics"
+)
+
+// resolvePTRs runs in the background and caches reverse DNS names of resolved IPs.
+// Due addresses are processed in batches; when a pass finds nothing to do (or makes
+// no progress) it sleeps for ptr.poll_seconds.
+func (r *Resolver) resolvePTRs() {
+	defer r.wg.Done()
+
+	pollInterval := time.Duration(r.cfg.Resolver.PTR.PollSeconds) * time.Second
+	for {
+		stored, full := r.resolvePTRBatch()
+		if stored > 0 && full {
+			select {
+			case <-r.stopCh:
+				return
+			default:
+				continue
+			}
+		}
+
+		select {
+		case <-time.After(pollInterval):
+		case <-r.stopCh:
+			return
+		}
+	}
+}
+
+// resolvePTRBatch looks up one batch of due addresses with ptr.workers concurrent lookups.
+// Returns the number of cached names and whether the batch was full (more may be due).
+func (r *Resolver) resolvePTRBatch() (int, bool) {
+	ptrCfg := r.cfg.Resolver.PTR
+	refresh := time.Duration(ptrCfg.RefreshHours) * time.Hour
+
+	ips, err := r.db.GetIPsForPTR(refresh, ptrCfg.BatchSize)
+	if err != nil {
+		log.Printf("Error getting IPs for PTR lookup: %v", err)
+		return 0, false
+	}
+	if len(ips) == 0 {
+		return 0, false
+	}
+
+	ipCh := make(chan string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	stored := 0
+
+	for i := 0; i < ptrCfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ip := range ipCh {
+				if r.lookupPTR(ip) {
+					mu.Lock()
+					stored++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, ip := range ips {
+		select {
+		case ipCh <- ip:
+		case <-r.stopCh:
+			break feed
+		}
+	}
+	close(ipCh)
+	wg.Wait()
+
+	log.Printf("PTR lookup: cached %d of %d addresses", stored, len(ips))
+	return stored, len(ips) == ptrCfg.BatchSize
+}
+
+// lookupPTR resolves and caches the PTR name of an address. Addresses without a PTR record
+// are cached with an empty name; other errors leave the address due for the next pass.
+func (r *Resolver) lookupPTR(ip string) bool {
+	if !r.limiter.Wait(r.stopCh) {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Resolver.TimeoutSeconds)*time.Second)
+	names, err := r.dnsConf.LookupAddr(ctx, ip)
+	cancel()
+
+	status := "success"
+	if err != nil {
+		if classifyError(err) != errClassNXDomain {
+			log.Printf("Error looking up PTR for %s: %v", ip, err)
+			r.recordMetric(func(m *metrics.Registry) {
+				m.ResolverPTRLookups.WithLabelValues("error").Inc()
+			})
+			return false
+		}
+		status = "not_found"
+	}
+	r.recordMetric(func(m *metrics.Registry) {
+		m.ResolverPTRLookups.WithLabelValues(status).Inc()
+	})
+
+	if err := r.db.UpsertIPPTR(ip, ptrName(names)); err != nil {
+		log.Printf("Error caching PTR for %s: %v", ip, err)
+		return false
+	}
+	return true
+}
+
+// ptrName returns the first PTR name without the trailing dot, or "" if there is none.
+func ptrName(names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	return strings.TrimSuffix(names[0], ".")
+}
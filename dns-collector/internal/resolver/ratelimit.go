@@ -0,0 +1,75 @@
+package resolver
+
+import (
+	"sync"
+	"time"
+)
+
+// tokenBucket is a simple token bucket limiter shared by all resolver workers.
+// A nil *tokenBucket imposes no limit.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens added per second
+	burst  float64 // bucket capacity
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket creates a limiter allowing qps operations per second with the given burst.
+// Returns nil (unlimited) when qps <= 0.
+func newTokenBucket(qps, burst int) *tokenBucket {
+	if qps <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   float64(qps),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// reserve takes a token if one is available, otherwise returns how long to wait for the next one.
+func (b *tokenBucket) reserve() (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second)), false
+}
+
+// Wait blocks until a token is available. Returns false if stopCh was closed first.
+func (b *tokenBucket) Wait(stopCh <-chan struct{}) bool {
+	if b == nil {
+		return true
+	}
+
+	for {
+		wait, ok := b.reserve()
+		if ok {
+			return true
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-stopCh:
+			timer.Stop()
+			return false
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package resolver
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewTokenBucket_Unlimited(t *testing.T) {
+	if b := newTokenBucket(0, 0); b != nil {
+		t.Error("Expected nil limiter for qps=0")
+	}
+
+	// A nil limiter never blocks
+	var b *tokenBucket
+	if !b.Wait(make(chan struct{})) {
+		t.Error("Expected nil limiter to allow immediately")
+	}
+}
+
+func TestTokenBucket_Burst(t *testing.T) {
+	b := newTokenBucket(10, 5)
+	stopCh := make(chan struct{})
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if !b.Wait(stopCh) {
+			t.Fatal("Expected Wait to succeed")
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("Expected burst of 5 to pass immediately, took %v", elapsed)
+	}
+}
+
+func TestTokenBucket_Rate(t *testing.T) {
+	b := newTokenBucket(20, 1)
+	stopCh := make(chan struct{})
+
+	// First token is available immediately, the next 4 take ~50ms each
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if !b.Wait(stopCh) {
+			t.Fatal("Expected Wait to succeed")
+		}
+	}
+
+	elapsed := time.Since(start)
+	if elapsed < 150*time.Millisecond {
+		t.Errorf("Expected rate limiting to take at least 150ms, took %v", elapsed)
+	}
+	if elapsed > time.Second {
+		t.Errorf("Rate limiting took too long: %v", elapsed)
+	}
+}
+
+func TestTokenBucket_StopUnblocks(t *testing.T) {
+	b := newTokenBucket(1, 1)
+	stopCh := make(chan struct{})
+
+	if !b.Wait(stopCh) {
+		t.Fatal("Expected first Wait to succeed")
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(stopCh)
+	}()
+
+	if b.Wait(stopCh) {
+		t.Error("Expected Wait to return false after stop")
+	}
+}
@@ -2,6 +2,7 @@ package resolver
 
 import (
 	"context"
+	"errors"
 	"log"
 	"net"
 	"strings"
@@ -9,154 +10,431 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/miekg/dns"
+
 	"dns-collector/internal/config"
 	"dns-collector/internal/database"
 	"dns-collector/internal/metrics"
+	"dns-collector/internal/policy"
 )
 
+// errSkippedByPolicy is the result of a lookup a domain's policy turned off
+var errSkippedByPolicy = errors.New("lookup skipped by policy")
+
 type Resolver struct {
 	cfg           *config.Config
-	db            *database.Database
+	db            database.Store
 	metrics       *metrics.Registry
-	ticker        *time.Ticker
 	stopCh        chan struct{}
 	wg            sync.WaitGroup
 	dnsConf       *net.Resolver
+	nameservers   []string  // servers of dnsConf, asked to tell NODATA from NXDOMAIN
+	cache         *dnsCache // shared DNS cache (nil = disabled)
 	activeWorkers int32
+
+	// Continuous scheduler state
+	queue      chan database.Domain // due domains waiting for a worker
+	priority   chan database.Domain // newly seen domains resolved ahead of the queue
+	limiter    *tokenBucket         // global upstream QPS cap (nil = unlimited)
+	inFlightMu sync.Mutex
+	inFlight   map[int64]struct{} // domains queued or being resolved
+
+	// Raw upstream queries for EDNS Client Subnet and DNSSEC
+	// (nil when neither vantage points nor DNSSEC checks are configured)
+	upstream *upstreamClient
+	vantages []vantage
+	dnssec   bool
+
+	// Per-domain resolution policies and the resolvers of their preferred upstreams
+	policies        *policy.Set
+	policyResolvers map[string]*net.Resolver
+
+	// Admin API state: pause gate and last run times (Unix nanoseconds)
+	pauseMu       sync.Mutex
+	resumeCh      chan struct{} // non-nil while paused, closed on resume
+	lastScheduled atomic.Int64
+	lastResolved  atomic.Int64
 }
 
-func NewResolver(cfg *config.Config, db *database.Database, m *metrics.Registry) *Resolver {
-	return &Resolver{
-		cfg:     cfg,
-		db:      db,
-		metrics: m,
-		stopCh:  make(chan struct{}),
-		dnsConf: &net.Resolver{
-			PreferGo: true,
-			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
-				d := net.Dialer{
-					Timeout: time.Duration(cfg.Resolver.TimeoutSeconds) * time.Second,
-				}
-				return d.DialContext(ctx, network, address)
-			},
+func NewResolver(cfg *config.Config, db database.Store, m *metrics.Registry) *Resolver {
+	nameservers, err := systemNameservers()
+	if err != nil {
+		log.Printf("Warning: names without addresses are reported as NXDOMAIN: %v", err)
+	}
+
+	timeout := time.Duration(cfg.Resolver.TimeoutSeconds) * time.Second
+	r := &Resolver{
+		cfg:         cfg,
+		db:          db,
+		metrics:     m,
+		stopCh:      make(chan struct{}),
+		nameservers: nameservers,
+		queue:       make(chan database.Domain, cfg.Resolver.Workers),
+		priority:    make(chan database.Domain, cfg.Resolver.PriorityQueueSize),
+		limiter:     newTokenBucket(cfg.Resolver.MaxQPS, cfg.Resolver.MaxQPS),
+		inFlight:    make(map[int64]struct{}),
+	}
+	if cfg.Resolver.Cache.Enabled {
+		r.cache = newDNSCache(cfg.Resolver.Cache, timeout, m)
+	}
+	r.dnsConf = newNetResolver(timeout, "", r.cache)
+
+	// EDNS Client Subnet and DNSSEC need an explicit upstream: the Go resolver
+	// can't attach EDNS options or expose the AD flag
+	r.vantages = parseVantagePoints(cfg.Resolver.VantagePoints)
+	r.dnssec = cfg.Resolver.DNSSEC
+	if len(r.vantages) > 0 || r.dnssec {
+		upstream := cfg.Resolver.Upstream
+		if upstream == "" {
+			var err error
+			if upstream, err = defaultUpstream(); err != nil {
+				log.Printf("Warning: EDNS Client Subnet and DNSSEC checks disabled: %v", err)
+				r.vantages = nil
+				r.dnssec = false
+			}
+		}
+		if len(r.vantages) > 0 || r.dnssec {
+			r.upstream = newUpstreamClient(upstream, timeout)
+		}
+	}
+
+	return r
+}
+
+// newNetResolver returns a Go resolver using server (host:port) for all queries,
+// or the resolv.conf nameservers if server is empty. With a cache, queries are
+// answered by the cache instead of a socket to the nameserver.
+func newNetResolver(timeout time.Duration, server string, cache *dnsCache) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			d := net.Dialer{
+				Timeout: timeout,
+			}
+			if server != "" {
+				address = server
+			}
+			if cache != nil {
+				return cache.dial(ctx, address), nil
+			}
+			return d.DialContext(ctx, network, address)
 		},
 	}
 }
 
+// SetPolicies registers the per-domain resolution policies. Must be called before Start.
+func (r *Resolver) SetPolicies(p *policy.Set) {
+	timeout := time.Duration(r.cfg.Resolver.TimeoutSeconds) * time.Second
+	r.policies = p
+	r.policyResolvers = make(map[string]*net.Resolver)
+	for _, upstream := range p.Upstreams() {
+		r.policyResolvers[upstream] = newNetResolver(timeout, upstream, r.cache)
+	}
+}
+
+// Start launches the worker pool and the scheduler that keeps it fed with due domains.
 func (r *Resolver) Start() {
-	interval := time.Duration(r.cfg.Resolver.IntervalSeconds) * time.Second
-	r.ticker = time.NewTicker(interval)
+	log.Printf("DNS resolver started (workers: %d, refresh interval: %ds, max QPS: %d)",
+		r.cfg.Resolver.Workers, r.cfg.Resolver.IntervalSeconds, r.cfg.Resolver.MaxQPS)
+
+	for i := 0; i < r.cfg.Resolver.Workers; i++ {
+		r.wg.Add(1)
+		go r.worker(i + 1)
+	}
+
+	r.wg.Add(2)
+	go r.schedule()
+	go r.reportBacklog()
 
-	log.Printf("DNS resolver started with interval: %v", interval)
+	if r.cache != nil {
+		log.Printf("DNS cache enabled (max entries: %d, max TTL: %ds, max negative TTL: %ds)",
+			r.cfg.Resolver.Cache.MaxEntries, r.cfg.Resolver.Cache.MaxTTLSeconds, r.cfg.Resolver.Cache.MaxNegativeTTLSeconds)
+	}
+
+	if r.cfg.Resolver.PTR.Enabled {
+		log.Printf("PTR resolver started (workers: %d, refresh: %dh)",
+			r.cfg.Resolver.PTR.Workers, r.cfg.Resolver.PTR.RefreshHours)
+		r.wg.Add(1)
+		go r.resolvePTRs()
+	}
+
+	if r.cfg.Resolver.Wildcard.Enabled {
+		log.Printf("Wildcard zone detection started (min siblings: %d, collapse: %v)",
+			r.cfg.Resolver.Wildcard.MinSiblings, r.cfg.Resolver.Wildcard.Collapse)
+		r.wg.Add(1)
+		go r.detectWildcards()
+	}
+}
 
-	// Run first resolution immediately
-	go r.runResolution()
+// schedule continuously moves due domains from the database into the worker queue.
+// When nothing new is due it sleeps for poll_seconds before looking again.
+func (r *Resolver) schedule() {
+	defer r.wg.Done()
 
-	// Start periodic resolution
-	go func() {
-		for {
+	pollInterval := time.Duration(r.cfg.Resolver.PollSeconds) * time.Second
+	for {
+		if !r.waitResumed() {
+			return // stopped
+		}
+		queued := r.fillQueue()
+		if queued < 0 {
+			return // stopped
+		}
+		if queued == 0 {
 			select {
-			case <-r.ticker.C:
-				go r.runResolution()
+			case <-time.After(pollInterval):
 			case <-r.stopCh:
 				return
 			}
 		}
-	}()
+	}
 }
 
-func (r *Resolver) runResolution() {
-	r.wg.Add(1)
-	defer r.wg.Done()
+// fillQueue fetches one batch of due domains and hands those not already in flight
+// to the workers. Returns the number of domains queued, or -1 if the resolver was stopped.
+func (r *Resolver) fillQueue() int {
+	select {
+	case <-r.stopCh:
+		return -1
+	default:
+	}
 
-	log.Println("Starting DNS resolution task")
+	// Claimed domains are leased to this instance, so keep the batch small:
+	// everything claimed here waits in the queue until a worker is free
+	batchSize := r.cfg.Resolver.Workers * 2
+	weights := r.cfg.Resolver.PriorityWeights
+	domains, err := r.db.ClaimDomainsToResolve(batchSize, r.cfg.Resolver.CyclicResolv,
+		r.cfg.Resolver.ResolvCooldownMins, r.refreshInterval(), r.leaseDuration(),
+		database.PriorityWeights{Popularity: weights.Popularity, Recency: weights.Recency, Staleness: weights.Staleness},
+		r.cfg.Resolver.Wildcard.Collapse)
+	if err != nil {
+		log.Printf("Error claiming domains to resolve: %v", err)
+		return 0
+	}
+	r.lastScheduled.Store(time.Now().UnixNano())
 
-	// Get domains that need to be resolved
-	// We'll process them in batches using worker pool
-	batchSize := r.cfg.Resolver.Workers * 10
-	cyclicMode := r.cfg.Resolver.CyclicResolv
-	cooldownMins := r.cfg.Resolver.ResolvCooldownMins
+	r.recordMetric(func(m *metrics.Registry) {
+		m.ResolverBatchSize.Set(float64(len(domains)))
+	})
 
-	domains, err := r.db.GetDomainsToResolve(batchSize, cyclicMode, cooldownMins)
-	if err != nil {
-		log.Printf("Error getting domains to resolve: %v", err)
-		return
+	queued := 0
+	for _, domain := range domains {
+		if !r.markInFlight(domain.ID) {
+			continue
+		}
+		select {
+		case r.queue <- domain:
+			queued++
+		case <-r.stopCh:
+			r.releaseInFlight(domain.ID)
+			return -1
+		}
 	}
 
-	if len(domains) == 0 {
-		log.Println("No domains to resolve")
+	return queued
+}
+
+// reportBacklog periodically publishes the number of due domains.
+func (r *Resolver) reportBacklog() {
+	defer r.wg.Done()
+
+	if r.metrics == nil {
 		return
 	}
 
-	log.Printf("Found %d domains to resolve", len(domains))
+	ticker := time.NewTicker(time.Duration(r.cfg.Resolver.PollSeconds) * time.Second)
+	defer ticker.Stop()
 
-	// Record batch size metric
-	r.recordMetric(func(m *metrics.Registry) {
-		m.ResolverBatchSize.Set(float64(len(domains)))
-	})
+	for {
+		backlog, err := r.db.CountDomainsToResolve(r.cfg.Resolver.CyclicResolv,
+			r.cfg.Resolver.ResolvCooldownMins, r.refreshInterval(), r.cfg.Resolver.Wildcard.Collapse)
+		if err != nil {
+			log.Printf("Error counting resolver backlog: %v", err)
+		} else {
+			r.metrics.ResolverBacklog.Set(float64(backlog))
+		}
 
-	// Create worker pool
-	domainCh := make(chan database.Domain, len(domains))
-	var wg sync.WaitGroup
+		select {
+		case <-ticker.C:
+		case <-r.stopCh:
+			return
+		}
+	}
+}
 
-	// Start workers
-	for i := 0; i < r.cfg.Resolver.Workers; i++ {
-		wg.Add(1)
-		go r.worker(i+1, domainCh, &wg)
+// ResolveNow offers a newly seen domain to the priority lane so it is resolved within
+// seconds instead of waiting for the scheduler. It never blocks: if the lane is full
+// the domain is left to the regular scheduler. Returns true if the domain was queued.
+func (r *Resolver) ResolveNow(domain database.Domain) bool {
+	if !r.markInFlight(domain.ID) {
+		return false // already queued or being resolved
 	}
 
-	// Send domains to workers
-	for _, domain := range domains {
-		domainCh <- domain
+	select {
+	case r.priority <- domain:
+		r.recordMetric(func(m *metrics.Registry) {
+			m.ResolverPriorityQueued.WithLabelValues("queued").Inc()
+		})
+		return true
+	default:
+		r.releaseInFlight(domain.ID)
+		r.recordMetric(func(m *metrics.Registry) {
+			m.ResolverPriorityQueued.WithLabelValues("dropped").Inc()
+		})
+		return false
 	}
-	close(domainCh)
+}
 
-	// Wait for all workers to finish
-	wg.Wait()
+// refreshInterval is the minimum time between two resolutions of the same domain.
+func (r *Resolver) refreshInterval() time.Duration {
+	return time.Duration(r.cfg.Resolver.IntervalSeconds) * time.Second
+}
 
-	// Reset batch size after completion
-	r.recordMetric(func(m *metrics.Registry) {
-		m.ResolverBatchSize.Set(0)
-		m.ResolverActiveWorkers.Set(0)
-	})
+// leaseDuration is how long claimed domains stay reserved for this instance.
+func (r *Resolver) leaseDuration() time.Duration {
+	return time.Duration(r.cfg.Resolver.LeaseSeconds) * time.Second
+}
 
-	log.Println("DNS resolution task completed")
+// markInFlight registers a domain as queued; returns false if it already is.
+func (r *Resolver) markInFlight(id int64) bool {
+	r.inFlightMu.Lock()
+	defer r.inFlightMu.Unlock()
+
+	if _, ok := r.inFlight[id]; ok {
+		return false
+	}
+	r.inFlight[id] = struct{}{}
+	return true
 }
 
-func (r *Resolver) worker(id int, domainCh <-chan database.Domain, wg *sync.WaitGroup) {
-	defer wg.Done()
+// releaseInFlight removes a domain from the in-flight set once it was resolved.
+func (r *Resolver) releaseInFlight(id int64) {
+	r.inFlightMu.Lock()
+	delete(r.inFlight, id)
+	r.inFlightMu.Unlock()
+}
 
-	// Track active workers
-	atomic.AddInt32(&r.activeWorkers, 1)
-	r.recordMetric(func(m *metrics.Registry) {
-		m.ResolverActiveWorkers.Set(float64(atomic.LoadInt32(&r.activeWorkers)))
-	})
-	defer func() {
-		atomic.AddInt32(&r.activeWorkers, -1)
-		r.recordMetric(func(m *metrics.Registry) {
-			m.ResolverActiveWorkers.Set(float64(atomic.LoadInt32(&r.activeWorkers)))
-		})
-	}()
+func (r *Resolver) worker(id int) {
+	defer r.wg.Done()
 
-	for domain := range domainCh {
+	streak := 0 // consecutive priority domains taken by this worker
+	for {
+		if !r.waitResumed() {
+			return
+		}
+		domain, priority, ok := r.nextDomain(&streak)
+		if !ok {
+			return
+		}
+
+		// Priority domains bypass ClaimDomainsToResolve; lease them so another
+		// instance that already picked the domain up keeps it
+		if priority && !r.claim(domain) {
+			r.releaseInFlight(domain.ID)
+			continue
+		}
+
+		r.setWorkerActive(1)
 		log.Printf("Worker %d: Resolving %s", id, domain.Domain)
 		r.resolveDomain(domain)
+		r.releaseInFlight(domain.ID)
+		r.setWorkerActive(-1)
 	}
 }
 
-func (r *Resolver) resolveDomain(domain database.Domain) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Resolver.TimeoutSeconds)*time.Second)
-	defer cancel()
+// nextDomain blocks until a domain is available for a worker. Priority domains go first,
+// but after priority_burst of them in a row a waiting routine domain is taken so a burst
+// of new domains cannot starve refreshes. Reports whether the domain came from the
+// priority lane; ok is false once the resolver is stopped.
+func (r *Resolver) nextDomain(streak *int) (domain database.Domain, priority bool, ok bool) {
+	select {
+	case <-r.stopCh:
+		return database.Domain{}, false, false
+	default:
+	}
+
+	if *streak < r.cfg.Resolver.PriorityBurst {
+		select {
+		case domain = <-r.priority:
+			*streak++
+			return domain, true, true
+		default:
+		}
+	}
+
+	select {
+	case domain = <-r.queue:
+		*streak = 0
+		return domain, false, true
+	default:
+	}
+
+	select {
+	case <-r.stopCh:
+		return database.Domain{}, false, false
+	case domain = <-r.priority:
+		*streak++
+		return domain, true, true
+	case domain = <-r.queue:
+		*streak = 0
+		return domain, false, true
+	}
+}
+
+// claim leases a single domain to this instance. On database errors the domain is
+// resolved anyway: a rare duplicate lookup is better than a stale export list.
+func (r *Resolver) claim(domain database.Domain) bool {
+	claimed, err := r.db.ClaimDomain(domain.ID, r.leaseDuration())
+	if err != nil {
+		log.Printf("Error claiming domain %s: %v", domain.Domain, err)
+		return true
+	}
+	return claimed
+}
+
+// setWorkerActive tracks the number of workers currently resolving a domain.
+func (r *Resolver) setWorkerActive(delta int32) {
+	active := atomic.AddInt32(&r.activeWorkers, delta)
+	r.recordMetric(func(m *metrics.Registry) {
+		m.ResolverActiveWorkers.Set(float64(active))
+	})
+}
+
+// resolveDomain looks up a domain's A and AAAA records, stores the answers and
+// updates the domain's resolution statistics. Returns the addresses found.
+func (r *Resolver) resolveDomain(domain database.Domain) Result {
+	var seen []string // IPs stored by this resolution
+	result := Result{Domain: domain.Domain}
+	defer func() { r.lastResolved.Store(time.Now().UnixNano()) }()
+	firstResolution := !domain.LastResolvTime.After(domain.TimeInsert)
+
+	// The domain's policy may pick another upstream and turn off AAAA lookups
+	dnsConf := r.dnsConf
+	nameservers := r.nameservers
+	ipv4Only := false
+	if p := r.policies.Match(domain.Domain); p != nil {
+		if p.Upstream != "" {
+			dnsConf = r.policyResolvers[p.Upstream]
+			nameservers = []string{p.Upstream}
+		}
+		ipv4Only = p.IPv4Only
+	}
 
-	hasResults := false
+	// Addresses stored per type, compared with the previous resolution below
+	lookups := map[string]*typeLookup{"ipv4": {}, "ipv6": {}}
 
 	// Resolve IPv4 addresses
+	if !r.limiter.Wait(r.stopCh) {
+		return result
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Resolver.TimeoutSeconds)*time.Second)
 	ipv4Start := time.Now()
-	ipv4Addrs, err := r.dnsConf.LookupIP(ctx, "ip4", domain.Domain)
+	ipv4Addrs, ipv4Err := dnsConf.LookupIP(ctx, "ip4", domain.Domain)
 	ipv4Duration := time.Since(ipv4Start).Seconds()
+	cancel()
 
-	if err != nil {
-		log.Printf("Error resolving IPv4 for %s: %v", domain.Domain, err)
+	if ipv4Err != nil {
+		log.Printf("Error resolving IPv4 for %s: %v", domain.Domain, ipv4Err)
 		r.recordMetric(func(m *metrics.Registry) {
 			m.ResolverLookups.WithLabelValues("ipv4", "error").Inc()
 			m.ResolverLookupDuration.WithLabelValues("ipv4").Observe(ipv4Duration)
@@ -168,57 +446,224 @@ func (r *Resolver) resolveDomain(domain database.Domain) {
 		})
 		for _, ip := range ipv4Addrs {
 			ipStr := ip.String()
-			if err := r.db.InsertOrUpdateIP(domain.ID, ipStr, "ipv4"); err != nil {
+			result.IPv4 = append(result.IPv4, ipStr)
+			if err := r.db.InsertOrUpdateIP(domain.ID, ipStr, "ipv4", database.SourceResolver); err != nil {
 				log.Printf("Error inserting IPv4 %s for domain %s: %v", ipStr, domain.Domain, err)
 			} else {
 				log.Printf("Resolved %s -> %s (IPv4)", domain.Domain, ipStr)
-				hasResults = true
+				seen = append(seen, ipStr)
+				lookups["ipv4"].ips = append(lookups["ipv4"].ips, ipStr)
 			}
 		}
 	}
 
 	// Resolve IPv6 addresses
-	ipv6Start := time.Now()
-	ipv6Addrs, err := r.dnsConf.LookupIP(ctx, "ip6", domain.Domain)
-	ipv6Duration := time.Since(ipv6Start).Seconds()
+	var ipv6Addrs []net.IP
+	ipv6Err := errSkippedByPolicy
+	ipv6Duration := 0.0
+	if !ipv4Only {
+		if !r.limiter.Wait(r.stopCh) {
+			return result
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Resolver.TimeoutSeconds)*time.Second)
+		ipv6Start := time.Now()
+		ipv6Addrs, ipv6Err = dnsConf.LookupIP(ctx, "ip6", domain.Domain)
+		ipv6Duration = time.Since(ipv6Start).Seconds()
+		cancel()
+	}
 
-	if err != nil {
-		log.Printf("Error resolving IPv6 for %s: %v", domain.Domain, err)
+	// With AAAA lookups turned off the domain fails or succeeds on its IPv4 lookup alone
+	if ipv6Err != nil && !ipv4Only {
+		log.Printf("Error resolving IPv6 for %s: %v", domain.Domain, ipv6Err)
 		r.recordMetric(func(m *metrics.Registry) {
 			m.ResolverLookups.WithLabelValues("ipv6", "error").Inc()
 			m.ResolverLookupDuration.WithLabelValues("ipv6").Observe(ipv6Duration)
 		})
-	} else {
+	} else if ipv6Err == nil {
 		r.recordMetric(func(m *metrics.Registry) {
 			m.ResolverLookups.WithLabelValues("ipv6", "success").Inc()
 			m.ResolverLookupDuration.WithLabelValues("ipv6").Observe(ipv6Duration)
 		})
 		for _, ip := range ipv6Addrs {
 			ipStr := ip.String()
-			if err := r.db.InsertOrUpdateIP(domain.ID, ipStr, "ipv6"); err != nil {
+			result.IPv6 = append(result.IPv6, ipStr)
+			if err := r.db.InsertOrUpdateIP(domain.ID, ipStr, "ipv6", database.SourceResolver); err != nil {
 				log.Printf("Error inserting IPv6 %s for domain %s: %v", ipStr, domain.Domain, err)
 			} else {
 				log.Printf("Resolved %s -> %s (IPv6)", domain.Domain, ipStr)
-				hasResults = true
+				seen = append(seen, ipStr)
+				lookups["ipv6"].ips = append(lookups["ipv6"].ips, ipStr)
 			}
 		}
 	}
 
+	// Resolve once more from every site's point of view; domains that failed
+	// outright are skipped so dead domains don't multiply upstream traffic
+	if ipv4Err == nil || ipv6Err == nil {
+		lookups["ipv4"].failed = ipv4Err != nil
+		lookups["ipv6"].failed = ipv6Err != nil
+		seen = append(seen, r.resolveVantages(domain, ipv4Only, lookups)...)
+
+		// Shift this resolution into the stability history of the domain's IPs and
+		// record a change event if the IP set differs from the previous resolution;
+		// only address types whose lookups all succeeded are compared, so a failed
+		// lookup doesn't report the addresses it would have returned as removed
+		if ipTypes, current := comparedIPs(lookups); len(ipTypes) > 0 {
+			r.recordIPResolution(domain, ipTypes, current)
+		}
+	}
+
+	if r.dnssec && (ipv4Err == nil || ipv6Err == nil) {
+		r.checkDNSSEC(domain)
+	}
+
 	// Update domain statistics even if resolution failed
-	// This ensures we don't keep trying to resolve non-existent domains
+	// A domain is failed only when both lookups errored; failed domains are
+	// postponed with exponential backoff so they don't take a worker slot every cycle.
+	// Domains without A/AAAA records (NODATA) exist and aren't failures.
 	cyclicMode := r.cfg.Resolver.CyclicResolv
-	if err := r.db.UpdateDomainResolvStats(domain.ID, cyclicMode); err != nil {
+	errClass := ""
+	if ipv4Err != nil && ipv6Err != nil {
+		lookupErrs := []error{ipv4Err}
+		if !ipv4Only {
+			lookupErrs = append(lookupErrs, ipv6Err)
+		}
+		errClass = r.failureClass(domain.Domain, nameservers, lookupErrs...)
+		result.Error = errClass
+	}
+	if errClass != "" && errClass != errClassNoData {
+		backoffBase := time.Duration(r.cfg.Resolver.BackoffBaseSeconds) * time.Second
+		backoffMax := time.Duration(r.cfg.Resolver.BackoffMaxSeconds) * time.Second
+		if err := r.db.UpdateDomainResolvFailure(domain.ID, cyclicMode, errClass, backoffBase, backoffMax); err != nil {
+			log.Printf("Error updating domain failure stats for %s: %v", domain.Domain, err)
+		}
+		r.recordMetric(func(m *metrics.Registry) {
+			m.ResolverFailures.WithLabelValues(errClass).Inc()
+		})
+	} else if err := r.db.UpdateDomainResolvStats(domain.ID, cyclicMode); err != nil {
 		log.Printf("Error updating domain stats for %s: %v", domain.Domain, err)
 	}
 
 	// Record domain processed metric
 	status := "success"
-	if !hasResults {
+	if errClass == errClassNoData {
+		status = errClassNoData
+		log.Printf("No A/AAAA records for %s (NODATA)", domain.Domain)
+	} else if len(seen) == 0 {
 		status = "no_results"
 		log.Printf("No IP addresses resolved for %s", domain.Domain)
 	}
 	r.recordMetric(func(m *metrics.Registry) {
 		m.ResolverDomainsProcessed.WithLabelValues(status).Inc()
+		if firstResolution {
+			m.ResolverFirstResolution.Observe(time.Since(domain.TimeInsert).Seconds())
+		}
+	})
+
+	return result
+}
+
+// typeLookup is the outcome of the lookups of one address type in a resolution
+type typeLookup struct {
+	ips    []string // addresses stored
+	failed bool     // a lookup of the type failed (or wasn't made)
+}
+
+// comparedIPs returns the address types whose lookups all succeeded and the
+// addresses stored for them, in a fixed order
+func comparedIPs(lookups map[string]*typeLookup) (ipTypes, ips []string) {
+	for _, ipType := range []string{"ipv4", "ipv6"} {
+		if l := lookups[ipType]; l != nil && !l.failed {
+			ipTypes = append(ipTypes, ipType)
+			ips = append(ips, l.ips...)
+		}
+	}
+	return ipTypes, ips
+}
+
+// recordIPResolution records a resolution in the stability history of the domain's
+// IPs of ipTypes and logs the change of its IP set, if any
+func (r *Resolver) recordIPResolution(domain database.Domain, ipTypes, ips []string) {
+	change, err := r.db.RecordIPResolution(domain.ID, ipTypes, ips)
+	if err != nil {
+		log.Printf("Error recording IP history for %s: %v", domain.Domain, err)
+	} else if change != nil {
+		log.Printf("IP set of %s changed: added %v, removed %v", domain.Domain, change.Added, change.Removed)
+		r.recordMetric(func(m *metrics.Registry) {
+			m.ResolverIPChanges.Inc()
+		})
+	}
+}
+
+// resolveVantages resolves a domain with the EDNS Client Subnet of every vantage point
+// and stores the IPs together with the vantage that returned them. The stored IPs
+// and failed lookups are added to lookups by address type; an address already in
+// lookups counts once towards its seen_count however many vantages return it.
+// Returns the stored IPs.
+func (r *Resolver) resolveVantages(domain database.Domain, ipv4Only bool, lookups map[string]*typeLookup) []string {
+	var seen []string
+	counted := make(map[string]bool)
+	for _, l := range lookups {
+		for _, ip := range l.ips {
+			counted[ip] = true
+		}
+	}
+	for _, v := range r.vantages {
+		for _, q := range []struct {
+			qtype  uint16
+			ipType string
+		}{{dns.TypeA, "ipv4"}, {dns.TypeAAAA, "ipv6"}} {
+			if ipv4Only && q.qtype == dns.TypeAAAA {
+				continue
+			}
+			if !r.limiter.Wait(r.stopCh) {
+				return seen
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Resolver.TimeoutSeconds)*time.Second)
+			ips, err := r.upstream.lookupECS(ctx, domain.Domain, q.qtype, v.subnet)
+			cancel()
+
+			status := "success"
+			if err != nil {
+				status = "error"
+				lookups[q.ipType].failed = true
+				log.Printf("Error resolving %s for %s via vantage %s: %v", q.ipType, domain.Domain, v.name, err)
+			}
+			r.recordMetric(func(m *metrics.Registry) {
+				m.ResolverECSLookups.WithLabelValues(v.name, q.ipType, status).Inc()
+			})
+
+			for _, ip := range ips {
+				ipStr := ip.String()
+				if err := r.db.InsertOrUpdateIPVantage(domain.ID, ipStr, q.ipType, v.name, counted[ipStr]); err != nil {
+					log.Printf("Error inserting %s %s for domain %s (vantage %s): %v", q.ipType, ipStr, domain.Domain, v.name, err)
+				} else {
+					counted[ipStr] = true
+					seen = append(seen, ipStr)
+					lookups[q.ipType].ips = append(lookups[q.ipType].ips, ipStr)
+				}
+			}
+		}
+	}
+	return seen
+}
+
+// checkDNSSEC records the domain's DNSSEC validation status as reported by the upstream.
+func (r *Resolver) checkDNSSEC(domain database.Domain) {
+	if !r.limiter.Wait(r.stopCh) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Resolver.TimeoutSeconds)*time.Second)
+	status := r.upstream.dnssecStatus(ctx, domain.Domain)
+	cancel()
+
+	if err := r.db.UpdateDomainDNSSECStatus(domain.ID, status); err != nil {
+		log.Printf("Error updating DNSSEC status for %s: %v", domain.Domain, err)
+	}
+	r.recordMetric(func(m *metrics.Registry) {
+		m.ResolverDNSSECChecks.WithLabelValues(status).Inc()
 	})
 }
 
@@ -238,9 +683,6 @@ func (r *Resolver) resolveCNAME(domain string) (string, error) {
 func (r *Resolver) Stop() {
 	log.Println("Stopping DNS resolver...")
 	close(r.stopCh)
-	if r.ticker != nil {
-		r.ticker.Stop()
-	}
 	r.wg.Wait()
 	log.Println("DNS resolver stopped")
 }
@@ -302,3 +302,205 @@ func TestTickerInterval(t *testing.T) {
 		// Expected - ticker hasn't fired yet
 	}
 }
+
+func TestInFlightDeduplication(t *testing.T) {
+	cfg := &config.Config{
+		Resolver: config.ResolverConfig{
+			TimeoutSeconds: 5,
+			Workers:        2,
+		},
+	}
+
+	resolver := NewResolver(cfg, nil, nil)
+
+	if !resolver.markInFlight(1) {
+		t.Error("Expected first mark to succeed")
+	}
+	if resolver.markInFlight(1) {
+		t.Error("Expected duplicate mark to be rejected while in flight")
+	}
+
+	resolver.releaseInFlight(1)
+
+	if !resolver.markInFlight(1) {
+		t.Error("Expected mark to succeed after release")
+	}
+}
+
+func TestWorkerStopsOnStopChannel(t *testing.T) {
+	cfg := &config.Config{
+		Resolver: config.ResolverConfig{
+			TimeoutSeconds: 5,
+			Workers:        1,
+		},
+	}
+
+	resolver := NewResolver(cfg, nil, nil)
+
+	resolver.wg.Add(1)
+	go resolver.worker(1)
+	close(resolver.stopCh)
+
+	done := make(chan struct{})
+	go func() {
+		resolver.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Worker did not stop after stopCh was closed")
+	}
+}
+
+func TestResolveNow(t *testing.T) {
+	cfg := &config.Config{
+		Resolver: config.ResolverConfig{
+			TimeoutSeconds:    5,
+			Workers:           1,
+			PriorityQueueSize: 1,
+			PriorityBurst:     4,
+		},
+	}
+
+	resolver := NewResolver(cfg, nil, nil)
+
+	if !resolver.ResolveNow(database.Domain{ID: 1, Domain: "new.example.com."}) {
+		t.Error("Expected new domain to be queued")
+	}
+	if resolver.ResolveNow(database.Domain{ID: 1, Domain: "new.example.com."}) {
+		t.Error("Expected duplicate domain to be rejected")
+	}
+	if resolver.ResolveNow(database.Domain{ID: 2, Domain: "other.example.com."}) {
+		t.Error("Expected domain to be dropped when the priority lane is full")
+	}
+
+	// Dropped domain must be left for the regular scheduler
+	if !resolver.markInFlight(2) {
+		t.Error("Expected dropped domain to be released from in-flight set")
+	}
+}
+
+func TestNextDomainPriorityBurst(t *testing.T) {
+	cfg := &config.Config{
+		Resolver: config.ResolverConfig{
+			TimeoutSeconds:    5,
+			Workers:           1,
+			PriorityQueueSize: 10,
+			PriorityBurst:     2,
+		},
+	}
+
+	resolver := NewResolver(cfg, nil, nil)
+
+	for i := int64(1); i <= 3; i++ {
+		resolver.priority <- database.Domain{ID: i}
+	}
+	resolver.queue <- database.Domain{ID: 100}
+
+	// Two priority domains, then the routine one, then priority again
+	expected := []int64{1, 2, 100, 3}
+	streak := 0
+	for _, want := range expected {
+		domain, priority, ok := resolver.nextDomain(&streak)
+		if !ok {
+			t.Fatal("Expected a domain")
+		}
+		if domain.ID != want {
+			t.Errorf("Expected domain %d, got %d", want, domain.ID)
+		}
+		if priority != (want != 100) {
+			t.Errorf("Expected priority=%v for domain %d", want != 100, want)
+		}
+	}
+
+	close(resolver.stopCh)
+	if _, _, ok := resolver.nextDomain(&streak); ok {
+		t.Error("Expected nextDomain to return false after stop")
+	}
+}
+
+func TestPTRName(t *testing.T) {
+	tests := []struct {
+		name     string
+		names    []string
+		expected string
+	}{
+		{"no record", nil, ""},
+		{"single name", []string{"edge-1.example.net."}, "edge-1.example.net"},
+		{"first of several", []string{"a.example.net.", "b.example.net."}, "a.example.net"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ptrName(tt.names); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	cfg := &config.Config{
+		Resolver: config.ResolverConfig{
+			TimeoutSeconds: 5,
+			Workers:        1,
+		},
+	}
+
+	resolver := NewResolver(cfg, nil, nil)
+
+	if resolver.Paused() {
+		t.Fatal("Expected new resolver not to be paused")
+	}
+
+	resolver.Pause()
+	resolver.Pause() // idempotent
+	if !resolver.Paused() {
+		t.Fatal("Expected resolver to be paused")
+	}
+
+	resumed := make(chan bool)
+	go func() { resumed <- resolver.waitResumed() }()
+
+	select {
+	case <-resumed:
+		t.Fatal("Expected waitResumed to block while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	resolver.Resume()
+	select {
+	case ok := <-resumed:
+		if !ok {
+			t.Error("Expected waitResumed to return true after Resume")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waitResumed did not return after Resume")
+	}
+
+	// A paused resolver must still stop
+	resolver.Pause()
+	close(resolver.stopCh)
+	if resolver.waitResumed() {
+		t.Error("Expected waitResumed to return false after Stop")
+	}
+}
+
+func TestResolveDomain_InvalidName(t *testing.T) {
+	cfg := &config.Config{
+		Resolver: config.ResolverConfig{
+			TimeoutSeconds: 5,
+			Workers:        1,
+		},
+	}
+
+	resolver := NewResolver(cfg, nil, nil)
+
+	for _, name := range []string{"", ".", "bad..example.com"} {
+		if _, err := resolver.ResolveDomain(name); err != ErrInvalidDomain {
+			t.Errorf("ResolveDomain(%q): expected ErrInvalidDomain, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// defaultUpstream returns the first nameserver from /etc/resolv.conf.
+func defaultUpstream() (string, error) {
+	conf, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+	if err != nil {
+		return "", fmt.Errorf("failed to read resolv.conf: %w", err)
+	}
+	if len(conf.Servers) == 0 {
+		return "", fmt.Errorf("no nameservers in resolv.conf")
+	}
+	return net.JoinHostPort(conf.Servers[0], conf.Port), nil
+}
+
+// upstreamClient sends raw DNS queries to a single upstream server. It is used where
+// the Go resolver can't help: EDNS options (client subnet) and DNSSEC flags.
+type upstreamClient struct {
+	udp      *dns.Client
+	tcp      *dns.Client
+	upstream string
+}
+
+func newUpstreamClient(upstream string, timeout time.Duration) *upstreamClient {
+	return &upstreamClient{
+		udp:      &dns.Client{Net: "udp", Timeout: timeout},
+		tcp:      &dns.Client{Net: "tcp", Timeout: timeout},
+		upstream: upstream,
+	}
+}
+
+// exchange sends a query over UDP and retries truncated answers over TCP.
+func (c *upstreamClient) exchange(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
+	resp, _, err := c.udp.ExchangeContext(ctx, msg, c.upstream)
+	if err == nil && resp.Truncated {
+		resp, _, err = c.tcp.ExchangeContext(ctx, msg, c.upstream)
+	}
+	return resp, err
+}
@@ -0,0 +1,118 @@
+package resolver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"strings"
+	"time"
+
+	"dns-collector/internal/metrics"
+)
+
+// Results of wildcard probes
+const (
+	wildcardYes   = "wildcard"
+	wildcardNo    = "not_wildcard"
+	wildcardError = "error"
+)
+
+// detectWildcards runs in the background and flags parent zones that answer every
+// subdomain. Every wildcard.poll_seconds it marks new children of known wildcard zones
+// and probes the zones whose children share identical IP sets.
+func (r *Resolver) detectWildcards() {
+	defer r.wg.Done()
+
+	pollInterval := time.Duration(r.cfg.Resolver.Wildcard.PollSeconds) * time.Second
+	for {
+		r.detectWildcardBatch()
+
+		select {
+		case <-time.After(pollInterval):
+		case <-r.stopCh:
+			return
+		}
+	}
+}
+
+// detectWildcardBatch probes one batch of candidate zones and records the results.
+func (r *Resolver) detectWildcardBatch() {
+	wcCfg := r.cfg.Resolver.Wildcard
+
+	if marked, err := r.db.MarkWildcardChildren(); err != nil {
+		log.Printf("Error marking wildcard children: %v", err)
+	} else if marked > 0 {
+		log.Printf("Wildcard detection: marked %d new domains under known wildcard zones", marked)
+	}
+
+	checkedBefore := time.Now().Add(-time.Duration(wcCfg.CheckHours) * time.Hour)
+	zones, err := r.db.GetWildcardCandidates(wcCfg.MinSiblings, checkedBefore, wcCfg.BatchSize)
+	if err != nil {
+		log.Printf("Error getting wildcard candidates: %v", err)
+		return
+	}
+
+	for _, zone := range zones {
+		select {
+		case <-r.stopCh:
+			return
+		default:
+		}
+
+		wildcard, err := r.probeWildcard(zone)
+		result := wildcardNo
+		switch {
+		case err != nil:
+			result = wildcardError
+		case wildcard:
+			result = wildcardYes
+		}
+		r.recordMetric(func(m *metrics.Registry) {
+			m.ResolverWildcardProbes.WithLabelValues(result).Inc()
+		})
+		if err != nil {
+			// Inconclusive: leave the zone to be probed again on the next pass
+			log.Printf("Error probing %s for a wildcard: %v", zone, err)
+			continue
+		}
+
+		updated, err := r.db.RecordWildcardProbe(zone, wildcard)
+		if err != nil {
+			log.Printf("Error recording wildcard probe of %s: %v", zone, err)
+			continue
+		}
+		if wildcard {
+			log.Printf("Wildcard zone %s detected, %d domains marked", zone, updated)
+		} else if updated > 0 {
+			log.Printf("Zone %s is no longer wildcard, %d domains unmarked", zone, updated)
+		}
+	}
+}
+
+// probeWildcard resolves a random label under zone. A zone is wildcard when the label
+// resolves and not wildcard on NXDOMAIN; other errors are returned.
+func (r *Resolver) probeWildcard(zone string) (bool, error) {
+	if !r.limiter.Wait(r.stopCh) {
+		return false, context.Canceled
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(r.cfg.Resolver.TimeoutSeconds)*time.Second)
+	defer cancel()
+
+	ips, err := r.dnsConf.LookupIP(ctx, "ip4", probeName(zone))
+	if err != nil {
+		if classifyError(err) == errClassNXDomain {
+			return false, nil
+		}
+		return false, err
+	}
+	return len(ips) > 0, nil
+}
+
+// probeName returns a fully qualified random subdomain of zone that is unlikely to exist.
+func probeName(zone string) string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return "wc-" + hex.EncodeToString(b) + "." + strings.TrimSuffix(zone, ".") + "."
+}
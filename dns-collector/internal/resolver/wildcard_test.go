@@ -0,0 +1,111 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"dns-collector/internal/config"
+)
+
+// startWildcardServer starts a local DNS server where every name under
+// wild.example.com resolves and everything else is NXDOMAIN.
+func startWildcardServer(t *testing.T) string {
+	t.Helper()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	mux := dns.NewServeMux()
+	mux.HandleFunc(".", func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+
+		name := req.Question[0].Name
+		switch {
+		case name == "broken.example.com." || strings.HasSuffix(name, ".broken.example.com."):
+			resp.Rcode = dns.RcodeServerFailure
+		case strings.HasSuffix(name, ".wild.example.com."):
+			if req.Question[0].Qtype == dns.TypeA {
+				resp.Answer = append(resp.Answer, &dns.A{
+					Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+					A:   net.IPv4(10, 0, 0, 1),
+				})
+			}
+		default:
+			resp.Rcode = dns.RcodeNameError
+		}
+		_ = w.WriteMsg(resp)
+	})
+
+	server := &dns.Server{PacketConn: pc, Handler: mux}
+	go func() { _ = server.ActivateAndServe() }()
+	t.Cleanup(func() { _ = server.Shutdown() })
+
+	return pc.LocalAddr().String()
+}
+
+func TestProbeWildcard(t *testing.T) {
+	addr := startWildcardServer(t)
+	cfg := &config.Config{
+		Resolver: config.ResolverConfig{TimeoutSeconds: 2},
+	}
+	resolver := &Resolver{
+		cfg:    cfg,
+		stopCh: make(chan struct{}),
+		dnsConf: &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				d := net.Dialer{Timeout: 2 * time.Second}
+				return d.DialContext(ctx, "udp", addr)
+			},
+		},
+	}
+
+	tests := []struct {
+		zone        string
+		expected    bool
+		expectError bool
+	}{
+		{"wild.example.com", true, false},
+		{"wild.example.com.", true, false},
+		{"plain.example.com", false, false},
+		{"broken.example.com", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.zone, func(t *testing.T) {
+			wildcard, err := resolver.probeWildcard(tt.zone)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error for an inconclusive probe")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if wildcard != tt.expected {
+				t.Errorf("Expected wildcard=%v, got %v", tt.expected, wildcard)
+			}
+		})
+	}
+}
+
+func TestProbeName(t *testing.T) {
+	first := probeName("example.com.")
+	second := probeName("example.com")
+
+	if !strings.HasSuffix(first, ".example.com.") || !strings.HasSuffix(second, ".example.com.") {
+		t.Errorf("Expected fully qualified names under example.com, got %s and %s", first, second)
+	}
+	if first == second {
+		t.Error("Expected random labels to differ")
+	}
+}
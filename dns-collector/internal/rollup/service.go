@@ -0,0 +1,153 @@
+package rollup
+
+import (
+	"log"
+	"time"
+
+	"dns-collector/internal/config"
+	"dns-collector/internal/metrics"
+)
+
+// settleDelay is how long after the end of an hour its statistics are rolled up,
+// so inserts still in flight at the hour boundary are included
+const settleDelay = time.Minute
+
+// Store is the part of the database used by the rollup service
+type Store interface {
+	RollUpHourlyStats(upTo time.Time, maxHours int) (time.Time, int64, error)
+	RollUpDailyStats(upTo time.Time, maxDays int) (time.Time, int64, error)
+}
+
+// Service maintains the hourly and daily rollups of query statistics. Every interval
+// the complete hours since the last run are aggregated into domain_stat_hourly and the
+// complete days into domain_stat_daily. A backlog (e.g. existing statistics on the
+// first run) is worked off in batches of batchHours.
+type Service struct {
+	db         Store
+	metrics    *metrics.Registry
+	interval   time.Duration
+	batchHours int
+	now        func() time.Time
+	stopChan   chan struct{}
+	doneChan   chan struct{}
+}
+
+func NewService(cfg *config.Config, db Store, m *metrics.Registry) *Service {
+	return &Service{
+		db:         db,
+		metrics:    m,
+		interval:   time.Duration(cfg.Rollup.IntervalMinutes) * time.Minute,
+		batchHours: cfg.Rollup.BatchHours,
+		now:        time.Now,
+		stopChan:   make(chan struct{}),
+		doneChan:   make(chan struct{}),
+	}
+}
+
+func (s *Service) Start() {
+	log.Printf("Starting statistics rollups (interval: %s, batch: %d hours)", s.interval, s.batchHours)
+	go s.run()
+}
+
+func (s *Service) Stop() {
+	log.Println("Stopping statistics rollups...")
+	close(s.stopChan)
+	<-s.doneChan
+	log.Println("Statistics rollups stopped")
+}
+
+func (s *Service) run() {
+	defer close(s.doneChan)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.rollUp()
+
+		select {
+		case <-ticker.C:
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+// rollUp brings the hourly rollup up to the last complete hour and the daily
+// rollup up to the last day completely covered by the hourly one.
+func (s *Service) rollUp() {
+	now := s.now()
+	upTo := now.Add(-settleDelay)
+
+	var hourly time.Time
+	var hourlyRows int64
+	for {
+		if s.stopping() {
+			return
+		}
+
+		watermark, rows, err := s.db.RollUpHourlyStats(upTo, s.batchHours)
+		if err != nil {
+			log.Printf("Error rolling up hourly stats: %v", err)
+			return
+		}
+		hourlyRows += rows
+		s.recordMetric(func(m *metrics.Registry) {
+			m.RollupRows.WithLabelValues("hourly").Add(float64(rows))
+			m.RollupLag.WithLabelValues("hourly").Set(now.Sub(watermark).Seconds())
+		})
+
+		// Done when the watermark stops moving (reached the last complete hour)
+		if watermark.Equal(hourly) {
+			break
+		}
+		hourly = watermark
+	}
+
+	var daily time.Time
+	var dailyRows int64
+	batchDays := max(s.batchHours/24, 1)
+	for {
+		if s.stopping() {
+			return
+		}
+
+		watermark, rows, err := s.db.RollUpDailyStats(hourly, batchDays)
+		if err != nil {
+			log.Printf("Error rolling up daily stats: %v", err)
+			return
+		}
+		dailyRows += rows
+		s.recordMetric(func(m *metrics.Registry) {
+			m.RollupRows.WithLabelValues("daily").Add(float64(rows))
+			m.RollupLag.WithLabelValues("daily").Set(now.Sub(watermark).Seconds())
+		})
+
+		if watermark.Equal(daily) {
+			break
+		}
+		daily = watermark
+	}
+
+	if hourlyRows > 0 || dailyRows > 0 {
+		log.Printf("Stats rollup: %d hourly and %d daily rows (rolled up to %s / %s)",
+			hourlyRows, dailyRows, hourly.Format(time.DateTime), daily.Format(time.DateTime))
+	}
+}
+
+// stopping reports whether Stop was called
+func (s *Service) stopping() bool {
+	select {
+	case <-s.stopChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// recordMetric safely records a metric if metrics are enabled.
+func (s *Service) recordMetric(f func(m *metrics.Registry)) {
+	if s.metrics != nil {
+		f(s.metrics)
+	}
+}
@@ -0,0 +1,114 @@
+package rollup
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"dns-collector/internal/config"
+)
+
+// mockStore advances its watermarks like the database: by at most the batch size
+// and never past the limit
+type mockStore struct {
+	hourly      time.Time
+	daily       time.Time
+	hourlyCalls int
+	dailyCalls  int
+	dailyUpTo   time.Time
+	err         error
+}
+
+func (m *mockStore) RollUpHourlyStats(upTo time.Time, maxHours int) (time.Time, int64, error) {
+	m.hourlyCalls++
+	if m.err != nil {
+		return time.Time{}, 0, m.err
+	}
+	limit := upTo.Truncate(time.Hour)
+	next := m.hourly.Add(time.Duration(maxHours) * time.Hour)
+	if next.After(limit) {
+		next = limit
+	}
+	if !next.After(m.hourly) {
+		return m.hourly, 0, nil
+	}
+	m.hourly = next
+	return m.hourly, 10, nil
+}
+
+func (m *mockStore) RollUpDailyStats(upTo time.Time, maxDays int) (time.Time, int64, error) {
+	m.dailyCalls++
+	m.dailyUpTo = upTo
+	limit := upTo.Truncate(24 * time.Hour)
+	next := m.daily.AddDate(0, 0, maxDays)
+	if next.After(limit) {
+		next = limit
+	}
+	if !next.After(m.daily) {
+		return m.daily, 0, nil
+	}
+	m.daily = next
+	return m.daily, 1, nil
+}
+
+func newTestService(store *mockStore, now time.Time) *Service {
+	cfg := &config.Config{Rollup: config.RollupConfig{Enabled: true, IntervalMinutes: 5, BatchHours: 24}}
+	s := NewService(cfg, store, nil)
+	s.now = func() time.Time { return now }
+	return s
+}
+
+func TestRollUp_Backlog(t *testing.T) {
+	now := time.Date(2024, 1, 15, 13, 30, 0, 0, time.UTC)
+	store := &mockStore{
+		hourly: time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC),
+		daily:  time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC),
+	}
+
+	newTestService(store, now).rollUp()
+
+	expectedHourly := time.Date(2024, 1, 15, 13, 0, 0, 0, time.UTC)
+	if !store.hourly.Equal(expectedHourly) {
+		t.Errorf("Expected hourly watermark %v, got %v", expectedHourly, store.hourly)
+	}
+	// 3 days and 13 hours in batches of 24 hours, plus the call that makes no progress
+	if store.hourlyCalls != 5 {
+		t.Errorf("Expected 5 hourly rollup calls, got %d", store.hourlyCalls)
+	}
+
+	expectedDaily := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	if !store.daily.Equal(expectedDaily) {
+		t.Errorf("Expected daily watermark %v, got %v", expectedDaily, store.daily)
+	}
+	if !store.dailyUpTo.Equal(expectedHourly) {
+		t.Errorf("Expected daily rollup up to the hourly watermark, got %v", store.dailyUpTo)
+	}
+}
+
+func TestRollUp_SettleDelay(t *testing.T) {
+	// Right after the hour the previous hour is not rolled up yet
+	now := time.Date(2024, 1, 15, 14, 0, 30, 0, time.UTC)
+	store := &mockStore{
+		hourly: time.Date(2024, 1, 15, 13, 0, 0, 0, time.UTC),
+		daily:  time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC),
+	}
+
+	newTestService(store, now).rollUp()
+
+	if !store.hourly.Equal(time.Date(2024, 1, 15, 13, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected hourly watermark to stay at 13:00, got %v", store.hourly)
+	}
+}
+
+func TestRollUp_HourlyError(t *testing.T) {
+	store := &mockStore{err: errors.New("connection refused")}
+
+	newTestService(store, time.Now()).rollUp()
+
+	if store.hourlyCalls != 1 {
+		t.Errorf("Expected 1 hourly rollup call, got %d", store.hourlyCalls)
+	}
+	if store.dailyCalls != 0 {
+		t.Errorf("Expected daily rollup to be skipped, got %d calls", store.dailyCalls)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"dns-collector/internal/config"
 	"dns-collector/internal/database"
 	"dns-collector/internal/metrics"
+	"dns-collector/internal/policy"
 )
 
 type DNSQuery struct {
@@ -17,17 +18,36 @@ type DNSQuery struct {
 	Domain   string `json:"domain"`
 	QType    string `json:"qtype"`
 	RType    string `json:"rtype"`
+
+	// A/AAAA addresses of the answer sent to the client (optional, passive capture)
+	Answers []string `json:"answers,omitempty"`
 }
 
 type UDPServer struct {
 	cfg     *config.Config
-	db      *database.Database
+	db      database.Store
 	metrics *metrics.Registry
 	conn    *net.UDPConn
 	stopCh  chan struct{}
+
+	// onNewDomain is called for domains seen for the first time (e.g. priority resolution)
+	onNewDomain func(domain database.Domain) bool
+
+	// policies assigns resolution settings to new domains (nil = default policy for all)
+	policies *policy.Set
+
+	// statsSink receives the query statistics instead of domain_stat (e.g. ClickHouse)
+	statsSink StatsSink
+	// keepDBStats also writes domain_stat while a stats sink is set
+	keepDBStats bool
 }
 
-func NewUDPServer(cfg *config.Config, db *database.Database, m *metrics.Registry) *UDPServer {
+// StatsSink is an external store of raw query statistics
+type StatsSink interface {
+	WriteQuery(domain, clientIP, qtype, rtype string, t time.Time) bool
+}
+
+func NewUDPServer(cfg *config.Config, db database.Store, m *metrics.Registry) *UDPServer {
 	return &UDPServer{
 		cfg:     cfg,
 		db:      db,
@@ -36,6 +56,25 @@ func NewUDPServer(cfg *config.Config, db *database.Database, m *metrics.Registry
 	}
 }
 
+// SetNewDomainHandler registers a callback invoked for every newly inserted domain.
+// Must be called before Start.
+func (s *UDPServer) SetNewDomainHandler(h func(domain database.Domain) bool) {
+	s.onNewDomain = h
+}
+
+// SetPolicies registers the resolution policy rules applied to new domains.
+// Must be called before Start.
+func (s *UDPServer) SetPolicies(p *policy.Set) {
+	s.policies = p
+}
+
+// SetStatsSink sends the query statistics to sink; domain_stat is only written as
+// well if keepDatabase is set. Must be called before Start.
+func (s *UDPServer) SetStatsSink(sink StatsSink, keepDatabase bool) {
+	s.statsSink = sink
+	s.keepDBStats = keepDatabase
+}
+
 func (s *UDPServer) Start() error {
 	addr := &net.UDPAddr{
 		Port: s.cfg.Server.UDPPort,
@@ -116,29 +155,47 @@ func (s *UDPServer) handleMessage(data []byte) {
 	if query.ClientIP == "" {
 		query.ClientIP = "unknown"
 	}
+	if query.QType == "" {
+		query.QType = "unknown"
+	}
 	if query.RType == "" {
 		query.RType = "unknown"
 	}
 
-	log.Printf("Received DNS query: domain=%s, client=%s, rtype=%s", query.Domain, query.ClientIP, query.RType)
+	log.Printf("Received DNS query: domain=%s, client=%s, qtype=%s, rtype=%s", query.Domain, query.ClientIP, query.QType, query.RType)
 
 	// Insert statistics
-	if err := s.db.InsertDomainStat(query.Domain, query.ClientIP, query.RType); err != nil {
-		log.Printf("Error inserting domain stat: %v", err)
+	if s.statsSink != nil {
+		s.statsSink.WriteQuery(query.Domain, query.ClientIP, query.QType, query.RType, start)
+	}
+	if s.statsSink == nil || s.keepDBStats {
+		if err := s.db.InsertDomainStat(query.Domain, query.ClientIP, query.QType, query.RType); err != nil {
+			log.Printf("Error inserting domain stat: %v", err)
+		}
 	}
 
 	// Insert or get domain
-	domain, isNew, err := s.db.InsertOrGetDomain(query.Domain, s.cfg.Resolver.MaxResolv)
+	domainPolicy := policy.DomainPolicy(s.policies.Match(query.Domain), s.cfg.Resolver.MaxResolv)
+	domain, isNew, err := s.db.InsertOrGetDomain(query.Domain, domainPolicy)
 	if err != nil {
 		log.Printf("Error inserting domain: %v", err)
 		return
 	}
 
+	// Hand new domains to the resolver right away so their IPs show up within seconds;
+	// domains whose policy forbids resolution (max_resolv = 0) are only recorded
+	if isNew && s.onNewDomain != nil && domain.MaxResolv > 0 {
+		s.onNewDomain(*domain)
+	}
+
 	// Update last_seen timestamp to track when domain was last queried
 	if err := s.db.UpdateDomainLastSeen(domain.ID); err != nil {
 		log.Printf("Error updating domain last_seen: %v", err)
 	}
 
+	// Record the addresses the DNS server answered with
+	s.recordAnswers(domain, query.Answers)
+
 	// Record metrics
 	s.recordMetric(func(m *metrics.Registry) {
 		m.ServerMessagesReceived.WithLabelValues("valid").Inc()
@@ -150,6 +207,36 @@ func (s *UDPServer) handleMessage(data []byte) {
 	})
 }
 
+// recordAnswers stores the answer addresses of a query as passive observations of the domain's IPs
+func (s *UDPServer) recordAnswers(domain *database.Domain, answers []string) {
+	for _, answer := range answers {
+		ip, ipType, ok := parseAnswer(answer)
+		if !ok {
+			log.Printf("Invalid answer address %q for %s", answer, domain.Domain)
+			continue
+		}
+		if err := s.db.InsertOrUpdateIP(domain.ID, ip, ipType, database.SourcePassive); err != nil {
+			log.Printf("Error inserting passive IP %s for domain %s: %v", ip, domain.Domain, err)
+			continue
+		}
+		s.recordMetric(func(m *metrics.Registry) {
+			m.ServerPassiveIPs.WithLabelValues(ipType).Inc()
+		})
+	}
+}
+
+// parseAnswer returns the canonical form and type (ipv4 or ipv6) of an answer address
+func parseAnswer(answer string) (string, string, bool) {
+	ip := net.ParseIP(answer)
+	if ip == nil {
+		return "", "", false
+	}
+	if ip.To4() != nil {
+		return ip.String(), "ipv4", true
+	}
+	return ip.String(), "ipv6", true
+}
+
 // trimInvalidJSONSuffix removes trailing garbage that may corrupt JSON parsing
 func trimInvalidJSONSuffix(data []byte) []byte {
 	// Try to find the first valid JSON object by iterating and testing
@@ -3,21 +3,23 @@ package server
 import (
 	"encoding/json"
 	"testing"
+	"time"
 
 	"dns-collector/internal/config"
+	"dns-collector/internal/database"
 )
 
 // MockDatabase for testing server
 type MockDatabase struct {
-	InsertDomainStatFunc   func(domain, clientIP, rtype string) error
+	InsertDomainStatFunc   func(domain, clientIP, qtype, rtype string) error
 	InsertOrGetDomainFunc  func(domain string, maxResolv int) (interface{}, error)
 	DeleteOldStatsFunc     func(retentionDays int) (int64, error)
 	CloseFunc              func() error
 }
 
-func (m *MockDatabase) InsertDomainStat(domain, clientIP, rtype string) error {
+func (m *MockDatabase) InsertDomainStat(domain, clientIP, qtype, rtype string) error {
 	if m.InsertDomainStatFunc != nil {
-		return m.InsertDomainStatFunc(domain, clientIP, rtype)
+		return m.InsertDomainStatFunc(domain, clientIP, qtype, rtype)
 	}
 	return nil
 }
@@ -68,6 +70,55 @@ func TestNewUDPServer(t *testing.T) {
 	_ = mockDB
 }
 
+func TestSetNewDomainHandler(t *testing.T) {
+	server := NewUDPServer(&config.Config{}, nil, nil)
+	if server.onNewDomain != nil {
+		t.Error("Expected no new domain handler by default")
+	}
+
+	var got string
+	server.SetNewDomainHandler(func(domain database.Domain) bool {
+		got = domain.Domain
+		return true
+	})
+
+	if server.onNewDomain == nil {
+		t.Fatal("Expected new domain handler to be set")
+	}
+	server.onNewDomain(database.Domain{ID: 1, Domain: "example.com."})
+	if got != "example.com." {
+		t.Errorf("Expected handler to receive example.com., got %q", got)
+	}
+}
+
+// recordingSink collects the domains written to it
+type recordingSink struct {
+	domains []string
+}
+
+func (r *recordingSink) WriteQuery(domain, clientIP, qtype, rtype string, t time.Time) bool {
+	r.domains = append(r.domains, domain)
+	return true
+}
+
+func TestSetStatsSink(t *testing.T) {
+	server := NewUDPServer(&config.Config{}, nil, nil)
+	if server.statsSink != nil {
+		t.Error("Expected no stats sink by default")
+	}
+
+	sink := &recordingSink{}
+	server.SetStatsSink(sink, true)
+
+	if server.statsSink != sink || !server.keepDBStats {
+		t.Fatal("Expected stats sink to be set with keepDBStats")
+	}
+	server.statsSink.WriteQuery("example.com.", "192.168.1.1", "A", "cache", time.Now())
+	if len(sink.domains) != 1 || sink.domains[0] != "example.com." {
+		t.Errorf("Expected sink to receive example.com., got %v", sink.domains)
+	}
+}
+
 func TestDNSQuery_JSONParsing(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -137,7 +188,7 @@ func TestHandleMessage_ValidQuery(t *testing.T) {
 	domainCalled := false
 
 	mockDB := &MockDatabase{
-		InsertDomainStatFunc: func(domain, clientIP, rtype string) error {
+		InsertDomainStatFunc: func(domain, clientIP, qtype, rtype string) error {
 			statCalled = true
 			if domain != "example.com" {
 				t.Errorf("Expected domain=example.com, got %s", domain)
@@ -353,3 +404,37 @@ func TestTrimInvalidJSONSuffix_RealWorldCases(t *testing.T) {
 		})
 	}
 }
+
+func TestDNSQuery_Answers(t *testing.T) {
+	var query DNSQuery
+	data := `{"client_ip":"192.168.0.50","domain":"example.com.","qtype":"A","rtype":"reply","answers":["93.184.216.34","2606:2800:220:1::1"]}`
+	if err := json.Unmarshal([]byte(data), &query); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(query.Answers) != 2 {
+		t.Fatalf("Expected 2 answers, got %d", len(query.Answers))
+	}
+}
+
+func TestParseAnswer(t *testing.T) {
+	tests := []struct {
+		answer     string
+		expectedIP string
+		ipType     string
+		ok         bool
+	}{
+		{"93.184.216.34", "93.184.216.34", "ipv4", true},
+		{"2606:2800:220:0001::1", "2606:2800:220:1::1", "ipv6", true},
+		{"::ffff:192.0.2.1", "192.0.2.1", "ipv4", true},
+		{"example.com.", "", "", false},
+		{"", "", "", false},
+	}
+
+	for _, tt := range tests {
+		ip, ipType, ok := parseAnswer(tt.answer)
+		if ok != tt.ok || ip != tt.expectedIP || ipType != tt.ipType {
+			t.Errorf("parseAnswer(%q) = %q, %q, %v; want %q, %q, %v",
+				tt.answer, ip, ipType, ok, tt.expectedIP, tt.ipType, tt.ok)
+		}
+	}
+}
@@ -10,7 +10,27 @@ UDP_PORT = 5353
 
 sock = None
 
-def send_udp(rtype, qinfo, **kwargs):
+def answer_ips(rep):
+    """Return the A/AAAA addresses of the answer section (passive IP capture)."""
+    ips = []
+    if rep is None:
+        return ips
+    try:
+        for i in range(0, rep.an_numrrsets):
+            rrset = rep.rrsets[i]
+            rtype = rrset.rk.type_str
+            data = rrset.entry.data
+            for j in range(0, data.count):
+                rr = data.rr_data[j]  # 2-byte rdlength prefix followed by rdata
+                if rtype == "A" and len(rr) == 6:
+                    ips.append(socket.inet_ntop(socket.AF_INET, rr[2:6]))
+                elif rtype == "AAAA" and len(rr) == 18:
+                    ips.append(socket.inet_ntop(socket.AF_INET6, rr[2:18]))
+    except Exception as e:
+        log_info("Failed to read answer IPs: " + str(e))
+    return ips
+
+def send_udp(rtype, qinfo, rep=None, **kwargs):
     global sock
     if sock is None:
         try:
@@ -41,6 +61,9 @@ def send_udp(rtype, qinfo, **kwargs):
         "qtype": qtype,
         "rtype": rtype,
     }
+    answers = answer_ips(rep)
+    if answers:
+        msg["answers"] = answers
     #log_info("python: msg " + json.dumps(msg))
     try:
         sock.sendto(json.dumps(msg).encode(), (UDP_IP, UDP_PORT))
@@ -72,7 +95,7 @@ def inplace_reply_callback(qinfo, qstate, rep, rcode, edns, opt_list_out,
     :return: True on success, False on failure.
 
     """
-    send_udp("reply", qinfo, **kwargs)
+    send_udp("reply", qinfo, rep, **kwargs)
     return True
 
 
@@ -103,7 +126,7 @@ def inplace_cache_callback(qinfo, qstate, rep, rcode, edns, opt_list_out, region
 
     """
     
-    send_udp("cache", qinfo, **kwargs)
+    send_udp("cache", qinfo, rep, **kwargs)
     return True
 
 def inplace_query_callback(qinfo, flags, qstate, addr, zone, region, **kwargs):
@@ -148,7 +171,7 @@ def inplace_local_callback(qinfo, qstate, rep, rcode, edns, opt_list_out, region
 
     """
 
-    send_udp("reply", qinfo, **kwargs)
+    send_udp("reply", qinfo, rep, **kwargs)
     return True
 
 def inform_super(id, qstate, superqstate, qdata):
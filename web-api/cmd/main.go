@@ -9,6 +9,7 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"syscall"
 	"time"
@@ -20,6 +21,7 @@ import (
 	"dns-collector-webapi/internal/database"
 	"dns-collector-webapi/internal/handlers"
 	"dns-collector-webapi/internal/metrics"
+	"dns-collector-webapi/internal/models"
 )
 
 type Config struct {
@@ -28,6 +30,8 @@ type Config struct {
 		Host string `yaml:"host"`
 	} `yaml:"server"`
 	Database struct {
+		Driver   string `yaml:"driver"` // postgres (default) or sqlite, as configured for the collector
+		Path     string `yaml:"path"`   // SQLite database file of the collector
 		Host     string `yaml:"host"`
 		Port     int    `yaml:"port"`
 		User     string `yaml:"user"`
@@ -42,8 +46,16 @@ type Config struct {
 		AllowedOrigins   []string `yaml:"allowed_origins"`
 		AllowCredentials bool     `yaml:"allow_credentials"`
 	} `yaml:"cors"`
-	Metrics     MetricsConfig      `yaml:"metrics"`
-	ExportLists []ExportListConfig `yaml:"export_lists"`
+	Metrics         MetricsConfig             `yaml:"metrics"`
+	ExportLists     []ExportListConfig        `yaml:"export_lists"`
+	PriorityWeights models.PriorityWeights    `yaml:"priority_weights"` // should match the collector's resolver.priority_weights
+	Stats           StatsConfig               `yaml:"stats"`
+	ClickHouse      database.ClickHouseConfig `yaml:"clickhouse"` // raw query statistics written by the collector
+}
+
+// StatsConfig controls how aggregate statistics are queried
+type StatsConfig struct {
+	RollupMinHours int `yaml:"rollup_min_hours"` // Shortest range answered from the hourly/daily rollups
 }
 
 type MetricsConfig struct {
@@ -62,6 +74,13 @@ type ExportListConfig struct {
 	ExcludeSharedIPs     *bool  `yaml:"exclude_shared_ips,omitempty"`
 	ExcludedIPsEndpoint  string `yaml:"excluded_ips_endpoint,omitempty"`
 	AdditionalIPsFile    string `yaml:"additional_ips_file,omitempty"`
+	CollapseWildcards    bool   `yaml:"collapse_wildcards,omitempty"` // list children of wildcard zones once, as their zone
+	Vantage              string `yaml:"vantage,omitempty"` // only IPs returned for this vantage point (empty = all IPs)
+	ASNs                 []int64  `yaml:"asns,omitempty"`         // only IPs announced by these ASNs
+	ExcludeASNs          []int64  `yaml:"exclude_asns,omitempty"` // drop IPs announced by these ASNs
+	Countries            []string `yaml:"countries,omitempty"`    // only IPs located in these countries (ISO 3166-1 alpha-2)
+	MinSeen              int      `yaml:"min_seen,omitempty"`     // only IPs returned in at least min_seen of the last seen_window resolutions
+	SeenWindow           int      `yaml:"seen_window,omitempty"`  // resolutions considered by min_seen (1-32)
 }
 
 // GetIncludeIPv4 returns the value of IncludeIPv4 or default (true)
@@ -88,6 +107,9 @@ func (c *ExportListConfig) GetExcludeSharedIPs() bool {
 	return *c.ExcludeSharedIPs
 }
 
+// identifierRe matches plain SQL identifiers (ClickHouse database and table names)
+var identifierRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
 func loadConfig(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -107,6 +129,18 @@ func loadConfig(path string) (*Config, error) {
 		cfg.Server.Host = "0.0.0.0"
 	}
 
+	// Validate storage backend
+	switch cfg.Database.Driver {
+	case "", "postgres":
+		cfg.Database.Driver = "postgres"
+	case "sqlite":
+		if cfg.Database.Path == "" {
+			cfg.Database.Path = "data/dns-collector.db"
+		}
+	default:
+		return nil, fmt.Errorf("invalid database driver: %s (expected postgres or sqlite)", cfg.Database.Driver)
+	}
+
 	// Set defaults for metrics
 	if cfg.Metrics.Path == "" {
 		cfg.Metrics.Path = "/metrics"
@@ -120,6 +154,40 @@ func loadConfig(path string) (*Config, error) {
 		cfg.Metrics.InfluxDB.Token = envToken
 	}
 
+	// Validate domain priority weights (all zero = collector defaults)
+	w := cfg.PriorityWeights
+	if w.Popularity < 0 || w.Recency < 0 || w.Staleness < 0 {
+		return nil, fmt.Errorf("priority_weights must not be negative")
+	}
+	if w.Popularity == 0 && w.Recency == 0 && w.Staleness == 0 {
+		cfg.PriorityWeights = models.DefaultPriorityWeights()
+	}
+
+	// Set defaults for aggregate statistics
+	if cfg.Stats.RollupMinHours <= 0 {
+		cfg.Stats.RollupMinHours = 48
+	}
+
+	// Set defaults for the ClickHouse statistics store
+	if envPassword := os.Getenv("CLICKHOUSE_PASSWORD"); envPassword != "" {
+		cfg.ClickHouse.Password = envPassword
+	}
+	if cfg.ClickHouse.Enabled && cfg.ClickHouse.URL == "" {
+		return nil, fmt.Errorf("clickhouse requires url")
+	}
+	if cfg.ClickHouse.Database == "" {
+		cfg.ClickHouse.Database = "dns_collector"
+	}
+	if cfg.ClickHouse.Table == "" {
+		cfg.ClickHouse.Table = "domain_stat"
+	}
+	if !identifierRe.MatchString(cfg.ClickHouse.Database) || !identifierRe.MatchString(cfg.ClickHouse.Table) {
+		return nil, fmt.Errorf("invalid clickhouse database or table name: %s.%s", cfg.ClickHouse.Database, cfg.ClickHouse.Table)
+	}
+	if cfg.ClickHouse.TimeoutSeconds <= 0 {
+		cfg.ClickHouse.TimeoutSeconds = 30
+	}
+
 	// Validate export lists configuration
 	if err := validateExportLists(cfg.ExportLists); err != nil {
 		return nil, fmt.Errorf("invalid export lists configuration: %w", err)
@@ -193,6 +261,22 @@ func validateExportLists(lists []ExportListConfig) error {
 			}
 		}
 
+		// Validate countries (stored upper-case by the collector)
+		for j, country := range list.Countries {
+			if len(country) != 2 {
+				return fmt.Errorf("export list '%s': invalid country code '%s'", list.Name, country)
+			}
+			list.Countries[j] = strings.ToUpper(country)
+		}
+
+		// Validate IP stability filter (the collector keeps the last 32 resolutions)
+		if list.MinSeen < 0 || list.SeenWindow < 0 {
+			return fmt.Errorf("export list '%s': min_seen and seen_window must be non-negative", list.Name)
+		}
+		if list.MinSeen > 0 && (list.SeenWindow < list.MinSeen || list.SeenWindow > 32) {
+			return fmt.Errorf("export list '%s': seen_window must be between min_seen and 32", list.Name)
+		}
+
 		// Validate additional_ips_file
 		if list.AdditionalIPsFile != "" {
 			// Must be absolute path
@@ -217,6 +301,30 @@ func validateExportLists(lists []ExportListConfig) error {
 	return nil
 }
 
+// openDatabase connects to the storage backend selected by database.driver
+func openDatabase(cfg *Config) (database.Backend, error) {
+	if cfg.Database.Driver == "sqlite" {
+		db, err := database.NewSQLite(cfg.Database.Path)
+		if err != nil {
+			return nil, err
+		}
+		return db, nil
+	}
+
+	db, err := database.New(
+		cfg.Database.Host,
+		cfg.Database.Port,
+		cfg.Database.User,
+		cfg.Database.Password,
+		cfg.Database.Database,
+		cfg.Database.SSLMode,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
 func main() {
 	configPath := flag.String("config", "config/config.yaml", "Path to configuration file")
 	flag.Parse()
@@ -245,14 +353,7 @@ func main() {
 	}
 
 	// Initialize database
-	db, err := database.New(
-		cfg.Database.Host,
-		cfg.Database.Port,
-		cfg.Database.User,
-		cfg.Database.Password,
-		cfg.Database.Database,
-		cfg.Database.SSLMode,
-	)
+	db, err := openDatabase(cfg)
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
@@ -262,7 +363,7 @@ func main() {
 		}
 	}()
 
-	log.Println("Database connected successfully")
+	log.Printf("Database connected successfully (%s)", cfg.Database.Driver)
 
 	// Run database migrations
 	log.Println("Running database migrations...")
@@ -271,6 +372,15 @@ func main() {
 	}
 	log.Println("Migrations completed successfully")
 
+	db.SetPriorityWeights(cfg.PriorityWeights)
+	db.SetRollupThreshold(time.Duration(cfg.Stats.RollupMinHours) * time.Hour)
+
+	// Serve raw statistics from ClickHouse if the collector writes them there
+	if cfg.ClickHouse.Enabled {
+		db = database.WithClickHouseStats(db, database.NewClickHouseStats(cfg.ClickHouse))
+		log.Printf("Raw statistics served from ClickHouse (%s.%s)", cfg.ClickHouse.Database, cfg.ClickHouse.Table)
+	}
+
 	// Initialize handlers
 	h := handlers.NewHandler(db)
 
@@ -322,19 +432,35 @@ func main() {
 	{
 		api.GET("/stats", h.GetStats)
 		api.GET("/stats/export", h.ExportStats)
+		api.GET("/stats/aggregate", h.GetStatsAggregate)
 		api.GET("/domains", h.GetDomains)
 		api.GET("/domains/export", h.ExportDomains)
 		api.GET("/domains/:id", h.GetDomainByID)
+		api.GET("/domains/:id/history", h.GetDomainHistory)
+		api.GET("/changes", h.GetIPChanges)
 	}
 
 	// Register export list endpoints
 	for _, exportList := range cfg.ExportLists {
 		// Capture loop variables to avoid closure issues
-		domainRegex := exportList.DomainRegex
+		opts := models.ExportOptions{
+			DomainRegex:       exportList.DomainRegex,
+			IncludeIPv4:       exportList.GetIncludeIPv4(),
+			IncludeIPv6:       exportList.GetIncludeIPv6(),
+			ExcludeSharedIPs:  exportList.GetExcludeSharedIPs(),
+			CollapseWildcards: exportList.CollapseWildcards,
+			Vantage:           exportList.Vantage,
+			Geo: models.GeoFilter{
+				ASNs:        exportList.ASNs,
+				ExcludeASNs: exportList.ExcludeASNs,
+				Countries:   exportList.Countries,
+			},
+			Stability: models.StabilityFilter{
+				MinSeen: exportList.MinSeen,
+				Window:  exportList.SeenWindow,
+			},
+		}
 		includeDomains := exportList.IncludeDomains
-		includeIPv4 := exportList.GetIncludeIPv4()
-		includeIPv6 := exportList.GetIncludeIPv6()
-		excludeSharedIPs := exportList.GetExcludeSharedIPs()
 		additionalIPsFile := exportList.AdditionalIPsFile
 		endpoint := exportList.Endpoint
 		excludedEndpoint := exportList.ExcludedIPsEndpoint
@@ -342,14 +468,7 @@ func main() {
 
 		// Register main export endpoint
 		router.GET(endpoint, func(c *gin.Context) {
-			h.ExportList(c,
-				domainRegex,
-				includeDomains,
-				includeIPv4,
-				includeIPv6,
-				excludeSharedIPs,
-				additionalIPsFile,
-			)
+			h.ExportList(c, opts, includeDomains, additionalIPsFile)
 		})
 		log.Printf("Registered export list '%s' at %s", listName, endpoint)
 
@@ -357,9 +476,9 @@ func main() {
 		if excludedEndpoint != "" {
 			router.GET(excludedEndpoint, func(c *gin.Context) {
 				h.ExportExcludedIPs(c,
-					domainRegex,
-					includeIPv4,
-					includeIPv6,
+					opts.DomainRegex,
+					opts.IncludeIPv4,
+					opts.IncludeIPv6,
 				)
 			})
 			log.Printf("Registered excluded IPs endpoint for '%s' at %s", listName, excludedEndpoint)
@@ -4,6 +4,8 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+
+	"dns-collector-webapi/internal/models"
 )
 
 func TestValidateExportLists_Success(t *testing.T) {
@@ -154,6 +156,58 @@ func TestValidateExportLists_InvalidEndpoint(t *testing.T) {
 	}
 }
 
+func TestValidateExportLists_Countries(t *testing.T) {
+	lists := []ExportListConfig{
+		{
+			Name:           "Test List",
+			Endpoint:       "/export/test",
+			DomainRegex:    ".*",
+			IncludeDomains: true,
+			Countries:      []string{"de", "US"},
+		},
+	}
+
+	if err := validateExportLists(lists); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if lists[0].Countries[0] != "DE" || lists[0].Countries[1] != "US" {
+		t.Errorf("Expected countries to be upper-cased, got %v", lists[0].Countries)
+	}
+
+	lists[0].Countries = []string{"Germany"}
+	err := validateExportLists(lists)
+	expectedMsg := "invalid country code"
+	if err == nil || !contains(err.Error(), expectedMsg) {
+		t.Errorf("Expected error containing '%s', got: %v", expectedMsg, err)
+	}
+}
+
+func TestValidateExportLists_Stability(t *testing.T) {
+	lists := []ExportListConfig{
+		{
+			Name:           "Test List",
+			Endpoint:       "/export/test",
+			DomainRegex:    ".*",
+			IncludeDomains: true,
+			MinSeen:        3,
+			SeenWindow:     5,
+		},
+	}
+
+	if err := validateExportLists(lists); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	for _, window := range []int{0, 2, 33} {
+		lists[0].SeenWindow = window
+		err := validateExportLists(lists)
+		expectedMsg := "seen_window must be between min_seen and 32"
+		if err == nil || !contains(err.Error(), expectedMsg) {
+			t.Errorf("seen_window=%d: expected error containing '%s', got: %v", window, expectedMsg, err)
+		}
+	}
+}
+
 func TestValidateExportLists_EmptyList(t *testing.T) {
 	lists := []ExportListConfig{}
 
@@ -270,6 +324,88 @@ cors:
 	if cfg.Server.Host != "0.0.0.0" {
 		t.Errorf("Expected default host 0.0.0.0, got %s", cfg.Server.Host)
 	}
+	if cfg.PriorityWeights != models.DefaultPriorityWeights() {
+		t.Errorf("Expected default priority weights, got %+v", cfg.PriorityWeights)
+	}
+}
+
+func TestLoadConfig_NegativePriorityWeight(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.yaml")
+
+	configContent := `database:
+  host: "localhost"
+priority_weights:
+  popularity: -1
+`
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to create temp config: %v", err)
+	}
+
+	_, err := loadConfig(configPath)
+	if err == nil {
+		t.Fatal("Expected error for negative priority weight, got nil")
+	}
+	if !contains(err.Error(), "priority_weights") {
+		t.Errorf("Expected priority_weights error, got: %v", err)
+	}
+}
+
+func TestLoadConfig_DatabaseDriver(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.yaml")
+
+	if err := os.WriteFile(configPath, []byte("database:\n  driver: sqlite\n"), 0644); err != nil {
+		t.Fatalf("Failed to create temp config: %v", err)
+	}
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if cfg.Database.Path != "data/dns-collector.db" {
+		t.Errorf("Expected default SQLite path, got %s", cfg.Database.Path)
+	}
+
+	if err := os.WriteFile(configPath, []byte("database:\n  driver: mysql\n"), 0644); err != nil {
+		t.Fatalf("Failed to create temp config: %v", err)
+	}
+	_, err = loadConfig(configPath)
+	if err == nil || !contains(err.Error(), "invalid database driver") {
+		t.Errorf("Expected invalid database driver error, got: %v", err)
+	}
+}
+
+func TestLoadConfig_ClickHouse(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "config.yaml")
+
+	t.Setenv("CLICKHOUSE_PASSWORD", "secret")
+	if err := os.WriteFile(configPath, []byte("clickhouse:\n  enabled: true\n  url: \"http://clickhouse:8123\"\n"), 0644); err != nil {
+		t.Fatalf("Failed to create temp config: %v", err)
+	}
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if cfg.ClickHouse.Database != "dns_collector" || cfg.ClickHouse.Table != "domain_stat" || cfg.ClickHouse.Password != "secret" {
+		t.Errorf("Unexpected ClickHouse config %+v", cfg.ClickHouse)
+	}
+
+	if err := os.WriteFile(configPath, []byte("clickhouse:\n  enabled: true\n"), 0644); err != nil {
+		t.Fatalf("Failed to create temp config: %v", err)
+	}
+	_, err = loadConfig(configPath)
+	if err == nil || !contains(err.Error(), "clickhouse requires url") {
+		t.Errorf("Expected missing url error, got: %v", err)
+	}
+
+	if err := os.WriteFile(configPath, []byte("clickhouse:\n  table: \"stats; DROP TABLE x\"\n"), 0644); err != nil {
+		t.Fatalf("Failed to create temp config: %v", err)
+	}
+	_, err = loadConfig(configPath)
+	if err == nil || !contains(err.Error(), "invalid clickhouse") {
+		t.Errorf("Expected invalid table name error, got: %v", err)
+	}
 }
 
 func TestLoadConfig_FileNotFound(t *testing.T) {
@@ -0,0 +1,228 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"dns-collector-webapi/internal/models"
+)
+
+// clickHouseTimeFormat is the text format of DateTime64(6) values (UTC)
+const clickHouseTimeFormat = "2006-01-02 15:04:05.999999"
+
+// ClickHouseConfig is the ClickHouse table the collector writes raw query statistics
+// to (clickhouse section of the collector config)
+type ClickHouseConfig struct {
+	Enabled        bool   `yaml:"enabled"`
+	URL            string `yaml:"url"` // HTTP interface, e.g. http://clickhouse:8123
+	Database       string `yaml:"database"`
+	Table          string `yaml:"table"`
+	User           string `yaml:"user"`
+	Password       string `yaml:"password"`
+	TimeoutSeconds int    `yaml:"timeout_seconds"`
+}
+
+// ClickHouseStats answers raw statistics queries from ClickHouse over its HTTP
+// interface. Filter values are sent as query parameters, never spliced into the SQL.
+type ClickHouseStats struct {
+	cfg    ClickHouseConfig
+	client *http.Client
+}
+
+func NewClickHouseStats(cfg ClickHouseConfig) *ClickHouseStats {
+	return &ClickHouseStats{
+		cfg:    cfg,
+		client: &http.Client{Timeout: time.Duration(cfg.TimeoutSeconds) * time.Second},
+	}
+}
+
+// clickHouseRow is a domain_stat row as returned with FORMAT JSONEachRow
+type clickHouseRow struct {
+	Domain    string  `json:"domain"`
+	ClientIP  *string `json:"client_ip"`
+	QType     string  `json:"qtype"`
+	RType     string  `json:"rtype"`
+	Timestamp string  `json:"timestamp"`
+}
+
+// GetStats retrieves raw query statistics like Database.GetStats. ClickHouse rows
+// have no id; ID is always 0 and sorting by id sorts by timestamp.
+func (c *ClickHouseStats) GetStats(filter models.StatsFilter) ([]models.DomainStat, int64, error) {
+	where := " WHERE 1=1"
+	params := url.Values{}
+	param := func(typ, value string) string {
+		name := fmt.Sprintf("p%d", len(params)+1)
+		params.Set("param_"+name, value)
+		return fmt.Sprintf("{%s:%s}", name, typ)
+	}
+
+	// Apply client IP filters
+	if len(filter.ClientIPs) > 0 || filter.Subnet != "" {
+		var ipConditions []string
+
+		if len(filter.ClientIPs) > 0 {
+			ips, unknown, err := splitClientIPs(filter.ClientIPs)
+			if err != nil {
+				return nil, 0, err
+			}
+			if len(ips) > 0 {
+				placeholders := make([]string, len(ips))
+				for i, ip := range ips {
+					placeholders[i] = param("String", ip)
+				}
+				ipConditions = append(ipConditions, fmt.Sprintf("client_ip IN (%s)", strings.Join(placeholders, ",")))
+			}
+			if unknown {
+				ipConditions = append(ipConditions, "client_ip IS NULL")
+			}
+		}
+
+		if filter.Subnet != "" {
+			if _, _, err := net.ParseCIDR(filter.Subnet); err != nil {
+				return nil, 0, fmt.Errorf("invalid subnet format: %w", err)
+			}
+			ipConditions = append(ipConditions, fmt.Sprintf(
+				"(client_ip IS NOT NULL AND isIPAddressInRange(assumeNotNull(client_ip), %s))", param("String", filter.Subnet)))
+		}
+
+		if len(ipConditions) > 0 {
+			where += " AND (" + strings.Join(ipConditions, " OR ") + ")"
+		}
+	}
+
+	// Apply date filters
+	if !filter.DateFrom.IsZero() {
+		where += " AND timestamp >= " + param("DateTime64(6, 'UTC')", filter.DateFrom.UTC().Format(clickHouseTimeFormat))
+	}
+	if !filter.DateTo.IsZero() {
+		where += " AND timestamp <= " + param("DateTime64(6, 'UTC')", filter.DateTo.UTC().Format(clickHouseTimeFormat))
+	}
+
+	table := c.cfg.Database + "." + c.cfg.Table
+
+	// Get total count
+	body, err := c.query("SELECT count() FROM "+table+where+" FORMAT TabSeparated", params)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count stats: %w", err)
+	}
+	total, err := strconv.ParseInt(strings.TrimSpace(string(body)), 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to parse stats count: %w", err)
+	}
+
+	// Apply sorting
+	validSortFields := map[string]bool{
+		"domain": true, "client_ip": true, "qtype": true, "rtype": true, "timestamp": true,
+	}
+	sortBy := "timestamp"
+	if filter.SortBy != "" && validSortFields[filter.SortBy] {
+		sortBy = filter.SortBy
+	}
+
+	sortOrder := "DESC"
+	if filter.SortOrder == "asc" {
+		sortOrder = "ASC"
+	}
+
+	// Apply pagination
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 100 // Default limit
+	}
+	offset := max(filter.Offset, 0)
+
+	query := fmt.Sprintf(
+		"SELECT domain, client_ip, qtype, rtype, timestamp FROM %s%s ORDER BY %s %s LIMIT %d OFFSET %d FORMAT JSONEachRow",
+		table, where, sortBy, sortOrder, limit, offset,
+	)
+	body, err = c.query(query, params)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query stats: %w", err)
+	}
+
+	var stats []models.DomainStat
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var row clickHouseRow
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan stat: %w", err)
+		}
+		ts, err := time.ParseInLocation(clickHouseTimeFormat, row.Timestamp, time.UTC)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to parse stat timestamp: %w", err)
+		}
+
+		s := models.DomainStat{
+			Domain:    row.Domain,
+			ClientIP:  UnknownClientIP,
+			QType:     row.QType,
+			RType:     row.RType,
+			Timestamp: ts.Local(),
+		}
+		if row.ClientIP != nil {
+			s.ClientIP = *row.ClientIP
+		}
+		stats = append(stats, s)
+	}
+
+	return stats, total, scanner.Err()
+}
+
+// query runs a read-only query over the HTTP interface and returns the response body
+func (c *ClickHouseStats) query(query string, params url.Values) ([]byte, error) {
+	values := url.Values{"query": {query}}
+	for k, v := range params {
+		values[k] = v
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(c.cfg.URL, "/")+"/?"+values.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if c.cfg.User != "" {
+		req.Header.Set("X-ClickHouse-User", c.cfg.User)
+		req.Header.Set("X-ClickHouse-Key", c.cfg.Password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach ClickHouse: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ClickHouse response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ClickHouse returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+// clickHouseBackend answers GetStats from ClickHouse and everything else from the
+// wrapped backend
+type clickHouseBackend struct {
+	Backend
+	stats *ClickHouseStats
+}
+
+// WithClickHouseStats routes the raw statistics queries of b to ClickHouse.
+// Aggregates keep being served from the rollups of b.
+func WithClickHouseStats(b Backend, stats *ClickHouseStats) Backend {
+	return &clickHouseBackend{Backend: b, stats: stats}
+}
+
+func (b *clickHouseBackend) GetStats(filter models.StatsFilter) ([]models.DomainStat, int64, error) {
+	return b.stats.GetStats(filter)
+}
@@ -0,0 +1,144 @@
+package database
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"dns-collector-webapi/internal/models"
+)
+
+// clickHouseFixture answers the count and row queries of GetStats with recorded
+// ClickHouse responses and keeps the last query parameters
+type clickHouseFixture struct {
+	queries []url.Values
+	user    string
+}
+
+func (f *clickHouseFixture) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	f.queries = append(f.queries, values)
+	f.user = r.Header.Get("X-ClickHouse-User")
+
+	query := values.Get("query")
+	switch {
+	case strings.Contains(query, "no_such_column"):
+		http.Error(w, "Code: 47. DB::Exception: Missing columns: 'no_such_column'", http.StatusBadRequest)
+	case strings.HasPrefix(query, "SELECT count()"):
+		_, _ = w.Write([]byte("2\n"))
+	default:
+		_, _ = w.Write([]byte(`{"domain":"a.example.com","client_ip":"192.168.1.10","qtype":"A","rtype":"cache","timestamp":"2024-01-15 10:30:00.123456"}
+{"domain":"cdn.example.org","client_ip":null,"qtype":"AAAA","rtype":"cache","timestamp":"2024-01-15 10:29:59"}
+`))
+	}
+}
+
+func newTestClickHouseStats(t *testing.T, fixture http.Handler, table string) *ClickHouseStats {
+	t.Helper()
+
+	srv := httptest.NewServer(fixture)
+	t.Cleanup(srv.Close)
+
+	return NewClickHouseStats(ClickHouseConfig{
+		Enabled:        true,
+		URL:            srv.URL,
+		Database:       "dns_collector",
+		Table:          table,
+		User:           "webapi",
+		TimeoutSeconds: 5,
+	})
+}
+
+func TestClickHouseStats_GetStats(t *testing.T) {
+	fixture := &clickHouseFixture{}
+	stats := newTestClickHouseStats(t, fixture, "domain_stat")
+
+	from := time.Date(2024, 1, 15, 12, 0, 0, 0, time.FixedZone("MSK", 3*3600))
+	result, total, err := stats.GetStats(models.StatsFilter{
+		ClientIPs: []string{"192.168.1.10", UnknownClientIP},
+		Subnet:    "10.0.0.0/8",
+		DateFrom:  from,
+		SortBy:    "id",
+		SortOrder: "asc",
+		Limit:     50,
+		Offset:    10,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if total != 2 || len(result) != 2 {
+		t.Fatalf("Expected 2 stats, got %d (total %d)", len(result), total)
+	}
+
+	first := result[0]
+	if first.Domain != "a.example.com" || first.ClientIP != "192.168.1.10" || first.ID != 0 {
+		t.Errorf("Unexpected first stat %+v", first)
+	}
+	expected := time.Date(2024, 1, 15, 10, 30, 0, 123456000, time.UTC)
+	if !first.Timestamp.Equal(expected) {
+		t.Errorf("Expected timestamp %v, got %v", expected, first.Timestamp)
+	}
+	if result[1].ClientIP != UnknownClientIP {
+		t.Errorf("Expected unknown client for null client_ip, got %q", result[1].ClientIP)
+	}
+
+	if len(fixture.queries) != 2 || fixture.user != "webapi" {
+		t.Fatalf("Expected 2 queries as webapi, got %d as %q", len(fixture.queries), fixture.user)
+	}
+	rows := fixture.queries[1]
+	query := rows.Get("query")
+	for _, part := range []string{
+		"FROM dns_collector.domain_stat WHERE",
+		"client_ip IN ({p1:String}) OR client_ip IS NULL OR",
+		"isIPAddressInRange(assumeNotNull(client_ip), {p2:String})",
+		"timestamp >= {p3:DateTime64(6, 'UTC')}",
+		"ORDER BY timestamp ASC LIMIT 50 OFFSET 10",
+	} {
+		if !strings.Contains(query, part) {
+			t.Errorf("Expected query to contain %q, got %q", part, query)
+		}
+	}
+	if rows.Get("param_p1") != "192.168.1.10" || rows.Get("param_p2") != "10.0.0.0/8" ||
+		rows.Get("param_p3") != "2024-01-15 09:00:00" {
+		t.Errorf("Unexpected query parameters %v", rows)
+	}
+}
+
+func TestClickHouseStats_Errors(t *testing.T) {
+	stats := newTestClickHouseStats(t, &clickHouseFixture{}, "no_such_column")
+
+	if _, _, err := stats.GetStats(models.StatsFilter{ClientIPs: []string{"not-an-ip"}}); err == nil {
+		t.Error("Expected error for invalid client IP")
+	}
+	if _, _, err := stats.GetStats(models.StatsFilter{Subnet: "10.0.0.0/33"}); err == nil {
+		t.Error("Expected error for invalid subnet")
+	}
+
+	_, _, err := stats.GetStats(models.StatsFilter{})
+	if err == nil || !strings.Contains(err.Error(), "Missing columns") {
+		t.Errorf("Expected ClickHouse error, got %v", err)
+	}
+}
+
+func TestWithClickHouseStats(t *testing.T) {
+	stats := newTestClickHouseStats(t, &clickHouseFixture{}, "domain_stat")
+	db := newTestSQLite(t)
+
+	backend := WithClickHouseStats(db, stats)
+
+	result, _, err := backend.GetStats(models.StatsFilter{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// The SQLite fixtures have 3 stats, ClickHouse 2
+	if len(result) != 2 {
+		t.Errorf("Expected stats from ClickHouse, got %d", len(result))
+	}
+
+	if _, total, err := backend.GetDomains(models.DomainsFilter{}); err != nil || total != 2 {
+		t.Errorf("Expected domains from SQLite, got %d (%v)", total, err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"net"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,8 +14,11 @@ import (
 )
 
 type Database struct {
-	DB     *sql.DB
-	config *dbConfig
+	DB       *sql.DB
+	config   *dbConfig
+	priority models.PriorityWeights // weights of the domain_priority() score
+
+	rollupThreshold time.Duration // shortest aggregate stats range read from the rollups
 }
 
 type dbConfig struct {
@@ -56,11 +60,20 @@ func New(host string, port int, user, password, dbname, sslmode string) (*Databa
 	db.SetConnMaxLifetime(5 * time.Minute)
 
 	return &Database{
-		DB:     db,
-		config: config,
+		DB:       db,
+		config:   config,
+		priority: models.DefaultPriorityWeights(),
+
+		rollupThreshold: DefaultRollupThreshold,
 	}, nil
 }
 
+// SetPriorityWeights sets the weights used to compute the domain priority column.
+// They should match the collector's resolver.priority_weights.
+func (db *Database) SetPriorityWeights(w models.PriorityWeights) {
+	db.priority = w
+}
+
 func (db *Database) Close() error {
 	if db.DB != nil {
 		return db.DB.Close()
@@ -70,7 +83,7 @@ func (db *Database) Close() error {
 
 // GetStats retrieves DNS query statistics with filtering and sorting
 func (db *Database) GetStats(filter models.StatsFilter) ([]models.DomainStat, int64, error) {
-	query := "SELECT id, domain, client_ip, rtype, timestamp FROM domain_stat WHERE 1=1"
+	query := "SELECT id, domain, client_ip, qtype, rtype, timestamp FROM domain_stat WHERE 1=1"
 	countQuery := "SELECT COUNT(*) FROM domain_stat WHERE 1=1"
 	args := []interface{}{}
 	argPos := 1
@@ -81,23 +94,32 @@ func (db *Database) GetStats(filter models.StatsFilter) ([]models.DomainStat, in
 
 		// Handle specific IPs
 		if len(filter.ClientIPs) > 0 {
-			placeholders := make([]string, len(filter.ClientIPs))
-			for i, ip := range filter.ClientIPs {
-				placeholders[i] = fmt.Sprintf("$%d", argPos)
-				argPos++
-				args = append(args, ip)
+			ips, unknown, err := splitClientIPs(filter.ClientIPs)
+			if err != nil {
+				return nil, 0, err
+			}
+			if len(ips) > 0 {
+				placeholders := make([]string, len(ips))
+				for i, ip := range ips {
+					placeholders[i] = fmt.Sprintf("$%d", argPos)
+					argPos++
+					args = append(args, ip)
+				}
+				ipConditions = append(ipConditions, fmt.Sprintf("client_ip IN (%s)", strings.Join(placeholders, ",")))
+			}
+			if unknown {
+				ipConditions = append(ipConditions, "client_ip IS NULL")
 			}
-			ipConditions = append(ipConditions, fmt.Sprintf("client_ip IN (%s)", strings.Join(placeholders, ",")))
 		}
 
-		// Handle subnet using PostgreSQL inet operators
+		// Handle subnet using PostgreSQL inet operators (served by the SP-GiST index)
 		if filter.Subnet != "" {
 			// Validate CIDR format
 			_, _, err := net.ParseCIDR(filter.Subnet)
 			if err != nil {
 				return nil, 0, fmt.Errorf("invalid subnet format: %w", err)
 			}
-			ipConditions = append(ipConditions, fmt.Sprintf("client_ip::inet << $%d::inet", argPos))
+			ipConditions = append(ipConditions, fmt.Sprintf("client_ip <<= $%d::inet", argPos))
 			argPos++
 			args = append(args, filter.Subnet)
 		}
@@ -131,7 +153,7 @@ func (db *Database) GetStats(filter models.StatsFilter) ([]models.DomainStat, in
 
 	// Apply sorting
 	validSortFields := map[string]bool{
-		"id": true, "domain": true, "client_ip": true, "rtype": true, "timestamp": true,
+		"id": true, "domain": true, "client_ip": true, "qtype": true, "rtype": true, "timestamp": true,
 	}
 	sortBy := "timestamp"
 	if filter.SortBy != "" && validSortFields[filter.SortBy] {
@@ -168,18 +190,104 @@ func (db *Database) GetStats(filter models.StatsFilter) ([]models.DomainStat, in
 	var stats []models.DomainStat
 	for rows.Next() {
 		var s models.DomainStat
-		if err := rows.Scan(&s.ID, &s.Domain, &s.ClientIP, &s.RType, &s.Timestamp); err != nil {
+		var clientIP sql.NullString
+		if err := rows.Scan(&s.ID, &s.Domain, &clientIP, &s.QType, &s.RType, &s.Timestamp); err != nil {
 			return nil, 0, fmt.Errorf("failed to scan stat: %w", err)
 		}
+		s.ClientIP = clientIPString(clientIP)
 		stats = append(stats, s)
 	}
 
 	return stats, total, rows.Err()
 }
 
+// UnknownClientIP stands for statistics of clients whose address the DNS server
+// didn't report; they are stored with a NULL client_ip
+const UnknownClientIP = "unknown"
+
+// splitClientIPs validates a client IP filter and separates the addresses from
+// UnknownClientIP
+func splitClientIPs(clientIPs []string) ([]string, bool, error) {
+	var ips []string
+	unknown := false
+	for _, ip := range clientIPs {
+		if ip == UnknownClientIP {
+			unknown = true
+			continue
+		}
+		if net.ParseIP(ip) == nil {
+			return nil, false, fmt.Errorf("invalid client IP: %s", ip)
+		}
+		ips = append(ips, ip)
+	}
+	return ips, unknown, nil
+}
+
+// clientIPString returns a scanned client_ip, UnknownClientIP for NULL
+func clientIPString(ip sql.NullString) string {
+	if !ip.Valid {
+		return UnknownClientIP
+	}
+	return ip.String
+}
+
+// validateDomainRegex rejects regex patterns that are too long or prone to
+// catastrophic backtracking
+func validateDomainRegex(regex string) error {
+	if len(regex) > 200 {
+		return fmt.Errorf("regex pattern too long (max 200 characters)")
+	}
+
+	// Check for potentially dangerous patterns
+	dangerousPatterns := []string{
+		"(.*)*", // Catastrophic backtracking
+		"(.+)+", // Catastrophic backtracking
+		"(.*)+", // Catastrophic backtracking
+		"(.+)*", // Catastrophic backtracking
+	}
+	for _, dangerous := range dangerousPatterns {
+		if strings.Contains(regex, dangerous) {
+			return fmt.Errorf("regex pattern contains potentially dangerous construct: %s", dangerous)
+		}
+	}
+	return nil
+}
+
+// domainColumns returns the column list scanned by scanDomain, including the
+// scheduling priority computed with the configured weights
+func (db *Database) domainColumns() string {
+	return selectDomainColumns(db.priority, "LOCALTIMESTAMP")
+}
+
+// selectDomainColumns returns the columns scanned by scanDomain with the priority
+// computed at the SQL expression now
+func selectDomainColumns(w models.PriorityWeights, now string) string {
+	return fmt.Sprintf("id, domain, time_insert, resolv_count, max_resolv, last_resolv_time, last_seen, "+
+		"last_error, consecutive_failures, next_resolv_time, query_count, "+
+		"domain_priority(query_count, last_seen, last_resolv_time, %s, %s, %s, %s) AS priority, dnssec_status, wildcard_zone, policy, resolv_interval",
+		now, formatWeight(w.Popularity), formatWeight(w.Recency), formatWeight(w.Staleness))
+}
+
+// formatWeight renders a weight as an SQL numeric literal
+func formatWeight(w float64) string {
+	return strconv.FormatFloat(w, 'f', -1, 64)
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanDomain scans a row selected with domainColumns
+func scanDomain(row rowScanner, d *models.Domain) error {
+	return row.Scan(&d.ID, &d.Domain, &d.TimeInsert, &d.ResolvCount, &d.MaxResolv, &d.LastResolvTime, &d.LastSeen,
+		&d.LastError, &d.ConsecutiveFailures, &d.NextResolvTime, &d.QueryCount, &d.Priority, &d.DNSSECStatus,
+		&d.WildcardZone, &d.Policy, &d.ResolvInterval)
+}
+
 // GetDomains retrieves domains with filtering and sorting
 func (db *Database) GetDomains(filter models.DomainsFilter) ([]models.Domain, int64, error) {
-	query := "SELECT id, domain, time_insert, resolv_count, max_resolv, last_resolv_time, last_seen FROM domain WHERE 1=1"
+	query := "SELECT " + db.domainColumns() + " FROM domain WHERE 1=1"
 	countQuery := "SELECT COUNT(*) FROM domain WHERE 1=1"
 	args := []interface{}{}
 	argPos := 1
@@ -187,21 +295,8 @@ func (db *Database) GetDomains(filter models.DomainsFilter) ([]models.Domain, in
 	// Apply domain regex filter in SQL
 	if filter.DomainRegex != "" {
 		// Validate regex pattern to prevent ReDoS attacks
-		if len(filter.DomainRegex) > 200 {
-			return nil, 0, fmt.Errorf("regex pattern too long (max 200 characters)")
-		}
-
-		// Check for potentially dangerous patterns
-		dangerousPatterns := []string{
-			"(.*)*",    // Catastrophic backtracking
-			"(.+)+",    // Catastrophic backtracking
-			"(.*)+",    // Catastrophic backtracking
-			"(.+)*",    // Catastrophic backtracking
-		}
-		for _, dangerous := range dangerousPatterns {
-			if strings.Contains(filter.DomainRegex, dangerous) {
-				return nil, 0, fmt.Errorf("regex pattern contains potentially dangerous construct: %s", dangerous)
-			}
+		if err := validateDomainRegex(filter.DomainRegex); err != nil {
+			return nil, 0, err
 		}
 
 		query += fmt.Sprintf(" AND domain ~ $%d", argPos)
@@ -210,6 +305,60 @@ func (db *Database) GetDomains(filter models.DomainsFilter) ([]models.Domain, in
 		args = append(args, filter.DomainRegex)
 	}
 
+	// Apply failure filters
+	if filter.Dead {
+		minFailures := filter.MinFailures
+		if minFailures <= 0 {
+			minFailures = 3 // Default threshold for dead domains
+		}
+		query += fmt.Sprintf(" AND consecutive_failures >= $%d", argPos)
+		countQuery += fmt.Sprintf(" AND consecutive_failures >= $%d", argPos)
+		argPos++
+		args = append(args, minFailures)
+	}
+	if filter.LastError != "" {
+		query += fmt.Sprintf(" AND last_error = $%d", argPos)
+		countQuery += fmt.Sprintf(" AND last_error = $%d", argPos)
+		argPos++
+		args = append(args, filter.LastError)
+	}
+	if filter.DNSSECStatus != "" {
+		query += fmt.Sprintf(" AND dnssec_status = $%d", argPos)
+		countQuery += fmt.Sprintf(" AND dnssec_status = $%d", argPos)
+		argPos++
+		args = append(args, filter.DNSSECStatus)
+	}
+
+	// Apply wildcard zone filter
+	if filter.WildcardZone != "" {
+		query += fmt.Sprintf(" AND wildcard_zone = $%d", argPos)
+		countQuery += fmt.Sprintf(" AND wildcard_zone = $%d", argPos)
+		argPos++
+		args = append(args, filter.WildcardZone)
+	}
+
+	// Apply resolution policy filter
+	if filter.Policy != "" {
+		query += fmt.Sprintf(" AND policy = $%d", argPos)
+		countQuery += fmt.Sprintf(" AND policy = $%d", argPos)
+		argPos++
+		args = append(args, filter.Policy)
+	}
+
+	// Apply GeoIP filters (domains with at least one IP in the AS / country)
+	if filter.ASN > 0 {
+		query += fmt.Sprintf(" AND id IN (SELECT domain_id FROM ip WHERE asn = $%d)", argPos)
+		countQuery += fmt.Sprintf(" AND id IN (SELECT domain_id FROM ip WHERE asn = $%d)", argPos)
+		argPos++
+		args = append(args, filter.ASN)
+	}
+	if filter.Country != "" {
+		query += fmt.Sprintf(" AND id IN (SELECT domain_id FROM ip WHERE country = $%d)", argPos)
+		countQuery += fmt.Sprintf(" AND id IN (SELECT domain_id FROM ip WHERE country = $%d)", argPos)
+		argPos++
+		args = append(args, strings.ToUpper(filter.Country))
+	}
+
 	// Apply date filters
 	if !filter.DateFrom.IsZero() {
 		query += fmt.Sprintf(" AND time_insert >= $%d", argPos)
@@ -235,6 +384,7 @@ func (db *Database) GetDomains(filter models.DomainsFilter) ([]models.Domain, in
 	validSortFields := map[string]bool{
 		"id": true, "domain": true, "time_insert": true,
 		"resolv_count": true, "max_resolv": true, "last_resolv_time": true, "last_seen": true,
+		"consecutive_failures": true, "next_resolv_time": true, "query_count": true, "priority": true, "dnssec_status": true,
 	}
 	sortBy := "time_insert"
 	if filter.SortBy != "" && validSortFields[filter.SortBy] {
@@ -271,7 +421,7 @@ func (db *Database) GetDomains(filter models.DomainsFilter) ([]models.Domain, in
 	var domains []models.Domain
 	for rows.Next() {
 		var d models.Domain
-		if err := rows.Scan(&d.ID, &d.Domain, &d.TimeInsert, &d.ResolvCount, &d.MaxResolv, &d.LastResolvTime, &d.LastSeen); err != nil {
+		if err := scanDomain(rows, &d); err != nil {
 			return nil, 0, fmt.Errorf("failed to scan domain: %w", err)
 		}
 		domains = append(domains, d)
@@ -282,7 +432,17 @@ func (db *Database) GetDomains(filter models.DomainsFilter) ([]models.Domain, in
 
 // GetDomainIPs retrieves all IP addresses for a specific domain
 func (db *Database) GetDomainIPs(domainID int64) ([]models.IP, error) {
-	query := "SELECT id, domain_id, ip, type, time FROM ip WHERE domain_id = $1 ORDER BY type, ip"
+	query := `SELECT ip.id, ip.domain_id, ip.ip, ip.type, ip.time,
+			COALESCE(ARRAY_AGG(v.vantage ORDER BY v.vantage) FILTER (WHERE v.vantage IS NOT NULL), '{}'),
+			COALESCE(p.ptr, ''), ip.asn, COALESCE(ip.as_org, ''), COALESCE(ip.country, ''),
+			ip.first_seen, ip.last_seen, ip.seen_count, COALESCE(ip.first_source, ''), COALESCE(ip.last_source, ''),
+			bit_count(ip.seen_history::bit(64))
+		FROM ip
+		LEFT JOIN ip_vantage v ON v.ip_id = ip.id
+		LEFT JOIN ip_ptr p ON p.ip = ip.ip
+		WHERE ip.domain_id = $1
+		GROUP BY ip.id, p.ptr
+		ORDER BY ip.type, ip.ip`
 
 	rows, err := db.DB.Query(query, domainID)
 	if err != nil {
@@ -293,9 +453,15 @@ func (db *Database) GetDomainIPs(domainID int64) ([]models.IP, error) {
 	var ips []models.IP
 	for rows.Next() {
 		var ip models.IP
-		if err := rows.Scan(&ip.ID, &ip.DomainID, &ip.IP, &ip.Type, &ip.Time); err != nil {
+		var vantages string
+		if err := rows.Scan(&ip.ID, &ip.DomainID, &ip.IP, &ip.Type, &ip.Time, &vantages, &ip.PTR,
+			&ip.ASN, &ip.ASOrg, &ip.Country, &ip.FirstSeen, &ip.LastSeen, &ip.SeenCount, &ip.FirstSource,
+			&ip.LastSource, &ip.SeenRecent); err != nil {
 			return nil, fmt.Errorf("failed to scan IP: %w", err)
 		}
+		if list := parsePostgreSQLArray(vantages); len(list) > 0 {
+			ip.Vantages = list
+		}
 		ips = append(ips, ip)
 	}
 
@@ -304,12 +470,10 @@ func (db *Database) GetDomainIPs(domainID int64) ([]models.IP, error) {
 
 // GetDomainWithIPs retrieves a domain with all its IPs
 func (db *Database) GetDomainWithIPs(domainID int64) (*models.Domain, error) {
-	query := "SELECT id, domain, time_insert, resolv_count, max_resolv, last_resolv_time, last_seen FROM domain WHERE id = $1"
+	query := "SELECT " + db.domainColumns() + " FROM domain WHERE id = $1"
 
 	var d models.Domain
-	err := db.DB.QueryRow(query, domainID).Scan(
-		&d.ID, &d.Domain, &d.TimeInsert, &d.ResolvCount, &d.MaxResolv, &d.LastResolvTime, &d.LastSeen,
-	)
+	err := scanDomain(db.DB.QueryRow(query, domainID), &d)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("domain not found")
@@ -355,10 +519,13 @@ func (db *Database) GetDomainsWithIPs(filter models.DomainsFilter) ([]models.Dom
 
 	// Bulk fetch all IPs in ONE query
 	query := fmt.Sprintf(`
-		SELECT id, domain_id, ip, type, time
+		SELECT ip.id, ip.domain_id, ip.ip, ip.type, ip.time, COALESCE(p.ptr, ''),
+			ip.asn, COALESCE(ip.as_org, ''), COALESCE(ip.country, ''),
+			ip.first_seen, ip.last_seen, ip.seen_count
 		FROM ip
-		WHERE domain_id IN (%s)
-		ORDER BY domain_id, type, ip
+		LEFT JOIN ip_ptr p ON p.ip = ip.ip
+		WHERE ip.domain_id IN (%s)
+		ORDER BY ip.domain_id, ip.type, ip.ip
 	`, strings.Join(placeholders, ","))
 
 	rows, err := db.DB.Query(query, domainIDs...)
@@ -370,7 +537,8 @@ func (db *Database) GetDomainsWithIPs(filter models.DomainsFilter) ([]models.Dom
 	// Map IPs to domains
 	for rows.Next() {
 		var ip models.IP
-		if err := rows.Scan(&ip.ID, &ip.DomainID, &ip.IP, &ip.Type, &ip.Time); err != nil {
+		if err := rows.Scan(&ip.ID, &ip.DomainID, &ip.IP, &ip.Type, &ip.Time, &ip.PTR,
+			&ip.ASN, &ip.ASOrg, &ip.Country, &ip.FirstSeen, &ip.LastSeen, &ip.SeenCount); err != nil {
 			return nil, 0, fmt.Errorf("failed to scan IP: %w", err)
 		}
 		if domain, ok := domainMap[ip.DomainID]; ok {
@@ -385,13 +553,86 @@ func (db *Database) GetDomainsWithIPs(filter models.DomainsFilter) ([]models.Dom
 	return domains, total, nil
 }
 
+// GetIPChanges retrieves IP set change events, newest first, optionally limited
+// to one domain, domains matching a regex and a time range
+func (db *Database) GetIPChanges(filter models.IPChangesFilter) ([]models.IPChangeEvent, int64, error) {
+	where := " WHERE 1=1"
+	args := []interface{}{}
+
+	if filter.DomainID > 0 {
+		args = append(args, filter.DomainID)
+		where += fmt.Sprintf(" AND e.domain_id = $%d", len(args))
+	}
+	if filter.DomainRegex != "" {
+		if err := validateDomainRegex(filter.DomainRegex); err != nil {
+			return nil, 0, err
+		}
+		args = append(args, filter.DomainRegex)
+		where += fmt.Sprintf(" AND d.domain ~ $%d", len(args))
+	}
+	if !filter.DateFrom.IsZero() {
+		args = append(args, filter.DateFrom)
+		where += fmt.Sprintf(" AND e.time >= $%d", len(args))
+	}
+	if !filter.DateTo.IsZero() {
+		args = append(args, filter.DateTo)
+		where += fmt.Sprintf(" AND e.time <= $%d", len(args))
+	}
+
+	from := " FROM ip_change_event e INNER JOIN domain d ON d.id = e.domain_id"
+
+	// Get total count
+	var total int64
+	if err := db.DB.QueryRow("SELECT COUNT(*)"+from+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count IP changes: %w", err)
+	}
+
+	// Apply pagination
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 100 // Default limit
+	}
+	query := "SELECT e.id, e.domain_id, d.domain, e.time, e.added, e.removed" + from + where +
+		" ORDER BY e.time DESC, e.id DESC"
+	args = append(args, limit)
+	query += fmt.Sprintf(" LIMIT $%d", len(args))
+	if filter.Offset > 0 {
+		args = append(args, filter.Offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query IP changes: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	events := []models.IPChangeEvent{}
+	for rows.Next() {
+		var e models.IPChangeEvent
+		var added, removed string
+		if err := rows.Scan(&e.ID, &e.DomainID, &e.Domain, &e.Time, &added, &removed); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan IP change: %w", err)
+		}
+		e.Added = parsePostgreSQLArray(added)
+		e.Removed = parsePostgreSQLArray(removed)
+		events = append(events, e)
+	}
+
+	return events, total, rows.Err()
+}
+
 // GetExportList retrieves domains and their IPs filtered by domain regex
-func (db *Database) GetExportList(domainRegex string, includeIPv4, includeIPv6, excludeSharedIPs bool) (*models.ExportList, error) {
+// A non-empty opts.Vantage restricts IPs to those returned for that EDNS Client Subnet site;
+// an empty one returns the union of all resolved IPs. opts.Geo restricts IPs by ASN and country,
+// opts.Stability drops IPs returned by too few of the domain's recent resolutions.
+// With opts.CollapseWildcards children of wildcard zones are listed once, as their zone.
+func (db *Database) GetExportList(opts models.ExportOptions) (*models.ExportList, error) {
 	// Validate regex pattern
-	if domainRegex == "" {
+	if opts.DomainRegex == "" {
 		return nil, fmt.Errorf("domain regex is required")
 	}
-	if len(domainRegex) > 200 {
+	if len(opts.DomainRegex) > 200 {
 		return nil, fmt.Errorf("regex pattern too long (max 200 characters)")
 	}
 
@@ -403,20 +644,24 @@ func (db *Database) GetExportList(domainRegex string, includeIPv4, includeIPv6,
 		"(.+)*",
 	}
 	for _, dangerous := range dangerousPatterns {
-		if strings.Contains(domainRegex, dangerous) {
+		if strings.Contains(opts.DomainRegex, dangerous) {
 			return nil, fmt.Errorf("regex pattern contains potentially dangerous construct: %s", dangerous)
 		}
 	}
 
 	// Query to get unique domains matching the regex
+	domainColumn := "domain"
+	if opts.CollapseWildcards {
+		domainColumn = "COALESCE(wildcard_zone, domain)"
+	}
 	domainsQuery := `
-		SELECT DISTINCT domain
+		SELECT DISTINCT ` + domainColumn + ` AS name
 		FROM domain
 		WHERE domain ~ $1
-		ORDER BY domain
+		ORDER BY name
 	`
 
-	rows, err := db.DB.Query(domainsQuery, domainRegex)
+	rows, err := db.DB.Query(domainsQuery, opts.DomainRegex)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query domains: %w", err)
 	}
@@ -436,7 +681,7 @@ func (db *Database) GetExportList(domainRegex string, includeIPv4, includeIPv6,
 	}
 
 	// If neither IPv4 nor IPv6 is enabled, return early with just domains
-	if !includeIPv4 && !includeIPv6 {
+	if !opts.IncludeIPv4 && !opts.IncludeIPv6 {
 		return &models.ExportList{
 			Domains: domains,
 			IPv4:    []string{},
@@ -444,16 +689,19 @@ func (db *Database) GetExportList(domainRegex string, includeIPv4, includeIPv6,
 		}, nil
 	}
 
+	// Restrict matched IPs to a vantage point, ASNs, countries and stable IPs if requested
+	ipFilter, ipsArgs := exportIPFilter(opts.Vantage, opts.Geo, opts.Stability, []interface{}{opts.DomainRegex})
+
 	// Build IP query with type filtering and optional shared IP exclusion
 	var ipsQuery string
-	if excludeSharedIPs {
+	if opts.ExcludeSharedIPs {
 		// Complex query with CTE to exclude IPs shared between matched and non-matched domains
 		ipsQuery = `
 			WITH matched_ips AS (
 				SELECT DISTINCT ip.ip, ip.type
 				FROM ip
 				INNER JOIN domain ON ip.domain_id = domain.id
-				WHERE domain.domain ~ $1
+				WHERE domain.domain ~ $1` + ipFilter + `
 			),
 			non_matched_ips AS (
 				SELECT DISTINCT ip.ip
@@ -461,9 +709,9 @@ func (db *Database) GetExportList(domainRegex string, includeIPv4, includeIPv6,
 				INNER JOIN domain ON ip.domain_id = domain.id
 				WHERE NOT (domain.domain ~ $1)
 			)
-			SELECT ip, type
-			FROM matched_ips
-			WHERE ip NOT IN (SELECT ip FROM non_matched_ips)
+			SELECT ip.ip, ip.type
+			FROM matched_ips ip
+			WHERE NOT EXISTS (SELECT 1 FROM non_matched_ips n WHERE n.ip = ip.ip)
 		`
 	} else {
 		// Simple query without shared IP exclusion
@@ -471,21 +719,21 @@ func (db *Database) GetExportList(domainRegex string, includeIPv4, includeIPv6,
 			SELECT DISTINCT ip.ip, ip.type
 			FROM ip
 			INNER JOIN domain ON ip.domain_id = domain.id
-			WHERE domain.domain ~ $1
+			WHERE domain.domain ~ $1` + ipFilter + `
 		`
 	}
 
 	// Add type filtering
-	if includeIPv4 && !includeIPv6 {
+	if opts.IncludeIPv4 && !opts.IncludeIPv6 {
 		ipsQuery += " AND ip.type = 'ipv4'"
-	} else if !includeIPv4 && includeIPv6 {
+	} else if !opts.IncludeIPv4 && opts.IncludeIPv6 {
 		ipsQuery += " AND ip.type = 'ipv6'"
 	}
 	// If both are true, no type filter needed
 
 	ipsQuery += " ORDER BY type, ip"
 
-	rows, err = db.DB.Query(ipsQuery, domainRegex)
+	rows, err = db.DB.Query(ipsQuery, ipsArgs...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query IPs: %w", err)
 	}
@@ -518,6 +766,40 @@ func (db *Database) GetExportList(domainRegex string, includeIPv4, includeIPv6,
 	}, nil
 }
 
+// exportIPFilter builds the SQL conditions on matched export list IPs, appending their
+// values to args
+func exportIPFilter(vantage string, geo models.GeoFilter, stability models.StabilityFilter, args []interface{}) (string, []interface{}) {
+	filter := ""
+	if vantage != "" {
+		args = append(args, vantage)
+		filter += fmt.Sprintf(" AND ip.id IN (SELECT ip_id FROM ip_vantage WHERE vantage = $%d)", len(args))
+	}
+	if len(geo.ASNs) > 0 {
+		filter += " AND ip.asn IN (" + appendPlaceholders(&args, geo.ASNs) + ")"
+	}
+	if len(geo.ExcludeASNs) > 0 {
+		filter += " AND (ip.asn IS NULL OR ip.asn NOT IN (" + appendPlaceholders(&args, geo.ExcludeASNs) + "))"
+	}
+	if len(geo.Countries) > 0 {
+		filter += " AND ip.country IN (" + appendPlaceholders(&args, geo.Countries) + ")"
+	}
+	if stability.MinSeen > 0 {
+		args = append(args, int64(1)<<stability.Window-1, stability.MinSeen)
+		filter += fmt.Sprintf(" AND bit_count((ip.seen_history & $%d)::bit(64)) >= $%d", len(args)-1, len(args))
+	}
+	return filter, args
+}
+
+// appendPlaceholders appends values to args and returns their comma-separated placeholders
+func appendPlaceholders[T any](args *[]interface{}, values []T) string {
+	placeholders := make([]string, len(values))
+	for i, v := range values {
+		*args = append(*args, v)
+		placeholders[i] = fmt.Sprintf("$%d", len(*args))
+	}
+	return strings.Join(placeholders, ",")
+}
+
 // GetExcludedIPs retrieves IPs that are excluded from export due to being shared
 // between matched and non-matched domains
 func (db *Database) GetExcludedIPs(domainRegex string, includeIPv4, includeIPv6 bool) ([]models.ExcludedIPInfo, error) {
@@ -573,11 +855,13 @@ func (db *Database) GetExcludedIPs(domainRegex string, includeIPv4, includeIPv6
 		SELECT
 			s.ip,
 			ARRAY_AGG(DISTINCT m.domain ORDER BY m.domain) AS matched_domains,
-			ARRAY_AGG(DISTINCT nm.domain ORDER BY nm.domain) AS non_matched_domains
+			ARRAY_AGG(DISTINCT nm.domain ORDER BY nm.domain) AS non_matched_domains,
+			COALESCE(p.ptr, '') AS ptr
 		FROM shared_ips s
 		LEFT JOIN matched_domain_ips m ON s.ip = m.ip
 		LEFT JOIN non_matched_domain_ips nm ON s.ip = nm.ip
-		GROUP BY s.ip
+		LEFT JOIN ip_ptr p ON p.ip = s.ip
+		GROUP BY s.ip, p.ptr
 		ORDER BY s.ip
 	`, typeFilter, typeFilter)
 
@@ -594,7 +878,7 @@ func (db *Database) GetExcludedIPs(domainRegex string, includeIPv4, includeIPv6
 
 		// PostgreSQL array_agg returns comma-separated string in Go when using array_agg with text
 		// We need to use pq.Array for proper array handling
-		if err := rows.Scan(&info.IP, &matchedDomains, &nonMatchedDomains); err != nil {
+		if err := rows.Scan(&info.IP, &matchedDomains, &nonMatchedDomains, &info.PTR); err != nil {
 			return nil, fmt.Errorf("failed to scan excluded IP info: %w", err)
 		}
 
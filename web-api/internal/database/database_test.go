@@ -1,13 +1,17 @@
 package database
 
 import (
+	"strings"
 	"testing"
+	"time"
+
+	"dns-collector-webapi/internal/models"
 )
 
 func TestGetExportList_ValidateEmptyRegex(t *testing.T) {
 	db := &Database{}
 
-	_, err := db.GetExportList("", true, true, false)
+	_, err := db.GetExportList(models.ExportOptions{DomainRegex: "", IncludeIPv4: true, IncludeIPv6: true})
 	if err == nil {
 		t.Error("Expected error for empty regex, got nil")
 	}
@@ -26,7 +30,7 @@ func TestGetExportList_ValidateRegexTooLong(t *testing.T) {
 		longRegex += "a"
 	}
 
-	_, err := db.GetExportList(longRegex, true, true, false)
+	_, err := db.GetExportList(models.ExportOptions{DomainRegex: longRegex, IncludeIPv4: true, IncludeIPv6: true})
 	if err == nil {
 		t.Error("Expected error for regex too long, got nil")
 	}
@@ -40,7 +44,7 @@ func TestGetExportList_ValidateRegexTooLong(t *testing.T) {
 func TestGetExportList_DangerousPattern_NestedStar(t *testing.T) {
 	db := &Database{}
 
-	_, err := db.GetExportList("(.*)*", true, true, false)
+	_, err := db.GetExportList(models.ExportOptions{DomainRegex: "(.*)*", IncludeIPv4: true, IncludeIPv6: true})
 	if err == nil {
 		t.Error("Expected error for dangerous pattern (.*)*,  got nil")
 	}
@@ -53,7 +57,7 @@ func TestGetExportList_DangerousPattern_NestedStar(t *testing.T) {
 func TestGetExportList_DangerousPattern_NestedPlus1(t *testing.T) {
 	db := &Database{}
 
-	_, err := db.GetExportList("(.+)+", true, true, false)
+	_, err := db.GetExportList(models.ExportOptions{DomainRegex: "(.+)+", IncludeIPv4: true, IncludeIPv6: true})
 	if err == nil {
 		t.Error("Expected error for dangerous pattern (.+)+, got nil")
 	}
@@ -66,7 +70,7 @@ func TestGetExportList_DangerousPattern_NestedPlus1(t *testing.T) {
 func TestGetExportList_DangerousPattern_NestedPlus2(t *testing.T) {
 	db := &Database{}
 
-	_, err := db.GetExportList("(.*)+", true, true, false)
+	_, err := db.GetExportList(models.ExportOptions{DomainRegex: "(.*)+", IncludeIPv4: true, IncludeIPv6: true})
 	if err == nil {
 		t.Error("Expected error for dangerous pattern (.*)+ , got nil")
 	}
@@ -79,7 +83,7 @@ func TestGetExportList_DangerousPattern_NestedPlus2(t *testing.T) {
 func TestGetExportList_DangerousPattern_NestedStar2(t *testing.T) {
 	db := &Database{}
 
-	_, err := db.GetExportList("(.+)*", true, true, false)
+	_, err := db.GetExportList(models.ExportOptions{DomainRegex: "(.+)*", IncludeIPv4: true, IncludeIPv6: true})
 	if err == nil {
 		t.Error("Expected error for dangerous pattern (.+)*, got nil")
 	}
@@ -151,3 +155,229 @@ func contains(s, substr string) bool {
 	}
 	return false
 }
+
+func TestDomainColumns_PriorityWeights(t *testing.T) {
+	db := &Database{priority: models.PriorityWeights{Popularity: 2, Recency: 0.5, Staleness: 0}}
+
+	columns := db.domainColumns()
+	expected := "domain_priority(query_count, last_seen, last_resolv_time, LOCALTIMESTAMP, 2, 0.5, 0) AS priority"
+	if !strings.Contains(columns, expected) {
+		t.Errorf("Expected columns to contain %q, got %q", expected, columns)
+	}
+}
+
+func TestExportIPFilter(t *testing.T) {
+	geo := models.GeoFilter{
+		ASNs:        []int64{13335, 15169},
+		ExcludeASNs: []int64{64500},
+		Countries:   []string{"DE"},
+	}
+
+	filter, args := exportIPFilter("msk", geo, models.StabilityFilter{}, []interface{}{".*"})
+
+	expected := " AND ip.id IN (SELECT ip_id FROM ip_vantage WHERE vantage = $2)" +
+		" AND ip.asn IN ($3,$4)" +
+		" AND (ip.asn IS NULL OR ip.asn NOT IN ($5))" +
+		" AND ip.country IN ($6)"
+	if filter != expected {
+		t.Errorf("Expected filter %q, got %q", expected, filter)
+	}
+	if len(args) != 6 || args[1] != "msk" || args[2] != int64(13335) || args[5] != "DE" {
+		t.Errorf("Unexpected args: %v", args)
+	}
+
+	filter, args = exportIPFilter("", models.GeoFilter{}, models.StabilityFilter{}, []interface{}{".*"})
+	if filter != "" || len(args) != 1 {
+		t.Errorf("Expected no filter, got %q with args %v", filter, args)
+	}
+}
+
+func TestExportIPFilter_Stability(t *testing.T) {
+	filter, args := exportIPFilter("", models.GeoFilter{}, models.StabilityFilter{MinSeen: 3, Window: 5}, []interface{}{".*"})
+
+	expected := " AND bit_count((ip.seen_history & $2)::bit(64)) >= $3"
+	if filter != expected {
+		t.Errorf("Expected filter %q, got %q", expected, filter)
+	}
+	if len(args) != 3 || args[1] != int64(31) || args[2] != 3 {
+		t.Errorf("Unexpected args: %v", args)
+	}
+}
+
+func TestGetIPChanges_DangerousPattern(t *testing.T) {
+	db := &Database{}
+
+	_, _, err := db.GetIPChanges(models.IPChangesFilter{DomainRegex: "(.+)+"})
+	if err == nil {
+		t.Fatal("Expected error for dangerous pattern (.+)+, got nil")
+	}
+
+	if !contains(err.Error(), "potentially dangerous construct") {
+		t.Errorf("Expected error about dangerous construct, got: %v", err)
+	}
+}
+
+func TestGetStats_InvalidClientIP(t *testing.T) {
+	db := &Database{}
+
+	_, _, err := db.GetStats(models.StatsFilter{ClientIPs: []string{"192.168.1.1", "not-an-ip"}})
+	if err == nil {
+		t.Fatal("Expected error for invalid client IP, got nil")
+	}
+
+	if !contains(err.Error(), "invalid client IP") {
+		t.Errorf("Expected error about invalid client IP, got: %v", err)
+	}
+}
+
+func TestSplitClientIPs(t *testing.T) {
+	ips, unknown, err := splitClientIPs([]string{"192.168.1.1", "unknown", "2001:db8::1"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(ips) != 2 || ips[0] != "192.168.1.1" || ips[1] != "2001:db8::1" {
+		t.Errorf("Unexpected IPs: %v", ips)
+	}
+	if !unknown {
+		t.Error("Expected unknown clients to be requested")
+	}
+
+	if _, unknown, _ := splitClientIPs([]string{"10.0.0.1"}); unknown {
+		t.Error("Expected no unknown clients")
+	}
+}
+
+func TestGetStatsAggregate_Validation(t *testing.T) {
+	db := &Database{}
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		filter models.StatsAggregateFilter
+	}{
+		{"invalid group_by", models.StatsAggregateFilter{GroupBy: []string{"rtype"}, DateFrom: from, DateTo: from.Add(time.Hour)}},
+		{"invalid interval", models.StatsAggregateFilter{Interval: "week", DateFrom: from, DateTo: from.Add(time.Hour)}},
+		{"empty range", models.StatsAggregateFilter{DateFrom: from, DateTo: from}},
+		{"dangerous pattern", models.StatsAggregateFilter{DomainRegex: "(.*)*", DateFrom: from, DateTo: from.Add(time.Hour)}},
+		{"invalid client IP", models.StatsAggregateFilter{ClientIPs: []string{"10.0.0.300"}, DateFrom: from, DateTo: from.Add(time.Hour)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := db.GetStatsAggregate(tt.filter); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestStatsSource(t *testing.T) {
+	db := &Database{rollupThreshold: 48 * time.Hour}
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		span     time.Duration
+		interval string
+		expected string
+	}{
+		{"short range", 24 * time.Hour, "", StatsSourceRaw},
+		{"short range per hour", 24 * time.Hour, "hour", StatsSourceRaw},
+		{"long range per hour", 7 * 24 * time.Hour, "hour", StatsSourceHourly},
+		{"long range per day", 7 * 24 * time.Hour, "day", StatsSourceDaily},
+		{"long range total", 30 * 24 * time.Hour, "", StatsSourceDaily},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := models.StatsAggregateFilter{Interval: tt.interval, DateFrom: from, DateTo: from.Add(tt.span)}
+			if got := db.statsSource(filter); got != tt.expected {
+				t.Errorf("Expected source %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestPlanStatSegments(t *testing.T) {
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 1, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	type segment struct {
+		table    string
+		from, to time.Time
+	}
+	tests := []struct {
+		name     string
+		source   string
+		from, to time.Time
+		hourly   time.Time
+		daily    time.Time
+		expected []segment
+	}{
+		{
+			name:   "daily with hourly and raw tail",
+			source: StatsSourceDaily,
+			from:   at(1, 10, 30), to: at(10, 13, 45),
+			hourly: at(10, 13, 0), daily: at(10, 0, 0),
+			expected: []segment{
+				{"domain_stat_daily", at(1, 0, 0), at(10, 0, 0)},
+				{"domain_stat_hourly", at(10, 0, 0), at(10, 13, 0)},
+				{"domain_stat", at(10, 13, 0), at(10, 13, 45)},
+			},
+		},
+		{
+			name:   "range before the watermarks",
+			source: StatsSourceDaily,
+			from:   at(1, 0, 0), to: at(5, 12, 30),
+			hourly: at(10, 13, 0), daily: at(10, 0, 0),
+			expected: []segment{
+				{"domain_stat_daily", at(1, 0, 0), at(5, 0, 0)},
+				{"domain_stat_hourly", at(5, 0, 0), at(5, 12, 0)},
+				{"domain_stat", at(5, 12, 0), at(5, 12, 30)},
+			},
+		},
+		{
+			name:   "rollups never ran",
+			source: StatsSourceDaily,
+			from:   at(1, 10, 0), to: at(5, 0, 0),
+			expected: []segment{
+				{"domain_stat", at(1, 0, 0), at(5, 0, 0)},
+			},
+		},
+		{
+			name:   "hourly",
+			source: StatsSourceHourly,
+			from:   at(1, 10, 30), to: at(5, 12, 30),
+			hourly: at(5, 12, 0),
+			expected: []segment{
+				{"domain_stat_hourly", at(1, 10, 0), at(5, 12, 0)},
+				{"domain_stat", at(5, 12, 0), at(5, 12, 30)},
+			},
+		},
+		{
+			name:   "raw",
+			source: StatsSourceRaw,
+			from:   at(1, 10, 30), to: at(2, 10, 30),
+			hourly: at(5, 12, 0), daily: at(5, 0, 0),
+			expected: []segment{
+				{"domain_stat", at(1, 10, 30), at(2, 10, 30)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			segments := planStatSegments(tt.source, tt.from, tt.to, tt.hourly, tt.daily)
+			if len(segments) != len(tt.expected) {
+				t.Fatalf("Expected %d segments, got %+v", len(tt.expected), segments)
+			}
+			for i, exp := range tt.expected {
+				got := segments[i]
+				if got.table != exp.table || !got.from.Equal(exp.from) || !got.to.Equal(exp.to) {
+					t.Errorf("Segment %d: expected %s [%v, %v), got %s [%v, %v)", i, exp.table, exp.from, exp.to, got.table, got.from, got.to)
+				}
+			}
+		})
+	}
+}
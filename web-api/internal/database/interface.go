@@ -1,14 +1,34 @@
 package database
 
-import "dns-collector-webapi/internal/models"
+import (
+	"time"
+
+	"dns-collector-webapi/internal/models"
+)
 
 // DB defines the interface for database operations
 type DB interface {
 	GetStats(filter models.StatsFilter) ([]models.DomainStat, int64, error)
+	GetStatsAggregate(filter models.StatsAggregateFilter) (*models.StatsAggregateResult, error)
 	GetDomains(filter models.DomainsFilter) ([]models.Domain, int64, error)
 	GetDomainWithIPs(id int64) (*models.Domain, error)
 	GetDomainsWithIPs(filter models.DomainsFilter) ([]models.Domain, int64, error)
-	GetExportList(domainRegex string, includeIPv4, includeIPv6, excludeSharedIPs bool) (*models.ExportList, error)
+	GetExportList(opts models.ExportOptions) (*models.ExportList, error)
 	GetExcludedIPs(domainRegex string, includeIPv4, includeIPv6 bool) ([]models.ExcludedIPInfo, error)
+	GetIPChanges(filter models.IPChangesFilter) ([]models.IPChangeEvent, int64, error)
 	Close() error
 }
+
+// Backend is a storage backend of the API: the queries of DB plus its setup.
+// Database reads PostgreSQL, SQLiteDatabase the collector's embedded SQLite file.
+type Backend interface {
+	DB
+	RunMigrations() error
+	SetPriorityWeights(w models.PriorityWeights)
+	SetRollupThreshold(d time.Duration)
+}
+
+var (
+	_ Backend = (*Database)(nil)
+	_ Backend = (*SQLiteDatabase)(nil)
+)
@@ -3,23 +3,22 @@ package database
 import (
 	"embed"
 	"fmt"
+	"io/fs"
 
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite"
 	"github.com/golang-migrate/migrate/v4/source/iofs"
 )
 
 //go:embed migrations/*.sql
 var migrationsFS embed.FS
 
+//go:embed migrations/sqlite/*.sql
+var sqliteMigrationsFS embed.FS
+
 // RunMigrations applies all pending database migrations
 func (db *Database) RunMigrations() error {
-	// Create source from embedded files
-	d, err := iofs.New(migrationsFS, "migrations")
-	if err != nil {
-		return fmt.Errorf("failed to load migrations: %w", err)
-	}
-
 	// Build connection URL
 	connURL := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=%s",
 		db.config.User,
@@ -30,6 +29,22 @@ func (db *Database) RunMigrations() error {
 		db.config.SSLMode,
 	)
 
+	return runMigrations(migrationsFS, "migrations", connURL)
+}
+
+// RunMigrations applies all pending migrations of the SQLite schema
+func (db *SQLiteDatabase) RunMigrations() error {
+	return runMigrations(sqliteMigrationsFS, "migrations/sqlite", "sqlite://"+db.path+"?_pragma=busy_timeout(5000)")
+}
+
+// runMigrations applies the migrations in dir of fsys to the database at connURL
+func runMigrations(fsys fs.FS, dir, connURL string) error {
+	// Create source from embedded files
+	d, err := iofs.New(fsys, dir)
+	if err != nil {
+		return fmt.Errorf("failed to load migrations: %w", err)
+	}
+
 	// Create migrator
 	m, err := migrate.NewWithSourceInstance("iofs", d, connURL)
 	if err != nil {
@@ -0,0 +1,7 @@
+-- Rollback resolution failure tracking
+-- Version: 1.0.0
+
+DROP INDEX IF EXISTS idx_domain_next_resolv_time;
+ALTER TABLE domain DROP COLUMN IF EXISTS next_resolv_time;
+ALTER TABLE domain DROP COLUMN IF EXISTS consecutive_failures;
+ALTER TABLE domain DROP COLUMN IF EXISTS last_error;
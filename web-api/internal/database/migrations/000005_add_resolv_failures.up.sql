@@ -0,0 +1,21 @@
+-- Track resolution failures per domain
+-- Domains that keep failing (NXDOMAIN, SERVFAIL, timeouts) are retried with
+-- exponential backoff instead of consuming a resolver slot every cycle
+-- Version: 1.0.0
+
+-- Error class of the last failed resolution: nxdomain, servfail, timeout, error
+ALTER TABLE domain ADD COLUMN IF NOT EXISTS last_error VARCHAR(20);
+
+-- Number of failed resolutions in a row (reset on success)
+ALTER TABLE domain ADD COLUMN IF NOT EXISTS consecutive_failures INTEGER NOT NULL DEFAULT 0;
+
+-- Earliest time of the next resolution attempt (NULL = no backoff)
+ALTER TABLE domain ADD COLUMN IF NOT EXISTS next_resolv_time TIMESTAMP;
+
+-- Partial index for domains currently in backoff
+CREATE INDEX IF NOT EXISTS idx_domain_next_resolv_time ON domain(next_resolv_time)
+    WHERE next_resolv_time IS NOT NULL;
+
+COMMENT ON COLUMN domain.last_error IS 'Error class of the last failed resolution: nxdomain, servfail, timeout or error';
+COMMENT ON COLUMN domain.consecutive_failures IS 'Number of consecutive failed resolutions';
+COMMENT ON COLUMN domain.next_resolv_time IS 'Resolution is skipped until this time (exponential backoff)';
@@ -0,0 +1,4 @@
+-- Rollback resolution leases
+-- Version: 1.0.0
+
+ALTER TABLE domain DROP COLUMN IF EXISTS leased_until;
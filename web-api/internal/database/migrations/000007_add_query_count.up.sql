@@ -0,0 +1,36 @@
+-- Popularity-weighted resolution priority
+-- query_count is incremented for every client query of a domain; domain_priority()
+-- combines popularity, last_seen recency and staleness of the resolved IPs into a
+-- scheduling score. Both the collector (resolution order) and the web-api
+-- (priority column) use the same function with weights from their configs.
+-- Version: 1.0.0
+
+-- Number of client queries seen for the domain
+ALTER TABLE domain ADD COLUMN IF NOT EXISTS query_count BIGINT NOT NULL DEFAULT 0;
+
+-- Backfill from statistics still kept in domain_stat
+UPDATE domain d SET query_count = s.cnt
+FROM (SELECT domain, COUNT(*) AS cnt FROM domain_stat GROUP BY domain) s
+WHERE d.domain = s.domain;
+
+-- Scheduling score, higher is resolved first:
+--   popularity: ln(1 + query_count)
+--   recency:    exp(-days since last_seen), 0 when never seen
+--   staleness:  ln(1 + hours since last resolution)
+CREATE OR REPLACE FUNCTION domain_priority(
+    query_count BIGINT,
+    last_seen TIMESTAMP,
+    last_resolv_time TIMESTAMP,
+    ref_time TIMESTAMP,
+    w_popularity DOUBLE PRECISION,
+    w_recency DOUBLE PRECISION,
+    w_staleness DOUBLE PRECISION
+) RETURNS DOUBLE PRECISION AS $$
+    SELECT w_popularity * LN(1 + GREATEST(query_count, 0))
+         + w_recency * COALESCE(EXP(-GREATEST(EXTRACT(EPOCH FROM (ref_time - last_seen)), 0) / 86400.0), 0)
+         + w_staleness * LN(1 + GREATEST(EXTRACT(EPOCH FROM (ref_time - last_resolv_time)), 0) / 3600.0)
+$$ LANGUAGE SQL IMMUTABLE;
+
+COMMENT ON COLUMN domain.query_count IS 'Number of client queries seen for the domain';
+COMMENT ON FUNCTION domain_priority(BIGINT, TIMESTAMP, TIMESTAMP, TIMESTAMP, DOUBLE PRECISION, DOUBLE PRECISION, DOUBLE PRECISION)
+    IS 'Resolution scheduling score combining popularity, recency and staleness';
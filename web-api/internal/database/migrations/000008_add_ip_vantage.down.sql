@@ -0,0 +1,4 @@
+-- Rollback multi-vantage resolution
+-- Version: 1.0.0
+
+DROP TABLE IF EXISTS ip_vantage;
@@ -0,0 +1,20 @@
+-- EDNS Client Subnet multi-vantage resolution
+-- CDN domains answer differently depending on the client location. The resolver
+-- repeats lookups with an EDNS Client Subnet option for every configured site
+-- (vantage point) and records which vantage produced each IP, so export lists
+-- can be generated per site or as a union of all IPs.
+-- Version: 1.0.0
+
+CREATE TABLE IF NOT EXISTS ip_vantage (
+    ip_id INTEGER NOT NULL REFERENCES ip(id) ON DELETE CASCADE,
+    vantage VARCHAR(64) NOT NULL,
+    time TIMESTAMP NOT NULL,
+    PRIMARY KEY (ip_id, vantage)
+);
+
+-- Per-site export lists select IPs by vantage
+CREATE INDEX IF NOT EXISTS idx_ip_vantage_vantage ON ip_vantage(vantage);
+
+COMMENT ON TABLE ip_vantage IS 'Vantage points (EDNS Client Subnet sites) that returned an IP';
+COMMENT ON COLUMN ip_vantage.vantage IS 'Vantage point name from resolver.vantage_points';
+COMMENT ON COLUMN ip_vantage.time IS 'Last time the vantage point returned the IP';
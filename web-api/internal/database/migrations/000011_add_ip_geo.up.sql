@@ -0,0 +1,29 @@
+-- Offline ASN and GeoIP enrichment of resolved IPs
+-- The collector annotates ip rows from local MaxMind-format (MMDB) databases and
+-- re-annotates them whenever the database files change, so export lists can be
+-- filtered by autonomous system and country.
+-- Version: 1.0.0
+
+-- Autonomous system number announcing the address (NULL = unknown)
+ALTER TABLE ip ADD COLUMN IF NOT EXISTS asn BIGINT;
+
+-- Autonomous system organization
+ALTER TABLE ip ADD COLUMN IF NOT EXISTS as_org TEXT;
+
+-- ISO 3166-1 alpha-2 country code
+ALTER TABLE ip ADD COLUMN IF NOT EXISTS country VARCHAR(2);
+
+-- Time of the last annotation (NULL = never annotated)
+ALTER TABLE ip ADD COLUMN IF NOT EXISTS geo_time TIMESTAMP;
+
+-- Export lists and domain filters select IPs by ASN and country
+CREATE INDEX IF NOT EXISTS idx_ip_asn ON ip(asn) WHERE asn IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_ip_country ON ip(country) WHERE country IS NOT NULL;
+
+-- Enrichment picks rows never annotated or annotated before the last database update
+CREATE INDEX IF NOT EXISTS idx_ip_geo_time ON ip(geo_time);
+
+COMMENT ON COLUMN ip.asn IS 'Autonomous system number from the ASN MMDB database';
+COMMENT ON COLUMN ip.as_org IS 'Autonomous system organization from the ASN MMDB database';
+COMMENT ON COLUMN ip.country IS 'ISO country code from the country MMDB database';
+COMMENT ON COLUMN ip.geo_time IS 'Time of the last ASN/country annotation';
@@ -0,0 +1,6 @@
+-- Rollback per-domain resolution policies
+-- Version: 1.0.0
+
+DROP INDEX IF EXISTS idx_domain_policy;
+ALTER TABLE domain DROP COLUMN IF EXISTS resolv_interval;
+ALTER TABLE domain DROP COLUMN IF EXISTS policy;
@@ -0,0 +1,9 @@
+-- Rollback IP observation history
+-- Version: 1.0.0
+
+ALTER TABLE ip DROP COLUMN IF EXISTS seen_history;
+ALTER TABLE ip DROP COLUMN IF EXISTS last_source;
+ALTER TABLE ip DROP COLUMN IF EXISTS first_source;
+ALTER TABLE ip DROP COLUMN IF EXISTS seen_count;
+ALTER TABLE ip DROP COLUMN IF EXISTS last_seen;
+ALTER TABLE ip DROP COLUMN IF EXISTS first_seen;
@@ -0,0 +1,22 @@
+-- IP set change events
+-- Whenever a resolution of a domain returns a set of IPs different from the
+-- previous resolution, the collector stores the added and removed addresses,
+-- so moves between hosting providers can be traced.
+-- Version: 1.0.0
+
+CREATE TABLE IF NOT EXISTS ip_change_event (
+    id BIGSERIAL PRIMARY KEY,
+    domain_id INTEGER NOT NULL REFERENCES domain(id) ON DELETE CASCADE,
+    time TIMESTAMP NOT NULL,
+    added TEXT[] NOT NULL DEFAULT '{}',
+    removed TEXT[] NOT NULL DEFAULT '{}'
+);
+
+-- History of one domain and the global recent changes feed
+CREATE INDEX IF NOT EXISTS idx_ip_change_event_domain ON ip_change_event(domain_id, time);
+CREATE INDEX IF NOT EXISTS idx_ip_change_event_time ON ip_change_event(time);
+
+COMMENT ON TABLE ip_change_event IS 'Changes of the IP set of a domain between consecutive resolutions';
+COMMENT ON COLUMN ip_change_event.time IS 'Time of the resolution that produced the change';
+COMMENT ON COLUMN ip_change_event.added IS 'Addresses not returned by the previous resolution';
+COMMENT ON COLUMN ip_change_event.removed IS 'Addresses of the previous resolution no longer returned';
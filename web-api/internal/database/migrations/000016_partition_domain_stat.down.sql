@@ -0,0 +1,25 @@
+-- Rollback partitioning of domain_stat
+-- Copies all rows back into a plain table; may take long on large tables.
+-- Version: 1.0.0
+
+CREATE TABLE domain_stat_plain (LIKE domain_stat INCLUDING DEFAULTS);
+INSERT INTO domain_stat_plain SELECT * FROM domain_stat;
+
+DO $$
+BEGIN
+    EXECUTE format('ALTER SEQUENCE %s OWNED BY domain_stat_plain.id',
+        pg_get_serial_sequence('domain_stat', 'id'));
+END $$;
+
+DROP TABLE domain_stat;
+ALTER TABLE domain_stat_plain RENAME TO domain_stat;
+ALTER TABLE domain_stat ADD PRIMARY KEY (id);
+
+CREATE INDEX IF NOT EXISTS idx_domain_stat_timestamp ON domain_stat(timestamp DESC);
+CREATE INDEX IF NOT EXISTS idx_domain_stat_client_ip ON domain_stat(client_ip);
+CREATE INDEX IF NOT EXISTS idx_domain_stat_domain ON domain_stat(domain);
+CREATE INDEX IF NOT EXISTS idx_domain_stat_rtype ON domain_stat(rtype);
+CREATE INDEX IF NOT EXISTS idx_domain_stat_time_client ON domain_stat(timestamp DESC, client_ip);
+CREATE INDEX IF NOT EXISTS idx_domain_stat_time_domain ON domain_stat(timestamp DESC, domain);
+
+COMMENT ON TABLE domain_stat IS 'Stores statistics for DNS queries';
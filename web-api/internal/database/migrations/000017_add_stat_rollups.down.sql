@@ -0,0 +1,8 @@
+-- Rollback hourly and daily rollups of query statistics
+-- Version: 1.0.0
+
+DROP TABLE IF EXISTS stat_rollup_state;
+DROP TABLE IF EXISTS domain_stat_daily;
+DROP TABLE IF EXISTS domain_stat_hourly;
+
+ALTER TABLE domain_stat DROP COLUMN IF EXISTS qtype;
@@ -0,0 +1,68 @@
+-- Native inet type for IP address columns
+-- ip.ip, ip_ptr.ip and the client_ip columns of the statistics were stored as
+-- text, so subnet filters had to cast every row (no index could be used) and
+-- clients recorded as 'unknown' broke the casts. Unknown clients become NULL.
+-- Rewrites domain_stat; may take long on large tables.
+-- Version: 1.0.0
+
+-- Text to inet conversion mapping values that are not IP addresses to NULL
+CREATE OR REPLACE FUNCTION pg_temp.try_inet(value TEXT) RETURNS inet AS $$
+BEGIN
+    RETURN value::inet;
+EXCEPTION WHEN invalid_text_representation THEN
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql IMMUTABLE;
+
+-- Resolved addresses are always valid; drop anything that isn't
+DELETE FROM ip WHERE pg_temp.try_inet(ip::TEXT) IS NULL;
+ALTER TABLE ip ALTER COLUMN ip TYPE inet USING ip::inet;
+
+DELETE FROM ip_ptr WHERE pg_temp.try_inet(ip::TEXT) IS NULL;
+ALTER TABLE ip_ptr ALTER COLUMN ip TYPE inet USING ip::inet;
+
+-- Client addresses: NULL for unknown clients. Fresh databases get inet columns
+-- from the collector already, so the values are read as text either way.
+ALTER TABLE domain_stat ALTER COLUMN client_ip DROP NOT NULL;
+ALTER TABLE domain_stat ALTER COLUMN client_ip TYPE inet
+    USING CASE WHEN client_ip::TEXT = 'unknown' THEN NULL ELSE pg_temp.try_inet(client_ip::TEXT) END;
+
+-- Rollups: the primary key can't hold NULL clients, a unique index treating NULLs
+-- as equal takes its place (also used by ON CONFLICT)
+ALTER TABLE domain_stat_hourly DROP CONSTRAINT IF EXISTS domain_stat_hourly_pkey;
+ALTER TABLE domain_stat_hourly ALTER COLUMN client_ip DROP NOT NULL;
+ALTER TABLE domain_stat_hourly ALTER COLUMN client_ip TYPE inet USING pg_temp.try_inet(client_ip::TEXT);
+
+-- Every client that wasn't an address is now NULL: merge their counts
+WITH unknown AS (
+    DELETE FROM domain_stat_hourly WHERE client_ip IS NULL
+    RETURNING bucket, domain, qtype, count
+)
+INSERT INTO domain_stat_hourly (bucket, domain, client_ip, qtype, count)
+SELECT bucket, domain, NULL, qtype, SUM(count) FROM unknown GROUP BY bucket, domain, qtype;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_domain_stat_hourly_key
+    ON domain_stat_hourly(bucket, domain, client_ip, qtype) NULLS NOT DISTINCT;
+
+ALTER TABLE domain_stat_daily DROP CONSTRAINT IF EXISTS domain_stat_daily_pkey;
+ALTER TABLE domain_stat_daily ALTER COLUMN client_ip DROP NOT NULL;
+ALTER TABLE domain_stat_daily ALTER COLUMN client_ip TYPE inet USING pg_temp.try_inet(client_ip::TEXT);
+
+WITH unknown AS (
+    DELETE FROM domain_stat_daily WHERE client_ip IS NULL
+    RETURNING bucket, domain, qtype, count
+)
+INSERT INTO domain_stat_daily (bucket, domain, client_ip, qtype, count)
+SELECT bucket, domain, NULL, qtype, SUM(count) FROM unknown GROUP BY bucket, domain, qtype;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_domain_stat_daily_key
+    ON domain_stat_daily(bucket, domain, client_ip, qtype) NULLS NOT DISTINCT;
+
+-- Containment searches (<<, <<=, &&) on addresses and client subnets
+CREATE INDEX IF NOT EXISTS idx_ip_address_gist ON ip USING gist (ip inet_ops);
+CREATE INDEX IF NOT EXISTS idx_domain_stat_client_ip_spgist ON domain_stat USING spgist (client_ip);
+
+COMMENT ON COLUMN ip.ip IS 'Resolved IPv4 or IPv6 address';
+COMMENT ON COLUMN domain_stat.client_ip IS 'Address of the client that sent the query (NULL if unknown)';
+COMMENT ON COLUMN domain_stat_hourly.client_ip IS 'Address of the client (NULL if unknown)';
+COMMENT ON COLUMN domain_stat_daily.client_ip IS 'Address of the client (NULL if unknown)';
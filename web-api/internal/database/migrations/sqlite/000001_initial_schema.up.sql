@@ -0,0 +1,141 @@
+-- Initial database schema for DNS Collector
+-- SQLite migration script for the embedded storage backend (database.driver: sqlite)
+-- Same tables as the PostgreSQL schema after its migration 000018, with SQLite types:
+--   * timestamps are TEXT 'YYYY-MM-DD HH:MM:SS.ffffff' in the collector's local time
+--   * IP addresses are TEXT (NULL client_ip = unknown client)
+--   * ip_change_event.added/removed are JSON arrays
+--   * domain_stat is a single table; retention deletes whole expired days
+-- domain_priority() and the REGEXP operator are provided by the application.
+-- Version: 1.0.0
+
+CREATE TABLE IF NOT EXISTS domain (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    domain TEXT NOT NULL UNIQUE,
+    time_insert TIMESTAMP NOT NULL,
+    resolv_count INTEGER NOT NULL DEFAULT 0,
+    max_resolv INTEGER NOT NULL,
+    last_resolv_time TIMESTAMP NOT NULL,
+    last_seen TIMESTAMP,
+    last_error TEXT,
+    consecutive_failures INTEGER NOT NULL DEFAULT 0,
+    next_resolv_time TIMESTAMP,
+    leased_until TIMESTAMP,
+    query_count INTEGER NOT NULL DEFAULT 0,
+    dnssec_status TEXT,
+    wildcard_zone TEXT,
+    policy TEXT,
+    resolv_interval INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS idx_domain_resolv_lookup ON domain(resolv_count, last_resolv_time);
+CREATE INDEX IF NOT EXISTS idx_domain_last_seen ON domain(last_seen);
+CREATE INDEX IF NOT EXISTS idx_domain_next_resolv_time ON domain(next_resolv_time);
+CREATE INDEX IF NOT EXISTS idx_domain_dnssec_status ON domain(dnssec_status);
+CREATE INDEX IF NOT EXISTS idx_domain_wildcard_zone ON domain(wildcard_zone, id);
+CREATE INDEX IF NOT EXISTS idx_domain_policy ON domain(policy);
+
+CREATE TABLE IF NOT EXISTS wildcard_zone (
+    zone TEXT PRIMARY KEY,
+    is_wildcard BOOLEAN NOT NULL,
+    detected_at TIMESTAMP,
+    checked_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS ip (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    domain_id INTEGER NOT NULL REFERENCES domain(id) ON DELETE CASCADE,
+    ip TEXT NOT NULL,
+    type TEXT NOT NULL CHECK (type IN ('ipv4', 'ipv6')),
+    time TIMESTAMP NOT NULL,
+    asn INTEGER,
+    as_org TEXT,
+    country TEXT,
+    geo_time TIMESTAMP,
+    first_seen TIMESTAMP,
+    last_seen TIMESTAMP,
+    seen_count INTEGER NOT NULL DEFAULT 1,
+    first_source TEXT,
+    last_source TEXT,
+    seen_history INTEGER NOT NULL DEFAULT 0,
+    UNIQUE(domain_id, ip)
+);
+
+CREATE INDEX IF NOT EXISTS idx_ip_domain_type ON ip(domain_id, type);
+CREATE INDEX IF NOT EXISTS idx_ip_address ON ip(ip);
+CREATE INDEX IF NOT EXISTS idx_ip_time ON ip(time);
+CREATE INDEX IF NOT EXISTS idx_ip_asn ON ip(asn) WHERE asn IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_ip_country ON ip(country) WHERE country IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_ip_geo_time ON ip(geo_time);
+
+CREATE TABLE IF NOT EXISTS ip_vantage (
+    ip_id INTEGER NOT NULL REFERENCES ip(id) ON DELETE CASCADE,
+    vantage TEXT NOT NULL,
+    time TIMESTAMP NOT NULL,
+    PRIMARY KEY (ip_id, vantage)
+);
+
+CREATE INDEX IF NOT EXISTS idx_ip_vantage_vantage ON ip_vantage(vantage);
+
+CREATE TABLE IF NOT EXISTS ip_change_event (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    domain_id INTEGER NOT NULL REFERENCES domain(id) ON DELETE CASCADE,
+    time TIMESTAMP NOT NULL,
+    added TEXT NOT NULL DEFAULT '[]',
+    removed TEXT NOT NULL DEFAULT '[]'
+);
+
+CREATE INDEX IF NOT EXISTS idx_ip_change_event_domain ON ip_change_event(domain_id, time);
+CREATE INDEX IF NOT EXISTS idx_ip_change_event_time ON ip_change_event(time);
+
+CREATE TABLE IF NOT EXISTS ip_ptr (
+    ip TEXT PRIMARY KEY,
+    ptr TEXT NOT NULL DEFAULT '',
+    time TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_ip_ptr_time ON ip_ptr(time);
+
+CREATE TABLE IF NOT EXISTS domain_stat (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    domain TEXT NOT NULL,
+    client_ip TEXT,
+    qtype TEXT NOT NULL DEFAULT '',
+    rtype TEXT NOT NULL,
+    timestamp TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_domain_stat_timestamp ON domain_stat(timestamp);
+CREATE INDEX IF NOT EXISTS idx_domain_stat_client_ip ON domain_stat(client_ip);
+CREATE INDEX IF NOT EXISTS idx_domain_stat_domain ON domain_stat(domain);
+
+-- Rollups; unknown clients (NULL) share one row per bucket, domain and qtype
+CREATE TABLE IF NOT EXISTS domain_stat_hourly (
+    bucket TIMESTAMP NOT NULL,
+    domain TEXT NOT NULL,
+    client_ip TEXT,
+    qtype TEXT NOT NULL,
+    count INTEGER NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_domain_stat_hourly_key
+    ON domain_stat_hourly(bucket, domain, IFNULL(client_ip, ''), qtype);
+CREATE INDEX IF NOT EXISTS idx_domain_stat_hourly_domain ON domain_stat_hourly(domain, bucket);
+CREATE INDEX IF NOT EXISTS idx_domain_stat_hourly_client_ip ON domain_stat_hourly(client_ip, bucket);
+
+CREATE TABLE IF NOT EXISTS domain_stat_daily (
+    bucket TIMESTAMP NOT NULL,
+    domain TEXT NOT NULL,
+    client_ip TEXT,
+    qtype TEXT NOT NULL,
+    count INTEGER NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_domain_stat_daily_key
+    ON domain_stat_daily(bucket, domain, IFNULL(client_ip, ''), qtype);
+CREATE INDEX IF NOT EXISTS idx_domain_stat_daily_domain ON domain_stat_daily(domain, bucket);
+CREATE INDEX IF NOT EXISTS idx_domain_stat_daily_client_ip ON domain_stat_daily(client_ip, bucket);
+
+CREATE TABLE IF NOT EXISTS stat_rollup_state (
+    rollup TEXT PRIMARY KEY,
+    rolled_up_to TIMESTAMP NOT NULL
+);
@@ -0,0 +1,308 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"dns-collector-webapi/internal/models"
+)
+
+// Sources of aggregate stats queries
+const (
+	StatsSourceRaw    = "raw"
+	StatsSourceHourly = "hourly"
+	StatsSourceDaily  = "daily"
+)
+
+// DefaultRollupThreshold is the shortest range answered from the rollup tables
+const DefaultRollupThreshold = 48 * time.Hour
+
+// statsGroupColumns are the columns aggregate stats can be grouped by
+var statsGroupColumns = map[string]bool{"domain": true, "client_ip": true, "qtype": true}
+
+// statSegment is a time range of an aggregate query answered from one table
+type statSegment struct {
+	table    string
+	column   string // time column
+	count    string // number of queries per row
+	from, to time.Time
+}
+
+// SetRollupThreshold sets the shortest range for which aggregate stats are read
+// from domain_stat_hourly/domain_stat_daily instead of domain_stat.
+func (db *Database) SetRollupThreshold(d time.Duration) {
+	db.rollupThreshold = d
+}
+
+// GetStatsAggregate counts queries in [DateFrom, DateTo), grouped by the requested
+// columns and optionally by hour or day. Short ranges are counted from domain_stat;
+// longer ones from the rollups the collector maintains, with the part not rolled up
+// yet (the last hour or day) taken from the finer tables.
+func (db *Database) GetStatsAggregate(filter models.StatsAggregateFilter) (*models.StatsAggregateResult, error) {
+	if err := validateStatsAggregateFilter(filter); err != nil {
+		return nil, err
+	}
+
+	source := db.statsSource(filter)
+	result := &models.StatsAggregateResult{
+		Data:     []models.StatsAggregate{},
+		Source:   source,
+		DateFrom: filter.DateFrom,
+		DateTo:   filter.DateTo,
+	}
+
+	var hourly, daily time.Time
+	if source != StatsSourceRaw {
+		var err error
+		if hourly, daily, err = getRollupWatermarks(db.DB, filter.DateFrom.Location()); err != nil {
+			return nil, err
+		}
+	}
+	segments := planStatSegments(source, filter.DateFrom, filter.DateTo, hourly, daily)
+	if len(segments) > 0 {
+		result.DateFrom = segments[0].from
+	}
+
+	// Union of the segments, each row with its number of queries
+	args := []interface{}{}
+	parts := make([]string, 0, len(segments))
+	for _, seg := range segments {
+		args = append(args, seg.from, seg.to)
+		parts = append(parts, fmt.Sprintf(
+			"SELECT %[1]s AS time, domain, client_ip, qtype, %[2]s AS count FROM %[3]s WHERE %[1]s >= $%[4]d AND %[1]s < $%[5]d",
+			seg.column, seg.count, seg.table, len(args)-1, len(args),
+		))
+	}
+
+	// Apply filters
+	var conditions []string
+	if filter.DomainRegex != "" {
+		args = append(args, filter.DomainRegex)
+		conditions = append(conditions, fmt.Sprintf("domain ~ $%d", len(args)))
+	}
+	if len(filter.ClientIPs) > 0 {
+		ips, unknown, err := splitClientIPs(filter.ClientIPs)
+		if err != nil {
+			return nil, err
+		}
+		var ipConditions []string
+		if len(ips) > 0 {
+			ipConditions = append(ipConditions, "client_ip IN ("+appendPlaceholders(&args, ips)+")")
+		}
+		if unknown {
+			ipConditions = append(ipConditions, "client_ip IS NULL")
+		}
+		conditions = append(conditions, "("+strings.Join(ipConditions, " OR ")+")")
+	}
+	if filter.QType != "" {
+		args = append(args, filter.QType)
+		conditions = append(conditions, fmt.Sprintf("qtype = $%d", len(args)))
+	}
+
+	columns := append([]string{}, filter.GroupBy...)
+	orderBy := "count DESC"
+	if filter.Interval != "" {
+		columns = append([]string{fmt.Sprintf("date_trunc('%s', time) AS bucket", filter.Interval)}, columns...)
+		orderBy = "bucket ASC, count DESC"
+	}
+
+	query := "SELECT "
+	if len(columns) > 0 {
+		query += strings.Join(columns, ", ") + ", "
+	}
+	query += "SUM(count)::BIGINT AS count FROM (" + strings.Join(parts, " UNION ALL ") + ") s"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	if len(columns) > 0 {
+		groups := make([]string, len(columns))
+		for i := range columns {
+			groups[i] = fmt.Sprintf("%d", i+1)
+		}
+		query += " GROUP BY " + strings.Join(groups, ", ")
+	}
+	query += " ORDER BY " + orderBy
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 100 // Default limit
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(" LIMIT $%d", len(args))
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query aggregate stats: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var a models.StatsAggregate
+		var bucket time.Time
+		var clientIP sql.NullString
+		dest := []interface{}{}
+		if filter.Interval != "" {
+			dest = append(dest, &bucket)
+		}
+		for _, col := range filter.GroupBy {
+			switch col {
+			case "domain":
+				dest = append(dest, &a.Domain)
+			case "client_ip":
+				dest = append(dest, &clientIP)
+			case "qtype":
+				dest = append(dest, &a.QType)
+			}
+		}
+		dest = append(dest, &a.Count)
+
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan aggregate stat: %w", err)
+		}
+		if filter.Interval != "" {
+			a.Bucket = &bucket
+		}
+		if clientIP.Valid {
+			a.ClientIP = clientIP.String
+		} else if slices.Contains(filter.GroupBy, "client_ip") {
+			a.ClientIP = UnknownClientIP
+		}
+		result.Data = append(result.Data, a)
+	}
+
+	return result, rows.Err()
+}
+
+// statsSource picks the table an aggregate query is answered from: short ranges
+// from domain_stat, hourly buckets from the hourly rollup, everything else from
+// the daily rollup.
+func (db *Database) statsSource(filter models.StatsAggregateFilter) string {
+	return statsSource(db.rollupThreshold, filter)
+}
+
+// validateStatsAggregateFilter checks the grouping, interval, range and regex of an
+// aggregate stats query
+func validateStatsAggregateFilter(filter models.StatsAggregateFilter) error {
+	for _, col := range filter.GroupBy {
+		if !statsGroupColumns[col] {
+			return fmt.Errorf("invalid group_by column: %s", col)
+		}
+	}
+	if filter.Interval != "" && filter.Interval != "hour" && filter.Interval != "day" {
+		return fmt.Errorf("invalid interval: %s", filter.Interval)
+	}
+	if !filter.DateFrom.Before(filter.DateTo) {
+		return fmt.Errorf("date_from must be before date_to")
+	}
+	if filter.DomainRegex != "" {
+		if err := validateDomainRegex(filter.DomainRegex); err != nil {
+			return fmt.Errorf("invalid domain regex: %w", err)
+		}
+	}
+	return nil
+}
+
+// statsSource picks the source of an aggregate query for the given rollup threshold
+func statsSource(threshold time.Duration, filter models.StatsAggregateFilter) string {
+	if threshold <= 0 {
+		threshold = DefaultRollupThreshold
+	}
+	if filter.DateTo.Sub(filter.DateFrom) < threshold {
+		return StatsSourceRaw
+	}
+	if filter.Interval == "hour" {
+		return StatsSourceHourly
+	}
+	return StatsSourceDaily
+}
+
+// getRollupWatermarks returns the times up to which the hourly and daily rollups
+// are complete, as wall time in loc (zero if a rollup hasn't run yet)
+func getRollupWatermarks(conn *sql.DB, loc *time.Location) (time.Time, time.Time, error) {
+	rows, err := conn.Query(`SELECT rollup, rolled_up_to FROM stat_rollup_state`)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to query rollup state: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var hourly, daily time.Time
+	for rows.Next() {
+		var rollup string
+		var t time.Time
+		if err := rows.Scan(&rollup, &t); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("failed to scan rollup state: %w", err)
+		}
+		// TIMESTAMP values carry no zone: keep the wall time
+		t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+		switch rollup {
+		case StatsSourceHourly:
+			hourly = t
+		case StatsSourceDaily:
+			daily = t
+		}
+	}
+
+	return hourly, daily, rows.Err()
+}
+
+// planStatSegments splits [from, to) between the tables of source: the daily rollup up to
+// its watermark, then the hourly rollup up to its watermark, then domain_stat. Rollup
+// ranges start at the whole hour or day containing from.
+func planStatSegments(source string, from, to, hourly, daily time.Time) []statSegment {
+	raw := statSegment{table: "domain_stat", column: "timestamp", count: "1"}
+	hourlySeg := statSegment{table: "domain_stat_hourly", column: "bucket", count: "count"}
+	dailySeg := statSegment{table: "domain_stat_daily", column: "bucket", count: "count"}
+
+	var segments []statSegment
+	add := func(seg statSegment, segFrom, segTo time.Time) {
+		if segFrom.Before(segTo) {
+			seg.from, seg.to = segFrom, segTo
+			segments = append(segments, seg)
+		}
+	}
+
+	switch source {
+	case StatsSourceDaily:
+		from = startOfDay(from)
+		d := startOfDay(clampTime(daily, from, to))
+		h := startOfHour(clampTime(hourly, d, to))
+		add(dailySeg, from, d)
+		add(hourlySeg, d, h)
+		add(raw, h, to)
+	case StatsSourceHourly:
+		from = startOfHour(from)
+		h := startOfHour(clampTime(hourly, from, to))
+		add(hourlySeg, from, h)
+		add(raw, h, to)
+	default:
+		add(raw, from, to)
+	}
+
+	return segments
+}
+
+// clampTime limits t to [lo, hi]
+func clampTime(t, lo, hi time.Time) time.Time {
+	if t.Before(lo) {
+		return lo
+	}
+	if t.After(hi) {
+		return hi
+	}
+	return t
+}
+
+// startOfHour truncates t to the start of its hour in t's location
+func startOfHour(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, t.Hour(), 0, 0, 0, t.Location())
+}
+
+// startOfDay truncates t to midnight of its day in t's location
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,952 @@
+package database
+
+import (
+	"container/list"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/bits"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"modernc.org/sqlite"
+
+	"dns-collector-webapi/internal/models"
+)
+
+// sqliteTimeLayout is the format of timestamps written by the collector's SQLite
+// backend: local wall time with fixed-width fractional seconds
+const sqliteTimeLayout = "2006-01-02 15:04:05.000000"
+
+// sqliteNow is LOCALTIMESTAMP in the stored timestamp format
+const sqliteNow = "strftime('%Y-%m-%d %H:%M:%f', 'now', 'localtime')"
+
+// sqliteTruncFormats are the strftime formats of the date_trunc units of aggregate stats
+var sqliteTruncFormats = map[string]string{
+	"hour": "%Y-%m-%d %H:00:00",
+	"day":  "%Y-%m-%d 00:00:00",
+}
+
+// SQLiteDatabase reads the SQLite file of a collector running with database.driver: sqlite.
+// It answers the same queries as Database; PostgreSQL operators are provided as
+// application-defined functions.
+type SQLiteDatabase struct {
+	DB       *sql.DB
+	path     string
+	priority models.PriorityWeights // weights of the domain_priority() score
+
+	rollupThreshold time.Duration // shortest aggregate stats range read from the rollups
+}
+
+func init() {
+	sqlite.MustRegisterDeterministicScalarFunction("regexp", 2, sqliteRegexp)
+	sqlite.MustRegisterDeterministicScalarFunction("domain_priority", 7, sqliteDomainPriority)
+	sqlite.MustRegisterDeterministicScalarFunction("bit_count", 1, sqliteBitCount)
+	sqlite.MustRegisterDeterministicScalarFunction("ip_in_subnet", 2, sqliteIPInSubnet)
+}
+
+// NewSQLite opens the SQLite database file at path
+func NewSQLite(path string) (*SQLiteDatabase, error) {
+	// WAL lets the API read while the collector writes; wait for the collector's write lock
+	db, err := sql.Open("sqlite", path+"?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	// Test connection
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	db.SetMaxOpenConns(4)
+
+	return &SQLiteDatabase{
+		DB:       db,
+		path:     path,
+		priority: models.DefaultPriorityWeights(),
+
+		rollupThreshold: DefaultRollupThreshold,
+	}, nil
+}
+
+// SetPriorityWeights sets the weights used to compute the domain priority column.
+// They should match the collector's resolver.priority_weights.
+func (db *SQLiteDatabase) SetPriorityWeights(w models.PriorityWeights) {
+	db.priority = w
+}
+
+// SetRollupThreshold sets the shortest range for which aggregate stats are read
+// from domain_stat_hourly/domain_stat_daily instead of domain_stat.
+func (db *SQLiteDatabase) SetRollupThreshold(d time.Duration) {
+	db.rollupThreshold = d
+}
+
+func (db *SQLiteDatabase) Close() error {
+	if db.DB != nil {
+		return db.DB.Close()
+	}
+	return nil
+}
+
+// sqliteArgs formats the time.Time arguments of a query as stored timestamps
+func sqliteArgs(args []interface{}) []interface{} {
+	out := make([]interface{}, len(args))
+	for i, arg := range args {
+		if t, ok := arg.(time.Time); ok {
+			arg = t.In(time.Local).Format(sqliteTimeLayout)
+		}
+		out[i] = arg
+	}
+	return out
+}
+
+func (db *SQLiteDatabase) query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.DB.Query(query, sqliteArgs(args)...)
+}
+
+func (db *SQLiteDatabase) queryRow(query string, args ...interface{}) *sql.Row {
+	return db.DB.QueryRow(query, sqliteArgs(args)...)
+}
+
+// GetStats retrieves DNS query statistics with filtering and sorting
+func (db *SQLiteDatabase) GetStats(filter models.StatsFilter) ([]models.DomainStat, int64, error) {
+	where := " WHERE 1=1"
+	args := []interface{}{}
+
+	// Apply client IP filters
+	var ipConditions []string
+	if len(filter.ClientIPs) > 0 {
+		ips, unknown, err := splitClientIPs(filter.ClientIPs)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(ips) > 0 {
+			ipConditions = append(ipConditions, "client_ip IN ("+appendPlaceholders(&args, ips)+")")
+		}
+		if unknown {
+			ipConditions = append(ipConditions, "client_ip IS NULL")
+		}
+	}
+	if filter.Subnet != "" {
+		if _, _, err := net.ParseCIDR(filter.Subnet); err != nil {
+			return nil, 0, fmt.Errorf("invalid subnet format: %w", err)
+		}
+		args = append(args, filter.Subnet)
+		ipConditions = append(ipConditions, fmt.Sprintf("ip_in_subnet(client_ip, $%d)", len(args)))
+	}
+	if len(ipConditions) > 0 {
+		where += " AND (" + strings.Join(ipConditions, " OR ") + ")"
+	}
+
+	// Apply date filters
+	if !filter.DateFrom.IsZero() {
+		args = append(args, filter.DateFrom)
+		where += fmt.Sprintf(" AND timestamp >= $%d", len(args))
+	}
+	if !filter.DateTo.IsZero() {
+		args = append(args, filter.DateTo)
+		where += fmt.Sprintf(" AND timestamp <= $%d", len(args))
+	}
+
+	// Get total count
+	var total int64
+	if err := db.queryRow("SELECT COUNT(*) FROM domain_stat"+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count stats: %w", err)
+	}
+
+	// Apply sorting
+	validSortFields := map[string]bool{
+		"id": true, "domain": true, "client_ip": true, "qtype": true, "rtype": true, "timestamp": true,
+	}
+	sortBy := "timestamp"
+	if filter.SortBy != "" && validSortFields[filter.SortBy] {
+		sortBy = filter.SortBy
+	}
+	sortOrder := "DESC"
+	if filter.SortOrder == "asc" {
+		sortOrder = "ASC"
+	}
+
+	query := "SELECT id, domain, client_ip, qtype, rtype, timestamp FROM domain_stat" + where +
+		fmt.Sprintf(" ORDER BY %s %s", sortBy, sortOrder)
+	query += paginate(&args, filter.Limit, filter.Offset)
+
+	rows, err := db.query(query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query stats: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var stats []models.DomainStat
+	for rows.Next() {
+		var s models.DomainStat
+		var clientIP sql.NullString
+		if err := rows.Scan(&s.ID, &s.Domain, &clientIP, &s.QType, &s.RType, &s.Timestamp); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan stat: %w", err)
+		}
+		s.ClientIP = clientIPString(clientIP)
+		stats = append(stats, s)
+	}
+
+	return stats, total, rows.Err()
+}
+
+// GetStatsAggregate counts queries in [DateFrom, DateTo) like Database.GetStatsAggregate.
+func (db *SQLiteDatabase) GetStatsAggregate(filter models.StatsAggregateFilter) (*models.StatsAggregateResult, error) {
+	if err := validateStatsAggregateFilter(filter); err != nil {
+		return nil, err
+	}
+
+	source := statsSource(db.rollupThreshold, filter)
+	result := &models.StatsAggregateResult{
+		Data:     []models.StatsAggregate{},
+		Source:   source,
+		DateFrom: filter.DateFrom,
+		DateTo:   filter.DateTo,
+	}
+
+	var hourly, daily time.Time
+	if source != StatsSourceRaw {
+		var err error
+		if hourly, daily, err = getRollupWatermarks(db.DB, filter.DateFrom.Location()); err != nil {
+			return nil, err
+		}
+	}
+	segments := planStatSegments(source, filter.DateFrom, filter.DateTo, hourly, daily)
+	if len(segments) > 0 {
+		result.DateFrom = segments[0].from
+	}
+
+	// Union of the segments, each row with its number of queries
+	args := []interface{}{}
+	parts := make([]string, 0, len(segments))
+	for _, seg := range segments {
+		args = append(args, seg.from, seg.to)
+		parts = append(parts, fmt.Sprintf(
+			"SELECT %[1]s AS time, domain, client_ip, qtype, %[2]s AS count FROM %[3]s WHERE %[1]s >= $%[4]d AND %[1]s < $%[5]d",
+			seg.column, seg.count, seg.table, len(args)-1, len(args),
+		))
+	}
+
+	// Apply filters
+	var conditions []string
+	if filter.DomainRegex != "" {
+		args = append(args, filter.DomainRegex)
+		conditions = append(conditions, fmt.Sprintf("domain REGEXP $%d", len(args)))
+	}
+	if len(filter.ClientIPs) > 0 {
+		ips, unknown, err := splitClientIPs(filter.ClientIPs)
+		if err != nil {
+			return nil, err
+		}
+		var ipConditions []string
+		if len(ips) > 0 {
+			ipConditions = append(ipConditions, "client_ip IN ("+appendPlaceholders(&args, ips)+")")
+		}
+		if unknown {
+			ipConditions = append(ipConditions, "client_ip IS NULL")
+		}
+		conditions = append(conditions, "("+strings.Join(ipConditions, " OR ")+")")
+	}
+	if filter.QType != "" {
+		args = append(args, filter.QType)
+		conditions = append(conditions, fmt.Sprintf("qtype = $%d", len(args)))
+	}
+
+	columns := append([]string{}, filter.GroupBy...)
+	orderBy := "count DESC"
+	if filter.Interval != "" {
+		columns = append([]string{fmt.Sprintf("strftime('%s', time) AS bucket", sqliteTruncFormats[filter.Interval])}, columns...)
+		orderBy = "bucket ASC, count DESC"
+	}
+
+	query := "SELECT "
+	if len(columns) > 0 {
+		query += strings.Join(columns, ", ") + ", "
+	}
+	query += "SUM(count) AS count FROM (" + strings.Join(parts, " UNION ALL ") + ") s"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	if len(columns) > 0 {
+		groups := make([]string, len(columns))
+		for i := range columns {
+			groups[i] = fmt.Sprintf("%d", i+1)
+		}
+		query += " GROUP BY " + strings.Join(groups, ", ")
+	}
+	query += " ORDER BY " + orderBy
+	query += paginate(&args, filter.Limit, 0)
+
+	rows, err := db.query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query aggregate stats: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var a models.StatsAggregate
+		var bucket string
+		var clientIP sql.NullString
+		dest := []interface{}{}
+		if filter.Interval != "" {
+			dest = append(dest, &bucket)
+		}
+		for _, col := range filter.GroupBy {
+			switch col {
+			case "domain":
+				dest = append(dest, &a.Domain)
+			case "client_ip":
+				dest = append(dest, &clientIP)
+			case "qtype":
+				dest = append(dest, &a.QType)
+			}
+		}
+		dest = append(dest, &a.Count)
+
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan aggregate stat: %w", err)
+		}
+		if filter.Interval != "" {
+			// Wall time without zone, as date_trunc() of a TIMESTAMP is scanned from PostgreSQL
+			t, err := time.Parse(time.DateTime, bucket)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse aggregate bucket: %w", err)
+			}
+			a.Bucket = &t
+		}
+		if clientIP.Valid {
+			a.ClientIP = clientIP.String
+		} else if slices.Contains(filter.GroupBy, "client_ip") {
+			a.ClientIP = UnknownClientIP
+		}
+		result.Data = append(result.Data, a)
+	}
+
+	return result, rows.Err()
+}
+
+// GetDomains retrieves domains with filtering and sorting
+func (db *SQLiteDatabase) GetDomains(filter models.DomainsFilter) ([]models.Domain, int64, error) {
+	where := " WHERE 1=1"
+	args := []interface{}{}
+
+	// Apply domain regex filter in SQL
+	if filter.DomainRegex != "" {
+		// Validate regex pattern to prevent ReDoS attacks
+		if err := validateDomainRegex(filter.DomainRegex); err != nil {
+			return nil, 0, err
+		}
+		args = append(args, filter.DomainRegex)
+		where += fmt.Sprintf(" AND domain REGEXP $%d", len(args))
+	}
+
+	// Apply failure filters
+	if filter.Dead {
+		minFailures := filter.MinFailures
+		if minFailures <= 0 {
+			minFailures = 3 // Default threshold for dead domains
+		}
+		args = append(args, minFailures)
+		where += fmt.Sprintf(" AND consecutive_failures >= $%d", len(args))
+	}
+	if filter.LastError != "" {
+		args = append(args, filter.LastError)
+		where += fmt.Sprintf(" AND last_error = $%d", len(args))
+	}
+	if filter.DNSSECStatus != "" {
+		args = append(args, filter.DNSSECStatus)
+		where += fmt.Sprintf(" AND dnssec_status = $%d", len(args))
+	}
+	if filter.WildcardZone != "" {
+		args = append(args, filter.WildcardZone)
+		where += fmt.Sprintf(" AND wildcard_zone = $%d", len(args))
+	}
+	if filter.Policy != "" {
+		args = append(args, filter.Policy)
+		where += fmt.Sprintf(" AND policy = $%d", len(args))
+	}
+
+	// Apply GeoIP filters (domains with at least one IP in the AS / country)
+	if filter.ASN > 0 {
+		args = append(args, filter.ASN)
+		where += fmt.Sprintf(" AND id IN (SELECT domain_id FROM ip WHERE asn = $%d)", len(args))
+	}
+	if filter.Country != "" {
+		args = append(args, strings.ToUpper(filter.Country))
+		where += fmt.Sprintf(" AND id IN (SELECT domain_id FROM ip WHERE country = $%d)", len(args))
+	}
+
+	// Apply date filters
+	if !filter.DateFrom.IsZero() {
+		args = append(args, filter.DateFrom)
+		where += fmt.Sprintf(" AND time_insert >= $%d", len(args))
+	}
+	if !filter.DateTo.IsZero() {
+		args = append(args, filter.DateTo)
+		where += fmt.Sprintf(" AND time_insert <= $%d", len(args))
+	}
+
+	// Get total count
+	var total int64
+	if err := db.queryRow("SELECT COUNT(*) FROM domain"+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count domains: %w", err)
+	}
+
+	// Apply sorting
+	validSortFields := map[string]bool{
+		"id": true, "domain": true, "time_insert": true,
+		"resolv_count": true, "max_resolv": true, "last_resolv_time": true, "last_seen": true,
+		"consecutive_failures": true, "next_resolv_time": true, "query_count": true, "priority": true, "dnssec_status": true,
+	}
+	sortBy := "time_insert"
+	if filter.SortBy != "" && validSortFields[filter.SortBy] {
+		sortBy = filter.SortBy
+	}
+	sortOrder := "DESC"
+	if filter.SortOrder == "asc" {
+		sortOrder = "ASC"
+	}
+
+	query := "SELECT " + selectDomainColumns(db.priority, sqliteNow) + " FROM domain" + where +
+		fmt.Sprintf(" ORDER BY %s %s", sortBy, sortOrder)
+	query += paginate(&args, filter.Limit, filter.Offset)
+
+	rows, err := db.query(query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query domains: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var domains []models.Domain
+	for rows.Next() {
+		var d models.Domain
+		if err := scanDomain(rows, &d); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan domain: %w", err)
+		}
+		domains = append(domains, d)
+	}
+
+	return domains, total, rows.Err()
+}
+
+// GetDomainIPs retrieves all IP addresses for a specific domain
+func (db *SQLiteDatabase) GetDomainIPs(domainID int64) ([]models.IP, error) {
+	rows, err := db.query(
+		`SELECT ip.id, ip.domain_id, ip.ip, ip.type, ip.time,
+			COALESCE(group_concat(v.vantage, ',' ORDER BY v.vantage), ''),
+			COALESCE(p.ptr, ''), ip.asn, COALESCE(ip.as_org, ''), COALESCE(ip.country, ''),
+			ip.first_seen, ip.last_seen, ip.seen_count, COALESCE(ip.first_source, ''), COALESCE(ip.last_source, ''),
+			bit_count(ip.seen_history)
+		FROM ip
+		LEFT JOIN ip_vantage v ON v.ip_id = ip.id
+		LEFT JOIN ip_ptr p ON p.ip = ip.ip
+		WHERE ip.domain_id = $1
+		GROUP BY ip.id, p.ptr
+		ORDER BY ip.type, ip.ip`,
+		domainID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query IPs: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var ips []models.IP
+	for rows.Next() {
+		var ip models.IP
+		var vantages string
+		if err := rows.Scan(&ip.ID, &ip.DomainID, &ip.IP, &ip.Type, &ip.Time, &vantages, &ip.PTR,
+			&ip.ASN, &ip.ASOrg, &ip.Country, &ip.FirstSeen, &ip.LastSeen, &ip.SeenCount, &ip.FirstSource,
+			&ip.LastSource, &ip.SeenRecent); err != nil {
+			return nil, fmt.Errorf("failed to scan IP: %w", err)
+		}
+		if list := parsePostgreSQLArray(vantages); len(list) > 0 {
+			ip.Vantages = list
+		}
+		ips = append(ips, ip)
+	}
+
+	return ips, rows.Err()
+}
+
+// GetDomainWithIPs retrieves a domain with all its IPs
+func (db *SQLiteDatabase) GetDomainWithIPs(domainID int64) (*models.Domain, error) {
+	query := "SELECT " + selectDomainColumns(db.priority, sqliteNow) + " FROM domain WHERE id = $1"
+
+	var d models.Domain
+	err := scanDomain(db.queryRow(query, domainID), &d)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("domain not found")
+		}
+		return nil, fmt.Errorf("failed to query domain: %w", err)
+	}
+
+	ips, err := db.GetDomainIPs(domainID)
+	if err != nil {
+		return nil, err
+	}
+	d.IPs = ips
+
+	return &d, nil
+}
+
+// GetDomainsWithIPs retrieves domains with all their IPs using bulk fetch to avoid N+1 queries
+func (db *SQLiteDatabase) GetDomainsWithIPs(filter models.DomainsFilter) ([]models.Domain, int64, error) {
+	domains, total, err := db.GetDomains(filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(domains) == 0 {
+		return domains, total, nil
+	}
+
+	domainIDs := make([]int64, len(domains))
+	domainMap := make(map[int64]*models.Domain)
+	for i := range domains {
+		domainIDs[i] = domains[i].ID
+		domainMap[domains[i].ID] = &domains[i]
+	}
+
+	args := []interface{}{}
+	rows, err := db.query(`
+		SELECT ip.id, ip.domain_id, ip.ip, ip.type, ip.time, COALESCE(p.ptr, ''),
+			ip.asn, COALESCE(ip.as_org, ''), COALESCE(ip.country, ''),
+			ip.first_seen, ip.last_seen, ip.seen_count
+		FROM ip
+		LEFT JOIN ip_ptr p ON p.ip = ip.ip
+		WHERE ip.domain_id IN (`+appendPlaceholders(&args, domainIDs)+`)
+		ORDER BY ip.domain_id, ip.type, ip.ip`,
+		args...,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch IPs: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var ip models.IP
+		if err := rows.Scan(&ip.ID, &ip.DomainID, &ip.IP, &ip.Type, &ip.Time, &ip.PTR,
+			&ip.ASN, &ip.ASOrg, &ip.Country, &ip.FirstSeen, &ip.LastSeen, &ip.SeenCount); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan IP: %w", err)
+		}
+		if domain, ok := domainMap[ip.DomainID]; ok {
+			domain.IPs = append(domain.IPs, ip)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return domains, total, nil
+}
+
+// GetIPChanges retrieves IP set change events, newest first, optionally limited
+// to one domain, domains matching a regex and a time range
+func (db *SQLiteDatabase) GetIPChanges(filter models.IPChangesFilter) ([]models.IPChangeEvent, int64, error) {
+	where := " WHERE 1=1"
+	args := []interface{}{}
+
+	if filter.DomainID > 0 {
+		args = append(args, filter.DomainID)
+		where += fmt.Sprintf(" AND e.domain_id = $%d", len(args))
+	}
+	if filter.DomainRegex != "" {
+		if err := validateDomainRegex(filter.DomainRegex); err != nil {
+			return nil, 0, err
+		}
+		args = append(args, filter.DomainRegex)
+		where += fmt.Sprintf(" AND d.domain REGEXP $%d", len(args))
+	}
+	if !filter.DateFrom.IsZero() {
+		args = append(args, filter.DateFrom)
+		where += fmt.Sprintf(" AND e.time >= $%d", len(args))
+	}
+	if !filter.DateTo.IsZero() {
+		args = append(args, filter.DateTo)
+		where += fmt.Sprintf(" AND e.time <= $%d", len(args))
+	}
+
+	from := " FROM ip_change_event e INNER JOIN domain d ON d.id = e.domain_id"
+
+	var total int64
+	if err := db.queryRow("SELECT COUNT(*)"+from+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count IP changes: %w", err)
+	}
+
+	query := "SELECT e.id, e.domain_id, d.domain, e.time, e.added, e.removed" + from + where +
+		" ORDER BY e.time DESC, e.id DESC"
+	query += paginate(&args, filter.Limit, filter.Offset)
+
+	rows, err := db.query(query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query IP changes: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	events := []models.IPChangeEvent{}
+	for rows.Next() {
+		var e models.IPChangeEvent
+		var added, removed string
+		if err := rows.Scan(&e.ID, &e.DomainID, &e.Domain, &e.Time, &added, &removed); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan IP change: %w", err)
+		}
+		// added/removed are JSON arrays in SQLite
+		if err := json.Unmarshal([]byte(added), &e.Added); err != nil {
+			return nil, 0, fmt.Errorf("failed to parse IP change: %w", err)
+		}
+		if err := json.Unmarshal([]byte(removed), &e.Removed); err != nil {
+			return nil, 0, fmt.Errorf("failed to parse IP change: %w", err)
+		}
+		events = append(events, e)
+	}
+
+	return events, total, rows.Err()
+}
+
+// GetExportList retrieves domains and their IPs filtered by domain regex
+// (see Database.GetExportList)
+func (db *SQLiteDatabase) GetExportList(opts models.ExportOptions) (*models.ExportList, error) {
+	if opts.DomainRegex == "" {
+		return nil, fmt.Errorf("domain regex is required")
+	}
+	if err := validateDomainRegex(opts.DomainRegex); err != nil {
+		return nil, err
+	}
+
+	domainColumn := "domain"
+	if opts.CollapseWildcards {
+		domainColumn = "COALESCE(wildcard_zone, domain)"
+	}
+	domains, err := db.queryStrings(`SELECT DISTINCT `+domainColumn+` AS name FROM domain WHERE domain REGEXP $1 ORDER BY name`, opts.DomainRegex)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query domains: %w", err)
+	}
+
+	// If neither IPv4 nor IPv6 is enabled, return early with just domains
+	if !opts.IncludeIPv4 && !opts.IncludeIPv6 {
+		return &models.ExportList{
+			Domains: domains,
+			IPv4:    []string{},
+			IPv6:    []string{},
+		}, nil
+	}
+
+	// seen_history is an INTEGER: bit_count() takes it without the bit(64) cast
+	ipFilter, ipsArgs := exportIPFilter(opts.Vantage, opts.Geo, opts.Stability, []interface{}{opts.DomainRegex})
+	ipFilter = strings.ReplaceAll(ipFilter, "::bit(64)", "")
+
+	var ipsQuery string
+	if opts.ExcludeSharedIPs {
+		ipsQuery = `
+			WITH matched_ips AS (
+				SELECT DISTINCT ip.ip, ip.type
+				FROM ip
+				INNER JOIN domain ON ip.domain_id = domain.id
+				WHERE domain.domain REGEXP $1` + ipFilter + `
+			),
+			non_matched_ips AS (
+				SELECT DISTINCT ip.ip
+				FROM ip
+				INNER JOIN domain ON ip.domain_id = domain.id
+				WHERE NOT (domain.domain REGEXP $1)
+			)
+			SELECT ip.ip, ip.type
+			FROM matched_ips ip
+			WHERE NOT EXISTS (SELECT 1 FROM non_matched_ips n WHERE n.ip = ip.ip)
+		`
+	} else {
+		ipsQuery = `
+			SELECT DISTINCT ip.ip, ip.type
+			FROM ip
+			INNER JOIN domain ON ip.domain_id = domain.id
+			WHERE domain.domain REGEXP $1` + ipFilter + `
+		`
+	}
+
+	if opts.IncludeIPv4 && !opts.IncludeIPv6 {
+		ipsQuery += " AND ip.type = 'ipv4'"
+	} else if !opts.IncludeIPv4 && opts.IncludeIPv6 {
+		ipsQuery += " AND ip.type = 'ipv6'"
+	}
+	ipsQuery += " ORDER BY type, ip"
+
+	rows, err := db.query(ipsQuery, ipsArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query IPs: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var ipv4List []string
+	var ipv6List []string
+	for rows.Next() {
+		var ip, ipType string
+		if err := rows.Scan(&ip, &ipType); err != nil {
+			return nil, fmt.Errorf("failed to scan IP: %w", err)
+		}
+		if ipType == "ipv4" {
+			ipv4List = append(ipv4List, ip)
+		} else if ipType == "ipv6" {
+			ipv6List = append(ipv6List, ip)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &models.ExportList{
+		Domains: domains,
+		IPv4:    ipv4List,
+		IPv6:    ipv6List,
+	}, nil
+}
+
+// GetExcludedIPs retrieves IPs that are excluded from export due to being shared
+// between matched and non-matched domains
+func (db *SQLiteDatabase) GetExcludedIPs(domainRegex string, includeIPv4, includeIPv6 bool) ([]models.ExcludedIPInfo, error) {
+	if domainRegex == "" {
+		return nil, fmt.Errorf("domain regex is required")
+	}
+	if err := validateDomainRegex(domainRegex); err != nil {
+		return nil, err
+	}
+
+	typeFilter := ""
+	if includeIPv4 && !includeIPv6 {
+		typeFilter = " AND ip.type = 'ipv4'"
+	} else if !includeIPv4 && includeIPv6 {
+		typeFilter = " AND ip.type = 'ipv6'"
+	}
+
+	query := fmt.Sprintf(`
+		WITH matched_domain_ips AS (
+			SELECT DISTINCT ip.ip, domain.domain
+			FROM ip
+			INNER JOIN domain ON ip.domain_id = domain.id
+			WHERE domain.domain REGEXP $1%s
+		),
+		non_matched_domain_ips AS (
+			SELECT DISTINCT ip.ip, domain.domain
+			FROM ip
+			INNER JOIN domain ON ip.domain_id = domain.id
+			WHERE NOT (domain.domain REGEXP $1)%s
+		),
+		shared_ips AS (
+			SELECT DISTINCT m.ip
+			FROM matched_domain_ips m
+			INNER JOIN non_matched_domain_ips nm ON m.ip = nm.ip
+		)
+		SELECT
+			s.ip,
+			group_concat(DISTINCT m.domain ORDER BY m.domain) AS matched_domains,
+			group_concat(DISTINCT nm.domain ORDER BY nm.domain) AS non_matched_domains,
+			COALESCE(p.ptr, '') AS ptr
+		FROM shared_ips s
+		LEFT JOIN matched_domain_ips m ON s.ip = m.ip
+		LEFT JOIN non_matched_domain_ips nm ON s.ip = nm.ip
+		LEFT JOIN ip_ptr p ON p.ip = s.ip
+		GROUP BY s.ip, p.ptr
+		ORDER BY s.ip
+	`, typeFilter, typeFilter)
+
+	rows, err := db.query(query, domainRegex)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query excluded IPs: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var result []models.ExcludedIPInfo
+	for rows.Next() {
+		var info models.ExcludedIPInfo
+		var matchedDomains, nonMatchedDomains string
+		if err := rows.Scan(&info.IP, &matchedDomains, &nonMatchedDomains, &info.PTR); err != nil {
+			return nil, fmt.Errorf("failed to scan excluded IP info: %w", err)
+		}
+		// group_concat() lists are comma-separated like PostgreSQL arrays without braces
+		info.MatchedDomains = parsePostgreSQLArray(matchedDomains)
+		info.NonMatchedDomains = parsePostgreSQLArray(nonMatchedDomains)
+		result = append(result, info)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// queryStrings runs a query returning a single text column
+func (db *SQLiteDatabase) queryStrings(query string, args ...interface{}) ([]string, error) {
+	rows, err := db.query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+
+	return values, rows.Err()
+}
+
+// paginate appends the LIMIT (default 100) and OFFSET of a query to args
+func paginate(args *[]interface{}, limit, offset int) string {
+	if limit <= 0 {
+		limit = 100 // Default limit
+	}
+	*args = append(*args, limit)
+	clause := fmt.Sprintf(" LIMIT $%d", len(*args))
+	if offset > 0 {
+		*args = append(*args, offset)
+		clause += fmt.Sprintf(" OFFSET $%d", len(*args))
+	}
+	return clause
+}
+
+// sqliteRegexpCacheSize bounds the compiled patterns kept by sqliteRegexp: patterns
+// come from filters and rules, so any number of distinct ones may be seen over time
+const sqliteRegexpCacheSize = 64
+
+// regexpCache keeps the most recently used compiled patterns
+type regexpCache struct {
+	mu         sync.Mutex
+	entries    map[string]*list.Element
+	lru        *list.List // front = most recently used, values are *regexpCacheEntry
+	maxEntries int
+}
+
+type regexpCacheEntry struct {
+	pattern string
+	re      *regexp.Regexp
+}
+
+func newRegexpCache(maxEntries int) *regexpCache {
+	return &regexpCache{
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+		maxEntries: maxEntries,
+	}
+}
+
+// get returns the compiled pattern, compiling and caching it on a miss
+func (c *regexpCache) get(pattern string) (*regexp.Regexp, error) {
+	c.mu.Lock()
+	if el, ok := c.entries[pattern]; ok {
+		c.lru.MoveToFront(el)
+		c.mu.Unlock()
+		return el.Value.(*regexpCacheEntry).re, nil
+	}
+	c.mu.Unlock()
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[pattern]; ok {
+		c.lru.MoveToFront(el)
+		return el.Value.(*regexpCacheEntry).re, nil
+	}
+	c.entries[pattern] = c.lru.PushFront(&regexpCacheEntry{pattern: pattern, re: re})
+	for c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*regexpCacheEntry).pattern)
+	}
+	return re, nil
+}
+
+var sqliteRegexps = newRegexpCache(sqliteRegexpCacheSize)
+
+// sqliteRegexp implements the REGEXP operator (x REGEXP pattern calls regexp(pattern, x))
+func sqliteRegexp(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+	pattern, ok := args[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("regexp: pattern must be text")
+	}
+	value, ok := args[1].(string)
+	if !ok {
+		return false, nil
+	}
+
+	re, err := sqliteRegexps.get(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression: %w", err)
+	}
+	return re.MatchString(value), nil
+}
+
+// sqliteDomainPriority is domain_priority() of PostgreSQL migration 000007
+func sqliteDomainPriority(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+	queryCount := sqliteFloat(args[0])
+	ref, _ := sqliteParseTime(args[3])
+
+	score := sqliteFloat(args[4]) * math.Log(1+math.Max(queryCount, 0))
+	if lastSeen, ok := sqliteParseTime(args[1]); ok {
+		days := math.Max(ref.Sub(lastSeen).Hours()/24, 0)
+		score += sqliteFloat(args[5]) * math.Exp(-days)
+	}
+	if lastResolv, ok := sqliteParseTime(args[2]); ok {
+		hours := math.Max(ref.Sub(lastResolv).Hours(), 0)
+		score += sqliteFloat(args[6]) * math.Log(1+hours)
+	}
+	return score, nil
+}
+
+// sqliteBitCount is bit_count() of an INTEGER
+func sqliteBitCount(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+	n, _ := args[0].(int64)
+	return int64(bits.OnesCount64(uint64(n))), nil
+}
+
+// sqliteIPInSubnet is the inet <<= operator: whether ip is within the CIDR subnet
+func sqliteIPInSubnet(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+	ip, _ := args[0].(string)
+	cidr, _ := args[1].(string)
+	_, subnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subnet format: %w", err)
+	}
+	addr := net.ParseIP(ip)
+	return addr != nil && subnet.Contains(addr), nil
+}
+
+// sqliteFloat converts a numeric function argument to float64
+func sqliteFloat(v driver.Value) float64 {
+	switch n := v.(type) {
+	case int64:
+		return float64(n)
+	case float64:
+		return n
+	}
+	return 0
+}
+
+// sqliteParseTime parses a stored timestamp passed to a function; false for NULL
+func sqliteParseTime(v driver.Value) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case string:
+		parsed, err := time.ParseInLocation("2006-01-02 15:04:05.999999999", t, time.Local)
+		return parsed, err == nil
+	}
+	return time.Time{}, false
+}
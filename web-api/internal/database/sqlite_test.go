@@ -0,0 +1,182 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"dns-collector-webapi/internal/models"
+)
+
+// newTestSQLite opens a migrated SQLite database with two domains sharing an address:
+// a.example.com (192.0.2.1 seen 3 times, 192.0.2.2 once, 2001:db8::1) and cdn.example.org (192.0.2.2)
+func newTestSQLite(t *testing.T) *SQLiteDatabase {
+	t.Helper()
+
+	db, err := NewSQLite(filepath.Join(t.TempDir(), "collector.db"))
+	if err != nil {
+		t.Fatalf("Failed to open SQLite database: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	if err := db.RunMigrations(); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	now := time.Now()
+	fixtures := []struct {
+		query string
+		args  []interface{}
+	}{
+		{`INSERT INTO domain (id, domain, time_insert, max_resolv, last_resolv_time, last_seen, query_count)
+			VALUES (1, 'a.example.com', $1, 10, $1, $1, 5), (2, 'cdn.example.org', $1, 10, $1, $1, 1)`, []interface{}{now}},
+		{`INSERT INTO ip (id, domain_id, ip, type, time, seen_history) VALUES
+			(1, 1, '192.0.2.1', 'ipv4', $1, 7), (2, 1, '192.0.2.2', 'ipv4', $1, 1),
+			(3, 1, '2001:db8::1', 'ipv6', $1, 7), (4, 2, '192.0.2.2', 'ipv4', $1, 7)`, []interface{}{now}},
+		{`INSERT INTO ip_vantage (ip_id, vantage, time) VALUES (1, 'msk', $1), (1, 'ams', $1)`, []interface{}{now}},
+		{`INSERT INTO ip_change_event (domain_id, time, added, removed) VALUES (1, $1, '["192.0.2.2"]', '[]')`, []interface{}{now}},
+		{`INSERT INTO domain_stat (domain, client_ip, qtype, rtype, timestamp) VALUES
+			('a.example.com', '192.168.1.10', 'A', 'cache', $1),
+			('a.example.com', '10.0.0.1', 'A', 'cache', $1),
+			('cdn.example.org', NULL, 'AAAA', 'cache', $1)`, []interface{}{now.Add(-time.Hour)}},
+	}
+	for _, f := range fixtures {
+		if _, err := db.DB.Exec(f.query, sqliteArgs(f.args)...); err != nil {
+			t.Fatalf("Failed to insert fixtures: %v", err)
+		}
+	}
+	return db
+}
+
+func TestSQLite_GetDomains(t *testing.T) {
+	db := newTestSQLite(t)
+
+	domains, total, err := db.GetDomains(models.DomainsFilter{DomainRegex: `\.com$`, SortBy: "priority"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if total != 1 || len(domains) != 1 || domains[0].Domain != "a.example.com" {
+		t.Fatalf("Expected a.example.com, got %v (total %d)", domains, total)
+	}
+	if domains[0].Priority <= 0 {
+		t.Errorf("Expected positive priority, got %f", domains[0].Priority)
+	}
+}
+
+func TestSQLite_GetDomainWithIPs(t *testing.T) {
+	db := newTestSQLite(t)
+
+	d, err := db.GetDomainWithIPs(1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(d.IPs) != 3 {
+		t.Fatalf("Expected 3 IPs, got %d", len(d.IPs))
+	}
+	ip := d.IPs[0]
+	if ip.IP != "192.0.2.1" || ip.SeenRecent != 3 || len(ip.Vantages) != 2 || ip.Vantages[0] != "ams" {
+		t.Errorf("Unexpected IP %+v", ip)
+	}
+
+	if _, err := db.GetDomainWithIPs(42); err == nil {
+		t.Error("Expected error for unknown domain")
+	}
+}
+
+func TestSQLite_GetExportList(t *testing.T) {
+	db := newTestSQLite(t)
+
+	list, err := db.GetExportList(models.ExportOptions{DomainRegex: `example\.com$`, IncludeIPv4: true, ExcludeSharedIPs: true})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// 192.0.2.2 is shared with cdn.example.org
+	if len(list.Domains) != 1 || len(list.IPv4) != 1 || list.IPv4[0] != "192.0.2.1" || len(list.IPv6) != 0 {
+		t.Errorf("Unexpected export list %+v", list)
+	}
+
+	stable := models.StabilityFilter{MinSeen: 2, Window: 3}
+	list, err = db.GetExportList(models.ExportOptions{DomainRegex: `example\.com$`, IncludeIPv4: true, IncludeIPv6: true, Vantage: "msk", Stability: stable})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(list.IPv4) != 1 || list.IPv4[0] != "192.0.2.1" || len(list.IPv6) != 0 {
+		t.Errorf("Unexpected export list %+v", list)
+	}
+
+	excluded, err := db.GetExcludedIPs(`example\.com$`, true, true)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(excluded) != 1 || excluded[0].IP != "192.0.2.2" || excluded[0].NonMatchedDomains[0] != "cdn.example.org" {
+		t.Errorf("Unexpected excluded IPs %+v", excluded)
+	}
+}
+
+func TestSQLite_GetStats(t *testing.T) {
+	db := newTestSQLite(t)
+
+	stats, total, err := db.GetStats(models.StatsFilter{ClientIPs: []string{UnknownClientIP}, Subnet: "192.168.1.0/24"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if total != 2 || len(stats) != 2 {
+		t.Fatalf("Expected 2 stats, got %d (total %d)", len(stats), total)
+	}
+
+	result, err := db.GetStatsAggregate(models.StatsAggregateFilter{
+		GroupBy:  []string{"client_ip"},
+		Interval: "hour",
+		DateFrom: time.Now().Add(-2 * time.Hour),
+		DateTo:   time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result.Source != StatsSourceRaw || len(result.Data) != 3 {
+		t.Fatalf("Expected 3 raw aggregates, got %+v", result)
+	}
+	if result.Data[0].Bucket == nil || result.Data[0].Bucket.Minute() != 0 {
+		t.Errorf("Expected hour bucket, got %v", result.Data[0].Bucket)
+	}
+}
+
+func TestSQLite_GetIPChanges(t *testing.T) {
+	db := newTestSQLite(t)
+
+	events, total, err := db.GetIPChanges(models.IPChangesFilter{DomainRegex: `^a\.`})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if total != 1 || len(events[0].Added) != 1 || events[0].Added[0] != "192.0.2.2" || len(events[0].Removed) != 0 {
+		t.Errorf("Unexpected IP changes %+v", events)
+	}
+}
+
+func TestRegexpCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	c := newRegexpCache(2)
+
+	first, err := c.get(`^a\.`)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := c.get(`^b\.`); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if again, _ := c.get(`^a\.`); again != first {
+		t.Error("Expected the cached pattern to be reused")
+	}
+	if _, err := c.get(`^c\.`); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(c.entries) != 2 || c.lru.Len() != 2 {
+		t.Fatalf("Expected 2 cached patterns, got %d", len(c.entries))
+	}
+	if _, ok := c.entries[`^b\.`]; ok {
+		t.Error("Expected the least recently used pattern to be evicted")
+	}
+	if _, err := c.get(`(`); err == nil {
+		t.Error("Expected error for invalid pattern")
+	}
+}
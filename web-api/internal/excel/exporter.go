@@ -2,6 +2,7 @@ package excel
 
 import (
 	"fmt"
+	"time"
 
 	"dns-collector-webapi/internal/models"
 
@@ -283,7 +284,7 @@ func (e *Exporter) ExportDomains(domains []models.Domain) (*excelize.File, error
 		return nil, fmt.Errorf("failed to create IPs sheet: %w", err)
 	}
 
-	ipHeaders := []string{"Domain", "IP Address", "Type", "Resolved At"}
+	ipHeaders := []string{"Domain", "IP Address", "Type", "Resolved At", "PTR", "ASN", "AS Org", "Country", "First Seen", "Last Seen", "Seen Count"}
 	for i, header := range ipHeaders {
 		cell, _ := excelize.CoordinatesToCellName(i+1, 1)
 		if err := f.SetCellValue(ipsSheet, cell, header); err != nil {
@@ -300,6 +301,13 @@ func (e *Exporter) ExportDomains(domains []models.Domain) (*excelize.File, error
 		"B": 20, // IP Address
 		"C": 10, // Type
 		"D": 20, // Resolved At
+		"E": 40, // PTR
+		"F": 10, // ASN
+		"G": 30, // AS Org
+		"H": 10, // Country
+		"I": 20, // First Seen
+		"J": 20, // Last Seen
+		"K": 12, // Seen Count
 	}
 	for col, width := range ipColumnWidths {
 		if err := f.SetColWidth(ipsSheet, col, col, width); err != nil {
@@ -320,6 +328,13 @@ func (e *Exporter) ExportDomains(domains []models.Domain) (*excelize.File, error
 				{2, ip.IP, 0},
 				{3, ip.Type, 0},
 				{4, ip.Time, dateStyle},
+				{5, ip.PTR, 0},
+				{6, asnValue(ip.ASN), 0},
+				{7, ip.ASOrg, 0},
+				{8, ip.Country, 0},
+				{9, timeValue(ip.FirstSeen), dateStyle},
+				{10, timeValue(ip.LastSeen), dateStyle},
+				{11, ip.SeenCount, 0},
 			}
 
 			for _, c := range cells {
@@ -351,7 +366,7 @@ func (e *Exporter) ExportDomains(domains []models.Domain) (*excelize.File, error
 
 	// Add auto-filter to IPs sheet
 	if ipRow > 2 {
-		lastCol, _ := excelize.CoordinatesToCellName(4, ipRow-1)
+		lastCol, _ := excelize.CoordinatesToCellName(11, ipRow-1)
 		filterRange := fmt.Sprintf("A1:%s", lastCol)
 		if err := f.AutoFilter(ipsSheet, filterRange, []excelize.AutoFilterOptions{}); err != nil {
 			return nil, fmt.Errorf("failed to add auto-filter: %w", err)
@@ -365,3 +380,19 @@ func (e *Exporter) ExportDomains(domains []models.Domain) (*excelize.File, error
 func strPtr(s string) *string {
 	return &s
 }
+
+// asnValue returns the ASN as a cell value, or an empty cell if it is unknown
+func asnValue(asn *int64) interface{} {
+	if asn == nil {
+		return ""
+	}
+	return *asn
+}
+
+// timeValue returns the time as a cell value, or an empty cell if it is unknown
+func timeValue(t *time.Time) interface{} {
+	if t == nil {
+		return ""
+	}
+	return *t
+}
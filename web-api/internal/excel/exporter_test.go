@@ -150,6 +150,7 @@ func TestExportDomains(t *testing.T) {
 	// Test with sample data
 	t.Run("With data", func(t *testing.T) {
 		now := time.Now()
+		asn := int64(15133)
 		domains := []models.Domain{
 			{
 				ID:             1,
@@ -165,6 +166,10 @@ func TestExportDomains(t *testing.T) {
 						IP:       "93.184.216.34",
 						Type:     "IPv4",
 						Time:     now,
+						PTR:      "edge.example.net",
+						ASN:      &asn,
+						ASOrg:    "EDGECAST",
+						Country:  "US",
 					},
 					{
 						ID:       2,
@@ -222,6 +227,27 @@ func TestExportDomains(t *testing.T) {
 			t.Errorf("Expected type 'IPv4', got %s (error: %v)", ipType, err)
 		}
 
+		ptr, err := file.GetCellValue("IP Addresses", "E2")
+		if err != nil || ptr != "edge.example.net" {
+			t.Errorf("Expected PTR 'edge.example.net', got %s (error: %v)", ptr, err)
+		}
+
+		asnCell, err := file.GetCellValue("IP Addresses", "F2")
+		if err != nil || asnCell != "15133" {
+			t.Errorf("Expected ASN '15133', got %s (error: %v)", asnCell, err)
+		}
+
+		country, err := file.GetCellValue("IP Addresses", "H2")
+		if err != nil || country != "US" {
+			t.Errorf("Expected country 'US', got %s (error: %v)", country, err)
+		}
+
+		// ASN is left empty when unknown
+		asnCell2, err := file.GetCellValue("IP Addresses", "F3")
+		if err != nil || asnCell2 != "" {
+			t.Errorf("Expected empty ASN, got %s (error: %v)", asnCell2, err)
+		}
+
 		// Verify second IP
 		ipAddr2, err := file.GetCellValue("IP Addresses", "B3")
 		if err != nil || ipAddr2 != "2606:2800:220:1:248:1893:25c8:1946" {
@@ -332,6 +358,13 @@ func verifyIPsHeaders(t *testing.T, file *excelize.File, sheetName string) {
 		{"B1", "IP Address"},
 		{"C1", "Type"},
 		{"D1", "Resolved At"},
+		{"E1", "PTR"},
+		{"F1", "ASN"},
+		{"G1", "AS Org"},
+		{"H1", "Country"},
+		{"I1", "First Seen"},
+		{"J1", "Last Seen"},
+		{"K1", "Seen Count"},
 	}
 
 	for _, h := range expectedHeaders {
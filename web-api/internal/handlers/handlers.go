@@ -92,6 +92,84 @@ func (h *Handler) GetStats(c *gin.Context) {
 	})
 }
 
+// maxAggregateLimit caps the number of rows of an aggregate stats response
+const maxAggregateLimit = 10000
+
+// GetStatsAggregate handles GET /api/stats/aggregate - query counts grouped by
+// domain, client and/or query type, optionally per hour or day. Long ranges are
+// answered from the rollup tables.
+func (h *Handler) GetStatsAggregate(c *gin.Context) {
+	var filter models.StatsAggregateFilter
+
+	// Parse grouping
+	if groupBy := c.Query("group_by"); groupBy != "" {
+		for _, col := range strings.Split(groupBy, ",") {
+			col = strings.TrimSpace(col)
+			if col != "domain" && col != "client_ip" && col != "qtype" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid group_by column: %s", col)})
+				return
+			}
+			filter.GroupBy = append(filter.GroupBy, col)
+		}
+	}
+	filter.Interval = c.Query("interval")
+	if filter.Interval != "" && filter.Interval != "hour" && filter.Interval != "day" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "interval must be hour or day"})
+		return
+	}
+
+	// Parse filters
+	filter.DomainRegex = c.Query("domain_regex")
+	if clientIPs := c.Query("client_ips"); clientIPs != "" {
+		filter.ClientIPs = strings.Split(clientIPs, ",")
+		for i := range filter.ClientIPs {
+			filter.ClientIPs[i] = strings.TrimSpace(filter.ClientIPs[i])
+		}
+	}
+	filter.QType = strings.ToUpper(c.Query("qtype"))
+
+	// Parse date range (default: the last 24 hours)
+	filter.DateTo = time.Now()
+	if dateTo := c.Query("date_to"); dateTo != "" {
+		t, err := time.Parse(time.RFC3339, dateTo)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid date_to, expected RFC3339"})
+			return
+		}
+		filter.DateTo = t
+	}
+	filter.DateFrom = filter.DateTo.Add(-24 * time.Hour)
+	if dateFrom := c.Query("date_from"); dateFrom != "" {
+		t, err := time.Parse(time.RFC3339, dateFrom)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid date_from, expected RFC3339"})
+			return
+		}
+		filter.DateFrom = t
+	}
+	if !filter.DateFrom.Before(filter.DateTo) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date_from must be before date_to"})
+		return
+	}
+
+	// Parse limit
+	filter.Limit = 100
+	if limit := c.Query("limit"); limit != "" {
+		if l, err := strconv.Atoi(limit); err == nil && l > 0 {
+			filter.Limit = min(l, maxAggregateLimit)
+		}
+	}
+
+	result, err := h.db.GetStatsAggregate(filter)
+	if err != nil {
+		log.Printf("Error getting aggregate stats: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
 // GetDomains handles GET /api/domains
 func (h *Handler) GetDomains(c *gin.Context) {
 	var filter models.DomainsFilter
@@ -99,6 +177,13 @@ func (h *Handler) GetDomains(c *gin.Context) {
 	// Parse domain regex
 	filter.DomainRegex = c.Query("domain_regex")
 
+	// Parse failure filters
+	parseFailureFilters(c, &filter)
+	filter.DNSSECStatus = c.Query("dnssec_status")
+	filter.WildcardZone = c.Query("wildcard_zone")
+	filter.Policy = c.Query("policy")
+	parseGeoFilters(c, &filter)
+
 	// Parse date range
 	if dateFrom := c.Query("date_from"); dateFrom != "" {
 		if t, err := time.Parse(time.RFC3339, dateFrom); err == nil {
@@ -150,6 +235,32 @@ func (h *Handler) GetDomains(c *gin.Context) {
 	})
 }
 
+// parseFailureFilters parses the dead-domain filters of domain endpoints:
+// dead=true, min_failures=N and last_error=nxdomain|servfail|timeout|error
+func parseFailureFilters(c *gin.Context, filter *models.DomainsFilter) {
+	if dead := c.Query("dead"); dead != "" {
+		if d, err := strconv.ParseBool(dead); err == nil {
+			filter.Dead = d
+		}
+	}
+	if minFailures := c.Query("min_failures"); minFailures != "" {
+		if n, err := strconv.Atoi(minFailures); err == nil {
+			filter.MinFailures = n
+		}
+	}
+	filter.LastError = c.Query("last_error")
+}
+
+// parseGeoFilters parses the GeoIP filters of domain endpoints: asn=N and country=CC
+func parseGeoFilters(c *gin.Context, filter *models.DomainsFilter) {
+	if asn := c.Query("asn"); asn != "" {
+		if n, err := strconv.ParseInt(strings.TrimPrefix(strings.ToUpper(asn), "AS"), 10, 64); err == nil {
+			filter.ASN = n
+		}
+	}
+	filter.Country = c.Query("country")
+}
+
 // GetDomainByID handles GET /api/domains/:id
 func (h *Handler) GetDomainByID(c *gin.Context) {
 	idStr := c.Param("id")
@@ -173,6 +284,84 @@ func (h *Handler) GetDomainByID(c *gin.Context) {
 	c.JSON(http.StatusOK, domain)
 }
 
+// GetDomainHistory handles GET /api/domains/:id/history
+func (h *Handler) GetDomainHistory(c *gin.Context) {
+	idStr := c.Param("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid domain ID"})
+		return
+	}
+
+	filter := parseIPChangesFilter(c)
+	filter.DomainID = id
+	h.respondIPChanges(c, filter)
+}
+
+// GetIPChanges handles GET /api/changes (recent IP set changes of all domains)
+func (h *Handler) GetIPChanges(c *gin.Context) {
+	h.respondIPChanges(c, parseIPChangesFilter(c))
+}
+
+// maxIPChangesLimit caps the number of events of an IP change response
+const maxIPChangesLimit = 1000
+
+// parseIPChangesFilter parses the filters of IP change endpoints:
+// domain_regex, date_from, date_to (ISO8601), limit and offset
+func parseIPChangesFilter(c *gin.Context) models.IPChangesFilter {
+	var filter models.IPChangesFilter
+
+	filter.DomainRegex = c.Query("domain_regex")
+
+	// Parse date range
+	if dateFrom := c.Query("date_from"); dateFrom != "" {
+		if t, err := time.Parse(time.RFC3339, dateFrom); err == nil {
+			filter.DateFrom = t
+		}
+	}
+	if dateTo := c.Query("date_to"); dateTo != "" {
+		if t, err := time.Parse(time.RFC3339, dateTo); err == nil {
+			filter.DateTo = t
+		}
+	}
+
+	// Parse pagination
+	filter.Limit = 100
+	if limit := c.Query("limit"); limit != "" {
+		if l, err := strconv.Atoi(limit); err == nil && l > 0 {
+			filter.Limit = min(l, maxIPChangesLimit)
+		}
+	}
+	if offset := c.Query("offset"); offset != "" {
+		if o, err := strconv.Atoi(offset); err == nil {
+			filter.Offset = o
+		}
+	}
+
+	return filter
+}
+
+// respondIPChanges queries IP change events and writes them as a paginated response
+func (h *Handler) respondIPChanges(c *gin.Context, filter models.IPChangesFilter) {
+	events, total, err := h.db.GetIPChanges(filter)
+	if err != nil {
+		log.Printf("Error getting IP changes: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Calculate total pages
+	totalPages := int(math.Ceil(float64(total) / float64(filter.Limit)))
+
+	c.JSON(http.StatusOK, models.PaginatedResponse{
+		Data:       events,
+		Total:      total,
+		Limit:      filter.Limit,
+		Offset:     filter.Offset,
+		TotalPages: totalPages,
+	})
+}
+
 // HealthCheck handles GET /health
 func (h *Handler) HealthCheck(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
@@ -182,9 +371,9 @@ func (h *Handler) HealthCheck(c *gin.Context) {
 }
 
 // ExportList handles export list endpoints
-func (h *Handler) ExportList(c *gin.Context, domainRegex string, includeDomains bool, includeIPv4, includeIPv6, excludeSharedIPs bool, additionalIPsFile string) {
+func (h *Handler) ExportList(c *gin.Context, opts models.ExportOptions, includeDomains bool, additionalIPsFile string) {
 	// Get data from database
-	exportList, err := h.db.GetExportList(domainRegex, includeIPv4, includeIPv6, excludeSharedIPs)
+	exportList, err := h.db.GetExportList(opts)
 	if err != nil {
 		log.Printf("Error getting export list: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -199,10 +388,10 @@ func (h *Handler) ExportList(c *gin.Context, domainRegex string, includeDomains
 			// Continue anyway - this is not a critical error
 		} else {
 			// Append additional IPs to export list
-			if includeIPv4 {
+			if opts.IncludeIPv4 {
 				exportList.IPv4 = append(exportList.IPv4, additionalIPv4...)
 			}
-			if includeIPv6 {
+			if opts.IncludeIPv6 {
 				exportList.IPv6 = append(exportList.IPv6, additionalIPv6...)
 			}
 			log.Printf("Loaded %d IPv4 and %d IPv6 addresses from %s", len(additionalIPv4), len(additionalIPv6), additionalIPsFile)
@@ -211,7 +400,7 @@ func (h *Handler) ExportList(c *gin.Context, domainRegex string, includeDomains
 
 	// Log if export list is empty (useful for debugging)
 	if len(exportList.Domains) == 0 && len(exportList.IPv4) == 0 && len(exportList.IPv6) == 0 {
-		log.Printf("Export list returned empty results for regex: %s", domainRegex)
+		log.Printf("Export list returned empty results for regex: %s", opts.DomainRegex)
 	}
 
 	// Build plain text response
@@ -261,10 +450,10 @@ func (h *Handler) ExportExcludedIPs(c *gin.Context, domainRegex string, includeI
 	}
 
 	// Build plain text response in format:
-	// IP | Matched Domains | Non-Matched Domains
+	// IP | Matched Domains | Non-Matched Domains | PTR
 	var result strings.Builder
 	result.WriteString("# Excluded IPs (shared between matched and non-matched domains)\n")
-	result.WriteString("# Format: IP | Matched Domains | Non-Matched Domains\n")
+	result.WriteString("# Format: IP | Matched Domains | Non-Matched Domains | PTR\n")
 	result.WriteString("#\n")
 
 	for _, info := range excludedIPs {
@@ -273,6 +462,8 @@ func (h *Handler) ExportExcludedIPs(c *gin.Context, domainRegex string, includeI
 		result.WriteString(strings.Join(info.MatchedDomains, ", "))
 		result.WriteString(" | ")
 		result.WriteString(strings.Join(info.NonMatchedDomains, ", "))
+		result.WriteString(" | ")
+		result.WriteString(info.PTR)
 		result.WriteString("\n")
 	}
 
@@ -369,6 +560,13 @@ func (h *Handler) ExportDomains(c *gin.Context) {
 	// Parse domain regex
 	filter.DomainRegex = c.Query("domain_regex")
 
+	// Parse failure filters
+	parseFailureFilters(c, &filter)
+	filter.DNSSECStatus = c.Query("dnssec_status")
+	filter.WildcardZone = c.Query("wildcard_zone")
+	filter.Policy = c.Query("policy")
+	parseGeoFilters(c, &filter)
+
 	// Parse date range
 	if dateFrom := c.Query("date_from"); dateFrom != "" {
 		if t, err := time.Parse(time.RFC3339, dateFrom); err == nil {
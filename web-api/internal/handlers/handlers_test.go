@@ -20,8 +20,10 @@ type MockDatabase struct {
 	GetDomainsFunc        func(filter models.DomainsFilter) ([]models.Domain, int64, error)
 	GetDomainWithIPsFunc  func(id int64) (*models.Domain, error)
 	GetDomainsWithIPsFunc func(filter models.DomainsFilter) ([]models.Domain, int64, error)
-	GetExportListFunc     func(domainRegex string, includeIPv4, includeIPv6, excludeSharedIPs bool) (*models.ExportList, error)
+	GetExportListFunc     func(opts models.ExportOptions) (*models.ExportList, error)
 	GetExcludedIPsFunc    func(domainRegex string, includeIPv4, includeIPv6 bool) ([]models.ExcludedIPInfo, error)
+	GetIPChangesFunc      func(filter models.IPChangesFilter) ([]models.IPChangeEvent, int64, error)
+	GetStatsAggregateFunc func(filter models.StatsAggregateFilter) (*models.StatsAggregateResult, error)
 }
 
 func (m *MockDatabase) GetStats(filter models.StatsFilter) ([]models.DomainStat, int64, error) {
@@ -52,9 +54,9 @@ func (m *MockDatabase) GetDomainsWithIPs(filter models.DomainsFilter) ([]models.
 	return nil, 0, nil
 }
 
-func (m *MockDatabase) GetExportList(domainRegex string, includeIPv4, includeIPv6, excludeSharedIPs bool) (*models.ExportList, error) {
+func (m *MockDatabase) GetExportList(opts models.ExportOptions) (*models.ExportList, error) {
 	if m.GetExportListFunc != nil {
-		return m.GetExportListFunc(domainRegex, includeIPv4, includeIPv6, excludeSharedIPs)
+		return m.GetExportListFunc(opts)
 	}
 	return &models.ExportList{}, nil
 }
@@ -66,6 +68,20 @@ func (m *MockDatabase) GetExcludedIPs(domainRegex string, includeIPv4, includeIP
 	return []models.ExcludedIPInfo{}, nil
 }
 
+func (m *MockDatabase) GetIPChanges(filter models.IPChangesFilter) ([]models.IPChangeEvent, int64, error) {
+	if m.GetIPChangesFunc != nil {
+		return m.GetIPChangesFunc(filter)
+	}
+	return []models.IPChangeEvent{}, 0, nil
+}
+
+func (m *MockDatabase) GetStatsAggregate(filter models.StatsAggregateFilter) (*models.StatsAggregateResult, error) {
+	if m.GetStatsAggregateFunc != nil {
+		return m.GetStatsAggregateFunc(filter)
+	}
+	return &models.StatsAggregateResult{}, nil
+}
+
 func (m *MockDatabase) Close() error {
 	return nil
 }
@@ -443,6 +459,140 @@ func TestGetDomains_WithDomainRegex(t *testing.T) {
 	}
 }
 
+func TestGetDomains_WithDeadFilter(t *testing.T) {
+	router, mockDB := setupTestRouter()
+
+	var capturedFilter models.DomainsFilter
+	mockDB.GetDomainsFunc = func(filter models.DomainsFilter) ([]models.Domain, int64, error) {
+		capturedFilter = filter
+		return []models.Domain{}, 0, nil
+	}
+
+	h := NewHandler(mockDB)
+	router.GET("/api/domains", h.GetDomains)
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/domains?dead=true&min_failures=5&last_error=nxdomain", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+
+	if !capturedFilter.Dead {
+		t.Error("Expected dead=true")
+	}
+	if capturedFilter.MinFailures != 5 {
+		t.Errorf("Expected min_failures=5, got %d", capturedFilter.MinFailures)
+	}
+	if capturedFilter.LastError != "nxdomain" {
+		t.Errorf("Expected last_error=nxdomain, got %s", capturedFilter.LastError)
+	}
+}
+
+func TestGetDomains_WithDNSSECFilter(t *testing.T) {
+	router, mockDB := setupTestRouter()
+
+	var capturedFilter models.DomainsFilter
+	mockDB.GetDomainsFunc = func(filter models.DomainsFilter) ([]models.Domain, int64, error) {
+		capturedFilter = filter
+		return []models.Domain{}, 0, nil
+	}
+
+	h := NewHandler(mockDB)
+	router.GET("/api/domains", h.GetDomains)
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/domains?dnssec_status=bogus", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+
+	if capturedFilter.DNSSECStatus != "bogus" {
+		t.Errorf("Expected dnssec_status=bogus, got %s", capturedFilter.DNSSECStatus)
+	}
+}
+
+func TestGetDomains_WithWildcardZoneFilter(t *testing.T) {
+	router, mockDB := setupTestRouter()
+
+	var capturedFilter models.DomainsFilter
+	mockDB.GetDomainsFunc = func(filter models.DomainsFilter) ([]models.Domain, int64, error) {
+		capturedFilter = filter
+		return []models.Domain{}, 0, nil
+	}
+
+	h := NewHandler(mockDB)
+	router.GET("/api/domains", h.GetDomains)
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/domains?wildcard_zone=track.example.com", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+
+	if capturedFilter.WildcardZone != "track.example.com" {
+		t.Errorf("Expected wildcard_zone=track.example.com, got %s", capturedFilter.WildcardZone)
+	}
+}
+
+func TestGetDomains_WithPolicyFilter(t *testing.T) {
+	router, mockDB := setupTestRouter()
+
+	var capturedFilter models.DomainsFilter
+	mockDB.GetDomainsFunc = func(filter models.DomainsFilter) ([]models.Domain, int64, error) {
+		capturedFilter = filter
+		return []models.Domain{}, 0, nil
+	}
+
+	h := NewHandler(mockDB)
+	router.GET("/api/domains", h.GetDomains)
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/domains?policy=cdn", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+
+	if capturedFilter.Policy != "cdn" {
+		t.Errorf("Expected policy=cdn, got %s", capturedFilter.Policy)
+	}
+}
+
+func TestGetDomains_WithGeoFilter(t *testing.T) {
+	router, mockDB := setupTestRouter()
+
+	var capturedFilter models.DomainsFilter
+	mockDB.GetDomainsFunc = func(filter models.DomainsFilter) ([]models.Domain, int64, error) {
+		capturedFilter = filter
+		return []models.Domain{}, 0, nil
+	}
+
+	h := NewHandler(mockDB)
+	router.GET("/api/domains", h.GetDomains)
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/domains?asn=AS13335&country=us", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+
+	if capturedFilter.ASN != 13335 {
+		t.Errorf("Expected asn=13335, got %d", capturedFilter.ASN)
+	}
+	if capturedFilter.Country != "us" {
+		t.Errorf("Expected country=us, got %s", capturedFilter.Country)
+	}
+}
+
 func TestGetDomains_DatabaseError(t *testing.T) {
 	router, mockDB := setupTestRouter()
 
@@ -462,10 +612,133 @@ func TestGetDomains_DatabaseError(t *testing.T) {
 	}
 }
 
+func TestExportList_Vantage(t *testing.T) {
+	router, mockDB := setupTestRouter()
+
+	var gotVantage string
+	mockDB.GetExportListFunc = func(opts models.ExportOptions) (*models.ExportList, error) {
+		gotVantage = opts.Vantage
+		return &models.ExportList{
+			IPv4: []string{"198.51.100.7"},
+		}, nil
+	}
+
+	h := NewHandler(mockDB)
+	router.GET("/export/msk", func(c *gin.Context) {
+		h.ExportList(c, models.ExportOptions{DomainRegex: ".*", IncludeIPv4: true, Vantage: "msk"}, false, "")
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "/export/msk", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if gotVantage != "msk" {
+		t.Errorf("Expected vantage 'msk' to be passed to database, got '%s'", gotVantage)
+	}
+	if w.Body.String() != "198.51.100.7\n" {
+		t.Errorf("Expected body '198.51.100.7\\n', got '%s'", w.Body.String())
+	}
+}
+
+func TestExportList_CollapseWildcards(t *testing.T) {
+	router, mockDB := setupTestRouter()
+
+	var gotCollapse bool
+	mockDB.GetExportListFunc = func(opts models.ExportOptions) (*models.ExportList, error) {
+		gotCollapse = opts.CollapseWildcards
+		return &models.ExportList{
+			Domains: []string{"plain.example.com", "track.example.com"},
+		}, nil
+	}
+
+	h := NewHandler(mockDB)
+	router.GET("/export/collapsed", func(c *gin.Context) {
+		h.ExportList(c, models.ExportOptions{DomainRegex: ".*", CollapseWildcards: true}, true, "")
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "/export/collapsed", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if !gotCollapse {
+		t.Error("Expected collapse_wildcards to be passed to database")
+	}
+	if !strings.Contains(w.Body.String(), "track.example.com") {
+		t.Errorf("Expected collapsed zone in output, got '%s'", w.Body.String())
+	}
+}
+
+func TestExportList_GeoFilter(t *testing.T) {
+	router, mockDB := setupTestRouter()
+
+	var gotGeo models.GeoFilter
+	mockDB.GetExportListFunc = func(opts models.ExportOptions) (*models.ExportList, error) {
+		gotGeo = opts.Geo
+		return &models.ExportList{
+			IPv4: []string{"198.51.100.7"},
+		}, nil
+	}
+
+	h := NewHandler(mockDB)
+	geo := models.GeoFilter{ExcludeASNs: []int64{13335}, Countries: []string{"DE"}}
+	router.GET("/export/de", func(c *gin.Context) {
+		h.ExportList(c, models.ExportOptions{DomainRegex: ".*", IncludeIPv4: true, Geo: geo}, false, "")
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "/export/de", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if len(gotGeo.ExcludeASNs) != 1 || gotGeo.ExcludeASNs[0] != 13335 {
+		t.Errorf("Expected exclude_asns [13335] to be passed to database, got %v", gotGeo.ExcludeASNs)
+	}
+	if len(gotGeo.Countries) != 1 || gotGeo.Countries[0] != "DE" {
+		t.Errorf("Expected countries [DE] to be passed to database, got %v", gotGeo.Countries)
+	}
+}
+
+func TestExportList_StabilityFilter(t *testing.T) {
+	router, mockDB := setupTestRouter()
+
+	var gotStability models.StabilityFilter
+	mockDB.GetExportListFunc = func(opts models.ExportOptions) (*models.ExportList, error) {
+		gotStability = opts.Stability
+		return &models.ExportList{
+			IPv4: []string{"198.51.100.7"},
+		}, nil
+	}
+
+	h := NewHandler(mockDB)
+	stability := models.StabilityFilter{MinSeen: 3, Window: 5}
+	router.GET("/export/stable", func(c *gin.Context) {
+		h.ExportList(c, models.ExportOptions{DomainRegex: ".*", IncludeIPv4: true, Stability: stability}, false, "")
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "/export/stable", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if gotStability != stability {
+		t.Errorf("Expected stability filter %+v to be passed to database, got %+v", stability, gotStability)
+	}
+}
+
 func TestExportList_Success(t *testing.T) {
 	router, mockDB := setupTestRouter()
 
-	mockDB.GetExportListFunc = func(domainRegex string, includeIPv4, includeIPv6, excludeSharedIPs bool) (*models.ExportList, error) {
+	mockDB.GetExportListFunc = func(opts models.ExportOptions) (*models.ExportList, error) {
 		return &models.ExportList{
 			Domains: []string{"example.com.", "test.com."}, // Domains with trailing dots (FQDN format from DB)
 			IPv4:    []string{"192.0.2.1", "192.0.2.2"},
@@ -475,7 +748,7 @@ func TestExportList_Success(t *testing.T) {
 
 	h := NewHandler(mockDB)
 	router.GET("/export/test", func(c *gin.Context) {
-		h.ExportList(c, ".*", true, true, true, false, "")
+		h.ExportList(c, models.ExportOptions{DomainRegex: ".*", IncludeIPv4: true, IncludeIPv6: true}, true, "")
 	})
 
 	req, _ := http.NewRequest(http.MethodGet, "/export/test", nil)
@@ -501,7 +774,7 @@ func TestExportList_Success(t *testing.T) {
 func TestExportList_IPsOnly(t *testing.T) {
 	router, mockDB := setupTestRouter()
 
-	mockDB.GetExportListFunc = func(domainRegex string, includeIPv4, includeIPv6, excludeSharedIPs bool) (*models.ExportList, error) {
+	mockDB.GetExportListFunc = func(opts models.ExportOptions) (*models.ExportList, error) {
 		return &models.ExportList{
 			Domains: []string{"example.com", "test.com"},
 			IPv4:    []string{"192.0.2.1"},
@@ -511,7 +784,7 @@ func TestExportList_IPsOnly(t *testing.T) {
 
 	h := NewHandler(mockDB)
 	router.GET("/export/ips", func(c *gin.Context) {
-		h.ExportList(c, ".*", false, true, true, false, "") // include_domains = false
+		h.ExportList(c, models.ExportOptions{DomainRegex: ".*", IncludeIPv4: true, IncludeIPv6: true}, false, "") // include_domains = false
 	})
 
 	req, _ := http.NewRequest(http.MethodGet, "/export/ips", nil)
@@ -532,7 +805,7 @@ func TestExportList_IPsOnly(t *testing.T) {
 func TestExportList_EmptyResults(t *testing.T) {
 	router, mockDB := setupTestRouter()
 
-	mockDB.GetExportListFunc = func(domainRegex string, includeIPv4, includeIPv6, excludeSharedIPs bool) (*models.ExportList, error) {
+	mockDB.GetExportListFunc = func(opts models.ExportOptions) (*models.ExportList, error) {
 		return &models.ExportList{
 			Domains: []string{},
 			IPv4:    []string{},
@@ -542,7 +815,7 @@ func TestExportList_EmptyResults(t *testing.T) {
 
 	h := NewHandler(mockDB)
 	router.GET("/export/empty", func(c *gin.Context) {
-		h.ExportList(c, "^nomatch$", true, true, true, false, "")
+		h.ExportList(c, models.ExportOptions{DomainRegex: "^nomatch$", IncludeIPv4: true, IncludeIPv6: true}, true, "")
 	})
 
 	req, _ := http.NewRequest(http.MethodGet, "/export/empty", nil)
@@ -561,13 +834,13 @@ func TestExportList_EmptyResults(t *testing.T) {
 func TestExportList_DatabaseError(t *testing.T) {
 	router, mockDB := setupTestRouter()
 
-	mockDB.GetExportListFunc = func(domainRegex string, includeIPv4, includeIPv6, excludeSharedIPs bool) (*models.ExportList, error) {
+	mockDB.GetExportListFunc = func(opts models.ExportOptions) (*models.ExportList, error) {
 		return nil, errors.New("database connection failed")
 	}
 
 	h := NewHandler(mockDB)
 	router.GET("/export/error", func(c *gin.Context) {
-		h.ExportList(c, ".*", true, true, true, false, "")
+		h.ExportList(c, models.ExportOptions{DomainRegex: ".*", IncludeIPv4: true, IncludeIPv6: true}, true, "")
 	})
 
 	req, _ := http.NewRequest(http.MethodGet, "/export/error", nil)
@@ -582,7 +855,7 @@ func TestExportList_DatabaseError(t *testing.T) {
 func TestExportList_OnlyIPv4(t *testing.T) {
 	router, mockDB := setupTestRouter()
 
-	mockDB.GetExportListFunc = func(domainRegex string, includeIPv4, includeIPv6, excludeSharedIPs bool) (*models.ExportList, error) {
+	mockDB.GetExportListFunc = func(opts models.ExportOptions) (*models.ExportList, error) {
 		return &models.ExportList{
 			Domains: []string{},
 			IPv4:    []string{"192.0.2.1", "192.0.2.2"},
@@ -592,7 +865,7 @@ func TestExportList_OnlyIPv4(t *testing.T) {
 
 	h := NewHandler(mockDB)
 	router.GET("/export/ipv4", func(c *gin.Context) {
-		h.ExportList(c, ".*", false, true, true, false, "")
+		h.ExportList(c, models.ExportOptions{DomainRegex: ".*", IncludeIPv4: true, IncludeIPv6: true}, false, "")
 	})
 
 	req, _ := http.NewRequest(http.MethodGet, "/export/ipv4", nil)
@@ -612,7 +885,7 @@ func TestExportList_OnlyIPv4(t *testing.T) {
 func TestExportList_RemoveTrailingDot(t *testing.T) {
 	router, mockDB := setupTestRouter()
 
-	mockDB.GetExportListFunc = func(domainRegex string, includeIPv4, includeIPv6, excludeSharedIPs bool) (*models.ExportList, error) {
+	mockDB.GetExportListFunc = func(opts models.ExportOptions) (*models.ExportList, error) {
 		return &models.ExportList{
 			// Domains in FQDN format with trailing dots (as stored in DB)
 			Domains: []string{
@@ -627,7 +900,7 @@ func TestExportList_RemoveTrailingDot(t *testing.T) {
 
 	h := NewHandler(mockDB)
 	router.GET("/export/trailing", func(c *gin.Context) {
-		h.ExportList(c, ".*", true, true, true, false, "")
+		h.ExportList(c, models.ExportOptions{DomainRegex: ".*", IncludeIPv4: true, IncludeIPv6: true}, true, "")
 	})
 
 	req, _ := http.NewRequest(http.MethodGet, "/export/trailing", nil)
@@ -655,3 +928,274 @@ func TestExportList_RemoveTrailingDot(t *testing.T) {
 		}
 	}
 }
+
+func TestExportExcludedIPs_PTR(t *testing.T) {
+	router, mockDB := setupTestRouter()
+
+	mockDB.GetExcludedIPsFunc = func(domainRegex string, includeIPv4, includeIPv6 bool) ([]models.ExcludedIPInfo, error) {
+		return []models.ExcludedIPInfo{
+			{
+				IP:                "104.16.0.1",
+				PTR:               "edge.cdn.example.net",
+				MatchedDomains:    []string{"a.example.com"},
+				NonMatchedDomains: []string{"other.org"},
+			},
+		}, nil
+	}
+
+	h := NewHandler(mockDB)
+	router.GET("/excluded", func(c *gin.Context) {
+		h.ExportExcludedIPs(c, "example\\.com$", true, false)
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "/excluded", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	expected := "104.16.0.1 | a.example.com | other.org | edge.cdn.example.net\n"
+	if !strings.Contains(w.Body.String(), expected) {
+		t.Errorf("Expected body to contain %q, got %q", expected, w.Body.String())
+	}
+}
+
+func TestGetDomainHistory(t *testing.T) {
+	router, mockDB := setupTestRouter()
+
+	var capturedFilter models.IPChangesFilter
+	mockDB.GetIPChangesFunc = func(filter models.IPChangesFilter) ([]models.IPChangeEvent, int64, error) {
+		capturedFilter = filter
+		return []models.IPChangeEvent{
+			{ID: 1, DomainID: 42, Domain: "example.com.", Time: time.Now(), Added: []string{"198.51.100.7"}, Removed: []string{"203.0.113.10"}},
+		}, 1, nil
+	}
+
+	h := NewHandler(mockDB)
+	router.GET("/api/domains/:id/history", h.GetDomainHistory)
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/domains/42/history?date_from=2026-01-01T00:00:00Z&limit=10", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if capturedFilter.DomainID != 42 {
+		t.Errorf("Expected domain_id=42, got %d", capturedFilter.DomainID)
+	}
+	if capturedFilter.Limit != 10 {
+		t.Errorf("Expected limit=10, got %d", capturedFilter.Limit)
+	}
+	if capturedFilter.DateFrom.IsZero() {
+		t.Error("Expected date_from to be parsed")
+	}
+
+	var response models.PaginatedResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if response.Total != 1 {
+		t.Errorf("Expected total=1, got %d", response.Total)
+	}
+}
+
+func TestGetDomainHistory_InvalidID(t *testing.T) {
+	router, mockDB := setupTestRouter()
+
+	h := NewHandler(mockDB)
+	router.GET("/api/domains/:id/history", h.GetDomainHistory)
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/domains/abc/history", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
+
+func TestGetIPChanges(t *testing.T) {
+	router, mockDB := setupTestRouter()
+
+	var capturedFilter models.IPChangesFilter
+	mockDB.GetIPChangesFunc = func(filter models.IPChangesFilter) ([]models.IPChangeEvent, int64, error) {
+		capturedFilter = filter
+		return []models.IPChangeEvent{}, 0, nil
+	}
+
+	h := NewHandler(mockDB)
+	router.GET("/api/changes", h.GetIPChanges)
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/changes?domain_regex=netflix", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if capturedFilter.DomainRegex != "netflix" {
+		t.Errorf("Expected domain_regex=netflix, got %s", capturedFilter.DomainRegex)
+	}
+	if capturedFilter.DomainID != 0 {
+		t.Errorf("Expected no domain_id, got %d", capturedFilter.DomainID)
+	}
+	if capturedFilter.Limit != 100 {
+		t.Errorf("Expected default limit=100, got %d", capturedFilter.Limit)
+	}
+}
+
+func TestGetIPChanges_LimitCapped(t *testing.T) {
+	router, mockDB := setupTestRouter()
+
+	var capturedFilter models.IPChangesFilter
+	mockDB.GetIPChangesFunc = func(filter models.IPChangesFilter) ([]models.IPChangeEvent, int64, error) {
+		capturedFilter = filter
+		return []models.IPChangeEvent{}, 0, nil
+	}
+
+	h := NewHandler(mockDB)
+	router.GET("/api/domains/:id/history", h.GetDomainHistory)
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/domains/42/history?limit=1000000", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if capturedFilter.Limit != maxIPChangesLimit {
+		t.Errorf("Expected limit capped at %d, got %d", maxIPChangesLimit, capturedFilter.Limit)
+	}
+}
+
+func TestGetStatsAggregate_Success(t *testing.T) {
+	router, mockDB := setupTestRouter()
+
+	bucket := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var received models.StatsAggregateFilter
+	mockDB.GetStatsAggregateFunc = func(filter models.StatsAggregateFilter) (*models.StatsAggregateResult, error) {
+		received = filter
+		return &models.StatsAggregateResult{
+			Data: []models.StatsAggregate{
+				{Bucket: &bucket, Domain: "example.com", Count: 42},
+			},
+			Source:   "daily",
+			DateFrom: filter.DateFrom,
+			DateTo:   filter.DateTo,
+		}, nil
+	}
+
+	h := NewHandler(mockDB)
+	router.GET("/api/stats/aggregate", h.GetStatsAggregate)
+
+	req, _ := http.NewRequest(http.MethodGet,
+		"/api/stats/aggregate?group_by=domain,%20qtype&interval=day&qtype=aaaa&date_from=2024-01-01T00:00:00Z&date_to=2024-01-08T00:00:00Z&limit=50000", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if len(received.GroupBy) != 2 || received.GroupBy[0] != "domain" || received.GroupBy[1] != "qtype" {
+		t.Errorf("Expected group_by [domain qtype], got %v", received.GroupBy)
+	}
+	if received.Interval != "day" {
+		t.Errorf("Expected interval=day, got %s", received.Interval)
+	}
+	if received.QType != "AAAA" {
+		t.Errorf("Expected qtype=AAAA, got %s", received.QType)
+	}
+	if received.Limit != maxAggregateLimit {
+		t.Errorf("Expected limit to be capped at %d, got %d", maxAggregateLimit, received.Limit)
+	}
+
+	var response models.StatsAggregateResult
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if response.Source != "daily" || len(response.Data) != 1 || response.Data[0].Count != 42 {
+		t.Errorf("Unexpected response: %+v", response)
+	}
+}
+
+func TestGetStatsAggregate_DefaultRange(t *testing.T) {
+	router, mockDB := setupTestRouter()
+
+	var received models.StatsAggregateFilter
+	mockDB.GetStatsAggregateFunc = func(filter models.StatsAggregateFilter) (*models.StatsAggregateResult, error) {
+		received = filter
+		return &models.StatsAggregateResult{}, nil
+	}
+
+	h := NewHandler(mockDB)
+	router.GET("/api/stats/aggregate", h.GetStatsAggregate)
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/stats/aggregate", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if received.DateTo.Sub(received.DateFrom) != 24*time.Hour {
+		t.Errorf("Expected a 24 hour default range, got %v", received.DateTo.Sub(received.DateFrom))
+	}
+	if received.Limit != 100 {
+		t.Errorf("Expected default limit 100, got %d", received.Limit)
+	}
+}
+
+func TestGetStatsAggregate_InvalidParams(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"invalid group_by", "group_by=rtype"},
+		{"invalid interval", "interval=week"},
+		{"invalid date", "date_from=yesterday"},
+		{"empty range", "date_from=2024-01-02T00:00:00Z&date_to=2024-01-01T00:00:00Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, mockDB := setupTestRouter()
+			mockDB.GetStatsAggregateFunc = func(filter models.StatsAggregateFilter) (*models.StatsAggregateResult, error) {
+				t.Error("Database should not be queried")
+				return nil, nil
+			}
+
+			h := NewHandler(mockDB)
+			router.GET("/api/stats/aggregate", h.GetStatsAggregate)
+
+			req, _ := http.NewRequest(http.MethodGet, "/api/stats/aggregate?"+tt.query, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status 400, got %d", w.Code)
+			}
+		})
+	}
+}
+
+func TestGetStatsAggregate_DatabaseError(t *testing.T) {
+	router, mockDB := setupTestRouter()
+	mockDB.GetStatsAggregateFunc = func(filter models.StatsAggregateFilter) (*models.StatsAggregateResult, error) {
+		return nil, errors.New("database error")
+	}
+
+	h := NewHandler(mockDB)
+	router.GET("/api/stats/aggregate", h.GetStatsAggregate)
+
+	req, _ := http.NewRequest(http.MethodGet, "/api/stats/aggregate?group_by=domain", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", w.Code)
+	}
+}
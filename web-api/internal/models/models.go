@@ -7,6 +7,7 @@ type DomainStat struct {
 	ID        int64     `json:"id"`
 	Domain    string    `json:"domain"`
 	ClientIP  string    `json:"client_ip"`
+	QType     string    `json:"qtype"`
 	RType     string    `json:"rtype"`
 	Timestamp time.Time `json:"timestamp"`
 }
@@ -21,6 +22,37 @@ type Domain struct {
 	LastResolvTime time.Time `json:"last_resolv_time"`
 	LastSeen       time.Time `json:"last_seen"`
 	IPs            []IP      `json:"ips,omitempty"`
+
+	// Resolution failure state (exponential backoff)
+	LastError           *string    `json:"last_error,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	NextResolvTime      *time.Time `json:"next_resolv_time,omitempty"`
+
+	// Resolution scheduling (higher priority is refreshed first)
+	QueryCount int64   `json:"query_count"`
+	Priority   float64 `json:"priority"`
+
+	// DNSSEC status of the last check: secure, insecure, bogus or indeterminate
+	DNSSECStatus *string `json:"dnssec_status,omitempty"`
+
+	// Wildcard zone the domain belongs to (set by the collector's wildcard detection)
+	WildcardZone *string `json:"wildcard_zone,omitempty"`
+
+	// Resolution policy rule matching the domain and the refresh interval it pins (seconds)
+	Policy         *string `json:"policy,omitempty"`
+	ResolvInterval *int    `json:"resolv_interval,omitempty"`
+}
+
+// PriorityWeights are the weights of the domain_priority() scheduling score
+type PriorityWeights struct {
+	Popularity float64 `yaml:"popularity"` // ln(1 + query_count)
+	Recency    float64 `yaml:"recency"`    // exp(-days since last_seen)
+	Staleness  float64 `yaml:"staleness"`  // ln(1 + hours since last resolution)
+}
+
+// DefaultPriorityWeights returns equal weights, matching the collector defaults
+func DefaultPriorityWeights() PriorityWeights {
+	return PriorityWeights{Popularity: 1, Recency: 1, Staleness: 1}
 }
 
 // IP represents an IP address associated with a domain
@@ -30,6 +62,19 @@ type IP struct {
 	IP       string    `json:"ip"`
 	Type     string    `json:"type"`
 	Time     time.Time `json:"time"`
+	Vantages []string  `json:"vantages,omitempty"` // EDNS Client Subnet sites that returned the IP
+	PTR      string    `json:"ptr,omitempty"`      // Cached reverse DNS name
+	ASN      *int64    `json:"asn,omitempty"`      // Autonomous system number (offline MMDB enrichment)
+	ASOrg    string    `json:"as_org,omitempty"`   // Autonomous system organization
+	Country  string    `json:"country,omitempty"`  // ISO country code
+
+	// Observation history (resolver and passive capture)
+	FirstSeen   *time.Time `json:"first_seen,omitempty"`
+	LastSeen    *time.Time `json:"last_seen,omitempty"`
+	SeenCount   int        `json:"seen_count"`
+	FirstSource string     `json:"first_source,omitempty"` // resolver or passive
+	LastSource  string     `json:"last_source,omitempty"`
+	SeenRecent  int        `json:"seen_recent"` // resolutions out of the last 32 that returned the IP
 }
 
 // StatsFilter represents filters for stats queries
@@ -44,15 +89,55 @@ type StatsFilter struct {
 	Offset    int       `json:"offset"`
 }
 
-// DomainsFilter represents filters for domains queries
-type DomainsFilter struct {
+// StatsAggregateFilter represents filters for aggregate stats queries
+type StatsAggregateFilter struct {
+	GroupBy     []string  `json:"group_by"` // domain, client_ip, qtype (empty = one total)
+	Interval    string    `json:"interval"` // hour or day buckets (empty = whole range)
 	DomainRegex string    `json:"domain_regex"`
+	ClientIPs   []string  `json:"client_ips"`
+	QType       string    `json:"qtype"`
 	DateFrom    time.Time `json:"date_from"`
-	DateTo      time.Time `json:"date_to"`
-	SortBy      string    `json:"sort_by"`
-	SortOrder   string    `json:"sort_order"` // asc or desc
+	DateTo      time.Time `json:"date_to"` // exclusive
 	Limit       int       `json:"limit"`
-	Offset      int       `json:"offset"`
+}
+
+// StatsAggregate is one row of an aggregate stats query; only the grouped
+// columns are set
+type StatsAggregate struct {
+	Bucket   *time.Time `json:"bucket,omitempty"`
+	Domain   string     `json:"domain,omitempty"`
+	ClientIP string     `json:"client_ip,omitempty"`
+	QType    string     `json:"qtype,omitempty"`
+	Count    int64      `json:"count"`
+}
+
+// StatsAggregateResult is the result of an aggregate stats query. Source is the
+// coarsest table used (raw, hourly or daily); ranges answered from rollups start
+// at a whole hour or day, DateFrom is the start actually covered.
+type StatsAggregateResult struct {
+	Data     []StatsAggregate `json:"data"`
+	Source   string           `json:"source"`
+	DateFrom time.Time        `json:"date_from"`
+	DateTo   time.Time        `json:"date_to"`
+}
+
+// DomainsFilter represents filters for domains queries
+type DomainsFilter struct {
+	DomainRegex  string    `json:"domain_regex"`
+	Dead         bool      `json:"dead"`          // only domains with at least MinFailures consecutive failures
+	MinFailures  int       `json:"min_failures"`  // threshold for Dead (default 3)
+	LastError    string    `json:"last_error"`    // nxdomain, servfail, timeout or error
+	DNSSECStatus string    `json:"dnssec_status"` // secure, insecure, bogus or indeterminate
+	ASN          int64     `json:"asn"`           // only domains with an IP in this autonomous system
+	Country      string    `json:"country"`       // only domains with an IP in this country (ISO code)
+	WildcardZone string    `json:"wildcard_zone"` // only children of this wildcard zone
+	Policy       string    `json:"policy"`        // only domains matching this resolution policy
+	DateFrom     time.Time `json:"date_from"`
+	DateTo       time.Time `json:"date_to"`
+	SortBy       string    `json:"sort_by"`
+	SortOrder    string    `json:"sort_order"` // asc or desc
+	Limit        int       `json:"limit"`
+	Offset       int       `json:"offset"`
 }
 
 // PaginatedResponse represents a paginated API response
@@ -71,9 +156,56 @@ type ExportList struct {
 	IPv6    []string
 }
 
+// ExportOptions selects the domains and IPs of an export list
+type ExportOptions struct {
+	DomainRegex       string
+	IncludeIPv4       bool
+	IncludeIPv6       bool
+	ExcludeSharedIPs  bool
+	CollapseWildcards bool            // list children of wildcard zones once, as their zone
+	Vantage           string          // EDNS Client Subnet site, empty = all resolved IPs
+	Geo               GeoFilter       // ASN and country restrictions
+	Stability         StabilityFilter // minimum share of recent resolutions returning the IP
+}
+
+// GeoFilter restricts export list IPs by ASN and country (empty fields impose no restriction)
+type GeoFilter struct {
+	ASNs        []int64  // only IPs announced by these autonomous systems
+	ExcludeASNs []int64  // drop IPs announced by these autonomous systems (e.g. cloud providers)
+	Countries   []string // only IPs located in these countries (ISO codes)
+}
+
+// IPChangeEvent is a change of the IP set of a domain between two consecutive resolutions
+type IPChangeEvent struct {
+	ID       int64     `json:"id"`
+	DomainID int64     `json:"domain_id"`
+	Domain   string    `json:"domain"`
+	Time     time.Time `json:"time"`
+	Added    []string  `json:"added"`   // addresses not returned by the previous resolution
+	Removed  []string  `json:"removed"` // addresses of the previous resolution no longer returned
+}
+
+// IPChangesFilter represents filters for IP change event queries
+type IPChangesFilter struct {
+	DomainID    int64     `json:"domain_id"` // only events of this domain (0 = all domains)
+	DomainRegex string    `json:"domain_regex"`
+	DateFrom    time.Time `json:"date_from"`
+	DateTo      time.Time `json:"date_to"`
+	Limit       int       `json:"limit"`
+	Offset      int       `json:"offset"`
+}
+
+// StabilityFilter keeps only export list IPs returned in at least MinSeen of the
+// domain's last Window resolutions (MinSeen 0 imposes no restriction)
+type StabilityFilter struct {
+	MinSeen int
+	Window  int // at most 32, the resolutions kept in ip.seen_history
+}
+
 // ExcludedIPInfo contains information about IP address excluded from export
 type ExcludedIPInfo struct {
 	IP                string   `json:"ip"`                  // IP address
+	PTR               string   `json:"ptr,omitempty"`       // Cached reverse DNS name
 	MatchedDomains    []string `json:"matched_domains"`     // Domains matching the regex
 	NonMatchedDomains []string `json:"non_matched_domains"` // Domains NOT matching the regex
 }